@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/gobwas/glob"
+)
+
+// pathFilter selects files by globs of their slash-separated path relative to the synced directory. "*" matches within
+// a path segment, "**" across segments.
+type pathFilter struct {
+	include []glob.Glob
+	exclude []glob.Glob
+}
+
+func newPathFilter(include, exclude []string) (*pathFilter, error) {
+	f := &pathFilter{}
+	for _, pattern := range include {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		f.include = append(f.include, g)
+	}
+	for _, pattern := range exclude {
+		g, err := glob.Compile(pattern, '/')
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+		f.exclude = append(f.exclude, g)
+	}
+	return f, nil
+}
+
+// excluded returns true if the file or directory matches an exclude pattern.
+func (f *pathFilter) excluded(relPath string) bool {
+	return slices.ContainsFunc(f.exclude, func(g glob.Glob) bool { return g.Match(relPath) })
+}
+
+// allows returns true if the file matches an include pattern (or there are none) and no exclude pattern.
+func (f *pathFilter) allows(relPath string) bool {
+	if f.excluded(relPath) {
+		return false
+	}
+	return len(f.include) == 0 || slices.ContainsFunc(f.include, func(g glob.Glob) bool { return g.Match(relPath) })
+}
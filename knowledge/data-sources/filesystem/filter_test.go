@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestPathFilter(t *testing.T) {
+	f, err := newPathFilter([]string{"docs/**", "*.md"}, []string{"docs/drafts", "**/*.tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for relPath, want := range map[string]bool{
+		"README.md":              true,
+		"notes/todo.md":          false,
+		"docs/guide/intro.md":    true,
+		"docs/guide/scratch.tmp": false,
+		"main.go":                false,
+	} {
+		if got := f.allows(relPath); got != want {
+			t.Errorf("allows(%q) = %v, want %v", relPath, got, want)
+		}
+	}
+	if !f.excluded("docs/drafts") {
+		t.Errorf("expected docs/drafts to be excluded")
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	taken := map[string]struct{}{}
+	for _, want := range []string{"docs", "docs-2", "docs-3"} {
+		if got := uniqueName("docs", taken); got != want {
+			t.Errorf("uniqueName() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxFileSize is the size limit of synced files, as most of the bigger files won't be supported from knowledge
+const defaultMaxFileSize = 50 << 20
+
+type MetadataInput struct {
+	FilesystemConfig *FilesystemConfig `json:"filesystemConfig,omitempty"`
+}
+
+type FilesystemConfig struct {
+	// Paths are the directories (or single files) to sync, e.g. a mounted network share
+	Paths []string `json:"paths"`
+	// Include restricts the sync to files whose path (relative to the directory) matches any of these globs
+	Include []string `json:"include,omitempty"`
+	// Exclude skips files and directories whose path (relative to the directory) matches any of these globs
+	Exclude []string `json:"exclude,omitempty"`
+	// MaxFileSize is the size limit in bytes of synced files (default: 50 MB)
+	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+}
+
+type MetadataOutput struct {
+	Status string                 `json:"status"`
+	Files  map[string]FileDetails `json:"files"`
+	State  State                  `json:"state"`
+}
+
+type State struct {
+	FilesystemState *FilesystemState `json:"filesystemState,omitempty"`
+}
+
+type FilesystemState struct {
+	// Folders are the folders of the configured paths in the workspace, by path. They're kept as long as the path is
+	// configured, so that adding, removing or reordering paths of the same name doesn't move files between folders.
+	Folders map[string]string `json:"folders,omitempty"`
+}
+
+// FileDetails of the synced files, by their absolute path on the filesystem.
+type FileDetails struct {
+	FilePath    string `json:"filePath"`
+	URL         string `json:"url"`
+	SizeInBytes int64  `json:"sizeInBytes"`
+	UpdatedAt   string `json:"updatedAt"`
+	// Source is the configured path the file was synced from
+	Source string `json:"source,omitempty"`
+}
+
+func main() {
+	logOut := logrus.New()
+	logOut.SetOutput(os.Stdout)
+	logOut.SetFormatter(&logrus.JSONFormatter{})
+	logErr := logrus.New()
+	logErr.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	gptscriptClient, err := gptscript.NewGPTScript()
+	if err != nil {
+		logOut.WithError(fmt.Errorf("failed to create gptscript client, error: %w", err)).Error()
+		os.Exit(0)
+	}
+
+	inputData := os.Getenv("GPTSCRIPT_INPUT")
+	input := MetadataInput{}
+	if err := json.Unmarshal([]byte(inputData), &input); err != nil {
+		logOut.WithError(fmt.Errorf("failed to unmarshal input data, error: %w", err)).Error()
+		os.Exit(0)
+	}
+	if input.FilesystemConfig == nil {
+		input.FilesystemConfig = &FilesystemConfig{}
+	}
+	if input.FilesystemConfig.MaxFileSize <= 0 {
+		input.FilesystemConfig.MaxFileSize = defaultMaxFileSize
+	}
+
+	output := MetadataOutput{}
+
+	var notfoundErr *gptscript.NotFoundInWorkspaceError
+	outputData, err := gptscriptClient.ReadFileInWorkspace(ctx, ".metadata.json")
+	if err != nil && !errors.As(err, &notfoundErr) {
+		logOut.WithError(fmt.Errorf("failed to read .metadata.json in workspace, error: %w", err)).Error()
+		os.Exit(0)
+	} else if err == nil {
+		if err := json.Unmarshal(outputData, &output); err != nil {
+			logOut.WithError(fmt.Errorf("failed to unmarshal output data, error: %w", err)).Error()
+			os.Exit(0)
+		}
+	}
+
+	if output.Files == nil {
+		output.Files = make(map[string]FileDetails)
+	}
+	if output.State.FilesystemState == nil {
+		output.State.FilesystemState = &FilesystemState{}
+	}
+	if output.State.FilesystemState.Folders == nil {
+		output.State.FilesystemState.Folders = make(map[string]string)
+	}
+
+	if err := sync(ctx, logErr, input.FilesystemConfig, &output, gptscriptClient); err != nil {
+		logOut.WithError(fmt.Errorf("failed to sync directories, error: %w", err)).Error()
+		os.Exit(0)
+	}
+
+	output.Status = ""
+	if err := writeMetadata(ctx, &output, gptscriptClient); err != nil {
+		logOut.WithError(fmt.Errorf("failed to write metadata, error: %w", err)).Error()
+		os.Exit(0)
+	}
+}
+
+// workspace is the part of the gptscript client that reads and writes the files of the workspace.
+type workspace interface {
+	ReadFileInWorkspace(ctx context.Context, filePath string, opts ...gptscript.ReadFileInWorkspaceOptions) ([]byte, error)
+	WriteFileInWorkspace(ctx context.Context, filePath string, contents []byte, opts ...gptscript.WriteFileInWorkspaceOptions) error
+	DeleteFileInWorkspace(ctx context.Context, filePath string, opts ...gptscript.DeleteFileInWorkspaceOptions) error
+}
+
+func writeMetadata(ctx context.Context, output *MetadataOutput, gptscript workspace) error {
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	return gptscript.WriteFileInWorkspace(ctx, ".metadata.json", data)
+}
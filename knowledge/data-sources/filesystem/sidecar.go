@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gptscript-ai/go-gptscript"
+)
+
+// sidecarSuffix is appended to the path of a file for its metadata sidecar, which the knowledge ingest adds to the metadata of the file.
+const sidecarSuffix = ".knowledge.json"
+
+// sourceMetadata describes a file on the filesystem, so that retrieved chunks can cite it.
+type sourceMetadata struct {
+	URL          string `json:"url"`
+	Title        string `json:"title,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func writeSidecar(ctx context.Context, gptscriptClient workspace, filePath string, metadata sourceMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return gptscriptClient.WriteFileInWorkspace(ctx, filePath+sidecarSuffix, data)
+}
+
+// deleteSidecar removes the sidecar of a file, if there is one.
+func deleteSidecar(ctx context.Context, gptscriptClient workspace, filePath string) error {
+	var notFoundError *gptscript.NotFoundInWorkspaceError
+	if err := gptscriptClient.DeleteFileInWorkspace(ctx, filePath+sidecarSuffix); err != nil && !errors.As(err, &notFoundError) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	url2 "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// sync copies the new and modified files of the configured paths to the workspace and removes the files that no longer exist.
+// The files of a directory are stored below its name (with a number appended if several directories have the same name).
+func sync(ctx context.Context, logErr *logrus.Logger, config *FilesystemConfig, output *MetadataOutput, gptscriptClient workspace) error {
+	filter, err := newPathFilter(config.Include, config.Exclude)
+	if err != nil {
+		return err
+	}
+
+	var sources []string
+	for _, p := range config.Paths {
+		sources = append(sources, strings.TrimSpace(p))
+	}
+
+	// remove the files of paths that are no longer configured first, so that their folders can be taken by new paths
+	if err := removeFiles(ctx, logErr, output, gptscriptClient, func(_ string, detail FileDetails) bool {
+		return !slices.Contains(sources, detail.Source)
+	}); err != nil {
+		return err
+	}
+	folders := output.State.FilesystemState.Folders
+	names := map[string]struct{}{}
+	for source, name := range folders {
+		if !slices.Contains(sources, source) {
+			delete(folders, source)
+			continue
+		}
+		names[name] = struct{}{}
+	}
+
+	synced := map[string]struct{}{}
+	// failed are the directories and files that couldn't be read, whose synced files are kept
+	var failed []string
+	for _, source := range sources {
+		root, err := filepath.Abs(source)
+		if err != nil {
+			return fmt.Errorf("invalid path %s: %w", source, err)
+		}
+		// fail instead of removing all files of the path if it's not available, e.g. because a share is not mounted
+		info, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("failed to access %s: %w", source, err)
+		}
+		name, ok := folders[source]
+		if !ok {
+			name = uniqueName(filepath.Base(root), names)
+			folders[source] = name
+		}
+
+		if !info.IsDir() {
+			// the sidecar of a single file isn't synced
+			if err := syncFile(ctx, logErr, output, gptscriptClient, config.MaxFileSize, synced, root, name, source, info, false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if file == root {
+					return err
+				}
+				logErr.Warnf("Skipping %s: %v", file, err)
+				failed = append(failed, file)
+				return nil
+			}
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if d.IsDir() {
+				if file != root && (d.Name() == ".git" || filter.excluded(rel)) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !filter.allows(rel) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				logErr.Warnf("Skipping %s: %v", file, err)
+				failed = append(failed, file)
+				return nil
+			}
+			return syncFile(ctx, logErr, output, gptscriptClient, config.MaxFileSize, synced, file, path.Join(name, rel), source, info,
+				sidecarSynced(file, rel, filter, config.MaxFileSize))
+		}); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", source, err)
+		}
+	}
+
+	// remove the files that no longer exist - but not the ones below directories that couldn't be read, e.g. because
+	// of a transient error of a network share
+	return removeFiles(ctx, logErr, output, gptscriptClient, func(file string, _ FileDetails) bool {
+		_, ok := synced[file]
+		return !ok && !slices.ContainsFunc(failed, func(prefix string) bool { return below(file, prefix) })
+	})
+}
+
+// syncFile copies the file to its path in the workspace, unless its size and modification time didn't change since the last sync.
+// Unless the file's own sidecar is synced as well, a sidecar with its source metadata is written.
+func syncFile(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, gptscriptClient workspace, maxFileSize int64, synced map[string]struct{}, file, filePath, source string, info fs.FileInfo, syncsSidecar bool) error {
+	if info.Size() > maxFileSize {
+		logErr.Infof("Skipping %s because it is larger than %d bytes", file, maxFileSize)
+		return nil
+	}
+	synced[file] = struct{}{}
+
+	updatedAt := info.ModTime().UTC().Format(time.RFC3339Nano)
+	detail, ok := output.Files[file]
+	if ok && detail.FilePath == filePath && detail.UpdatedAt == updatedAt && detail.SizeInBytes == info.Size() {
+		logErr.Infof("Skipping %s because it is not changed", filePath)
+		return nil
+	}
+	if ok && detail.FilePath != filePath {
+		// the directory was renamed, or another directory of the same name was added before it
+		if err := removeFile(ctx, logErr, gptscriptClient, detail.FilePath); err != nil {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		logErr.Warnf("Skipping %s: %v", file, err)
+		return nil
+	}
+	if err := gptscriptClient.WriteFileInWorkspace(ctx, filePath, data); err != nil {
+		return err
+	}
+	u := (&url2.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+	// a sidecar next to the file is copied as well and takes precedence
+	if !strings.HasSuffix(file, sidecarSuffix) && !syncsSidecar {
+		if err := writeSidecar(ctx, gptscriptClient, filePath, sourceMetadata{URL: u, Title: info.Name(), LastModified: updatedAt}); err != nil {
+			return err
+		}
+	}
+	logErr.Infof("Copied %s", filePath)
+
+	output.Files[file] = FileDetails{
+		FilePath:    filePath,
+		URL:         u,
+		SizeInBytes: info.Size(),
+		UpdatedAt:   updatedAt,
+		Source:      source,
+	}
+	output.Status = fmt.Sprintf("Syncing file %v", filePath)
+	return writeMetadata(ctx, output, gptscriptClient)
+}
+
+// removeFiles deletes the files matching the filter from the workspace and metadata.
+func removeFiles(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, gptscriptClient workspace, filter func(file string, detail FileDetails) bool) error {
+	for file, detail := range output.Files {
+		if !filter(file, detail) {
+			continue
+		}
+		if err := removeFile(ctx, logErr, gptscriptClient, detail.FilePath); err != nil {
+			return err
+		}
+		delete(output.Files, file)
+	}
+	return nil
+}
+
+// removeFile deletes a file and its sidecar from the workspace.
+func removeFile(ctx context.Context, logErr *logrus.Logger, gptscriptClient workspace, filePath string) error {
+	logErr.Infof("Deleting %s", filePath)
+	var notFoundErr *gptscript.NotFoundInWorkspaceError
+	if err := gptscriptClient.DeleteFileInWorkspace(ctx, filePath); err != nil && !errors.As(err, &notFoundErr) {
+		return err
+	}
+	return deleteSidecar(ctx, gptscriptClient, filePath)
+}
+
+// uniqueName returns the name, or the name with the lowest number appended that isn't taken yet, and takes it.
+func uniqueName(name string, taken map[string]struct{}) string {
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := taken[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	taken[unique] = struct{}{}
+	return unique
+}
+
+// below returns true if the file is the directory (or file) or is in it.
+func below(file, dir string) bool {
+	return file == dir || strings.HasPrefix(file, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// sidecarSynced returns true if the file has a sidecar next to it that is synced as well, i.e. that isn't filtered out
+// or too large.
+func sidecarSynced(file, rel string, filter *pathFilter, maxFileSize int64) bool {
+	info, err := os.Lstat(file + sidecarSuffix)
+	return err == nil && info.Mode().IsRegular() && info.Size() <= maxFileSize && filter.allows(rel+sidecarSuffix)
+}
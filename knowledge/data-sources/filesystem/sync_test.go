@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeWorkspace keeps the files of the workspace in memory.
+type fakeWorkspace map[string][]byte
+
+func (w fakeWorkspace) ReadFileInWorkspace(_ context.Context, filePath string, _ ...gptscript.ReadFileInWorkspaceOptions) ([]byte, error) {
+	data, ok := w[filePath]
+	if !ok {
+		return nil, &gptscript.NotFoundInWorkspaceError{}
+	}
+	return data, nil
+}
+
+func (w fakeWorkspace) WriteFileInWorkspace(_ context.Context, filePath string, contents []byte, _ ...gptscript.WriteFileInWorkspaceOptions) error {
+	w[filePath] = contents
+	return nil
+}
+
+func (w fakeWorkspace) DeleteFileInWorkspace(_ context.Context, filePath string, _ ...gptscript.DeleteFileInWorkspaceOptions) error {
+	if _, ok := w[filePath]; !ok {
+		return &gptscript.NotFoundInWorkspaceError{}
+	}
+	delete(w, filePath)
+	return nil
+}
+
+func newTestOutput() *MetadataOutput {
+	return &MetadataOutput{
+		Files: map[string]FileDetails{},
+		State: State{FilesystemState: &FilesystemState{Folders: map[string]string{}}},
+	}
+}
+
+func writeTestFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkWorkspace fails if a file of the metadata is missing in the workspace or has the wrong content.
+func checkWorkspace(t *testing.T, ws fakeWorkspace, output *MetadataOutput, want map[string]string) {
+	t.Helper()
+	if len(output.Files) != len(want) {
+		t.Errorf("got %d files in the metadata, want %d", len(output.Files), len(want))
+	}
+	for _, detail := range output.Files {
+		data, ok := ws[detail.FilePath]
+		if !ok {
+			t.Errorf("%s is missing in the workspace", detail.FilePath)
+			continue
+		}
+		if string(data) != want[detail.FilePath] {
+			t.Errorf("%s = %q, want %q", detail.FilePath, data, want[detail.FilePath])
+		}
+	}
+}
+
+func TestSyncSameNamedDirectories(t *testing.T) {
+	ctx := context.Background()
+	logErr := logrus.New()
+	logErr.SetOutput(io.Discard)
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a", "handbook"), filepath.Join(dir, "b", "handbook")
+	writeTestFile(t, filepath.Join(first, "intro.md"), "first")
+	writeTestFile(t, filepath.Join(second, "intro.md"), "second")
+
+	ws := fakeWorkspace{}
+	output := newTestOutput()
+	config := &FilesystemConfig{Paths: []string{first, second}, MaxFileSize: defaultMaxFileSize}
+	if err := sync(ctx, logErr, config, output, ws); err != nil {
+		t.Fatal(err)
+	}
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "first", "handbook-2/intro.md": "second"})
+
+	// reordering the paths doesn't move their files
+	config.Paths = []string{second, first}
+	if err := sync(ctx, logErr, config, output, ws); err != nil {
+		t.Fatal(err)
+	}
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "first", "handbook-2/intro.md": "second"})
+
+	// removing the first path removes its files, but not the ones of the second path
+	config.Paths = []string{second}
+	if err := sync(ctx, logErr, config, output, ws); err != nil {
+		t.Fatal(err)
+	}
+	checkWorkspace(t, ws, output, map[string]string{"handbook-2/intro.md": "second"})
+	if _, ok := ws["handbook/intro.md"]; ok {
+		t.Errorf("expected the files of the removed path to be deleted")
+	}
+
+	// a new path of the same name takes the free folder
+	third := filepath.Join(dir, "c", "handbook")
+	writeTestFile(t, filepath.Join(third, "intro.md"), "third")
+	config.Paths = []string{third, second}
+	if err := sync(ctx, logErr, config, output, ws); err != nil {
+		t.Fatal(err)
+	}
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "third", "handbook-2/intro.md": "second"})
+}
+
+func TestSyncKeepsUnreadableDirectories(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directories can't be made unreadable for root")
+	}
+	ctx := context.Background()
+	logErr := logrus.New()
+	logErr.SetOutput(io.Discard)
+	dir := filepath.Join(t.TempDir(), "handbook")
+	writeTestFile(t, filepath.Join(dir, "intro.md"), "intro")
+	writeTestFile(t, filepath.Join(dir, "guides", "setup.md"), "setup")
+
+	ws := fakeWorkspace{}
+	output := newTestOutput()
+	config := &FilesystemConfig{Paths: []string{dir}, MaxFileSize: defaultMaxFileSize}
+	if err := sync(ctx, logErr, config, output, ws); err != nil {
+		t.Fatal(err)
+	}
+
+	guides := filepath.Join(dir, "guides")
+	if err := os.Chmod(guides, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(guides, 0755)
+	if err := sync(ctx, logErr, config, output, ws); err != nil {
+		t.Fatal(err)
+	}
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "intro", "handbook/guides/setup.md": "setup"})
+}
+
+func TestSyncSidecars(t *testing.T) {
+	ctx := context.Background()
+	logErr := logrus.New()
+	logErr.SetOutput(io.Discard)
+	dir := filepath.Join(t.TempDir(), "handbook")
+	writeTestFile(t, filepath.Join(dir, "intro.md"), "intro")
+	writeTestFile(t, filepath.Join(dir, "intro.md"+sidecarSuffix), `{"title":"Introduction"}`)
+
+	// the file's own sidecar is copied instead of a generated one
+	ws := fakeWorkspace{}
+	config := &FilesystemConfig{Paths: []string{dir}, MaxFileSize: defaultMaxFileSize}
+	if err := sync(ctx, logErr, config, newTestOutput(), ws); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ws["handbook/intro.md"+sidecarSuffix]); got != `{"title":"Introduction"}` {
+		t.Errorf("sidecar = %q, want the file's own sidecar", got)
+	}
+
+	// a sidecar that is filtered out isn't copied, so one is generated
+	ws = fakeWorkspace{}
+	config.Include = []string{"*.md"}
+	if err := sync(ctx, logErr, config, newTestOutput(), ws); err != nil {
+		t.Fatal(err)
+	}
+	var metadata sourceMetadata
+	if err := json.Unmarshal(ws["handbook/intro.md"+sidecarSuffix], &metadata); err != nil {
+		t.Fatalf("expected a generated sidecar: %v", err)
+	}
+	if metadata.Title != "intro.md" {
+		t.Errorf("sidecar title = %q, want %q", metadata.Title, "intro.md")
+	}
+}
+
+func TestBelow(t *testing.T) {
+	for _, c := range []struct {
+		file, dir string
+		want      bool
+	}{
+		{"/mnt/share/guides/setup.md", "/mnt/share/guides", true},
+		{"/mnt/share/guides", "/mnt/share/guides", true},
+		{"/mnt/share/guidelines.md", "/mnt/share/guides", false},
+		{"/mnt/share/intro.md", "/mnt/share/guides", false},
+	} {
+		if got := below(c.file, c.dir); got != c.want {
+			t.Errorf("below(%q, %q) = %v, want %v", c.file, c.dir, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxFileSize is the size limit of synced files, as most of the bigger files won't be supported from knowledge
+const defaultMaxFileSize = 50 << 20
+
+type MetadataInput struct {
+	GitConfig *GitConfig `json:"gitConfig,omitempty"`
+}
+
+type GitConfig struct {
+	Repositories []Repository `json:"repositories"`
+	// MaxFileSize is the size limit in bytes of synced files (default: 50 MB)
+	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+	// CacheDir keeps the clones of the repositories between syncs, so that only new commits are fetched (default: the user cache dir)
+	CacheDir string `json:"cacheDir,omitempty"`
+}
+
+type Repository struct {
+	// URL of the remote, e.g. https://git.example.com/team/handbook.git or git@git.example.com:team/handbook.git
+	URL string `json:"url"`
+	// Branch to sync (default: the remote's default branch)
+	Branch string `json:"branch,omitempty"`
+	// Include restricts the sync to files whose path in the repository matches any of these globs
+	Include []string `json:"include,omitempty"`
+	// Exclude skips files whose path in the repository matches any of these globs
+	Exclude []string `json:"exclude,omitempty"`
+	Auth    *GitAuth `json:"auth,omitempty"`
+}
+
+// GitAuth holds the credentials of a remote. Values can reference secrets as ${VAR}, which are read from the env
+// of the gptscript credential (or the environment, which gptscript credential tools populate).
+type GitAuth struct {
+	// Credential is the name of the gptscript credential the ${VAR} references are read from
+	Credential         string   `json:"credential,omitempty"`
+	CredentialContexts []string `json:"credentialContexts,omitempty"`
+	// Username and Password are sent with basic auth to HTTP(S) remotes - use an access token as password
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// SSHKey is the PEM encoded private key for SSH remotes, e.g. ${GIT_SSH_KEY}
+	SSHKey           string `json:"sshKey,omitempty"`
+	SSHKeyPassphrase string `json:"sshKeyPassphrase,omitempty"`
+	// KnownHosts are the known_hosts lines the host key of SSH remotes is verified with (default: ~/.ssh/known_hosts)
+	KnownHosts            string `json:"knownHosts,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey,omitempty"`
+}
+
+type MetadataOutput struct {
+	Status string                 `json:"status"`
+	Files  map[string]FileDetails `json:"files"`
+	State  State                  `json:"state"`
+}
+
+type State struct {
+	GitState *GitState `json:"gitState,omitempty"`
+}
+
+type GitState struct {
+	// Repositories are the states of the repositories by URL
+	Repositories map[string]*RepositoryState `json:"repositories,omitempty"`
+}
+
+type RepositoryState struct {
+	// Name is the folder of the repository's files in the workspace
+	Name   string `json:"name"`
+	Branch string `json:"branch"`
+	// Commit is the last synced commit
+	Commit string `json:"commit"`
+	// Filter is the include and exclude patterns of the last sync, after a change of which all files are compared again
+	Filter string `json:"filter,omitempty"`
+	// MaxFileSize of the last sync, after a change of which all files are compared again
+	MaxFileSize int64 `json:"maxFileSize,omitempty"`
+}
+
+// FileDetails of the synced files, by the URL of their repository and their path in it (<url>#<path>).
+type FileDetails struct {
+	FilePath    string `json:"filePath"`
+	URL         string `json:"url"`
+	SizeInBytes int64  `json:"sizeInBytes"`
+	UpdatedAt   string `json:"updatedAt"`
+	// Checksum is the hash of the file's git blob
+	Checksum   string `json:"checksum"`
+	Repository string `json:"repository"`
+}
+
+func main() {
+	logOut := logrus.New()
+	logOut.SetOutput(os.Stdout)
+	logOut.SetFormatter(&logrus.JSONFormatter{})
+	logErr := logrus.New()
+	logErr.SetOutput(os.Stderr)
+
+	ctx := context.Background()
+	gptscriptClient, err := gptscript.NewGPTScript()
+	if err != nil {
+		logOut.WithError(fmt.Errorf("failed to create gptscript client, error: %w", err)).Error()
+		os.Exit(0)
+	}
+
+	inputData := os.Getenv("GPTSCRIPT_INPUT")
+	input := MetadataInput{}
+	if err := json.Unmarshal([]byte(inputData), &input); err != nil {
+		logOut.WithError(fmt.Errorf("failed to unmarshal input data, error: %w", err)).Error()
+		os.Exit(0)
+	}
+	if input.GitConfig == nil {
+		input.GitConfig = &GitConfig{}
+	}
+	if input.GitConfig.MaxFileSize <= 0 {
+		input.GitConfig.MaxFileSize = defaultMaxFileSize
+	}
+	if input.GitConfig.CacheDir == "" {
+		input.GitConfig.CacheDir = defaultCacheDir()
+	}
+
+	output := MetadataOutput{}
+
+	var notfoundErr *gptscript.NotFoundInWorkspaceError
+	outputData, err := gptscriptClient.ReadFileInWorkspace(ctx, ".metadata.json")
+	if err != nil && !errors.As(err, &notfoundErr) {
+		logOut.WithError(fmt.Errorf("failed to read .metadata.json in workspace, error: %w", err)).Error()
+		os.Exit(0)
+	} else if err == nil {
+		if err := json.Unmarshal(outputData, &output); err != nil {
+			logOut.WithError(fmt.Errorf("failed to unmarshal output data, error: %w", err)).Error()
+			os.Exit(0)
+		}
+	}
+
+	if output.Files == nil {
+		output.Files = make(map[string]FileDetails)
+	}
+	if output.State.GitState == nil {
+		output.State.GitState = &GitState{}
+	}
+	if output.State.GitState.Repositories == nil {
+		output.State.GitState.Repositories = make(map[string]*RepositoryState)
+	}
+
+	if err := sync(ctx, logErr, input.GitConfig, &output, gptscriptClient); err != nil {
+		logOut.WithError(fmt.Errorf("failed to sync git repositories, error: %w", err)).Error()
+		os.Exit(0)
+	}
+
+	output.Status = ""
+	if err := writeMetadata(ctx, &output, gptscriptClient); err != nil {
+		logOut.WithError(fmt.Errorf("failed to write metadata, error: %w", err)).Error()
+		os.Exit(0)
+	}
+}
+
+// client is the part of the gptscript client that reads and writes the files of the workspace and reveals credentials.
+type client interface {
+	ReadFileInWorkspace(ctx context.Context, filePath string, opts ...gptscript.ReadFileInWorkspaceOptions) ([]byte, error)
+	WriteFileInWorkspace(ctx context.Context, filePath string, contents []byte, opts ...gptscript.WriteFileInWorkspaceOptions) error
+	DeleteFileInWorkspace(ctx context.Context, filePath string, opts ...gptscript.DeleteFileInWorkspaceOptions) error
+	RevealCredential(ctx context.Context, credCtxs []string, name string) (gptscript.Credential, error)
+}
+
+func writeMetadata(ctx context.Context, output *MetadataOutput, gptscript client) error {
+	data, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return err
+	}
+	return gptscript.WriteFileInWorkspace(ctx, ".metadata.json", data)
+}
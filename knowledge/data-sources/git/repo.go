@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	url2 "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+func defaultCacheDir() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "knowledge-git")
+	}
+	return filepath.Join(os.TempDir(), "knowledge-git")
+}
+
+// cacheDir returns the directory of the clone of the repository in the cache dir.
+func cacheDir(dir, repoURL string) string {
+	sum := sha256.Sum256([]byte(displayURL(repoURL)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8]))
+}
+
+// authMethod expands the ${VAR} references in the auth config with the env of its gptscript credential (or the environment)
+// and returns the auth method for the remote. Without auth config, SSH remotes are authenticated by the SSH agent.
+func authMethod(ctx context.Context, repoURL string, auth *GitAuth, gptscriptClient client) (transport.AuthMethod, error) {
+	if auth == nil {
+		return nil, nil
+	}
+
+	credentialEnv := map[string]string{}
+	if auth.Credential != "" {
+		credential, err := gptscriptClient.RevealCredential(ctx, auth.CredentialContexts, auth.Credential)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reveal credential %s: %w", auth.Credential, err)
+		}
+		credentialEnv = credential.Env
+	}
+	expand := func(s string) string {
+		return os.Expand(s, func(key string) string {
+			if v, ok := credentialEnv[key]; ok {
+				return v
+			}
+			return os.Getenv(key)
+		})
+	}
+
+	if auth.SSHKey != "" {
+		user := "git"
+		if endpoint, err := transport.NewEndpoint(repoURL); err == nil && endpoint.User != "" {
+			user = endpoint.User
+		}
+		keys, err := gitssh.NewPublicKeys(user, []byte(expand(auth.SSHKey)), expand(auth.SSHKeyPassphrase))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH key: %w", err)
+		}
+		switch {
+		case auth.InsecureIgnoreHostKey:
+			keys.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		case auth.KnownHosts != "":
+			if keys.HostKeyCallback, err = knownHostsCallback(expand(auth.KnownHosts)); err != nil {
+				return nil, err
+			}
+		}
+		return keys, nil
+	}
+
+	if auth.Username != "" || auth.Password != "" {
+		username := expand(auth.Username)
+		if username == "" {
+			// most hosts accept any user name with an access token
+			username = "git"
+		}
+		return &githttp.BasicAuth{Username: username, Password: expand(auth.Password)}, nil
+	}
+	return nil, nil
+}
+
+// knownHostsCallback verifies host keys with known_hosts lines, which are read from a temporary file.
+func knownHostsCallback(knownHosts string) (ssh.HostKeyCallback, error) {
+	f, err := os.CreateTemp("", "known_hosts")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(knownHosts + "\n"); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	callback, err := gitssh.NewKnownHostsCallback(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("invalid known hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// defaultBranch returns the branch the HEAD of the remote points to.
+func defaultBranch(ctx context.Context, repoURL string, auth transport.AuthMethod) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{repoURL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list the references of %s: %w", displayURL(repoURL), err)
+	}
+
+	var head *plumbing.Reference
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD {
+			head = ref
+		}
+	}
+	if head == nil {
+		return "", fmt.Errorf("%s has no HEAD, set the branch to sync", displayURL(repoURL))
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short(), nil
+	}
+	for _, ref := range refs {
+		if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+			return ref.Name().Short(), nil
+		}
+	}
+	return "", fmt.Errorf("failed to find the default branch of %s, set the branch to sync", displayURL(repoURL))
+}
+
+// fetchBranch fetches the last commit of the branch into the (shallow) clone of the repository in dir and returns it.
+// Only the new objects are fetched if the clone exists; it is cloned again if it can't be updated.
+func fetchBranch(ctx context.Context, logErr *logrus.Logger, dir, repoURL, branch string, auth transport.AuthMethod) (*object.Commit, error) {
+	remoteRef := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch)
+
+	repo, err := git.PlainOpen(dir)
+	if err == nil {
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(branch), remoteRef))},
+			Auth:     auth,
+			Depth:    1,
+			Tags:     git.NoTags,
+			Force:    true,
+		})
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			err = nil
+		}
+		if err != nil {
+			logErr.Warnf("Failed to fetch %s, cloning it again: %v", displayURL(repoURL), err)
+		}
+	}
+	if err != nil {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+		logErr.Infof("Cloning %s", displayURL(repoURL))
+		repo, err = git.PlainCloneContext(ctx, dir, true, &git.CloneOptions{
+			URL:           repoURL,
+			Auth:          auth,
+			ReferenceName: plumbing.NewBranchReferenceName(branch),
+			SingleBranch:  true,
+			Depth:         1,
+			Tags:          git.NoTags,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to clone %s: %w", displayURL(repoURL), err)
+		}
+	}
+
+	ref, err := repo.Reference(remoteRef, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find branch %s of %s: %w", branch, displayURL(repoURL), err)
+	}
+	return repo.CommitObject(ref.Hash())
+}
+
+// displayURL returns the URL without user info, to not leak credentials embedded in it to logs and the metadata
+// (tokens are often passed as the user name, e.g. https://<token>@git.example.com/team/handbook.git).
+func displayURL(repoURL string) string {
+	u, err := url2.Parse(repoURL)
+	if err != nil || u.User == nil || u.Scheme == "" {
+		return repoURL
+	}
+	u.User = nil
+	return u.String()
+}
+
+// repoName returns the name of the repository from its URL, e.g. handbook for git@git.example.com:team/handbook.git.
+func repoName(repoURL string) string {
+	name := strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "" {
+		return "repository"
+	}
+	return name
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// sync fetches the configured branches and syncs the files that changed since the last synced commit. The files of a
+// repository are stored below its name (with a number appended if several repositories have the same name), which it
+// keeps as long as it's configured.
+func sync(ctx context.Context, logErr *logrus.Logger, config *GitConfig, output *MetadataOutput, gptscriptClient client) error {
+	var urls []string
+	for _, repo := range config.Repositories {
+		key := displayURL(strings.TrimSpace(repo.URL))
+		// the state and files of a repository are keyed by its URL
+		if slices.Contains(urls, key) {
+			return fmt.Errorf("repository %s is configured more than once", key)
+		}
+		urls = append(urls, key)
+	}
+
+	// remove the repositories that are no longer configured first, so that their folders can be taken by new repositories
+	states := output.State.GitState.Repositories
+	for key := range states {
+		if slices.Contains(urls, key) {
+			continue
+		}
+		delete(states, key)
+		if err := os.RemoveAll(cacheDir(config.CacheDir, key)); err != nil {
+			logErr.Warnf("Failed to remove the clone of %s: %v", key, err)
+		}
+	}
+	if err := removeFiles(ctx, logErr, output, gptscriptClient, func(_ string, detail FileDetails) bool {
+		return !slices.Contains(urls, detail.Repository)
+	}); err != nil {
+		return err
+	}
+	names := map[string]struct{}{}
+	for _, state := range states {
+		names[state.Name] = struct{}{}
+	}
+
+	for _, repo := range config.Repositories {
+		repoURL := strings.TrimSpace(repo.URL)
+		key := displayURL(repoURL)
+
+		filter, err := newPathFilter(repo.Include, repo.Exclude)
+		if err != nil {
+			return err
+		}
+		auth, err := authMethod(ctx, repoURL, repo.Auth, gptscriptClient)
+		if err != nil {
+			return err
+		}
+		branch := repo.Branch
+		if branch == "" {
+			if branch, err = defaultBranch(ctx, repoURL, auth); err != nil {
+				return err
+			}
+		}
+		commit, err := fetchBranch(ctx, logErr, cacheDir(config.CacheDir, repoURL), repoURL, branch, auth)
+		if err != nil {
+			return err
+		}
+
+		last := states[key]
+		state := &RepositoryState{
+			Branch:      branch,
+			Commit:      commit.Hash.String(),
+			Filter:      strings.Join(repo.Include, ",") + ";" + strings.Join(repo.Exclude, ","),
+			MaxFileSize: config.MaxFileSize,
+		}
+		if last != nil {
+			state.Name = last.Name
+		} else {
+			state.Name = uniqueName(repoName(repoURL), names)
+		}
+		if last != nil && *last == *state {
+			logErr.Infof("Skipping %s because it is not changed", key)
+			continue
+		}
+		if err := syncCommit(ctx, logErr, output, gptscriptClient, config.MaxFileSize, key, state, commit, filter); err != nil {
+			return err
+		}
+		states[key] = state
+		if err := writeMetadata(ctx, output, gptscriptClient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncCommit writes the files of the commit whose blob differs from the synced one to the workspace and removes the files
+// that are not in the commit (or no longer match the filter). Comparing the blobs instead of diffing the commits also
+// handles force pushes, branch switches and lost clones, after which the last synced commit is not available.
+func syncCommit(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, gptscriptClient client, maxFileSize int64, repoURL string, state *RepositoryState, commit *object.Commit, filter *pathFilter) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s of %s: %w", state.Commit, repoURL, err)
+	}
+
+	synced := map[string]struct{}{}
+	if err := tree.Files().ForEach(func(f *object.File) error {
+		// symbolic links and submodules are skipped
+		if f.Mode != filemode.Regular && f.Mode != filemode.Executable {
+			return nil
+		}
+		if !filter.allows(f.Name) {
+			return nil
+		}
+		if f.Size > maxFileSize {
+			logErr.Infof("Skipping %s because it is larger than %d bytes", f.Name, maxFileSize)
+			return nil
+		}
+
+		id := fileID(repoURL, f.Name)
+		synced[id] = struct{}{}
+		filePath := path.Join(state.Name, f.Name)
+		detail, ok := output.Files[id]
+		if ok && detail.FilePath == filePath && detail.Checksum == f.Hash.String() {
+			return nil
+		}
+		if ok && detail.FilePath != filePath {
+			if err := removeFile(ctx, logErr, gptscriptClient, detail.FilePath); err != nil {
+				return err
+			}
+		}
+
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := gptscriptClient.WriteFileInWorkspace(ctx, filePath, data); err != nil {
+			return err
+		}
+		updatedAt := commit.Committer.When.UTC().Format(time.RFC3339)
+		if err := writeSidecar(ctx, gptscriptClient, filePath, sourceMetadata{
+			URL:          repoURL,
+			Title:        path.Base(f.Name),
+			Path:         f.Name,
+			Branch:       state.Branch,
+			Commit:       state.Commit,
+			LastModified: updatedAt,
+		}); err != nil {
+			return err
+		}
+		logErr.Infof("Synced %s", filePath)
+
+		output.Files[id] = FileDetails{
+			FilePath:    filePath,
+			URL:         repoURL,
+			SizeInBytes: f.Size,
+			UpdatedAt:   updatedAt,
+			Checksum:    f.Hash.String(),
+			Repository:  repoURL,
+		}
+		output.Status = fmt.Sprintf("Syncing file %v", filePath)
+		return writeMetadata(ctx, output, gptscriptClient)
+	}); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", repoURL, err)
+	}
+
+	return removeFiles(ctx, logErr, output, gptscriptClient, func(id string, detail FileDetails) bool {
+		_, ok := synced[id]
+		return detail.Repository == repoURL && !ok
+	})
+}
+
+// removeFiles deletes the files matching the filter from the workspace and metadata.
+func removeFiles(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, gptscriptClient client, filter func(id string, detail FileDetails) bool) error {
+	for id, detail := range output.Files {
+		if !filter(id, detail) {
+			continue
+		}
+		if err := removeFile(ctx, logErr, gptscriptClient, detail.FilePath); err != nil {
+			return err
+		}
+		delete(output.Files, id)
+	}
+	return nil
+}
+
+// removeFile deletes a file and its sidecar from the workspace.
+func removeFile(ctx context.Context, logErr *logrus.Logger, gptscriptClient client, filePath string) error {
+	logErr.Infof("Deleting %s", filePath)
+	var notFoundErr *gptscript.NotFoundInWorkspaceError
+	if err := gptscriptClient.DeleteFileInWorkspace(ctx, filePath); err != nil && !errors.As(err, &notFoundErr) {
+		return err
+	}
+	return deleteSidecar(ctx, gptscriptClient, filePath)
+}
+
+// fileID returns the key of a file in the metadata.
+func fileID(repoURL, name string) string {
+	return repoURL + "#" + name
+}
+
+// uniqueName returns the name, or the name with the lowest number appended that isn't taken yet, and takes it.
+func uniqueName(name string, taken map[string]struct{}) string {
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := taken[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	taken[unique] = struct{}{}
+	return unique
+}
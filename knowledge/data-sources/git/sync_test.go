@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeClient keeps the files of the workspace in memory.
+type fakeClient map[string][]byte
+
+func (c fakeClient) ReadFileInWorkspace(_ context.Context, filePath string, _ ...gptscript.ReadFileInWorkspaceOptions) ([]byte, error) {
+	data, ok := c[filePath]
+	if !ok {
+		return nil, &gptscript.NotFoundInWorkspaceError{}
+	}
+	return data, nil
+}
+
+func (c fakeClient) WriteFileInWorkspace(_ context.Context, filePath string, contents []byte, _ ...gptscript.WriteFileInWorkspaceOptions) error {
+	c[filePath] = contents
+	return nil
+}
+
+func (c fakeClient) DeleteFileInWorkspace(_ context.Context, filePath string, _ ...gptscript.DeleteFileInWorkspaceOptions) error {
+	if _, ok := c[filePath]; !ok {
+		return &gptscript.NotFoundInWorkspaceError{}
+	}
+	delete(c, filePath)
+	return nil
+}
+
+func (c fakeClient) RevealCredential(context.Context, []string, string) (gptscript.Credential, error) {
+	return gptscript.Credential{}, errors.New("no credentials in tests")
+}
+
+func newTestOutput() *MetadataOutput {
+	return &MetadataOutput{
+		Files: map[string]FileDetails{},
+		State: State{GitState: &GitState{Repositories: map[string]*RepositoryState{}}},
+	}
+}
+
+func newTestLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// newTestRepo creates a repository with a commit of the given files.
+func newTestRepo(t *testing.T, dir string, files map[string]string) *git.Repository {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		commitFile(t, repo, dir, name, content)
+	}
+	return repo
+}
+
+// checkWorkspace fails if the files of the metadata aren't the wanted ones or have the wrong content in the workspace.
+func checkWorkspace(t *testing.T, ws fakeClient, output *MetadataOutput, want map[string]string) {
+	t.Helper()
+	if len(output.Files) != len(want) {
+		t.Errorf("got %d files in the metadata, want %d", len(output.Files), len(want))
+	}
+	for _, detail := range output.Files {
+		data, ok := ws[detail.FilePath]
+		if !ok {
+			t.Errorf("%s is missing in the workspace", detail.FilePath)
+			continue
+		}
+		if string(data) != want[detail.FilePath] {
+			t.Errorf("%s = %q, want %q", detail.FilePath, data, want[detail.FilePath])
+		}
+	}
+}
+
+func TestSyncSameNamedRepositories(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a", "handbook"), filepath.Join(dir, "b", "handbook")
+	newTestRepo(t, first, map[string]string{"intro.md": "first"})
+	newTestRepo(t, second, map[string]string{"intro.md": "second"})
+
+	ws := fakeClient{}
+	output := newTestOutput()
+	config := &GitConfig{Repositories: []Repository{{URL: first}, {URL: second}}, MaxFileSize: defaultMaxFileSize, CacheDir: t.TempDir()}
+	run := func() {
+		t.Helper()
+		if err := sync(ctx, newTestLogger(), config, output, ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "first", "handbook-2/intro.md": "second"})
+
+	// reordering the repositories doesn't move their files
+	config.Repositories = []Repository{{URL: second}, {URL: first}}
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "first", "handbook-2/intro.md": "second"})
+
+	// removing the first repository removes its files, but not the ones of the second repository
+	config.Repositories = []Repository{{URL: second}}
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook-2/intro.md": "second"})
+	if _, ok := ws["handbook/intro.md"]; ok {
+		t.Errorf("expected the files of the removed repository to be deleted")
+	}
+
+	// a new repository of the same name takes the free folder
+	third := filepath.Join(dir, "c", "handbook")
+	newTestRepo(t, third, map[string]string{"intro.md": "third"})
+	config.Repositories = []Repository{{URL: third}, {URL: second}}
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "third", "handbook-2/intro.md": "second"})
+}
+
+func TestSyncRejectsDuplicateRepositories(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "handbook")
+	newTestRepo(t, dir, map[string]string{"intro.md": "intro"})
+
+	config := &GitConfig{Repositories: []Repository{{URL: dir}, {URL: dir, Branch: "other"}}, MaxFileSize: defaultMaxFileSize, CacheDir: t.TempDir()}
+	if err := sync(context.Background(), newTestLogger(), config, newTestOutput(), fakeClient{}); err == nil {
+		t.Errorf("expected an error for a repository that is configured twice")
+	}
+}
+
+func headCommit(t *testing.T, repo *git.Repository) *object.Commit {
+	t.Helper()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return commit
+}
+
+func TestSyncCommit(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newTestRepo(t, dir, map[string]string{"docs/intro.md": "intro", "docs/setup.md": "setup", "notes.txt": "notes"})
+
+	ws := fakeClient{}
+	output := newTestOutput()
+	syncCommit := func(name string, include []string) {
+		t.Helper()
+		filter, err := newPathFilter(include, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit := headCommit(t, repo)
+		state := &RepositoryState{Name: name, Branch: "master", Commit: commit.Hash.String()}
+		if err := syncCommit(ctx, newTestLogger(), output, ws, defaultMaxFileSize, "https://git.example.com/handbook.git", state, commit, filter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	syncCommit("handbook", nil)
+	checkWorkspace(t, ws, output, map[string]string{"handbook/docs/intro.md": "intro", "handbook/docs/setup.md": "setup", "handbook/notes.txt": "notes"})
+	if _, ok := ws["handbook/docs/intro.md"+sidecarSuffix]; !ok {
+		t.Errorf("expected a metadata sidecar for handbook/docs/intro.md")
+	}
+
+	// only files whose blob changed are written again
+	ws["handbook/docs/intro.md"] = []byte("unchanged")
+	commitFile(t, repo, dir, "docs/setup.md", "setup v2")
+	syncCommit("handbook", nil)
+	checkWorkspace(t, ws, output, map[string]string{"handbook/docs/intro.md": "unchanged", "handbook/docs/setup.md": "setup v2", "handbook/notes.txt": "notes"})
+
+	// files that drop out of the filter are removed
+	syncCommit("handbook", []string{"docs/**"})
+	checkWorkspace(t, ws, output, map[string]string{"handbook/docs/intro.md": "unchanged", "handbook/docs/setup.md": "setup v2"})
+	if _, ok := ws["handbook/notes.txt"]; ok {
+		t.Errorf("expected handbook/notes.txt to be removed")
+	}
+	if _, ok := ws["handbook/notes.txt"+sidecarSuffix]; ok {
+		t.Errorf("expected the sidecar of handbook/notes.txt to be removed")
+	}
+
+	// files are moved if the folder of the repository changed
+	syncCommit("handbook-2", []string{"docs/**"})
+	checkWorkspace(t, ws, output, map[string]string{"handbook-2/docs/intro.md": "intro", "handbook-2/docs/setup.md": "setup v2"})
+	if _, ok := ws["handbook/docs/intro.md"]; ok {
+		t.Errorf("expected handbook/docs/intro.md to be removed")
+	}
+}
+
+func TestSyncSkipsUnchangedRepositories(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "handbook")
+	repo := newTestRepo(t, dir, map[string]string{"intro.md": "intro", "big.md": "0123456789"})
+
+	ws := fakeClient{}
+	output := newTestOutput()
+	config := &GitConfig{Repositories: []Repository{{URL: dir}}, MaxFileSize: 5, CacheDir: t.TempDir()}
+	run := func() {
+		t.Helper()
+		if err := sync(ctx, newTestLogger(), config, output, ws); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "intro"})
+
+	// neither the commit nor the configuration changed
+	ws["handbook/intro.md"] = []byte("unchanged")
+	delete(ws, "handbook/intro.md"+sidecarSuffix)
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "unchanged"})
+
+	// a bigger size limit syncs the files that were too large
+	config.MaxFileSize = defaultMaxFileSize
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "unchanged", "handbook/big.md": "0123456789"})
+
+	// a new commit
+	commitFile(t, repo, dir, "intro.md", "intro v2")
+	run()
+	checkWorkspace(t, ws, output, map[string]string{"handbook/intro.md": "intro v2", "handbook/big.md": "0123456789"})
+	if state := output.State.GitState.Repositories[dir]; state == nil || state.Commit != headCommit(t, repo).Hash.String() {
+		t.Errorf("expected the state to record the last synced commit")
+	}
+}
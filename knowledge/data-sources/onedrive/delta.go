@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/go-gptscript"
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	drives2 "github.com/microsoftgraph/msgraph-sdk-go/drives"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxThrottlingRetries is the number of retries of throttled requests, in addition to the SDK's own retries
+	maxThrottlingRetries = 5
+	// defaultThrottlingDelay is used if a throttled response has no Retry-After header
+	defaultThrottlingDelay = 30 * time.Second
+	// maxFolderDepth guards against cycles in the recorded folders
+	maxFolderDepth = 256
+	// maxDeltaRestarts is the number of times a sync starts over when the delta token expired, e.g. while paging
+	maxDeltaRestarts = 3
+)
+
+// syncFolder syncs the files below a shared folder with a delta query: the first sync lists all items, later ones only
+// the changed and deleted items since the last sync. The paging is recorded, so an interrupted sync resumes where it stopped.
+func syncFolder(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, link string, state *LinkState, root models.DriveItemable) error {
+	if state.DeltaLink == "" && state.NextLink == "" {
+		startFullSync(state)
+	} else if folder := state.Folders[state.ItemID]; folder.Name != state.Name {
+		// the shared folder was renamed (or the source's name changed), so are the paths of its files
+		state.Folders[state.ItemID] = FolderState{Name: state.Name}
+		if err := relocateFiles(ctx, logErr, output, gptscriptClient, link, state); err != nil {
+			return err
+		}
+	}
+
+	for restarts := 0; ; {
+		url := state.NextLink
+		if url == "" {
+			url = state.DeltaLink
+		}
+		page, err := withThrottling(ctx, logErr, func() (drives2.ItemItemsItemDeltaGetResponseable, error) {
+			builder := client.Drives().ByDriveId(state.DriveID).Items().ByDriveItemId(state.ItemID).Delta()
+			if url != "" {
+				builder = builder.WithUrl(url)
+			}
+			return builder.GetAsDeltaGetResponse(ctx, deltaRequestConfig)
+		})
+		if statusCode(err) == http.StatusGone {
+			// the delta token expired, the folder has to be listed again - unless even that keeps failing
+			if url == "" || restarts >= maxDeltaRestarts {
+				return fmt.Errorf("failed to list the changes of %s: %w", link, err)
+			}
+			restarts++
+			logErr.Infof("Resyncing %s because its delta token expired", link)
+			startFullSync(state)
+			continue
+		} else if url == "" && (statusCode(err) == http.StatusBadRequest || statusCode(err) == http.StatusNotImplemented) {
+			logErr.Infof("Delta queries are not supported for %s, syncing all files: %v", link, err)
+			return walkFolder(ctx, logErr, output, client, gptscriptClient, link, state.Name, root)
+		} else if err != nil {
+			return err
+		}
+
+		for _, item := range page.GetValue() {
+			if err := applyDeltaItem(ctx, logErr, output, client, gptscriptClient, link, state, item); err != nil {
+				return err
+			}
+		}
+
+		if next := page.GetOdataNextLink(); next != nil && *next != "" {
+			state.NextLink = *next
+			if err := writeMetadata(ctx, output, gptscriptClient); err != nil {
+				return err
+			}
+			continue
+		}
+		if deltaLink := page.GetOdataDeltaLink(); deltaLink != nil {
+			state.DeltaLink = *deltaLink
+		}
+		state.NextLink = ""
+		break
+	}
+
+	if state.Enumerated != nil {
+		// a full sync lists all files, the others have been removed
+		if err := removeFiles(ctx, logErr, output, gptscriptClient, func(id string, detail FileDetails) bool {
+			_, ok := state.Enumerated[id]
+			return detail.Link == link && !ok
+		}); err != nil {
+			return err
+		}
+		state.Enumerated = nil
+	}
+	return nil
+}
+
+// deltaRequestConfig asks delta queries to report the items whose permissions changed, to update their ACLs.
+var deltaRequestConfig = func() *drives2.ItemItemsItemDeltaRequestBuilderGetRequestConfiguration {
+	headers := abstractions.NewRequestHeaders()
+	headers.Add("Prefer", "deltashowsharingchanges")
+	return &drives2.ItemItemsItemDeltaRequestBuilderGetRequestConfiguration{Headers: headers}
+}()
+
+// startFullSync resets the state of a link to list all items of the folder.
+func startFullSync(state *LinkState) {
+	state.DeltaLink, state.NextLink = "", ""
+	state.Folders = map[string]FolderState{state.ItemID: {Name: state.Name}}
+	state.Enumerated = map[string]struct{}{}
+}
+
+// walkFolder syncs the files of a shared folder without delta query.
+func walkFolder(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, link, name string, root models.DriveItemable) error {
+	item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+		return client.Drives().ByDriveId(*root.GetParentReference().GetDriveId()).Items().ByDriveItemId(*root.GetId()).Get(ctx, &drives2.ItemItemsDriveItemItemRequestBuilderGetRequestConfiguration{
+			QueryParameters: &drives2.ItemItemsDriveItemItemRequestBuilderGetQueryParameters{
+				Expand: []string{"children"},
+			},
+		})
+	})
+	if err != nil {
+		return err
+	}
+	children, err := syncChildrenFileForItem(ctx, client, gptscriptClient, item, output, path.Join("/", getFullName(item)), name, link, logErr)
+	if err != nil {
+		return err
+	}
+
+	synced := make(map[string]struct{}, len(children))
+	for _, child := range children {
+		synced[*child.GetId()] = struct{}{}
+	}
+	return removeFiles(ctx, logErr, output, gptscriptClient, func(id string, detail FileDetails) bool {
+		_, ok := synced[id]
+		return detail.Link == link && !ok
+	})
+}
+
+// applyDeltaItem syncs a changed or deleted item of a delta response.
+func applyDeltaItem(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, link string, state *LinkState, item models.DriveItemable) error {
+	id := *item.GetId()
+	if item.GetDeleted() != nil {
+		if _, ok := state.Folders[id]; ok {
+			// the files of a deleted folder are not always reported as deleted
+			err := removeFiles(ctx, logErr, output, gptscriptClient, func(fileID string, detail FileDetails) bool {
+				return detail.Link == link && (fileID == id || state.below(detail.ParentID, id))
+			})
+			for folderID := range state.Folders {
+				if folderID != id && state.below(folderID, id) {
+					delete(state.Folders, folderID)
+				}
+			}
+			delete(state.Folders, id)
+			return err
+		}
+		return removeFiles(ctx, logErr, output, gptscriptClient, func(fileID string, _ FileDetails) bool {
+			return fileID == id
+		})
+	}
+
+	if item.GetFile() == nil && sharingChanged(item) {
+		// the permissions of the files below the folder may have changed with it
+		for fileID, detail := range output.Files {
+			if detail.Link == link && state.below(detail.ParentID, id) {
+				if err := refreshSidecarACL(ctx, logErr, client, gptscriptClient, state.DriveID, fileID, detail.FilePath); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if id == state.ItemID {
+		// the name of the shared folder is the source's name
+		return nil
+	}
+	var parentID string
+	if item.GetParentReference() != nil && item.GetParentReference().GetId() != nil {
+		parentID = *item.GetParentReference().GetId()
+	}
+
+	if item.GetFile() == nil {
+		folder := FolderState{Name: *item.GetName(), ParentID: parentID}
+		previous, ok := state.Folders[id]
+		state.Folders[id] = folder
+		if ok && previous != folder {
+			// renamed or moved, so are the files below it
+			return relocateFiles(ctx, logErr, output, gptscriptClient, link, state)
+		}
+		return nil
+	}
+
+	if state.Enumerated != nil {
+		state.Enumerated[id] = struct{}{}
+	}
+	folderPath, ok := state.path(parentID)
+	if !ok {
+		logErr.Infof("Skipping %s because its folder is unknown", *item.GetName())
+		return nil
+	}
+	if tooLarge(item) {
+		return nil
+	}
+	return saveToMetadata(ctx, logErr, output, client, gptscriptClient, item, path.Join(folderPath, *item.GetName()), link, parentID, sharingChanged(item))
+}
+
+// relocateFiles moves the files of the link whose folder path changed.
+func relocateFiles(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, gptscriptClient *gptscript.GPTScript, link string, state *LinkState) error {
+	for id, detail := range output.Files {
+		if detail.Link != link {
+			continue
+		}
+		folderPath, ok := state.path(detail.ParentID)
+		if !ok {
+			continue
+		}
+		newPath := path.Join(folderPath, path.Base(detail.FilePath))
+		if newPath == detail.FilePath {
+			continue
+		}
+
+		data, err := gptscriptClient.ReadFileInWorkspace(ctx, detail.FilePath)
+		if err != nil {
+			return err
+		}
+		if err := gptscriptClient.WriteFileInWorkspace(ctx, newPath, data); err != nil {
+			return err
+		}
+		if err := gptscriptClient.DeleteFileInWorkspace(ctx, detail.FilePath); err != nil {
+			return err
+		}
+		if sidecar, err := gptscriptClient.ReadFileInWorkspace(ctx, detail.FilePath+sidecarSuffix); err == nil {
+			if err := gptscriptClient.WriteFileInWorkspace(ctx, newPath+sidecarSuffix, sidecar); err != nil {
+				return err
+			}
+			if err := deleteSidecar(ctx, gptscriptClient, detail.FilePath); err != nil {
+				return err
+			}
+		} else if !isNotFoundInWorkspace(err) {
+			return err
+		}
+		logErr.Infof("Moved %s to %s", detail.FilePath, newPath)
+
+		detail.FilePath = newPath
+		output.Files[id] = detail
+		fileState := output.State.OneDriveState.Files[id]
+		fileState.FolderPath, fileState.FileName = strings.TrimPrefix(path.Dir(newPath), "/"), path.Base(newPath)
+		output.State.OneDriveState.Files[id] = fileState
+	}
+	return nil
+}
+
+// path returns the workspace path of a folder of the link, starting with the shared folder's name.
+func (s *LinkState) path(folderID string) (string, bool) {
+	var names []string
+	for range maxFolderDepth {
+		folder, ok := s.Folders[folderID]
+		if !ok {
+			return "", false
+		}
+		names = append([]string{folder.Name}, names...)
+		if folderID == s.ItemID {
+			return "/" + path.Join(names...), true
+		}
+		folderID = folder.ParentID
+	}
+	return "", false
+}
+
+// below returns true if the folder is (indirectly) below the ancestor.
+func (s *LinkState) below(folderID, ancestorID string) bool {
+	for range maxFolderDepth {
+		if folderID == ancestorID {
+			return true
+		}
+		folder, ok := s.Folders[folderID]
+		if !ok || folder.ParentID == "" {
+			return false
+		}
+		folderID = folder.ParentID
+	}
+	return false
+}
+
+// withThrottling calls Microsoft Graph, retrying throttled requests (429 or 503) after their Retry-After delay.
+func withThrottling[T any](ctx context.Context, logErr *logrus.Logger, call func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := call()
+		code := statusCode(err)
+		if (code != http.StatusTooManyRequests && code != http.StatusServiceUnavailable) || attempt >= maxThrottlingRetries {
+			return result, err
+		}
+
+		delay := retryAfter(err)
+		logErr.Infof("Throttled by Microsoft Graph, retrying in %s", delay)
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// statusCode returns the HTTP status code of a Microsoft Graph error, or 0.
+func statusCode(err error) int {
+	var odataErr *odataerrors.ODataError
+	if errors.As(err, &odataErr) {
+		return odataErr.ResponseStatusCode
+	}
+	return 0
+}
+
+// retryAfter returns the delay of the Retry-After header of a Microsoft Graph error (seconds or an HTTP date).
+func retryAfter(err error) time.Duration {
+	var odataErr *odataerrors.ODataError
+	if !errors.As(err, &odataErr) || odataErr.ResponseHeaders == nil {
+		return defaultThrottlingDelay
+	}
+	for _, value := range odataErr.ResponseHeaders.Get("Retry-After") {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if t, err := http.ParseTime(value); err == nil {
+			return time.Until(t)
+		}
+	}
+	return defaultThrottlingDelay
+}
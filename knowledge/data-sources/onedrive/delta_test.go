@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	abstractions "github.com/microsoft/kiota-abstractions-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/microsoftgraph/msgraph-sdk-go/models/odataerrors"
+)
+
+func TestLinkStatePath(t *testing.T) {
+	state := &LinkState{ItemID: "root", Folders: map[string]FolderState{
+		"root":   {Name: "Shared"},
+		"docs":   {Name: "Docs", ParentID: "root"},
+		"specs":  {Name: "Specs", ParentID: "docs"},
+		"orphan": {Name: "Orphan", ParentID: "unknown"},
+		"cycle1": {Name: "A", ParentID: "cycle2"},
+		"cycle2": {Name: "B", ParentID: "cycle1"},
+	}}
+
+	tests := []struct {
+		folderID, path string
+		ok             bool
+	}{
+		{"root", "/Shared", true},
+		{"specs", "/Shared/Docs/Specs", true},
+		{"orphan", "", false},
+		{"unknown", "", false},
+		{"cycle1", "", false},
+	}
+	for _, test := range tests {
+		if p, ok := state.path(test.folderID); p != test.path || ok != test.ok {
+			t.Errorf("expected path %q (%t) for %s, got %q (%t)", test.path, test.ok, test.folderID, p, ok)
+		}
+	}
+
+	if !state.below("specs", "root") || !state.below("specs", "docs") || !state.below("docs", "docs") {
+		t.Error("expected folders to be below their ancestors")
+	}
+	if state.below("docs", "specs") || state.below("orphan", "root") || state.below("cycle1", "root") {
+		t.Error("expected folders not to be below other folders")
+	}
+}
+
+// graphError returns an error of Microsoft Graph with the status code and Retry-After header.
+func graphError(code int, retryAfter string) error {
+	err := odataerrors.NewODataError()
+	err.ResponseStatusCode = code
+	err.ResponseHeaders = abstractions.NewResponseHeaders()
+	if retryAfter != "" {
+		err.ResponseHeaders.Add("Retry-After", retryAfter)
+	}
+	return err
+}
+
+func TestStatusCode(t *testing.T) {
+	if code := statusCode(fmt.Errorf("wrapped: %w", graphError(http.StatusGone, ""))); code != http.StatusGone {
+		t.Errorf("expected status code %d, got %d", http.StatusGone, code)
+	}
+	if code := statusCode(errors.New("network error")); code != 0 {
+		t.Errorf("expected no status code, got %d", code)
+	}
+	if code := statusCode(nil); code != 0 {
+		t.Errorf("expected no status code, got %d", code)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if delay := retryAfter(graphError(http.StatusTooManyRequests, "7")); delay != 7*time.Second {
+		t.Errorf("expected a delay of 7s, got %s", delay)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if delay := retryAfter(graphError(http.StatusServiceUnavailable, date)); delay <= 58*time.Second || delay > time.Minute {
+		t.Errorf("expected a delay of about a minute, got %s", delay)
+	}
+	if delay := retryAfter(graphError(http.StatusTooManyRequests, "")); delay != defaultThrottlingDelay {
+		t.Errorf("expected the default delay without Retry-After, got %s", delay)
+	}
+	if delay := retryAfter(errors.New("network error")); delay != defaultThrottlingDelay {
+		t.Errorf("expected the default delay for other errors, got %s", delay)
+	}
+}
+
+func TestWithThrottling(t *testing.T) {
+	ctx := context.Background()
+	logErr := newTestLogger()
+
+	// throttled requests are retried
+	calls := 0
+	result, err := withThrottling(ctx, logErr, func() (string, error) {
+		if calls++; calls < 3 {
+			return "", graphError(http.StatusTooManyRequests, "0")
+		}
+		return "ok", nil
+	})
+	if err != nil || result != "ok" || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %q, %v after %d calls", result, err, calls)
+	}
+
+	// other errors aren't
+	calls = 0
+	_, err = withThrottling(ctx, logErr, func() (string, error) {
+		calls++
+		return "", graphError(http.StatusNotFound, "")
+	})
+	if statusCode(err) != http.StatusNotFound || calls != 1 {
+		t.Errorf("expected the error without retries, got %v after %d calls", err, calls)
+	}
+
+	// the retries are limited
+	calls = 0
+	_, err = withThrottling(ctx, logErr, func() (string, error) {
+		calls++
+		return "", graphError(http.StatusServiceUnavailable, "0")
+	})
+	if statusCode(err) != http.StatusServiceUnavailable || calls != maxThrottlingRetries+1 {
+		t.Errorf("expected the error after %d calls, got %v after %d calls", maxThrottlingRetries+1, err, calls)
+	}
+
+	// and stop when the context is canceled
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = withThrottling(canceled, logErr, func() (string, error) {
+		return "", graphError(http.StatusTooManyRequests, "60")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the context error, got %v", err)
+	}
+}
+
+func TestSyncFolderExpiredDelta(t *testing.T) {
+	requests := 0
+	client := newTestGraphClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if prefer := r.Header.Get("Prefer"); prefer != "deltashowsharingchanges" {
+			t.Errorf("expected the delta query to ask for sharing changes, got Prefer: %q", prefer)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusGone)
+		_, _ = io.WriteString(w, `{"error": {"code": "resyncRequired", "message": "Resync required"}}`)
+	})
+
+	root := models.NewDriveItem()
+	deltaLink := client.GetAdapter().GetBaseUrl() + "/drives/drive/items/root/delta()?token=expired"
+	state := &LinkState{IsFolder: true, Name: "Shared", DriveID: "drive", ItemID: "root", DeltaLink: deltaLink}
+	state.Folders = map[string]FolderState{"root": {Name: "Shared"}}
+	output := &MetadataOutput{Files: map[string]FileDetails{}, State: State{OneDriveState: &OneDriveLinksConnectorState{Files: map[string]FileState{}}}}
+
+	// the expired token starts a full sync, which doesn't start over when it fails the same way
+	err := syncFolder(context.Background(), newTestLogger(), output, client, nil, "link", state, root)
+	if statusCode(err) != http.StatusGone {
+		t.Errorf("expected the delta query to fail, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if state.DeltaLink != "" || state.Enumerated == nil {
+		t.Error("expected the next sync to be a full sync")
+	}
+}
+
+func TestSharingChanged(t *testing.T) {
+	client := newTestGraphClient(t, graphResponses(t, map[string]string{
+		"/drives/drive/items/shared":   `{"id": "shared", "name": "a.docx", "@microsoft.graph.sharedChanged": "True"}`,
+		"/drives/drive/items/unshared": `{"id": "unshared", "name": "b.docx"}`,
+	}))
+
+	for id, expected := range map[string]bool{"shared": true, "unshared": false} {
+		item, err := client.Drives().ByDriveId("drive").Items().ByDriveItemId(id).Get(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed := sharingChanged(item); changed != expected {
+			t.Errorf("expected sharing changed %t for %s, got %t", expected, id, changed)
+		}
+	}
+}
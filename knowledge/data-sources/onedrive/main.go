@@ -9,6 +9,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -17,7 +18,6 @@ import (
 	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
 	drives2 "github.com/microsoftgraph/msgraph-sdk-go/drives"
 	"github.com/microsoftgraph/msgraph-sdk-go/models"
-	"github.com/microsoftgraph/msgraph-sdk-go/shares"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,6 +27,33 @@ type MetadataInput struct {
 
 type OneDriveConfig struct {
 	SharedLinks []string `json:"sharedLinks"`
+	// SharePointLibraries are document libraries of SharePoint sites
+	SharePointLibraries []SharePointLibrary `json:"sharepointLibraries,omitempty"`
+	// Drives are drives (or folders of drives) by ID
+	Drives []DriveFolder `json:"drives,omitempty"`
+	// TeamsChannels are the Files folders of Teams channels
+	TeamsChannels []TeamsChannel `json:"teamsChannels,omitempty"`
+}
+
+type SharePointLibrary struct {
+	// SiteURL is the URL of the site, e.g. https://contoso.sharepoint.com/sites/Marketing
+	SiteURL string `json:"siteURL"`
+	// Library is the name of the document library (default: Documents)
+	Library string `json:"library,omitempty"`
+	// FolderPath restricts the sync to a folder of the library
+	FolderPath string `json:"folderPath,omitempty"`
+}
+
+type DriveFolder struct {
+	DriveID string `json:"driveID"`
+	// FolderPath restricts the sync to a folder of the drive
+	FolderPath string `json:"folderPath,omitempty"`
+}
+
+type TeamsChannel struct {
+	TeamID string `json:"teamID"`
+	// ChannelID is the channel whose files are synced (default: the team's primary channel)
+	ChannelID string `json:"channelID,omitempty"`
 }
 
 type MetadataOutput struct {
@@ -41,12 +68,28 @@ type State struct {
 
 type OneDriveLinksConnectorState struct {
 	Files map[string]FileState `json:"files,omitempty"`
-	Links map[string]LinkState `json:"links,omitempty"`
+	// Links are the states of the shared links and other sources by key
+	Links map[string]*LinkState `json:"links,omitempty"`
 }
 
 type LinkState struct {
 	IsFolder bool   `json:"isFolder"`
 	Name     string `json:"name"`
+	DriveID  string `json:"driveID,omitempty"`
+	ItemID   string `json:"itemID,omitempty"`
+	// DeltaLink fetches the changes of a shared folder since the last sync
+	DeltaLink string `json:"deltaLink,omitempty"`
+	// NextLink resumes the paging of a sync that was interrupted
+	NextLink string `json:"nextLink,omitempty"`
+	// Folders of a shared folder by ID, to build the paths of the items in delta responses, which don't include them
+	Folders map[string]FolderState `json:"folders,omitempty"`
+	// Enumerated are the IDs of the files listed so far by a full sync, after which the files of the link that weren't listed are removed
+	Enumerated map[string]struct{} `json:"enumerated,omitempty"`
+}
+
+type FolderState struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parentID,omitempty"`
 }
 
 type FileState struct {
@@ -76,6 +119,9 @@ type FileDetails struct {
 	URL         string `json:"url"`
 	SizeInBytes int64  `json:"sizeInBytes"`
 	UpdatedAt   string `json:"updatedAt"`
+	// Link is the key of the shared link (or other source) the file was synced from
+	Link     string `json:"link,omitempty"`
+	ParentID string `json:"parentID,omitempty"`
 }
 
 func main() {
@@ -136,7 +182,7 @@ func main() {
 		output.State.OneDriveState.Files = make(map[string]FileState)
 	}
 	if output.State.OneDriveState.Links == nil {
-		output.State.OneDriveState.Links = make(map[string]LinkState)
+		output.State.OneDriveState.Links = make(map[string]*LinkState)
 	}
 
 	for i := range input.OneDriveConfig.SharedLinks {
@@ -156,48 +202,92 @@ func main() {
 }
 
 func sync(ctx context.Context, logErr *logrus.Logger, input MetadataInput, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscript *gptscript.GPTScript) error {
-	items := map[string]models.DriveItemable{}
-	for _, link := range input.OneDriveConfig.SharedLinks {
-		requestParameters := &shares.ItemDriveItemRequestBuilderGetQueryParameters{
-			Expand: []string{"children"},
-		}
-		configuration := &shares.ItemDriveItemRequestBuilderGetRequestConfiguration{
-			QueryParameters: requestParameters,
-		}
-		shareDriveItem, err := client.Shares().BySharedDriveItemId(encodeURL(link)).DriveItem().Get(ctx, configuration)
+	var keys []string
+	for _, src := range sources(input.OneDriveConfig, client, logErr) {
+		keys = append(keys, src.key)
+		item, name, err := src.resolve(ctx)
 		if err != nil {
 			return err
 		}
-		root := path.Dir(getFullName(shareDriveItem))
-		output.State.OneDriveState.Links[link] = LinkState{
-			IsFolder: shareDriveItem.GetFile() == nil,
-			Name:     *shareDriveItem.GetName(),
+
+		driveID, itemID := *item.GetParentReference().GetDriveId(), *item.GetId()
+		state := output.State.OneDriveState.Links[src.key]
+		if state == nil || state.DriveID != driveID || state.ItemID != itemID {
+			// new source, or it points to another item now - start over
+			state = &LinkState{DriveID: driveID, ItemID: itemID}
+			output.State.OneDriveState.Links[src.key] = state
 		}
+		state.IsFolder = item.GetFile() == nil
+		state.Name = name
 
-		children, err := syncChildrenFileForItem(ctx, client, gptscript, shareDriveItem, output, root, logErr)
-		if err != nil {
+		if !state.IsFolder {
+			if err := syncFile(ctx, logErr, output, client, gptscript, src.key, item); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := syncFolder(ctx, logErr, output, client, gptscript, src.key, state, item); err != nil {
 			return err
 		}
-		for _, child := range children {
-			items[*child.GetId()] = child
+	}
+
+	for key := range output.State.OneDriveState.Links {
+		if !slices.Contains(keys, key) {
+			delete(output.State.OneDriveState.Links, key)
 		}
 	}
+	// remove the files of sources that were removed (or of syncs before sources were recorded)
+	return removeFiles(ctx, logErr, output, gptscript, func(_ string, detail FileDetails) bool {
+		return !slices.Contains(keys, detail.Link)
+	})
+}
+
+// syncFile syncs a shared link to a single file.
+func syncFile(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, link string, item models.DriveItemable) error {
+	id := *item.GetId()
+	if err := removeFiles(ctx, logErr, output, gptscriptClient, func(fileID string, detail FileDetails) bool {
+		return detail.Link == link && fileID != id
+	}); err != nil {
+		return err
+	}
+	if tooLarge(item) {
+		return nil
+	}
+	// the permissions of a single file are checked on every sync
+	return saveToMetadata(ctx, logErr, output, client, gptscriptClient, item, "/"+*item.GetName(), link, "", true)
+}
 
-	for id := range output.Files {
-		if _, ok := items[id]; !ok {
-			if output.Files[id].FilePath != "" {
-				logErr.Infof("Deleting %s", output.Files[id].FilePath)
-				if err := gptscript.DeleteFileInWorkspace(ctx, output.Files[id].FilePath); err != nil {
-					return err
-				}
+// removeFiles deletes the files matching the filter from the workspace and metadata.
+func removeFiles(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, gptscript *gptscript.GPTScript, filter func(id string, detail FileDetails) bool) error {
+	for id, detail := range output.Files {
+		if !filter(id, detail) {
+			continue
+		}
+		if detail.FilePath != "" {
+			logErr.Infof("Deleting %s", detail.FilePath)
+			if err := gptscript.DeleteFileInWorkspace(ctx, detail.FilePath); err != nil && !isNotFoundInWorkspace(err) {
+				return err
+			}
+			if err := deleteSidecar(ctx, gptscript, detail.FilePath); err != nil {
+				return err
 			}
-			delete(output.Files, id)
 		}
+		delete(output.Files, id)
+		delete(output.State.OneDriveState.Files, id)
 	}
-
 	return nil
 }
 
+func isNotFoundInWorkspace(err error) bool {
+	var notFoundErr *gptscript.NotFoundInWorkspaceError
+	return errors.As(err, &notFoundErr)
+}
+
+// tooLarge returns true for files of 50 MB or more, as most of the bigger files won't be supported from knowledge
+func tooLarge(item models.DriveItemable) bool {
+	return item.GetSize() != nil && *item.GetSize() >= 1024*1024*50
+}
+
 func writeMetadata(ctx context.Context, output *MetadataOutput, gptscript *gptscript.GPTScript) error {
 	data, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
@@ -206,13 +296,16 @@ func writeMetadata(ctx context.Context, output *MetadataOutput, gptscript *gptsc
 	return gptscript.WriteFileInWorkspace(ctx, ".metadata.json", data)
 }
 
-func syncChildrenFileForItem(ctx context.Context, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, item models.DriveItemable, output *MetadataOutput, root string, logErr *logrus.Logger) ([]models.DriveItemable, error) {
+// syncChildrenFileForItem syncs all files below the item by walking the folders, for drives that don't support delta queries on folders.
+// The paths of the files start with the name of the folder, followed by their path relative to the folder's (full) root path.
+func syncChildrenFileForItem(ctx context.Context, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, item models.DriveItemable, output *MetadataOutput, root, name, link string, logErr *logrus.Logger) ([]models.DriveItemable, error) {
 	if item.GetFile() != nil {
-		// We only sync item that is less than 50 MB, as most of the bigger files won't be supported from knowledge
-		if item.GetSize() != nil && *item.GetSize() >= 1024*1024*50 {
+		if tooLarge(item) {
 			return nil, nil
 		}
-		if err := saveToMetadata(ctx, logErr, output, client, gptscriptClient, item, root); err != nil {
+		relativePath := path.Join("/", name, strings.TrimPrefix(path.Join("/", getFullName(item)), root))
+		// without delta queries, sharing changes are unknown, so the permissions are checked on every sync
+		if err := saveToMetadata(ctx, logErr, output, client, gptscriptClient, item, relativePath, link, *item.GetParentReference().GetId(), true); err != nil {
 			return nil, err
 		}
 		return []models.DriveItemable{item}, nil
@@ -220,15 +313,17 @@ func syncChildrenFileForItem(ctx context.Context, client *msgraphsdk.GraphServic
 
 	var result []models.DriveItemable
 	for _, child := range item.GetChildren() {
-		item, err := client.Drives().ByDriveId(*child.GetParentReference().GetDriveId()).Items().ByDriveItemId(*child.GetId()).Get(ctx, &drives2.ItemItemsDriveItemItemRequestBuilderGetRequestConfiguration{
-			QueryParameters: &drives2.ItemItemsDriveItemItemRequestBuilderGetQueryParameters{
-				Expand: []string{"children"},
-			},
+		item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+			return client.Drives().ByDriveId(*child.GetParentReference().GetDriveId()).Items().ByDriveItemId(*child.GetId()).Get(ctx, &drives2.ItemItemsDriveItemItemRequestBuilderGetRequestConfiguration{
+				QueryParameters: &drives2.ItemItemsDriveItemItemRequestBuilderGetQueryParameters{
+					Expand: []string{"children"},
+				},
+			})
 		})
 		if err != nil {
 			return nil, err
 		}
-		children, err := syncChildrenFileForItem(ctx, client, gptscriptClient, item, output, root, logErr)
+		children, err := syncChildrenFileForItem(ctx, client, gptscriptClient, item, output, root, name, link, logErr)
 		if err != nil {
 			return nil, err
 		}
@@ -237,30 +332,34 @@ func syncChildrenFileForItem(ctx context.Context, client *msgraphsdk.GraphServic
 	return result, nil
 }
 
-func saveToMetadata(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, item models.DriveItemable, root string) error {
-	folders := make(map[string]struct{})
-	files := make(map[string]FileState)
-	fullPath := getFullName(item)
-	relativePath := strings.TrimPrefix(fullPath, root)
-	topRootFolder := strings.Split(strings.TrimPrefix(relativePath, string(os.PathSeparator)), string(os.PathSeparator))[0]
-	created := false
-	detail, ok := output.Files[*item.GetId()]
-	if !ok {
-		created = true
-		detail.FilePath = relativePath
-		detail.URL = *item.GetWebUrl()
-		detail.UpdatedAt = (*item.GetLastModifiedDateTime()).String()
-		detail.SizeInBytes = *item.GetSize()
-		output.Files[*item.GetId()] = detail
+// saveToMetadata downloads the file to its relative path in the workspace, unless it hasn't been modified since the last sync.
+// With refreshACL, the ACL in the sidecar of a file that wasn't modified is updated, e.g. as it was shared with others.
+func saveToMetadata(ctx context.Context, logErr *logrus.Logger, output *MetadataOutput, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, item models.DriveItemable, relativePath, link, parentID string, refreshACL bool) error {
+	id := *item.GetId()
+	detail, ok := output.Files[id]
+	download := !ok || detail.UpdatedAt != item.GetLastModifiedDateTime().String()
+	if ok && detail.FilePath != relativePath {
+		// renamed or moved
+		logErr.Infof("Deleting %s, as it was moved to %s", detail.FilePath, relativePath)
+		if err := gptscriptClient.DeleteFileInWorkspace(ctx, detail.FilePath); err != nil && !isNotFoundInWorkspace(err) {
+			return err
+		}
+		if err := deleteSidecar(ctx, gptscriptClient, detail.FilePath); err != nil {
+			return err
+		}
+		download = true
 	}
-	files[*item.GetId()] = FileState{
+
+	output.State.OneDriveState.Files[id] = FileState{
 		FolderPath: strings.TrimPrefix(filepath.Dir(relativePath), string(os.PathSeparator)),
 		FileName:   path.Base(relativePath),
 		URL:        *item.GetWebUrl(),
 	}
-	if created || detail.UpdatedAt != item.GetLastModifiedDateTime().String() {
+	if download {
 		driveID := *item.GetParentReference().GetDriveId()
-		data, err := client.Drives().ByDriveId(driveID).Items().ByDriveItemId(*item.GetId()).Content().Get(ctx, nil)
+		data, err := withThrottling(ctx, logErr, func() ([]byte, error) {
+			return client.Drives().ByDriveId(driveID).Items().ByDriveItemId(id).Content().Get(ctx, nil)
+		})
 		if err != nil {
 			return err
 		}
@@ -268,23 +367,31 @@ func saveToMetadata(ctx context.Context, logErr *logrus.Logger, output *Metadata
 		if err := gptscriptClient.WriteFileInWorkspace(ctx, relativePath, data); err != nil {
 			return err
 		}
+		metadata := itemMetadata(item, itemACL(ctx, logErr, client, driveID, id))
+		if err := writeSidecar(ctx, gptscriptClient, relativePath, metadata); err != nil {
+			return err
+		}
 		logErr.Infof("Downloaded %s", relativePath)
-		detail.UpdatedAt = item.GetLastModifiedDateTime().String()
-		detail.URL = *item.GetWebUrl()
-		detail.FilePath = relativePath
-		output.Files[*item.GetId()] = detail
 	} else {
+		if refreshACL {
+			metadata := itemMetadata(item, itemACL(ctx, logErr, client, *item.GetParentReference().GetDriveId(), id))
+			if err := refreshSidecar(ctx, gptscriptClient, relativePath, metadata); err != nil {
+				return err
+			}
+		}
 		logErr.Infof("Skipping %s because it is not changed", relativePath)
 	}
-	folders[topRootFolder] = struct{}{}
-	output.State.OneDriveState.Files = files
-	output.Status = fmt.Sprintf("Syncing file %v", relativePath)
-	if err := writeMetadata(ctx, output, gptscriptClient); err != nil {
-		return err
-	}
 
-	output.State.OneDriveState.Files = files
-	return nil
+	detail.UpdatedAt = item.GetLastModifiedDateTime().String()
+	detail.URL = *item.GetWebUrl()
+	detail.FilePath = relativePath
+	detail.SizeInBytes = *item.GetSize()
+	detail.Link = link
+	detail.ParentID = parentID
+	output.Files[id] = detail
+
+	output.Status = fmt.Sprintf("Syncing file %v", relativePath)
+	return writeMetadata(ctx, output, gptscriptClient)
 }
 
 func getFullName(item models.DriveItemable) string {
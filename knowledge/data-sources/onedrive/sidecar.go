@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/go-gptscript"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/sirupsen/logrus"
+)
+
+// sidecarSuffix is appended to the path of a file for its metadata sidecar, which the knowledge ingest adds to the metadata of the file.
+const sidecarSuffix = ".knowledge.json"
+
+// sourceMetadata describes a file in OneDrive, so that retrieved chunks can cite it.
+type sourceMetadata struct {
+	URL            string     `json:"url"`
+	Title          string     `json:"title,omitempty"`
+	Author         string     `json:"author,omitempty"`
+	LastModifiedBy string     `json:"lastModifiedBy,omitempty"`
+	LastModified   string     `json:"lastModified,omitempty"`
+	ACL            *sourceACL `json:"acl,omitempty"`
+}
+
+// sourceACL are the principals the file is shared with, in the format of the ACL metadata of the knowledge ingest.
+type sourceACL struct {
+	SourcePermissions []string `json:"sourcePermissions"`
+}
+
+func itemMetadata(item models.DriveItemable, acl *sourceACL) sourceMetadata {
+	metadata := sourceMetadata{
+		URL:   *item.GetWebUrl(),
+		Title: *item.GetName(),
+		ACL:   acl,
+	}
+	if by := item.GetCreatedBy(); by != nil && by.GetUser() != nil && by.GetUser().GetDisplayName() != nil {
+		metadata.Author = *by.GetUser().GetDisplayName()
+	}
+	if by := item.GetLastModifiedBy(); by != nil && by.GetUser() != nil && by.GetUser().GetDisplayName() != nil {
+		metadata.LastModifiedBy = *by.GetUser().GetDisplayName()
+	}
+	if item.GetLastModifiedDateTime() != nil {
+		metadata.LastModified = item.GetLastModifiedDateTime().UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return metadata
+}
+
+// itemACL returns the users and groups the file is shared with. It returns nil if the file is shared with anyone or the
+// whole organization by a link, or if the permissions can't be read, in which case access isn't restricted.
+func itemACL(ctx context.Context, logErr *logrus.Logger, client *msgraphsdk.GraphServiceClient, driveID, id string) *sourceACL {
+	permissions, err := withThrottling(ctx, logErr, func() (models.PermissionCollectionResponseable, error) {
+		return client.Drives().ByDriveId(driveID).Items().ByDriveItemId(id).Permissions().Get(ctx, nil)
+	})
+	if err != nil {
+		logErr.Warnf("Failed to get the permissions of %s, not restricting access: %v", id, err)
+		return nil
+	}
+
+	var principals []string
+	for _, permission := range permissions.GetValue() {
+		if link := permission.GetLink(); link != nil && link.GetScope() != nil && *link.GetScope() != "users" {
+			return nil
+		}
+		identities := permission.GetGrantedToIdentitiesV2()
+		if permission.GetGrantedToV2() != nil {
+			identities = append(identities, permission.GetGrantedToV2())
+		}
+		for _, identity := range identities {
+			if user := identity.GetUser(); user != nil {
+				if email, ok := user.GetAdditionalData()["email"].(*string); ok && email != nil {
+					principals = append(principals, "user:"+*email)
+				} else if user.GetId() != nil {
+					principals = append(principals, "user:"+*user.GetId())
+				}
+			}
+			if group := identity.GetGroup(); group != nil && group.GetId() != nil {
+				principals = append(principals, "group:"+*group.GetId())
+			}
+			if group := identity.GetSiteGroup(); group != nil && group.GetDisplayName() != nil {
+				principals = append(principals, "group:"+*group.GetDisplayName())
+			}
+		}
+	}
+	if len(principals) == 0 {
+		return nil
+	}
+	slices.Sort(principals)
+	return &sourceACL{SourcePermissions: slices.Compact(principals)}
+}
+
+func writeSidecar(ctx context.Context, gptscriptClient *gptscript.GPTScript, filePath string, metadata sourceMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return gptscriptClient.WriteFileInWorkspace(ctx, filePath+sidecarSuffix, data)
+}
+
+// refreshSidecar rewrites the sidecar of a file that wasn't downloaded again, if its metadata (e.g. the ACL) changed.
+// Rewriting an unchanged sidecar would make the file look modified to the ingest.
+func refreshSidecar(ctx context.Context, gptscriptClient *gptscript.GPTScript, filePath string, metadata sourceMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	existing, err := gptscriptClient.ReadFileInWorkspace(ctx, filePath+sidecarSuffix)
+	if err == nil && bytes.Equal(existing, data) {
+		return nil
+	} else if err != nil && !isNotFoundInWorkspace(err) {
+		return err
+	}
+	return gptscriptClient.WriteFileInWorkspace(ctx, filePath+sidecarSuffix, data)
+}
+
+// refreshSidecarACL updates the ACL in the sidecar of a file, e.g. below a folder whose sharing changed.
+func refreshSidecarACL(ctx context.Context, logErr *logrus.Logger, client *msgraphsdk.GraphServiceClient, gptscriptClient *gptscript.GPTScript, driveID, id, filePath string) error {
+	data, err := gptscriptClient.ReadFileInWorkspace(ctx, filePath+sidecarSuffix)
+	if isNotFoundInWorkspace(err) {
+		// written with the file's next download
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var metadata sourceMetadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return err
+	}
+	metadata.ACL = itemACL(ctx, logErr, client, driveID, id)
+	return refreshSidecar(ctx, gptscriptClient, filePath, metadata)
+}
+
+// sharingChanged returns true if the item of a delta response is reported for a change of its permissions.
+func sharingChanged(item models.DriveItemable) bool {
+	switch changed := item.GetAdditionalData()["@microsoft.graph.sharedChanged"].(type) {
+	case *string:
+		return changed != nil && strings.EqualFold(*changed, "true")
+	case *bool:
+		return changed != nil && *changed
+	}
+	return false
+}
+
+// deleteSidecar removes the sidecar of a file, if there is one.
+func deleteSidecar(ctx context.Context, gptscriptClient *gptscript.GPTScript, filePath string) error {
+	if err := gptscriptClient.DeleteFileInWorkspace(ctx, filePath+sidecarSuffix); err != nil && !isNotFoundInWorkspace(err) {
+		return err
+	}
+	return nil
+}
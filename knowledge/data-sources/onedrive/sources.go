@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	url2 "net/url"
+	"path"
+	"strings"
+
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/microsoftgraph/msgraph-sdk-go/models"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultSharePointLibrary = "Documents"
+
+// source is a file or folder to sync. Its state and files are recorded under its key (the link, for shared links).
+type source struct {
+	key string
+	// resolve returns the item of the source and the name of its folder in the workspace
+	resolve func(ctx context.Context) (models.DriveItemable, string, error)
+}
+
+// sources returns the configured shared links, SharePoint libraries, drives and Teams channels.
+func sources(config *OneDriveConfig, client *msgraphsdk.GraphServiceClient, logErr *logrus.Logger) []source {
+	var result []source
+	for _, link := range config.SharedLinks {
+		result = append(result, source{
+			key: link,
+			resolve: func(ctx context.Context) (models.DriveItemable, string, error) {
+				item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+					return client.Shares().BySharedDriveItemId(encodeURL(link)).DriveItem().Get(ctx, nil)
+				})
+				if err != nil {
+					return nil, "", err
+				}
+				return item, *item.GetName(), nil
+			},
+		})
+	}
+
+	for _, library := range config.SharePointLibraries {
+		result = append(result, source{
+			key: library.key(),
+			resolve: func(ctx context.Context) (models.DriveItemable, string, error) {
+				return resolveSharePointLibrary(ctx, logErr, client, library)
+			},
+		})
+	}
+
+	for _, drive := range config.Drives {
+		result = append(result, source{
+			key: drive.key(),
+			resolve: func(ctx context.Context) (models.DriveItemable, string, error) {
+				if drive.FolderPath != "" {
+					item, err := driveItemByPath(ctx, logErr, client, drive.DriveID, drive.FolderPath)
+					if err != nil {
+						return nil, "", err
+					}
+					return item, drive.folder(*item.GetName()), nil
+				}
+				d, err := withThrottling(ctx, logErr, func() (models.Driveable, error) {
+					return client.Drives().ByDriveId(drive.DriveID).Get(ctx, nil)
+				})
+				if err != nil {
+					return nil, "", err
+				}
+				item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+					return client.Drives().ByDriveId(drive.DriveID).Root().Get(ctx, nil)
+				})
+				if err != nil {
+					return nil, "", err
+				}
+				return item, drive.folder(*d.GetName()), nil
+			},
+		})
+	}
+
+	for _, channel := range config.TeamsChannels {
+		result = append(result, source{
+			key: channel.key(),
+			resolve: func(ctx context.Context) (models.DriveItemable, string, error) {
+				item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+					team := client.Teams().ByTeamId(channel.TeamID)
+					if channel.ChannelID == "" {
+						return team.PrimaryChannel().FilesFolder().Get(ctx, nil)
+					}
+					return team.Channels().ByChannelId(channel.ChannelID).FilesFolder().Get(ctx, nil)
+				})
+				if err != nil {
+					return nil, "", err
+				}
+				return item, channel.folder(*item.GetName()), nil
+			},
+		})
+	}
+	return result
+}
+
+func (l SharePointLibrary) key() string {
+	return "sharepoint:" + strings.TrimRight(l.SiteURL, "/") + "#" + path.Join(l.libraryName(), l.FolderPath)
+}
+
+// folder returns the workspace folder of the library (or its folder) with the given name. It is below a folder of the
+// site, as the libraries of different sites usually have the same name.
+func (l SharePointLibrary) folder(name string) string {
+	siteURL, err := url2.Parse(l.SiteURL)
+	if err != nil {
+		return name
+	}
+	return path.Join(siteURL.Host, siteURL.Path, name)
+}
+
+func (l SharePointLibrary) libraryName() string {
+	if l.Library == "" {
+		return defaultSharePointLibrary
+	}
+	return l.Library
+}
+
+func (d DriveFolder) key() string {
+	return "drive:" + d.DriveID + "#" + strings.Trim(d.FolderPath, "/")
+}
+
+// folder returns the workspace folder of the drive (or its folder) with the given name. It is below a folder of the
+// drive ID, as the drives of different users usually have the same name (e.g. OneDrive).
+func (d DriveFolder) folder(name string) string {
+	return path.Join(d.DriveID, name)
+}
+
+func (c TeamsChannel) key() string {
+	return "teams:" + c.TeamID + "#" + c.ChannelID
+}
+
+// folder returns the workspace folder of the channel's files folder with the given name (the channel's name). It is
+// below a folder of the team, as the channels of different teams often have the same name (e.g. General).
+func (c TeamsChannel) folder(name string) string {
+	return path.Join(c.TeamID, name)
+}
+
+// resolveSharePointLibrary returns the root (or folder) of a document library of a SharePoint site.
+func resolveSharePointLibrary(ctx context.Context, logErr *logrus.Logger, client *msgraphsdk.GraphServiceClient, library SharePointLibrary) (models.DriveItemable, string, error) {
+	siteURL, err := url2.Parse(library.SiteURL)
+	if err != nil || siteURL.Host == "" {
+		return nil, "", fmt.Errorf("invalid SharePoint site URL %s", library.SiteURL)
+	}
+
+	site, err := withThrottling(ctx, logErr, func() (models.Siteable, error) {
+		if sitePath := strings.TrimRight(siteURL.Path, "/"); sitePath != "" {
+			return client.Sites().BySiteId(siteURL.Host).GetByPathWithPath(&sitePath).Get(ctx, nil)
+		}
+		return client.Sites().BySiteId(siteURL.Host).Get(ctx, nil)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get SharePoint site %s: %w", library.SiteURL, err)
+	}
+
+	drives, err := withThrottling(ctx, logErr, func() (models.DriveCollectionResponseable, error) {
+		return client.Sites().BySiteId(*site.GetId()).Drives().Get(ctx, nil)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list the document libraries of %s: %w", library.SiteURL, err)
+	}
+	var drive models.Driveable
+	for _, d := range drives.GetValue() {
+		if d.GetName() != nil && strings.EqualFold(*d.GetName(), library.libraryName()) {
+			drive = d
+			break
+		}
+	}
+	if drive == nil {
+		return nil, "", fmt.Errorf("document library %s not found in %s", library.libraryName(), library.SiteURL)
+	}
+
+	if library.FolderPath != "" {
+		item, err := driveItemByPath(ctx, logErr, client, *drive.GetId(), library.FolderPath)
+		if err != nil {
+			return nil, "", err
+		}
+		// the library's name is kept, as folders of different libraries may have the same name
+		return item, library.folder(path.Join(*drive.GetName(), *item.GetName())), nil
+	}
+	item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+		return client.Drives().ByDriveId(*drive.GetId()).Root().Get(ctx, nil)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return item, library.folder(*drive.GetName()), nil
+}
+
+// driveItemByPath returns the item at the path (relative to the root) of a drive.
+func driveItemByPath(ctx context.Context, logErr *logrus.Logger, client *msgraphsdk.GraphServiceClient, driveID, folderPath string) (models.DriveItemable, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(folderPath, "/"), "/") {
+		segments = append(segments, url2.PathEscape(segment))
+	}
+	// the path based address isn't part of the SDK's request builders
+	rawURL := fmt.Sprintf("%s/drives/%s/root:/%s", client.GetAdapter().GetBaseUrl(), url2.PathEscape(driveID), strings.Join(segments, "/"))
+	item, err := withThrottling(ctx, logErr, func() (models.DriveItemable, error) {
+		return client.Drives().ByDriveId(driveID).Items().ByDriveItemId("").WithUrl(rawURL).Get(ctx, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder %s of drive %s: %w", folderPath, driveID, err)
+	}
+	return item, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/microsoft/kiota-abstractions-go/authentication"
+	msgraphsdk "github.com/microsoftgraph/msgraph-sdk-go"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestGraphClient returns a Microsoft Graph client for a fake Graph API.
+func newTestGraphClient(t *testing.T, handler http.HandlerFunc) *msgraphsdk.GraphServiceClient {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	adapter, err := msgraphsdk.NewGraphRequestAdapter(&authentication.AnonymousAuthenticationProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter.SetBaseUrl(srv.URL)
+	return msgraphsdk.NewGraphServiceClient(adapter)
+}
+
+// graphResponses responds with the JSON of the request's path (without the API version).
+func graphResponses(t *testing.T, responses map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, response)
+	}
+}
+
+func newTestLogger() *logrus.Logger {
+	logErr := logrus.New()
+	logErr.SetOutput(io.Discard)
+	return logErr
+}
+
+func TestSourceKeys(t *testing.T) {
+	tests := map[string]string{
+		SharePointLibrary{SiteURL: "https://contoso.sharepoint.com/sites/Marketing/"}.key():                           "sharepoint:https://contoso.sharepoint.com/sites/Marketing#Documents",
+		SharePointLibrary{SiteURL: "https://contoso.sharepoint.com", Library: "Specs", FolderPath: "/2024/Q1/"}.key(): "sharepoint:https://contoso.sharepoint.com#Specs/2024/Q1",
+		DriveFolder{DriveID: "b!abc", FolderPath: "/Specs/"}.key():                                                    "drive:b!abc#Specs",
+		TeamsChannel{TeamID: "team-1"}.key():                                                                          "teams:team-1#",
+		TeamsChannel{TeamID: "team-1", ChannelID: "19:abc@thread.skype"}.key():                                        "teams:team-1#19:abc@thread.skype",
+	}
+	for key, expected := range tests {
+		if key != expected {
+			t.Errorf("expected key %q, got %q", expected, key)
+		}
+	}
+}
+
+func TestSourcesFolders(t *testing.T) {
+	client := newTestGraphClient(t, graphResponses(t, map[string]string{
+		"/sites/contoso.sharepoint.com/getByPath(path='/sites/Marketing')": `{"id": "marketing"}`,
+		"/sites/contoso.sharepoint.com/getByPath(path='/sites/Sales')":     `{"id": "sales"}`,
+		"/sites/marketing/drives":                                `{"value": [{"id": "marketing-docs", "name": "Documents"}]}`,
+		"/sites/sales/drives":                                    `{"value": [{"id": "sales-wiki", "name": "Wiki"}, {"id": "sales-docs", "name": "Documents"}]}`,
+		"/drives/marketing-docs/root":                            `{"id": "marketing-root", "name": "root", "parentReference": {"driveId": "marketing-docs"}}`,
+		"/drives/sales-docs/root":                                `{"id": "sales-root", "name": "root", "parentReference": {"driveId": "sales-docs"}}`,
+		"/drives/sales-docs/root:/Campaigns/2024":                `{"id": "sales-2024", "name": "2024", "parentReference": {"driveId": "sales-docs"}}`,
+		"/drives/b!abc":                                          `{"id": "b!abc", "name": "OneDrive"}`,
+		"/drives/b!abc/root":                                     `{"id": "abc-root", "name": "root", "parentReference": {"driveId": "b!abc"}}`,
+		"/drives/b!def/root:/Specs":                              `{"id": "def-specs", "name": "Specs", "parentReference": {"driveId": "b!def"}}`,
+		"/teams/team-1/primaryChannel/filesFolder":               `{"id": "team-1-general", "name": "General", "parentReference": {"driveId": "team-1-docs"}}`,
+		"/teams/team-2/channels/19:abc@thread.skype/filesFolder": `{"id": "team-2-general", "name": "General", "parentReference": {"driveId": "team-2-docs"}}`,
+	}))
+
+	config := &OneDriveConfig{
+		SharePointLibraries: []SharePointLibrary{
+			{SiteURL: "https://contoso.sharepoint.com/sites/Marketing"},
+			{SiteURL: "https://contoso.sharepoint.com/sites/Sales", Library: "documents"},
+			{SiteURL: "https://contoso.sharepoint.com/sites/Sales", FolderPath: "Campaigns/2024"},
+		},
+		Drives: []DriveFolder{
+			{DriveID: "b!abc"},
+			{DriveID: "b!def", FolderPath: "Specs"},
+		},
+		TeamsChannels: []TeamsChannel{
+			{TeamID: "team-1"},
+			{TeamID: "team-2", ChannelID: "19:abc@thread.skype"},
+		},
+	}
+	expected := []struct{ itemID, folder string }{
+		{"marketing-root", "contoso.sharepoint.com/sites/Marketing/Documents"},
+		{"sales-root", "contoso.sharepoint.com/sites/Sales/Documents"},
+		{"sales-2024", "contoso.sharepoint.com/sites/Sales/Documents/2024"},
+		{"abc-root", "b!abc/OneDrive"},
+		{"def-specs", "b!def/Specs"},
+		{"team-1-general", "team-1/General"},
+		{"team-2-general", "team-2/General"},
+	}
+
+	srcs := sources(config, client, newTestLogger())
+	if len(srcs) != len(expected) {
+		t.Fatalf("expected %d sources, got %d", len(expected), len(srcs))
+	}
+	for i, src := range srcs {
+		item, folder, err := src.resolve(context.Background())
+		if err != nil {
+			t.Errorf("failed to resolve %s: %v", src.key, err)
+			continue
+		}
+		if *item.GetId() != expected[i].itemID || folder != expected[i].folder {
+			t.Errorf("expected %s to resolve to %s in %s, got %s in %s", src.key, expected[i].itemID, expected[i].folder, *item.GetId(), folder)
+		}
+	}
+
+	missing := sources(&OneDriveConfig{SharePointLibraries: []SharePointLibrary{{SiteURL: "https://contoso.sharepoint.com/sites/Marketing", Library: "Wiki"}}}, client, newTestLogger())
+	if _, _, err := missing[0].resolve(context.Background()); err == nil {
+		t.Error("expected an error for a missing library")
+	}
+	invalid := sources(&OneDriveConfig{SharePointLibraries: []SharePointLibrary{{SiteURL: "contoso"}}}, client, newTestLogger())
+	if _, _, err := invalid[0].resolve(context.Background()); err == nil {
+		t.Error("expected an error for an invalid site URL")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	url2 "net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gobwas/glob"
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// hostAuth holds the (expanded) credentials of a HostAuth.
+type hostAuth struct {
+	hosts   []glob.Glob
+	header  http.Header
+	cookies []*http.Cookie
+	login   *FormLogin
+}
+
+func (h *hostAuth) matches(host string) bool {
+	host = strings.ToLower(host)
+	return slices.ContainsFunc(h.hosts, func(g glob.Glob) bool { return g.Match(host) })
+}
+
+// authenticator adds the configured credentials to the requests to their hosts and keeps the session cookies,
+// e.g. of a form login, in a cookie jar shared by all clients of a crawl.
+type authenticator struct {
+	auths []*hostAuth
+	jar   *cookiejar.Jar
+}
+
+// newAuthenticator expands the ${VAR} references in the auth configs with the env of their gptscript credential
+// (or the environment, which gptscript credential tools populate).
+func newAuthenticator(ctx context.Context, configs []HostAuth, gptscriptClient *gptscript.GPTScript) (*authenticator, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	a := &authenticator{jar: jar}
+
+	for _, config := range configs {
+		if len(config.Hosts) == 0 {
+			return nil, fmt.Errorf("auth config without hosts")
+		}
+
+		credentialEnv := map[string]string{}
+		if config.Credential != "" {
+			credential, err := gptscriptClient.RevealCredential(ctx, config.CredentialContexts, config.Credential)
+			if err != nil {
+				return nil, fmt.Errorf("failed to reveal credential %s: %w", config.Credential, err)
+			}
+			credentialEnv = credential.Env
+		}
+		expand := func(s string) string {
+			return os.Expand(s, func(key string) string {
+				if v, ok := credentialEnv[key]; ok {
+					return v
+				}
+				return os.Getenv(key)
+			})
+		}
+
+		h := &hostAuth{header: http.Header{}}
+		for _, host := range config.Hosts {
+			g, err := glob.Compile(strings.ToLower(host), '.')
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth host %q: %w", host, err)
+			}
+			h.hosts = append(h.hosts, g)
+		}
+		for key, value := range config.Headers {
+			h.header.Set(key, expand(value))
+		}
+		if config.BearerToken != "" {
+			h.header.Set("Authorization", "Bearer "+expand(config.BearerToken))
+		}
+		if config.Username != "" {
+			req := &http.Request{Header: http.Header{}}
+			req.SetBasicAuth(expand(config.Username), expand(config.Password))
+			h.header.Set("Authorization", req.Header.Get("Authorization"))
+		}
+		for name, value := range config.Cookies {
+			h.cookies = append(h.cookies, &http.Cookie{Name: name, Value: expand(value)})
+		}
+		if config.Login != nil {
+			login := &FormLogin{URL: expand(config.Login.URL), PageURL: expand(config.Login.PageURL), Fields: map[string]string{}}
+			for key, value := range config.Login.Fields {
+				login.Fields[key] = expand(value)
+			}
+			h.login = login
+		}
+		a.auths = append(a.auths, h)
+	}
+	return a, nil
+}
+
+// forHost returns the auth config of the host, or nil.
+func (a *authenticator) forHost(host string) *hostAuth {
+	for _, h := range a.auths {
+		if h.matches(host) {
+			return h
+		}
+	}
+	return nil
+}
+
+// cookies returns the session and configured cookies for the URL, e.g. to pass them to the headless browser.
+func (a *authenticator) cookies(u *url2.URL) []*http.Cookie {
+	cookies := a.jar.Cookies(u)
+	if h := a.forHost(u.Hostname()); h != nil {
+		cookies = append(cookies, h.cookies...)
+	}
+	return cookies
+}
+
+// headers returns the configured headers for the URL (e.g. Authorization), to pass them to the headless browser.
+func (a *authenticator) headers(u *url2.URL) http.Header {
+	if h := a.forHost(u.Hostname()); h != nil {
+		return h.header
+	}
+	return nil
+}
+
+// transport returns a RoundTripper adding the auth headers and cookies of the request's host.
+func (a *authenticator) transport(base http.RoundTripper) http.RoundTripper {
+	if len(a.auths) == 0 {
+		return base
+	}
+	return &authTransport{base: base, auth: a}
+}
+
+// login runs the form logins, whose session cookies are kept in the jar.
+func (a *authenticator) login(ctx context.Context, client *http.Client, userAgent string, logOut *logrus.Logger) error {
+	for _, h := range a.auths {
+		if h.login == nil {
+			continue
+		}
+
+		fields := url2.Values{}
+		for key, value := range h.login.Fields {
+			fields.Set(key, value)
+		}
+		if h.login.PageURL != "" {
+			// the login page sets the session cookie and hidden fields, like CSRF tokens
+			hidden, err := loginPageFields(ctx, client, h.login.PageURL, userAgent)
+			if err != nil {
+				return fmt.Errorf("failed to load login page %s: %w", h.login.PageURL, err)
+			}
+			for key, value := range hidden {
+				if !fields.Has(key) {
+					fields.Set(key, value)
+				}
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.login.URL, strings.NewReader(fields.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", userAgent)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to log in at %s: %w", h.login.URL, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("failed to log in at %s: status code %d", h.login.URL, resp.StatusCode)
+		}
+		logOut.Infof("logged in at %s", h.login.URL)
+	}
+	return nil
+}
+
+// loginPageFields returns the hidden fields of the forms on the login page.
+func loginPageFields(ctx context.Context, client *http.Client, pageURL, userAgent string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]string{}
+	doc.Find(`form input[type="hidden"]`).Each(func(_ int, s *goquery.Selection) {
+		if name := s.AttrOr("name", ""); name != "" {
+			fields[name] = s.AttrOr("value", "")
+		}
+	})
+	return fields, nil
+}
+
+// authTransport adds credentials to the requests to the hosts they are configured for, and to no others
+// (also not when redirected).
+type authTransport struct {
+	base http.RoundTripper
+	auth *authenticator
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h := t.auth.forHost(req.URL.Hostname())
+	if h == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	for key, values := range h.header {
+		if req.Header.Get(key) == "" {
+			req.Header[key] = values
+		}
+	}
+	for _, cookie := range h.cookies {
+		if _, err := req.Cookie(cookie.Name); err != nil {
+			req.AddCookie(cookie)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
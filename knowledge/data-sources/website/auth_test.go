@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthenticator(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("WIKI_TOKEN", "secret-token")
+	t.Setenv("WIKI_PASSWORD", "secret-password")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: "pre-session", Value: "1"})
+			fmt.Fprint(w, `<html><body><form method="post"><input type="hidden" name="csrf" value="abc"><input name="password"></form></body></html>`)
+			return
+		}
+		_ = r.ParseForm()
+		if _, err := r.Cookie("pre-session"); err != nil || r.PostForm.Get("csrf") != "abc" || r.PostForm.Get("password") != "secret-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "valid"})
+	})
+	mux.HandleFunc("/wiki", func(w http.ResponseWriter, r *http.Request) {
+		session, err := r.Cookie("session")
+		if err != nil || session.Value != "valid" || r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "wiki")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	u, _ := url2.Parse(srv.URL)
+
+	auth, err := newAuthenticator(ctx, []HostAuth{{
+		Hosts:       []string{u.Hostname()},
+		BearerToken: "${WIKI_TOKEN}",
+		Login: &FormLogin{
+			URL:     srv.URL + "/login",
+			PageURL: srv.URL + "/login",
+			Fields:  map[string]string{"password": "${WIKI_PASSWORD}"},
+		},
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+	client := &http.Client{Transport: auth.transport(http.DefaultTransport), Jar: auth.jar}
+	if err := auth.login(ctx, client, defaultUserAgent, logOut); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get(srv.URL + "/wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the authenticated request to succeed, got status code %d", resp.StatusCode)
+	}
+
+	if auth.forHost("other.example.com") != nil {
+		t.Error("expected no credentials for other hosts")
+	}
+	// the headless browser gets the same headers, but only for the configured hosts
+	if got := auth.headers(u).Get("Authorization"); got != "Bearer secret-token" {
+		t.Errorf("expected the bearer token for the browser, got %q", got)
+	}
+	if headers := auth.headers(&url2.URL{Scheme: "https", Host: "other.example.com"}); headers != nil {
+		t.Errorf("expected no headers for other hosts, got %v", headers)
+	}
+	if _, err := newAuthenticator(ctx, []HostAuth{{BearerToken: "token"}}, nil); err == nil {
+		t.Error("expected an error for credentials without hosts")
+	}
+}
@@ -6,13 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	url2 "net/url"
 	"path"
-	"path/filepath"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/gocolly/colly"
 	"github.com/gptscript-ai/go-gptscript"
@@ -22,9 +20,39 @@ import (
 func crawlColly(ctx context.Context, input *MetadataInput, output *MetadataOutput, logOut *logrus.Logger, gptscript *gptscript.GPTScript) error {
 	visited := make(map[string]struct{})
 	folders := make(map[string]struct{})
+	auth, err := newAuthenticator(ctx, input.WebsiteCrawlingConfig.Auth, gptscript)
+	if err != nil {
+		return err
+	}
+	policies := newHostPolicies(input.WebsiteCrawlingConfig, logOut)
+	policies.client.Transport, policies.client.Jar = auth.transport(http.DefaultTransport), auth.jar
+	if err := auth.login(ctx, policies.client, policies.userAgent, logOut); err != nil {
+		return err
+	}
+	stored, err := listWorkspaceFiles(ctx, gptscript)
+	if err != nil {
+		return err
+	}
+	renderer := newRenderer(ctx, input.WebsiteCrawlingConfig.Render, policies, auth, logOut)
+	if renderer != nil {
+		defer renderer.close()
+	}
 
 	for _, url := range input.WebsiteCrawlingConfig.URLs {
-		if err := scrape(ctx, logOut, output, gptscript, visited, folders, url, input.Limit); err != nil {
+		baseURL, err := url2.Parse(url)
+		if err != nil {
+			return fmt.Errorf("invalid URL %s: %w", url, err)
+		}
+		scope, err := newCrawlScope(baseURL, input.WebsiteCrawlingConfig)
+		if err != nil {
+			return err
+		}
+
+		var pages []sitemapEntry
+		if !input.WebsiteCrawlingConfig.DisableSitemaps {
+			pages = discoverSitemapPages(ctx, logOut, policies, scope, input.WebsiteCrawlingConfig.SitemapURLs)
+		}
+		if err := scrape(ctx, logOut, output, gptscript, stored, policies, auth, renderer, scope, visited, folders, url, pages, input.Limit, input.WebsiteCrawlingConfig.MaxDepth); err != nil {
 			return fmt.Errorf("failed to scrape %s: %w", url, err)
 		}
 	}
@@ -35,6 +63,9 @@ func crawlColly(ctx context.Context, input *MetadataInput, output *MetadataOutpu
 			if err := gptscript.DeleteFileInWorkspace(ctx, file.FilePath); err != nil {
 				return err
 			}
+			if err := deleteSidecar(ctx, gptscript, file.FilePath); err != nil {
+				return err
+			}
 			delete(output.Files, p)
 		}
 	}
@@ -43,8 +74,76 @@ func crawlColly(ctx context.Context, input *MetadataInput, output *MetadataOutpu
 	return writeMetadata(ctx, output, gptscript)
 }
 
-func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, gptscriptClient *gptscript.GPTScript, visited map[string]struct{}, folders map[string]struct{}, url string, limit int) error {
+func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, gptscriptClient *gptscript.GPTScript, stored workspaceFiles, policies *hostPolicies, auth *authenticator, renderer *renderer, scope *crawlScope, visited map[string]struct{}, folders map[string]struct{}, url string, sitemapPages []sitemapEntry, limit, maxDepth int) error {
+	sitemapLastMods := make(map[string]string, len(sitemapPages))
+	for _, page := range sitemapPages {
+		sitemapLastMods[page.Loc] = page.LastMod
+	}
+
+	// links followed from each page, recorded so that they can be followed again when the page is not modified
+	pageLinks := make(map[string][]string)
+
 	collector := colly.NewCollector()
+	collector.UserAgent = policies.userAgent
+	if maxDepth > 0 {
+		collector.MaxDepth = maxDepth + 1 // the start URL has depth 1
+	}
+	collector.MaxBodySize = int(scope.maxDocumentSize) + 1
+	collector.SetCookieJar(auth.jar)
+	transport := auth.transport(http.DefaultTransport)
+	if renderer != nil {
+		transport = &renderingTransport{base: transport, render: renderer.render, maxBodySize: scope.maxDocumentSize, logOut: logOut}
+	}
+	collector.WithTransport(transport)
+	collector.OnRequest(func(r *colly.Request) {
+		if !policies.allowed(ctx, r.URL) {
+			logOut.Infof("skipping %s because it is disallowed by robots.txt", r.URL.String())
+			r.Abort()
+			return
+		}
+		if err := policies.wait(ctx, r.URL); err != nil {
+			r.Abort()
+			return
+		}
+		filePath := urlToFilePath(r.URL)
+		if details, ok := output.Files[filePath]; ok && stored.exists(filePath) {
+			for key, values := range conditionalHeaders(details) {
+				(*r.Headers)[key] = values
+			}
+		}
+	})
+	collector.OnError(func(r *colly.Response, err error) {
+		if r.StatusCode != http.StatusNotModified {
+			logOut.Infof("failed to scrape %s: %v", r.Request.URL.String(), err)
+			return
+		}
+		filePath := urlToFilePath(r.Request.URL)
+		if _, ok := visited[filePath]; ok {
+			return
+		}
+		visited[filePath] = struct{}{}
+		output.Status = fmt.Sprintf("Skipping %s because it has not changed", r.Request.URL.String())
+		logOut.Infof("skipping %s because it was not modified", r.Request.URL.String())
+		followStoredLinks(ctx, logOut, output, gptscriptClient, stored, policies, scope, visited, filePath, limit, r.Request.Visit)
+	})
+	// documents (e.g. a start URL or sitemap page without a document extension) are stored as they are
+	collector.OnResponse(func(r *colly.Response) {
+		ext := detectDocumentType(*r.Headers, r.Request.URL)
+		if ext == "" {
+			return
+		}
+		filePath := documentFilePath(r.Request.URL, scope.baseURL, ext)
+		if _, ok := visited[filePath]; ok {
+			return
+		}
+		if len(r.Body) > int(scope.maxDocumentSize) {
+			logOut.Infof("skipping %s because it is larger than %d bytes", r.Request.URL.String(), scope.maxDocumentSize)
+			return
+		}
+		if err := storeDocument(ctx, logOut, output, visited, gptscriptClient, stored, filePath, r.Request.URL, r.Body, *r.Headers); err != nil {
+			logOut.Infof("Failed to scrape document %s: %v", r.Request.URL.String(), err)
+		}
+	})
 	collector.OnHTML("body", func(e *colly.HTMLElement) {
 		html, err := e.DOM.Html()
 		if err != nil {
@@ -52,45 +151,17 @@ func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput,
 			return
 		}
 		hostname := e.Request.URL.Hostname()
-		urlPathWithQuery := e.Request.URL.Path
-		if e.Request.URL.RawQuery != "" {
-			urlPathWithQuery += "?" + url2.QueryEscape(e.Request.URL.RawQuery)
-		}
-
-		var filePath string
-		if urlPathWithQuery == "" {
-			filePath = path.Join(hostname, "index.html")
-		} else {
-			trimmedPath := strings.Trim(urlPathWithQuery, "/")
-			if trimmedPath == "" {
-				filePath = path.Join(hostname, "index.html")
-			} else {
-				segments := strings.Split(trimmedPath, "/")
-				fileName := segments[len(segments)-1] + ".html"
-				filePath = path.Join(hostname, strings.Join(segments[:len(segments)-1], "/"), fileName)
-			}
-		}
+		filePath := urlToFilePath(e.Request.URL)
 		if _, ok := visited[filePath]; ok {
 			return
 		}
 
 		logOut.Infof("scraping %s", e.Request.URL.String())
-		fileNotExists := false
-		var notFoundError *gptscript.NotFoundInWorkspaceError
-		if _, err := gptscriptClient.ReadFileInWorkspace(ctx, filePath); errors.As(err, &notFoundError) {
-			fileNotExists = true
-		}
+		fileNotExists := !stored.exists(filePath)
 
 		etag := e.Response.Headers.Get("ETag")
 		lastModified := e.Response.Headers.Get("Last-Modified")
-		var updatedAt string
-		if etag != "" {
-			updatedAt = etag
-		} else if lastModified != "" {
-			updatedAt = lastModified
-		} else {
-			updatedAt = time.Now().Format(time.RFC3339)
-		}
+		updatedAt := updatedAtFromValidators(etag, lastModified)
 
 		defer func() {
 			if err := writeMetadata(ctx, output, gptscriptClient); err != nil {
@@ -98,7 +169,14 @@ func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput,
 			}
 		}()
 
-		if updatedAt == output.Files[e.Request.URL.String()].UpdatedAt && !fileNotExists {
+		sitemapLastMod := sitemapLastMods[e.Request.URL.String()]
+		if details, ok := output.Files[filePath]; ok {
+			// keep the validators up to date for the conditional request of the next crawl
+			details.ETag, details.LastModified = etag, lastModified
+			output.Files[filePath] = details
+		}
+		if updatedAt == output.Files[filePath].UpdatedAt && !fileNotExists {
+			visited[filePath] = struct{}{}
 			output.Status = fmt.Sprintf("Skipping %s because it has not changed", e.Request.URL.String())
 			logOut.Infof("skipping %s because it has not changed for etag/last-modified: %s/%s", e.Request.URL.String(), etag, lastModified)
 			return
@@ -109,7 +187,8 @@ func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput,
 			logOut.Errorf("Failed to get checksum for %s: %v", e.Request.URL.String(), err)
 			return
 		}
-		if checksum == output.Files[e.Request.URL.String()].Checksum && !fileNotExists {
+		if checksum == output.Files[filePath].Checksum && !fileNotExists {
+			visited[filePath] = struct{}{}
 			output.Status = fmt.Sprintf("Skipping %s because it has not changed", e.Request.URL.String())
 			logOut.Infof("skipping %s because it has not changed", e.Request.URL.String())
 			return
@@ -119,15 +198,26 @@ func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput,
 			logOut.Errorf("Failed to write file %s: %v", filePath, err)
 			return
 		}
+		pageLastModified := lastModified
+		if pageLastModified == "" {
+			pageLastModified = sitemapLastMod
+		}
+		metadata := pageMetadata(e.DOM.Parent(), e.Request.URL.String(), pageLastModified)
+		if err := writeSidecar(ctx, gptscriptClient, filePath, metadata); err != nil {
+			logOut.Errorf("Failed to write metadata sidecar of %s: %v", filePath, err)
+		}
 
 		visited[filePath] = struct{}{}
 
 		output.Files[filePath] = FileDetails{
-			FilePath:    filePath,
-			URL:         e.Request.URL.String(),
-			UpdatedAt:   updatedAt,
-			Checksum:    checksum,
-			SizeInBytes: int64(len([]byte(html))),
+			FilePath:       filePath,
+			URL:            e.Request.URL.String(),
+			UpdatedAt:      updatedAt,
+			Checksum:       checksum,
+			SizeInBytes:    int64(len([]byte(html))),
+			SitemapLastMod: sitemapLastMod,
+			ETag:           etag,
+			LastModified:   lastModified,
 		}
 
 		folders[hostname] = struct{}{}
@@ -141,61 +231,110 @@ func scrape(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput,
 			return
 		}
 
-		baseURL, err := url2.Parse(url)
+		linkURL, err := e.Request.URL.Parse(link)
 		if err != nil {
-			logOut.Infof("Invalid base URL: %v", err)
+			logOut.Infof("Invalid link URL %s: %v", link, err)
 			return
 		}
-		linkURL, err := url2.Parse(link)
+		linkURL = scope.normalize(linkURL)
+		if followLink(ctx, logOut, output, gptscriptClient, stored, policies, scope, visited, linkURL, e.Request.Visit) {
+			from := e.Request.URL.String()
+			if link := linkURL.String(); !slices.Contains(pageLinks[from], link) {
+				pageLinks[from] = append(pageLinks[from], link)
+			}
+		}
+	})
+	collector.OnScraped(func(r *colly.Response) {
+		from := r.Request.URL.String()
+		filePath := urlToFilePath(r.Request.URL)
+		if details, ok := output.Files[filePath]; ok {
+			details.Links = pageLinks[from]
+			output.Files[filePath] = details
+		}
+		delete(pageLinks, from)
+	})
+	if err := collector.Visit(url); err != nil && !isNotModified(err) {
+		return err
+	}
+
+	// Pages from the sitemaps, which weren't found by following links - unchanged ones (according to their lastmod) are skipped
+	for _, page := range sitemapPages {
+		if len(visited) >= limit {
+			break
+		}
+		pageURL, err := url2.Parse(page.Loc)
 		if err != nil {
-			logOut.Infof("Invalid link URL %s: %v", link, err)
-			return
+			continue
 		}
-		if _, ok := visited[linkURL.String()]; ok {
-			return
+		filePath := urlToFilePath(pageURL)
+		if _, ok := visited[filePath]; ok {
+			continue
 		}
-		if strings.ToLower(path.Ext(linkURL.Path)) == ".pdf" {
-			if err := scrapePDF(ctx, logOut, output, visited, linkURL, baseURL, gptscriptClient); err != nil {
-				logOut.Infof("Failed to scrape PDF %s: %v", linkURL.String(), err)
-			}
-		} else {
-			// don't scrape if linkURL link to external host
-			if linkURL.Host != "" && !isSameDomainOrSubdomain(linkURL.Host, baseURL.Host) {
-				return
-			}
+		if existing, ok := output.Files[filePath]; ok && unchangedSince(page.LastMod, existing.SitemapLastMod) && stored.exists(filePath) {
+			logOut.Infof("skipping %s because it has not changed since %s", page.Loc, existing.SitemapLastMod)
+			visited[filePath] = struct{}{}
+			followStoredLinks(ctx, logOut, output, gptscriptClient, stored, policies, scope, visited, filePath, limit, collector.Visit)
+			continue
+		}
+		if err := collector.Visit(page.Loc); err != nil && !errors.Is(err, colly.ErrAlreadyVisited) && !isNotModified(err) {
+			logOut.Infof("failed to scrape %s: %v", page.Loc, err)
+		}
+	}
+	return nil
+}
 
-			// if linkURL has absolute path, and it doesn't match baseURL, skip
-			if strings.HasPrefix(linkURL.Path, "/") && !strings.HasPrefix(linkURL.Path, baseURL.Path) {
-				return
-			}
+// followLink downloads a document or visits a page that is in the crawl scope. It returns false if the link isn't followed.
+func followLink(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, gptscriptClient *gptscript.GPTScript, stored workspaceFiles, policies *hostPolicies, scope *crawlScope, visited map[string]struct{}, linkURL *url2.URL, visit func(string) error) bool {
+	if documentExt(linkURL.Path) != "" {
+		if scope.excluded(linkURL) {
+			return false
+		}
+		if err := scrapeDocument(ctx, logOut, output, policies, scope, visited, linkURL, gptscriptClient, stored); err != nil {
+			logOut.Infof("Failed to scrape document %s: %v", linkURL.String(), err)
+		}
+		return true
+	}
+	if !scope.allows(linkURL) {
+		return false
+	}
+	_ = visit(linkURL.String())
+	return true
+}
 
-			// if it is relative path, join with current path and check again
-			finalPath := filepath.Clean(filepath.Join(e.Request.URL.Path, linkURL.Path))
+// followStoredLinks follows the links recorded for a page that wasn't downloaded again because it has not changed,
+// so that the pages and documents only reachable through it are still crawled (and not removed).
+func followStoredLinks(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, gptscriptClient *gptscript.GPTScript, stored workspaceFiles, policies *hostPolicies, scope *crawlScope, visited map[string]struct{}, filePath string, limit int, visit func(string) error) {
+	for _, link := range output.Files[filePath].Links {
+		if len(visited) >= limit {
+			return
+		}
+		linkURL, err := url2.Parse(link)
+		if err != nil {
+			continue
+		}
+		followLink(ctx, logOut, output, gptscriptClient, stored, policies, scope, visited, linkURL, visit)
+	}
+}
 
-			if !strings.HasPrefix(finalPath, baseURL.Path) {
-				return
-			}
+// isNotModified returns true for the error colly returns for a 304 response, which is handled by the OnError callback.
+func isNotModified(err error) bool {
+	return err != nil && err.Error() == http.StatusText(http.StatusNotModified)
+}
 
-			if linkURL.Host == "" && !strings.HasPrefix(link, "#") {
-				if !strings.HasSuffix(baseURL.Path, "/") {
-					baseURL.Path += "/"
-				}
-				fullLink := baseURL.ResolveReference(linkURL).String()
-				parsedLink, err := url2.Parse(fullLink)
-				if err != nil {
-					logOut.Infof("Invalid link URL %s: %v", link, err)
-					return
-				}
-				// don't scrape duplicate pages for homepage, for example, https://www.acorn.io and https://www.acorn.io/
-				if parsedLink.Path == "/" {
-					parsedLink.Path = ""
-				}
-				linkURL = parsedLink
-			}
-			e.Request.Visit(linkURL.String())
-		}
-	})
-	return collector.Visit(url)
+// urlToFilePath returns the workspace path of the file a page is stored in.
+func urlToFilePath(u *url2.URL) string {
+	urlPathWithQuery := u.Path
+	if u.RawQuery != "" {
+		urlPathWithQuery += "?" + url2.QueryEscape(u.RawQuery)
+	}
+
+	trimmedPath := strings.Trim(urlPathWithQuery, "/")
+	if trimmedPath == "" {
+		return path.Join(u.Hostname(), "index.html")
+	}
+	segments := strings.Split(trimmedPath, "/")
+	fileName := segments[len(segments)-1] + ".html"
+	return path.Join(u.Hostname(), strings.Join(segments[:len(segments)-1], "/"), fileName)
 }
 
 func isSameDomainOrSubdomain(linkHostname, baseHostname string) bool {
@@ -225,76 +364,6 @@ func isSameDomainOrSubdomain(linkHostname, baseHostname string) bool {
 	return false
 }
 
-func scrapePDF(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, visited map[string]struct{}, linkURL *url2.URL, baseURL *url2.URL, gptscript *gptscript.GPTScript) error {
-	if linkURL.Host == "" {
-		var err error
-		fullLink := baseURL.ResolveReference(linkURL).String()
-		linkURL, err = url2.Parse(fullLink)
-		if err != nil {
-			return fmt.Errorf("invalid link URL %s: %v", fullLink, err)
-		}
-	}
-	filePath := path.Join(linkURL.Host, strings.TrimPrefix(linkURL.Path, "/"))
-	if !isSameDomainOrSubdomain(linkURL.Host, baseURL.Host) {
-		filePath = path.Join(baseURL.Host, filePath)
-	}
-	if _, ok := visited[filePath]; ok {
-		return nil
-	}
-
-	logOut.Infof("downloading PDF %s", linkURL.String())
-	resp, err := http.Get(linkURL.String())
-	if err != nil {
-		return fmt.Errorf("failed to download PDF %s: %v", linkURL.String(), err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download PDF %s: status code %d", linkURL.String(), resp.StatusCode)
-	}
-
-	if resp.Header.Get("Content-Type") != "application/pdf" {
-		logOut.Infof("skipping %s because it is not a PDF (likely redirect on old link)", linkURL.String())
-		return nil
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read PDF %s: %v", linkURL.String(), err)
-	}
-
-	newChecksum, err := getChecksum(data)
-	if err != nil {
-		return fmt.Errorf("failed to calculate checksum: %v", err)
-	}
-
-	if fileDetails, exists := output.Files[linkURL.String()]; exists {
-		if fileDetails.Checksum == newChecksum {
-			logOut.Infof("PDF %s has not been modified", linkURL.String())
-			return nil
-		}
-	}
-
-	if err := gptscript.WriteFileInWorkspace(ctx, filePath, data); err != nil {
-		return fmt.Errorf("failed to write PDF %s: %v", linkURL.String(), err)
-	}
-
-	visited[filePath] = struct{}{}
-
-	output.Status = fmt.Sprintf("Scraped %v", linkURL.String())
-	output.Files[filePath] = FileDetails{
-		FilePath:    filePath,
-		URL:         linkURL.String(),
-		UpdatedAt:   time.Now().String(),
-		Checksum:    newChecksum,
-		SizeInBytes: int64(len(data)),
-	}
-
-	if err := writeMetadata(ctx, output, gptscript); err != nil {
-		return fmt.Errorf("failed to write metadata: %v", err)
-	}
-	return nil
-}
-
 func getChecksum(content []byte) (string, error) {
 	hash := sha256.New()
 	_, err := hash.Write(content)
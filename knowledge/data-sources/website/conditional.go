@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/go-gptscript"
+)
+
+// conditionalHeaders returns the If-None-Match and If-Modified-Since headers to revalidate a previously downloaded file.
+// Files recorded before the validators were stored separately only have UpdatedAt, which holds the ETag or Last-Modified.
+func conditionalHeaders(details FileDetails) http.Header {
+	etag, lastModified := details.ETag, details.LastModified
+	if etag == "" && lastModified == "" && details.UpdatedAt != "" {
+		if strings.HasPrefix(details.UpdatedAt, `"`) || strings.HasPrefix(details.UpdatedAt, `W/"`) {
+			etag = details.UpdatedAt
+		} else if _, err := http.ParseTime(details.UpdatedAt); err == nil {
+			lastModified = details.UpdatedAt
+		}
+	}
+
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	return header
+}
+
+// updatedAtFromValidators returns the UpdatedAt of a download: its ETag, else its Last-Modified, else the current time.
+func updatedAtFromValidators(etag, lastModified string) string {
+	if etag != "" {
+		return etag
+	} else if lastModified != "" {
+		return lastModified
+	}
+	return time.Now().Format(time.RFC3339)
+}
+
+// workspaceFiles is the set of files in the workspace, listed once per crawl, to tell which of the recorded files
+// can be revalidated without reading them.
+type workspaceFiles map[string]struct{}
+
+// listWorkspaceFiles lists the files in the workspace.
+func listWorkspaceFiles(ctx context.Context, lister interface {
+	ListFilesInWorkspace(ctx context.Context, opts ...gptscript.ListFilesInWorkspaceOptions) ([]string, error)
+}) (workspaceFiles, error) {
+	files, err := lister.ListFilesInWorkspace(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspace files: %w", err)
+	}
+	stored := make(workspaceFiles, len(files))
+	for _, file := range files {
+		stored[file] = struct{}{}
+	}
+	return stored, nil
+}
+
+// exists returns true if the file was in the workspace when the crawl started.
+func (w workspaceFiles) exists(filePath string) bool {
+	_, ok := w[filePath]
+	return ok
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"testing"
+
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+func TestConditionalHeaders(t *testing.T) {
+	tests := []struct {
+		name                         string
+		details                      FileDetails
+		ifNoneMatch, ifModifiedSince string
+	}{
+		{"validators", FileDetails{ETag: `"abc"`, LastModified: "Wed, 01 May 2024 10:00:00 GMT"}, `"abc"`, "Wed, 01 May 2024 10:00:00 GMT"},
+		{"legacy etag", FileDetails{UpdatedAt: `W/"abc"`}, `W/"abc"`, ""},
+		{"legacy last-modified", FileDetails{UpdatedAt: "Wed, 01 May 2024 10:00:00 GMT"}, "", "Wed, 01 May 2024 10:00:00 GMT"},
+		{"legacy download time", FileDetails{UpdatedAt: "2024-05-01T10:00:00Z"}, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := conditionalHeaders(test.details)
+			if v := header.Get("If-None-Match"); v != test.ifNoneMatch {
+				t.Errorf("expected If-None-Match %q, got %q", test.ifNoneMatch, v)
+			}
+			if v := header.Get("If-Modified-Since"); v != test.ifModifiedSince {
+				t.Errorf("expected If-Modified-Since %q, got %q", test.ifModifiedSince, v)
+			}
+		})
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("%PDF-1.4"))
+	}))
+	defer srv.Close()
+
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+	policies := newHostPolicies(WebsiteCrawlingConfig{IgnoreRobotsTxt: true}, logOut)
+	u, _ := url2.Parse(srv.URL + "/docs/guide.pdf")
+
+	resp, err := policies.get(context.Background(), u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	details := FileDetails{ETag: resp.Header.Get("ETag")}
+	if resp.StatusCode != http.StatusOK || details.ETag != `"v1"` {
+		t.Fatalf("unexpected response %d with etag %q", resp.StatusCode, details.ETag)
+	}
+
+	resp, err = policies.get(context.Background(), u, conditionalHeaders(details))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected status %d, got %d", http.StatusNotModified, resp.StatusCode)
+	}
+}
+
+type fakeLister []string
+
+func (l fakeLister) ListFilesInWorkspace(context.Context, ...gptscript.ListFilesInWorkspaceOptions) ([]string, error) {
+	if l == nil {
+		return nil, errors.New("workspace unavailable")
+	}
+	return l, nil
+}
+
+func TestWorkspaceFiles(t *testing.T) {
+	stored, err := listWorkspaceFiles(context.Background(), fakeLister{"example.com/index.html", "example.com/index.html.knowledge.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stored.exists("example.com/index.html") {
+		t.Error("expected the listed file to exist")
+	}
+	if stored.exists("example.com/docs/index.html") {
+		t.Error("expected a file that isn't listed not to exist")
+	}
+
+	if _, err := listWorkspaceFiles(context.Background(), fakeLister(nil)); err == nil {
+		t.Error("expected an error if the workspace can't be listed")
+	}
+}
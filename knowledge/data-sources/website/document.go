@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	url2 "net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/go-gptscript"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxDocumentSize is the size limit of downloaded documents, unless configured otherwise
+const defaultMaxDocumentSize = 50 << 20
+
+// documentTypes are the (linked) documents the knowledge engine can ingest, by extension and content types
+var documentTypes = []struct {
+	ext          string
+	contentTypes []string
+}{
+	{".pdf", []string{"application/pdf"}},
+	{".docx", []string{"application/vnd.openxmlformats-officedocument.wordprocessingml.document"}},
+	{".pptx", []string{"application/vnd.openxmlformats-officedocument.presentationml.presentation"}},
+	{".csv", []string{"text/csv", "application/csv"}},
+	{".md", []string{"text/markdown", "text/x-markdown"}},
+	{".txt", []string{"text/plain"}},
+	{".json", []string{"application/json"}},
+	{".ipynb", []string{"application/x-ipynb+json"}},
+}
+
+// genericContentTypes don't tell the type of a document - servers use them for any download
+var genericContentTypes = []string{"", "application/octet-stream", "binary/octet-stream", "application/download", "application/force-download", "text/plain"}
+
+// documentExt returns the (lowercase) extension of the file name or path, if it's a document type, else "".
+func documentExt(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	for _, t := range documentTypes {
+		if t.ext == ext {
+			return ext
+		}
+	}
+	return ""
+}
+
+// detectDocumentType returns the extension of the document in a response, or "" if it isn't a document that can be ingested.
+// The file name of the Content-Disposition takes precedence over the URL's extension, which takes precedence over the
+// Content-Type, unless it doesn't match (e.g. a link to a PDF that redirects to an HTML page).
+func detectDocumentType(header http.Header, u *url2.URL) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		if ext := documentExt(params["filename"]); ext != "" {
+			return ext
+		}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	for _, t := range documentTypes {
+		if t.ext == documentExt(u.Path) && (slices.Contains(genericContentTypes, contentType) || slices.Contains(t.contentTypes, contentType)) {
+			return t.ext
+		}
+	}
+	for _, t := range documentTypes {
+		if slices.Contains(t.contentTypes, contentType) {
+			return t.ext
+		}
+	}
+	return ""
+}
+
+// documentFilePath returns the workspace path of a document. Documents from other hosts are stored below the start URL's host,
+// and the extension is appended if the URL doesn't have it (e.g. /download?id=1 with a Content-Disposition file name).
+func documentFilePath(u, baseURL *url2.URL, ext string) string {
+	filePath := path.Join(u.Host, strings.TrimPrefix(u.Path, "/"))
+	if !isSameDomainOrSubdomain(u.Host, baseURL.Host) {
+		filePath = path.Join(baseURL.Host, filePath)
+	}
+	if strings.ToLower(path.Ext(filePath)) != ext {
+		if u.RawQuery != "" {
+			filePath += "?" + url2.QueryEscape(u.RawQuery)
+		}
+		filePath += ext
+	}
+	return filePath
+}
+
+// scrapeDocument downloads a linked document, unless it has not been modified since the last crawl.
+func scrapeDocument(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, policies *hostPolicies, scope *crawlScope, visited map[string]struct{}, linkURL *url2.URL, gptscript *gptscript.GPTScript, stored workspaceFiles) error {
+	if linkURL.Host == "" {
+		var err error
+		fullLink := scope.baseURL.ResolveReference(linkURL).String()
+		linkURL, err = url2.Parse(fullLink)
+		if err != nil {
+			return fmt.Errorf("invalid link URL %s: %v", fullLink, err)
+		}
+	}
+	filePath := documentFilePath(linkURL, scope.baseURL, documentExt(linkURL.Path))
+	if _, ok := visited[filePath]; ok {
+		return nil
+	}
+
+	var header http.Header
+	if details, ok := output.Files[filePath]; ok && stored.exists(filePath) {
+		header = conditionalHeaders(details)
+	}
+
+	logOut.Infof("downloading document %s", linkURL.String())
+	resp, err := policies.get(ctx, linkURL, header)
+	if err != nil {
+		return fmt.Errorf("failed to download document %s: %v", linkURL.String(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		visited[filePath] = struct{}{}
+		logOut.Infof("document %s has not been modified", linkURL.String())
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download document %s: status code %d", linkURL.String(), resp.StatusCode)
+	}
+
+	ext := detectDocumentType(resp.Header, linkURL)
+	if ext == "" {
+		logOut.Infof("skipping %s because it is not a supported document (likely redirect on old link)", linkURL.String())
+		return nil
+	}
+	filePath = documentFilePath(linkURL, scope.baseURL, ext)
+	if _, ok := visited[filePath]; ok {
+		return nil
+	}
+
+	if resp.ContentLength > scope.maxDocumentSize {
+		logOut.Infof("skipping %s because it is larger than %d bytes", linkURL.String(), scope.maxDocumentSize)
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, scope.maxDocumentSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read document %s: %v", linkURL.String(), err)
+	}
+	if int64(len(data)) > scope.maxDocumentSize {
+		logOut.Infof("skipping %s because it is larger than %d bytes", linkURL.String(), scope.maxDocumentSize)
+		return nil
+	}
+
+	return storeDocument(ctx, logOut, output, visited, gptscript, stored, filePath, linkURL, data, resp.Header)
+}
+
+// storeDocument writes a downloaded document to the workspace and records it in the metadata, unless its checksum didn't change.
+func storeDocument(ctx context.Context, logOut *logrus.Logger, output *MetadataOutput, visited map[string]struct{}, gptscript *gptscript.GPTScript, stored workspaceFiles, filePath string, u *url2.URL, data []byte, header http.Header) error {
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+
+	newChecksum, err := getChecksum(data)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %v", err)
+	}
+
+	if fileDetails, exists := output.Files[filePath]; exists && stored.exists(filePath) {
+		if fileDetails.Checksum == newChecksum {
+			fileDetails.ETag, fileDetails.LastModified = etag, lastModified
+			output.Files[filePath] = fileDetails
+			visited[filePath] = struct{}{}
+			logOut.Infof("document %s has not been modified", u.String())
+			return nil
+		}
+	}
+
+	if err := gptscript.WriteFileInWorkspace(ctx, filePath, data); err != nil {
+		return fmt.Errorf("failed to write document %s: %v", u.String(), err)
+	}
+	if err := writeSidecar(ctx, gptscript, filePath, documentMetadata(u.String(), filePath, lastModified)); err != nil {
+		return fmt.Errorf("failed to write metadata sidecar of %s: %v", filePath, err)
+	}
+
+	visited[filePath] = struct{}{}
+
+	output.Status = fmt.Sprintf("Scraped %v", u.String())
+	output.Files[filePath] = FileDetails{
+		FilePath:     filePath,
+		URL:          u.String(),
+		UpdatedAt:    updatedAtFromValidators(etag, lastModified),
+		Checksum:     newChecksum,
+		SizeInBytes:  int64(len(data)),
+		ETag:         etag,
+		LastModified: lastModified,
+	}
+
+	if err := writeMetadata(ctx, output, gptscript); err != nil {
+		return fmt.Errorf("failed to write metadata: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	url2 "net/url"
+	"testing"
+)
+
+func TestDetectDocumentType(t *testing.T) {
+	tests := []struct {
+		name               string
+		url                string
+		contentType        string
+		contentDisposition string
+		expected           string
+	}{
+		{"pdf", "https://example.com/manual.pdf", "application/pdf", "", ".pdf"},
+		{"pdf redirected to page", "https://example.com/manual.pdf", "text/html; charset=utf-8", "", ""},
+		{"markdown as text", "https://example.com/README.md", "text/plain; charset=utf-8", "", ".md"},
+		{"docx as octet-stream", "https://example.com/guide.DOCX", "application/octet-stream", "", ".docx"},
+		{"content type", "https://example.com/export", "text/csv", "", ".csv"},
+		{"content disposition", "https://example.com/download?id=3", "application/octet-stream", `attachment; filename="slides.pptx"`, ".pptx"},
+		{"unsupported disposition", "https://example.com/download?id=4", "application/zip", `attachment; filename="archive.zip"`, ""},
+		{"page", "https://example.com/docs", "text/html", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, _ := url2.Parse(test.url)
+			header := http.Header{}
+			header.Set("Content-Type", test.contentType)
+			if test.contentDisposition != "" {
+				header.Set("Content-Disposition", test.contentDisposition)
+			}
+			if result := detectDocumentType(header, u); result != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestDocumentFilePath(t *testing.T) {
+	baseURL, _ := url2.Parse("https://www.example.com")
+	tests := []struct {
+		url, ext, expected string
+	}{
+		{"https://example.com/docs/manual.pdf", ".pdf", "example.com/docs/manual.pdf"},
+		{"https://cdn.other.com/files/guide.pdf", ".pdf", "www.example.com/cdn.other.com/files/guide.pdf"},
+		{"https://example.com/download?id=3", ".pptx", "example.com/download?id%3D3.pptx"},
+	}
+	for _, test := range tests {
+		u, _ := url2.Parse(test.url)
+		if result := documentFilePath(u, baseURL, test.ext); result != test.expected {
+			t.Errorf("expected %s for %s, got %s", test.expected, test.url, result)
+		}
+	}
+}
@@ -19,6 +19,73 @@ type MetadataInput struct {
 
 type WebsiteCrawlingConfig struct {
 	URLs []string `json:"urls"`
+	// UserAgent is sent with all requests and used to find the applicable robots.txt rules
+	UserAgent string `json:"userAgent,omitempty"`
+	// IgnoreRobotsTxt crawls pages disallowed by robots.txt and ignores its crawl-delay
+	IgnoreRobotsTxt bool `json:"ignoreRobotsTxt,omitempty"`
+	// RequestsPerSecond limits the requests per host - a longer robots.txt crawl-delay takes precedence
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+	// DisableSitemaps only discovers pages by following links
+	DisableSitemaps bool `json:"disableSitemaps,omitempty"`
+	// SitemapURLs are used instead of the sitemaps announced in robots.txt (or /sitemap.xml)
+	SitemapURLs []string `json:"sitemapURLs,omitempty"`
+	// Include restricts the crawl to URLs matching any of these glob (or "regex:" prefixed) patterns,
+	// instead of the URLs below the start URL's path
+	Include []string `json:"include,omitempty"`
+	// Exclude skips URLs matching any of these glob (or "regex:" prefixed) patterns
+	Exclude []string `json:"exclude,omitempty"`
+	// MaxDepth limits the number of links followed from a start URL or sitemap page - 0 means no limit
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// DropQueryParams are removed from URLs in addition to common tracking parameters (e.g. utm_*)
+	DropQueryParams []string `json:"dropQueryParams,omitempty"`
+	// PaginationParams are removed from URLs, so that all pages of a paginated listing are crawled once
+	PaginationParams []string `json:"paginationParams,omitempty"`
+	// AllowedHosts are crawled in addition to the start URL's domain - globs like *.example.com are supported
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	// MaxDocumentSize is the size limit in bytes of linked documents (PDF, DOCX, PPTX, CSV, Markdown, text, JSON and notebooks)
+	MaxDocumentSize int64 `json:"maxDocumentSize,omitempty"`
+	// Render renders pages in a headless Chromium before scraping them, for sites that build their content with JavaScript
+	Render RenderConfig `json:"render,omitempty"`
+	// Auth authenticates the requests to intranet hosts
+	Auth []HostAuth `json:"auth,omitempty"`
+}
+
+// HostAuth holds the credentials for some hosts. Values can reference secrets as ${VAR}, which are read from the env
+// of the gptscript credential (or the environment, which gptscript credential tools populate).
+type HostAuth struct {
+	// Hosts the credentials are sent to - globs like *.example.com are supported
+	Hosts []string `json:"hosts"`
+	// Credential is the name of the gptscript credential the ${VAR} references are read from
+	Credential         string   `json:"credential,omitempty"`
+	CredentialContexts []string `json:"credentialContexts,omitempty"`
+	// Headers are sent with every request, e.g. {"X-API-Key": "${WIKI_API_KEY}"}
+	Headers     map[string]string `json:"headers,omitempty"`
+	BearerToken string            `json:"bearerToken,omitempty"`
+	// Username and Password are sent with basic auth
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+	// Login is a form login run before crawling, whose session cookies are sent with all requests
+	Login *FormLogin `json:"login,omitempty"`
+}
+
+type FormLogin struct {
+	// URL the login form is posted to
+	URL string `json:"url"`
+	// PageURL is the page of the login form - it is loaded first for its session cookies and hidden fields (e.g. CSRF tokens)
+	PageURL string `json:"pageURL,omitempty"`
+	// Fields are posted to the URL, e.g. {"username": "${WIKI_USER}", "password": "${WIKI_PASSWORD}"}
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+type RenderConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// WaitSelector is a CSS selector of an element that is only present when the page has been rendered
+	WaitSelector string `json:"waitSelector,omitempty"`
+	// TimeoutSeconds limits the rendering of a page, after which the fetched HTML is used (default: 30)
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// BrowserPath is the Chromium (or Chrome) executable, which is looked up in the PATH by default
+	BrowserPath string `json:"browserPath,omitempty"`
 }
 
 type MetadataOutput struct {
@@ -41,6 +108,13 @@ type FileDetails struct {
 	UpdatedAt   string `json:"updatedAt,omitempty"`
 	Checksum    string `json:"checksum,omitempty"`
 	SizeInBytes int64  `json:"sizeInBytes,omitempty"`
+	// SitemapLastMod is the page's lastmod in the sitemap when it was scraped
+	SitemapLastMod string `json:"sitemapLastMod,omitempty"`
+	// ETag and LastModified are the validators of the last download, sent with conditional requests on the next crawl
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// Links are the followed links of a page, which are still followed when the page is not modified
+	Links []string `json:"links,omitempty"`
 }
 
 func main() {
@@ -67,6 +141,19 @@ func main() {
 	if input.Limit == 0 {
 		input.Limit = getFromEnvOrDefault("OBOT_WEBSCRAPER_LIMIT", 250)
 	}
+	if input.WebsiteCrawlingConfig.UserAgent == "" {
+		input.WebsiteCrawlingConfig.UserAgent = os.Getenv("OBOT_WEBSCRAPER_USER_AGENT")
+	}
+	if input.WebsiteCrawlingConfig.RequestsPerSecond == 0 {
+		input.WebsiteCrawlingConfig.RequestsPerSecond = float64(getFromEnvOrDefault("OBOT_WEBSCRAPER_REQUESTS_PER_SECOND", 2))
+	}
+
+	if input.WebsiteCrawlingConfig.Render.BrowserPath == "" {
+		input.WebsiteCrawlingConfig.Render.BrowserPath = os.Getenv("OBOT_WEBSCRAPER_BROWSER_PATH")
+	}
+	if input.WebsiteCrawlingConfig.MaxDocumentSize == 0 {
+		input.WebsiteCrawlingConfig.MaxDocumentSize = int64(getFromEnvOrDefault("OBOT_WEBSCRAPER_MAX_DOCUMENT_SIZE_MB", defaultMaxDocumentSize>>20)) << 20
+	}
 
 	output := MetadataOutput{}
 
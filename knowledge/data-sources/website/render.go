@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	url2 "net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultRenderTimeout = 30 * time.Second
+
+// renderer captures the DOM of pages after their JavaScript ran, by driving a local headless Chromium
+// through the DevTools protocol. The browser's requests are intercepted: the page itself is served from what was
+// fetched already, and the requests for its resources obey the host policies like the crawler's own.
+type renderer struct {
+	browserCtx   context.Context
+	cancel       context.CancelFunc
+	waitSelector string
+	timeout      time.Duration
+	policies     *hostPolicies
+	// auth provides the cookies (e.g. the session cookies of a form login) and headers to send to the configured hosts
+	auth *authenticator
+}
+
+// fetchedPage is a page fetched by the crawler, which is rendered without fetching it again.
+type fetchedPage struct {
+	url    string
+	header http.Header
+	body   []byte
+	// served is set once the page was served to the browser, so that other documents (e.g. of iframes) are fetched
+	served atomic.Bool
+}
+
+// newRenderer starts a headless Chromium for rendering pages. It returns nil if rendering is disabled
+// or no browser is available, in which case pages are fetched as they are.
+func newRenderer(ctx context.Context, config RenderConfig, policies *hostPolicies, auth *authenticator, logOut *logrus.Logger) *renderer {
+	if !config.Enabled {
+		return nil
+	}
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.UserAgent(policies.userAgent))
+	if config.BrowserPath != "" {
+		opts = append(opts, chromedp.ExecPath(config.BrowserPath))
+	}
+	if os.Geteuid() == 0 {
+		// Chromium refuses to start its sandbox as root, e.g. in containers
+		opts = append(opts, chromedp.NoSandbox)
+	}
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	cancel := func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+
+	// start the browser right away, to fall back to fetching pages if it isn't available
+	if err := chromedp.Run(browserCtx); err != nil {
+		logOut.Infof("failed to start headless browser, fetching pages without rendering: %v", err)
+		cancel()
+		return nil
+	}
+
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultRenderTimeout
+	}
+	return &renderer{
+		browserCtx:   browserCtx,
+		cancel:       cancel,
+		waitSelector: config.WaitSelector,
+		timeout:      timeout,
+		policies:     policies,
+		auth:         auth,
+	}
+}
+
+// render returns the HTML of the page after it has been rendered, i.e. when the wait selector (or the body) is ready.
+func (r *renderer) render(ctx context.Context, page *fetchedPage) (string, error) {
+	tabCtx, cancelTab := chromedp.NewContext(r.browserCtx)
+	defer cancelTab()
+	tabCtx, cancel := context.WithTimeout(tabCtx, r.timeout)
+	defer cancel()
+	// stop rendering when the crawl is canceled
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	waitSelector := r.waitSelector
+	if waitSelector == "" {
+		waitSelector = "body"
+	}
+
+	chromedp.ListenTarget(tabCtx, func(ev any) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// the listener must not block, as it receives the events of the tab one by one (and requests may wait for their host)
+		go func() {
+			ctx := cdp.WithExecutor(tabCtx, chromedp.FromContext(tabCtx).Target)
+			// fails if the tab was closed in the meantime
+			_ = r.requestAction(ctx, paused, page).Do(ctx)
+		}()
+	})
+
+	var html string
+	err := chromedp.Run(tabCtx,
+		fetch.Enable(),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			u, err := url2.Parse(page.url)
+			if err != nil || r.auth == nil {
+				return err
+			}
+			for _, cookie := range r.auth.cookies(u) {
+				if err := network.SetCookie(cookie.Name, cookie.Value).WithURL(page.url).Do(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+		chromedp.Navigate(page.url),
+		chromedp.WaitReady(waitSelector, chromedp.ByQuery),
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+	)
+	return html, err
+}
+
+// requestAction returns how to handle a paused request of the tab rendering the page: the page is served from what was
+// fetched already, requests disallowed by robots.txt fail, and the others are continued (with the configured headers of
+// their host) once the host's delay has passed. The headers are only added to the requests to their hosts, and not
+// e.g. to those of third-party scripts.
+func (r *renderer) requestAction(ctx context.Context, paused *fetch.EventRequestPaused, page *fetchedPage) chromedp.Action {
+	if paused.ResourceType == network.ResourceTypeDocument && page.served.CompareAndSwap(false, true) {
+		return fetch.FulfillRequest(paused.RequestID, http.StatusOK).
+			WithResponseHeaders(responseHeaders(page.header)).
+			WithBody(base64.StdEncoding.EncodeToString(page.body))
+	}
+
+	continueRequest := fetch.ContinueRequest(paused.RequestID)
+	u, err := url2.Parse(paused.Request.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return continueRequest
+	}
+	if !r.policies.allowed(ctx, u) {
+		return fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient)
+	}
+	if err := r.policies.wait(ctx, u); err != nil {
+		return fetch.FailRequest(paused.RequestID, network.ErrorReasonAborted)
+	}
+	if r.auth != nil {
+		continueRequest = continueRequest.WithHeaders(requestHeaders(paused.Request.Headers, r.auth.headers(u)))
+	}
+	return continueRequest
+}
+
+// responseHeaders returns the headers to serve a fetched page with. The body was decoded when it was fetched,
+// so its encoding and length don't apply anymore.
+func responseHeaders(header http.Header) []*fetch.HeaderEntry {
+	var entries []*fetch.HeaderEntry
+	for name, values := range header {
+		if name == "Content-Encoding" || name == "Content-Length" {
+			continue
+		}
+		for _, value := range values {
+			entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+		}
+	}
+	return entries
+}
+
+// requestHeaders returns the headers of a paused request with the given headers added (unless the request has them
+// already, like the authTransport does), or nil to leave them unchanged.
+func requestHeaders(headers network.Headers, add http.Header) []*fetch.HeaderEntry {
+	if len(add) == 0 {
+		return nil
+	}
+	header := http.Header{}
+	for name, value := range headers {
+		header.Set(name, fmt.Sprint(value))
+	}
+	for name, values := range add {
+		if header.Get(name) == "" {
+			header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	entries := make([]*fetch.HeaderEntry, 0, len(header))
+	for name, values := range header {
+		for _, value := range values {
+			entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+		}
+	}
+	return entries
+}
+
+// close stops the browser.
+func (r *renderer) close() {
+	r.cancel()
+}
+
+// renderingTransport fetches pages as usual (obeying conditional requests) and replaces the HTML of successful
+// responses with the rendered DOM. If rendering fails, the fetched HTML is used.
+type renderingTransport struct {
+	base   http.RoundTripper
+	render func(ctx context.Context, page *fetchedPage) (string, error)
+	// maxBodySize is the size of the largest page to render, larger ones are returned as they are
+	maxBodySize int64
+	logOut      *logrus.Logger
+}
+
+func (t *renderingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, t.maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > t.maxBodySize {
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	html, err := t.render(req.Context(), &fetchedPage{url: req.URL.String(), header: resp.Header, body: body})
+	if err != nil {
+		t.logOut.Infof("failed to render %s, using the fetched HTML: %v", req.URL.String(), err)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	resp.Body = io.NopCloser(strings.NewReader(html))
+	resp.ContentLength = int64(len(html))
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	return resp, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"strings"
+	"testing"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRenderingTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/app":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><div id="root"></div></body></html>`))
+		case "/broken":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body>static</body></html>`))
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body>` + strings.Repeat("x", 100) + `</body></html>`))
+		default:
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		}
+	}))
+	defer srv.Close()
+
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+	client := &http.Client{Transport: &renderingTransport{
+		base: http.DefaultTransport,
+		render: func(_ context.Context, page *fetchedPage) (string, error) {
+			if page.url == srv.URL+"/broken" {
+				return "", errors.New("timeout")
+			}
+			if page.url == srv.URL+"/large" {
+				t.Error("expected pages larger than the limit not to be rendered")
+			}
+			// the fetched page is rendered, it isn't fetched again
+			if string(page.body) != `<html><body><div id="root"></div></body></html>` {
+				return "", fmt.Errorf("unexpected page %q", page.body)
+			}
+			return `<html><body><div id="root">rendered</div></body></html>`, nil
+		},
+		maxBodySize: 100,
+		logOut:      logOut,
+	}}
+
+	tests := map[string]string{
+		"/app":       `<html><body><div id="root">rendered</div></body></html>`,
+		"/broken":    `<html><body>static</body></html>`,
+		"/large":     `<html><body>` + strings.Repeat("x", 100) + `</body></html>`,
+		"/guide.pdf": "%PDF-1.4",
+	}
+	for path, expected := range tests {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != expected {
+			t.Errorf("expected %q for %s, got %q", expected, path, body)
+		}
+	}
+}
+
+func TestRendererFallback(t *testing.T) {
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+	policies := newHostPolicies(WebsiteCrawlingConfig{}, logOut)
+	if r := newRenderer(context.Background(), RenderConfig{}, policies, nil, logOut); r != nil {
+		t.Error("expected no renderer when rendering is disabled")
+	}
+	if r := newRenderer(context.Background(), RenderConfig{Enabled: true, BrowserPath: "/nonexistent/chromium"}, policies, nil, logOut); r != nil {
+		r.close()
+		t.Error("expected no renderer without a browser")
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	if headers := requestHeaders(network.Headers{"Accept": "text/html"}, nil); headers != nil {
+		t.Errorf("expected unchanged headers without headers to add, got %v", headers)
+	}
+
+	add := http.Header{}
+	add.Set("Authorization", "Bearer secret")
+	add.Set("X-Api-Key", "key")
+	headers := map[string]string{}
+	for _, entry := range requestHeaders(network.Headers{"Accept": "text/html", "x-api-key": "page"}, add) {
+		headers[entry.Name] = entry.Value
+	}
+	expected := map[string]string{"Accept": "text/html", "Authorization": "Bearer secret", "X-Api-Key": "page"}
+	if len(headers) != len(expected) {
+		t.Errorf("expected headers %v, got %v", expected, headers)
+	}
+	for name, value := range expected {
+		if headers[name] != value {
+			t.Errorf("expected %s: %q, got %q", name, value, headers[name])
+		}
+	}
+}
+
+func TestRequestAction(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /private/\n"))
+		}
+	}))
+	defer srv.Close()
+	u, _ := url2.Parse(srv.URL)
+
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+	auth, err := newAuthenticator(ctx, []HostAuth{{Hosts: []string{u.Hostname()}, BearerToken: "token"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &renderer{policies: newHostPolicies(WebsiteCrawlingConfig{}, logOut), auth: auth}
+	page := &fetchedPage{url: srv.URL + "/app", header: http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}}, body: []byte("<html></html>")}
+	paused := func(resourceType network.ResourceType, url string) *fetch.EventRequestPaused {
+		return &fetch.EventRequestPaused{RequestID: "1", ResourceType: resourceType, Request: &network.Request{URL: url, Headers: network.Headers{}}}
+	}
+
+	// the page is served from what was fetched, once
+	fulfill, ok := r.requestAction(ctx, paused(network.ResourceTypeDocument, page.url), page).(*fetch.FulfillRequestParams)
+	if !ok {
+		t.Fatal("expected the page to be served")
+	}
+	if body, _ := base64.StdEncoding.DecodeString(fulfill.Body); string(body) != "<html></html>" {
+		t.Errorf("expected the fetched page, got %q", body)
+	}
+	if len(fulfill.ResponseHeaders) != 1 || fulfill.ResponseHeaders[0].Name != "Content-Type" {
+		t.Errorf("expected only the content type header, got %v", fulfill.ResponseHeaders)
+	}
+	if _, ok := r.requestAction(ctx, paused(network.ResourceTypeDocument, srv.URL+"/frame"), page).(*fetch.ContinueRequestParams); !ok {
+		t.Error("expected other documents to be fetched")
+	}
+
+	// resources obey robots.txt and get the headers of their host
+	if _, ok := r.requestAction(ctx, paused(network.ResourceTypeScript, srv.URL+"/private/app.js"), page).(*fetch.FailRequestParams); !ok {
+		t.Error("expected resources disallowed by robots.txt to fail")
+	}
+	cont, ok := r.requestAction(ctx, paused(network.ResourceTypeScript, srv.URL+"/app.js"), page).(*fetch.ContinueRequestParams)
+	if !ok || len(cont.Headers) != 1 || cont.Headers[0].Value != "Bearer token" {
+		t.Errorf("expected the resource to be fetched with the auth headers, got %v", cont)
+	}
+	cont, ok = r.requestAction(ctx, paused(network.ResourceTypeScript, "data:text/javascript,1"), page).(*fetch.ContinueRequestParams)
+	if !ok || cont.Headers != nil {
+		t.Errorf("expected data URLs to be continued as they are, got %v", cont)
+	}
+}
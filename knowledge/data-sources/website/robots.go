@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	url2 "net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/temoto/robotstxt"
+)
+
+const defaultUserAgent = "knowledge-website-crawler"
+
+// hostPolicies makes the crawler polite: it obeys the robots.txt rules for its user agent and
+// waits between requests to the same host (the robots.txt crawl-delay, if it's longer than the configured delay).
+type hostPolicies struct {
+	client       *http.Client
+	userAgent    string
+	ignoreRobots bool
+	minDelay     time.Duration
+	logOut       *logrus.Logger
+
+	mu    sync.Mutex
+	hosts map[string]*hostPolicy
+}
+
+type hostPolicy struct {
+	mu          sync.Mutex
+	robots      *robotstxt.RobotsData
+	group       *robotstxt.Group
+	delay       time.Duration
+	lastRequest time.Time
+}
+
+func newHostPolicies(config WebsiteCrawlingConfig, logOut *logrus.Logger) *hostPolicies {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	var minDelay time.Duration
+	if config.RequestsPerSecond > 0 {
+		minDelay = time.Duration(float64(time.Second) / config.RequestsPerSecond)
+	}
+	return &hostPolicies{
+		client:       &http.Client{Timeout: 30 * time.Second},
+		userAgent:    userAgent,
+		ignoreRobots: config.IgnoreRobotsTxt,
+		minDelay:     minDelay,
+		logOut:       logOut,
+		hosts:        map[string]*hostPolicy{},
+	}
+}
+
+// policy returns the policy for the host of the URL, fetching its robots.txt on first use.
+func (p *hostPolicies) policy(ctx context.Context, u *url2.URL) *hostPolicy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if hp, ok := p.hosts[u.Host]; ok {
+		return hp
+	}
+
+	hp := &hostPolicy{delay: p.minDelay}
+	p.hosts[u.Host] = hp
+	if p.ignoreRobots {
+		return hp
+	}
+
+	robotsURL := &url2.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	robots, err := p.fetchRobots(ctx, robotsURL.String())
+	if err != nil {
+		// unreachable robots.txt - crawl as if there was none
+		p.logOut.Infof("failed to fetch %s, ignoring it: %v", robotsURL, err)
+		return hp
+	}
+	hp.robots = robots
+	hp.group = robots.FindGroup(p.userAgent)
+	if hp.group != nil && hp.group.CrawlDelay > hp.delay {
+		hp.delay = hp.group.CrawlDelay
+	}
+	return hp
+}
+
+func (p *hostPolicies) fetchRobots(ctx context.Context, robotsURL string) (*robotstxt.RobotsData, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// 4xx means everything is allowed, 5xx means nothing is
+	return robotstxt.FromResponse(resp)
+}
+
+// allowed returns true if robots.txt allows the user agent to fetch the URL.
+func (p *hostPolicies) allowed(ctx context.Context, u *url2.URL) bool {
+	hp := p.policy(ctx, u)
+	if hp.group == nil {
+		return true
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return hp.group.Test(path)
+}
+
+// sitemaps returns the sitemaps announced in the robots.txt of the URL's host.
+func (p *hostPolicies) sitemaps(ctx context.Context, u *url2.URL) []string {
+	hp := p.policy(ctx, u)
+	if hp.robots == nil {
+		return nil
+	}
+	return hp.robots.Sitemaps
+}
+
+// wait blocks until the next request to the URL's host may be sent.
+func (p *hostPolicies) wait(ctx context.Context, u *url2.URL) error {
+	hp := p.policy(ctx, u)
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+
+	if wait := time.Until(hp.lastRequest.Add(hp.delay)); wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	hp.lastRequest = time.Now()
+	return nil
+}
+
+// get sends a GET request with the given (optional) headers for the URL, if robots.txt allows it, after waiting for the host's delay.
+func (p *hostPolicies) get(ctx context.Context, u *url2.URL, header http.Header) (*http.Response, error) {
+	if !p.allowed(ctx, u) {
+		return nil, fmt.Errorf("%s is disallowed by robots.txt", u)
+	}
+	if err := p.wait(ctx, u); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+	return p.client.Do(req)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	url2 "net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// defaultTrackingParams are query parameters that never change the content of a page
+var defaultTrackingParams = []string{"utm_*", "gclid", "fbclid", "msclkid", "mc_cid", "mc_eid", "_ga", "_hsenc", "_hsmi", "ref_src"}
+
+const regexPatternPrefix = "regex:"
+
+// urlPattern matches URLs by a glob or regular expression. Patterns containing "://" are matched against the full URL
+// (without query), all others against its path.
+type urlPattern struct {
+	raw     string
+	fullURL bool
+	glob    glob.Glob
+	regex   *regexp.Regexp
+}
+
+func compileURLPattern(pattern string) (*urlPattern, error) {
+	p := &urlPattern{raw: pattern}
+	if expr, ok := strings.CutPrefix(pattern, regexPatternPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+		}
+		p.regex, p.fullURL = re, strings.Contains(expr, "://")
+		return p, nil
+	}
+	g, err := glob.Compile(pattern, '/')
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	p.glob, p.fullURL = g, strings.Contains(pattern, "://")
+	return p, nil
+}
+
+func (p *urlPattern) match(u *url2.URL) bool {
+	s := u.Path
+	if p.fullURL {
+		s = (&url2.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+	}
+	if s == "" {
+		s = "/"
+	}
+	if p.regex != nil {
+		return p.regex.MatchString(s)
+	}
+	return p.glob.Match(s)
+}
+
+// crawlScope decides which URLs are crawled from a start URL and how they are normalized.
+type crawlScope struct {
+	baseURL      *url2.URL
+	include      []*urlPattern
+	exclude      []*urlPattern
+	allowedHosts []glob.Glob
+	dropParams   []glob.Glob
+	// maxDocumentSize is the size limit of documents (and pages), larger ones are skipped
+	maxDocumentSize int64
+}
+
+func newCrawlScope(baseURL *url2.URL, config WebsiteCrawlingConfig) (*crawlScope, error) {
+	s := &crawlScope{baseURL: baseURL, maxDocumentSize: config.MaxDocumentSize}
+	if s.maxDocumentSize <= 0 {
+		s.maxDocumentSize = defaultMaxDocumentSize
+	}
+	for _, pattern := range config.Include {
+		p, err := compileURLPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.include = append(s.include, p)
+	}
+	for _, pattern := range config.Exclude {
+		p, err := compileURLPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.exclude = append(s.exclude, p)
+	}
+	for _, host := range config.AllowedHosts {
+		g, err := glob.Compile(strings.ToLower(host), '.')
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed host %q: %w", host, err)
+		}
+		s.allowedHosts = append(s.allowedHosts, g)
+	}
+	for _, param := range slices.Concat(defaultTrackingParams, config.DropQueryParams, config.PaginationParams) {
+		g, err := glob.Compile(param)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query parameter pattern %q: %w", param, err)
+		}
+		s.dropParams = append(s.dropParams, g)
+	}
+	return s, nil
+}
+
+// allows returns true if the URL should be crawled: it must be on the start URL's (www-)domain or an allowed host,
+// match an include pattern (or be below the start URL's path, if there are none) and must not match any exclude pattern.
+func (s *crawlScope) allows(u *url2.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	sameSite := isSameDomainOrSubdomain(u.Host, s.baseURL.Host)
+	if !sameSite && !s.allowedHost(u.Hostname()) {
+		return false
+	}
+
+	if len(s.include) > 0 {
+		if !slices.ContainsFunc(s.include, func(p *urlPattern) bool { return p.match(u) }) {
+			return false
+		}
+	} else if sameSite && !strings.HasPrefix(u.Path, s.baseURL.Path) {
+		return false
+	}
+
+	return !slices.ContainsFunc(s.exclude, func(p *urlPattern) bool { return p.match(u) })
+}
+
+// excluded returns true if the URL matches an exclude pattern (or doesn't match any include pattern).
+// Unlike allows, it doesn't restrict hosts and paths, as linked documents are downloaded from anywhere.
+func (s *crawlScope) excluded(u *url2.URL) bool {
+	if len(s.include) > 0 && !slices.ContainsFunc(s.include, func(p *urlPattern) bool { return p.match(u) }) {
+		return true
+	}
+	return slices.ContainsFunc(s.exclude, func(p *urlPattern) bool { return p.match(u) })
+}
+
+func (s *crawlScope) allowedHost(host string) bool {
+	host = strings.ToLower(host)
+	return slices.ContainsFunc(s.allowedHosts, func(g glob.Glob) bool { return g.Match(host) })
+}
+
+// normalize returns the canonical form of a URL, so that variants of the same page are only crawled once:
+// without fragment, tracking and pagination parameters, with sorted query parameters and without a trailing slash
+// for the homepage (e.g. https://www.acorn.io and https://www.acorn.io/).
+func (s *crawlScope) normalize(u *url2.URL) *url2.URL {
+	n := *u
+	n.Fragment, n.RawFragment = "", ""
+	n.Host = strings.ToLower(n.Host)
+	if n.Path == "/" {
+		n.Path, n.RawPath = "", ""
+	}
+
+	if n.RawQuery != "" {
+		query := n.Query()
+		for param := range query {
+			if slices.ContainsFunc(s.dropParams, func(g glob.Glob) bool { return g.Match(param) }) {
+				query.Del(param)
+			}
+		}
+		n.RawQuery = query.Encode() // sorted by key
+	}
+	return &n
+}
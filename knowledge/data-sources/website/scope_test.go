@@ -0,0 +1,81 @@
+package main
+
+import (
+	url2 "net/url"
+	"testing"
+)
+
+func TestCrawlScope(t *testing.T) {
+	baseURL, _ := url2.Parse("https://www.example.com")
+
+	tests := []struct {
+		name     string
+		config   WebsiteCrawlingConfig
+		url      string
+		expected bool
+	}{
+		{"same site", WebsiteCrawlingConfig{}, "https://example.com/blog/post", true},
+		{"external host", WebsiteCrawlingConfig{}, "https://other.com/docs", false},
+		{"not http", WebsiteCrawlingConfig{}, "mailto:info@example.com", false},
+		{"include glob", WebsiteCrawlingConfig{Include: []string{"/docs/v2/**"}}, "https://www.example.com/docs/v2/setup/install", true},
+		{"include glob - other version", WebsiteCrawlingConfig{Include: []string{"/docs/v2/**"}}, "https://www.example.com/docs/v1/setup", false},
+		{"include glob - single segment", WebsiteCrawlingConfig{Include: []string{"/docs/*"}}, "https://www.example.com/docs/v2/setup", false},
+		{"include regex", WebsiteCrawlingConfig{Include: []string{`regex:^/docs/v[23]/`}}, "https://www.example.com/docs/v3/intro", true},
+		{"include full URL", WebsiteCrawlingConfig{Include: []string{"https://www.example.com/docs/**"}}, "https://www.example.com/docs/intro", true},
+		{"exclude", WebsiteCrawlingConfig{Exclude: []string{"/blog/**", "/changelog*"}}, "https://www.example.com/blog/post", false},
+		{"exclude prefix glob", WebsiteCrawlingConfig{Exclude: []string{"/blog/**", "/changelog*"}}, "https://www.example.com/changelog-2024", false},
+		{"allowed host", WebsiteCrawlingConfig{AllowedHosts: []string{"*.example-cdn.com"}}, "https://docs.example-cdn.com/guide", true},
+		{"allowed host - excluded", WebsiteCrawlingConfig{AllowedHosts: []string{"*.example-cdn.com"}, Exclude: []string{"/guide"}}, "https://docs.example-cdn.com/guide", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scope, err := newCrawlScope(baseURL, test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := url2.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := scope.allows(u); result != test.expected {
+				t.Errorf("expected %v for %s, got %v", test.expected, test.url, result)
+			}
+		})
+	}
+
+	// The base path restricts the crawl, unless there are include patterns
+	docsURL, _ := url2.Parse("https://example.com/docs")
+	scope, _ := newCrawlScope(docsURL, WebsiteCrawlingConfig{})
+	blog, _ := url2.Parse("https://example.com/blog")
+	if scope.allows(blog) {
+		t.Errorf("expected %s to be out of scope", blog)
+	}
+
+	if _, err := newCrawlScope(baseURL, WebsiteCrawlingConfig{Include: []string{"regex:("}}); err == nil {
+		t.Error("expected an error for an invalid regex")
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	baseURL, _ := url2.Parse("https://example.com")
+	scope, err := newCrawlScope(baseURL, WebsiteCrawlingConfig{DropQueryParams: []string{"session"}, PaginationParams: []string{"page"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"https://Example.com/":                                 "https://example.com",
+		"https://example.com/docs#install":                     "https://example.com/docs",
+		"https://example.com/docs?utm_source=x&utm_medium=y":   "https://example.com/docs",
+		"https://example.com/list?page=3&tag=go&session=abc":   "https://example.com/list?tag=go",
+		"https://example.com/search?q=b&lang=en&gclid=123":     "https://example.com/search?lang=en&q=b",
+		"https://example.com/docs/intro?fbclid=1#section-name": "https://example.com/docs/intro",
+	}
+	for in, expected := range tests {
+		u, _ := url2.Parse(in)
+		if result := scope.normalize(u).String(); result != expected {
+			t.Errorf("expected %s for %s, got %s", expected, in, result)
+		}
+	}
+}
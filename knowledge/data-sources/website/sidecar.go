@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gptscript-ai/go-gptscript"
+)
+
+// sidecarSuffix is appended to the path of a file for its metadata sidecar, which the knowledge ingest adds to the metadata of the file.
+const sidecarSuffix = ".knowledge.json"
+
+// sourceMetadata describes a page or document in the source system, so that retrieved chunks can cite it.
+type sourceMetadata struct {
+	URL          string `json:"url"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Author       string `json:"author,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// pageMetadata returns the metadata of an HTML page from its title and meta tags.
+func pageMetadata(doc *goquery.Selection, url, lastModified string) sourceMetadata {
+	meta := func(names ...string) string {
+		for _, name := range names {
+			if v := strings.TrimSpace(doc.Find(`meta[name="`+name+`"], meta[property="`+name+`"]`).First().AttrOr("content", "")); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	title := meta("og:title")
+	if title == "" {
+		title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	return sourceMetadata{
+		URL:          url,
+		Title:        title,
+		Description:  meta("description", "og:description"),
+		Author:       meta("author", "article:author"),
+		LastModified: lastModified,
+	}
+}
+
+// documentMetadata returns the metadata of a linked document, titled by its file name.
+func documentMetadata(url, filePath, lastModified string) sourceMetadata {
+	return sourceMetadata{
+		URL:          url,
+		Title:        path.Base(filePath),
+		LastModified: lastModified,
+	}
+}
+
+func writeSidecar(ctx context.Context, gptscriptClient *gptscript.GPTScript, filePath string, metadata sourceMetadata) error {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return gptscriptClient.WriteFileInWorkspace(ctx, filePath+sidecarSuffix, data)
+}
+
+// deleteSidecar removes the sidecar of a file, if there is one.
+func deleteSidecar(ctx context.Context, gptscriptClient *gptscript.GPTScript, filePath string) error {
+	var notFoundError *gptscript.NotFoundInWorkspaceError
+	if err := gptscriptClient.DeleteFileInWorkspace(ctx, filePath+sidecarSuffix); err != nil && !errors.As(err, &notFoundError) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	url2 "net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxSitemapDepth limits the nesting of sitemap indexes
+	maxSitemapDepth = 3
+	// maxSitemapSize is the maximum (uncompressed) size of a sitemap, as per the sitemap protocol
+	maxSitemapSize = 50 << 20
+)
+
+type sitemapEntry struct {
+	Loc     string
+	LastMod string
+}
+
+// sitemapXML covers both, <urlset> and <sitemapindex> documents
+type sitemapXML struct {
+	XMLName xml.Name `xml:""`
+	URLs    []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// discoverSitemapPages returns the (normalized) pages listed in the sitemaps of the start URL's host that are in the crawl scope.
+// The sitemaps are the configured ones, else the ones announced in robots.txt, else /sitemap.xml.
+func discoverSitemapPages(ctx context.Context, logOut *logrus.Logger, policies *hostPolicies, scope *crawlScope, sitemapURLs []string) []sitemapEntry {
+	baseURL := scope.baseURL
+	if len(sitemapURLs) == 0 {
+		sitemapURLs = policies.sitemaps(ctx, baseURL)
+	}
+	if len(sitemapURLs) == 0 {
+		sitemapURLs = []string{(&url2.URL{Scheme: baseURL.Scheme, Host: baseURL.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	seen := map[string]struct{}{}
+	var pages []sitemapEntry
+	for _, sitemapURL := range sitemapURLs {
+		entries, err := fetchSitemap(ctx, policies, sitemapURL, 0, seen)
+		if err != nil {
+			logOut.Infof("failed to read sitemap %s: %v", sitemapURL, err)
+			continue
+		}
+		for _, e := range entries {
+			u, err := url2.Parse(e.Loc)
+			if err != nil {
+				continue
+			}
+			if u = scope.normalize(u); !scope.allows(u) {
+				continue
+			}
+			pages = append(pages, sitemapEntry{Loc: u.String(), LastMod: e.LastMod})
+		}
+	}
+	logOut.Infof("found %d pages in the sitemaps of %s", len(pages), baseURL)
+	return pages
+}
+
+// fetchSitemap returns the pages of a sitemap, following sitemap indexes.
+func fetchSitemap(ctx context.Context, policies *hostPolicies, sitemapURL string, depth int, seen map[string]struct{}) ([]sitemapEntry, error) {
+	if _, ok := seen[sitemapURL]; ok {
+		return nil, nil
+	}
+	seen[sitemapURL] = struct{}{}
+
+	u, err := url2.Parse(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := policies.get(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+
+	var body io.Reader = io.LimitReader(resp.Body, maxSitemapSize)
+	if strings.HasSuffix(u.Path, ".gz") && resp.Header.Get("Content-Encoding") == "" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		body = io.LimitReader(gz, maxSitemapSize)
+	}
+
+	sitemap, err := parseSitemap(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []sitemapEntry
+	for _, e := range sitemap.URLs {
+		if loc := strings.TrimSpace(e.Loc); loc != "" {
+			entries = append(entries, sitemapEntry{Loc: loc, LastMod: strings.TrimSpace(e.LastMod)})
+		}
+	}
+	if depth < maxSitemapDepth {
+		for _, s := range sitemap.Sitemaps {
+			nested, err := fetchSitemap(ctx, policies, strings.TrimSpace(s.Loc), depth+1, seen)
+			if err != nil {
+				policies.logOut.Infof("failed to read sitemap %s: %v", s.Loc, err)
+				continue
+			}
+			entries = append(entries, nested...)
+		}
+	}
+	return entries, nil
+}
+
+func parseSitemap(r io.Reader) (*sitemapXML, error) {
+	var sitemap sitemapXML
+	if err := xml.NewDecoder(r).Decode(&sitemap); err != nil {
+		return nil, fmt.Errorf("invalid sitemap: %w", err)
+	}
+	if name := sitemap.XMLName.Local; name != "urlset" && name != "sitemapindex" {
+		return nil, fmt.Errorf("invalid sitemap: unexpected root element <%s>", name)
+	}
+	return &sitemap, nil
+}
+
+// unchangedSince returns true if the sitemap's lastmod of a page is not newer than the recorded one.
+func unchangedSince(lastMod, recorded string) bool {
+	if lastMod == "" || recorded == "" {
+		return false
+	}
+	if lastMod == recorded {
+		return true
+	}
+	t, err1 := parseLastMod(lastMod)
+	r, err2 := parseLastMod(recorded)
+	return err1 == nil && err2 == nil && !t.After(r)
+}
+
+// parseLastMod parses the W3C datetime formats used in sitemaps.
+func parseLastMod(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid lastmod %q", s)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nCrawl-delay: 0.2\n\nUser-agent: greedy-bot\nDisallow: /\n\nSitemap: %s/sitemap-index.xml\n", srv.URL)
+	})
+	mux.HandleFunc("/sitemap-index.xml", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/sitemap-docs.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+	})
+	mux.HandleFunc("/sitemap-docs.xml", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/docs/intro</loc><lastmod>2024-05-01</lastmod></url>
+  <url><loc>%[1]s/docs/setup</loc></url>
+  <url><loc>%[1]s/blog/news</loc></url>
+</urlset>`, srv.URL)
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHostPolicies(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestSite(t)
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+
+	policies := newHostPolicies(WebsiteCrawlingConfig{RequestsPerSecond: 100}, logOut)
+	u, _ := url2.Parse(srv.URL + "/docs/intro")
+	private, _ := url2.Parse(srv.URL + "/private/page")
+
+	if !policies.allowed(ctx, u) {
+		t.Errorf("expected %s to be allowed", u)
+	}
+	if policies.allowed(ctx, private) {
+		t.Errorf("expected %s to be disallowed", private)
+	}
+	if _, err := policies.get(ctx, private, nil); err == nil {
+		t.Errorf("expected request for %s to fail", private)
+	}
+
+	// The crawl-delay is longer than the configured delay
+	start := time.Now()
+	for range 3 {
+		if err := policies.wait(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("expected requests to be delayed by the crawl-delay, took %s", elapsed)
+	}
+
+	greedy := newHostPolicies(WebsiteCrawlingConfig{UserAgent: "greedy-bot"}, logOut)
+	if greedy.allowed(ctx, u) {
+		t.Errorf("expected %s to be disallowed for greedy-bot", u)
+	}
+	ignoring := newHostPolicies(WebsiteCrawlingConfig{UserAgent: "greedy-bot", IgnoreRobotsTxt: true}, logOut)
+	if !ignoring.allowed(ctx, u) {
+		t.Errorf("expected %s to be allowed when ignoring robots.txt", u)
+	}
+}
+
+func TestDiscoverSitemapPages(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestSite(t)
+	logOut := logrus.New()
+	logOut.SetOutput(io.Discard)
+	policies := newHostPolicies(WebsiteCrawlingConfig{RequestsPerSecond: 100}, logOut)
+
+	// The sitemap index is announced in robots.txt - only pages below the base URL are returned
+	baseURL, _ := url2.Parse(srv.URL + "/docs")
+	scope, err := newCrawlScope(baseURL, WebsiteCrawlingConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := discoverSitemapPages(ctx, logOut, policies, scope, nil)
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %v", pages)
+	}
+	if pages[0].Loc != srv.URL+"/docs/intro" || pages[0].LastMod != "2024-05-01" {
+		t.Errorf("unexpected page %v", pages[0])
+	}
+
+	if !unchangedSince("2024-05-01", "2024-05-01T00:00:00Z") || unchangedSince("2024-05-02", "2024-05-01") || unchangedSince("", "2024-05-01") {
+		t.Error("unexpected lastmod comparison")
+	}
+}
@@ -21,6 +21,7 @@ require (
 	github.com/adrg/xdg v0.4.0
 	github.com/asg017/sqlite-vec-go-bindings v0.1.4-alpha.2
 	github.com/cohere-ai/cohere-go/v2 v2.8.2
+	github.com/fsnotify/fsnotify v1.5.1
 	github.com/gabriel-vasile/mimetype v1.4.4
 	github.com/gen2brain/go-fitz v1.24.14
 	github.com/glebarez/sqlite v1.11.0
@@ -7,6 +7,7 @@ import (
 	dstypes "github.com/gptscript-ai/knowledge/pkg/datastore/types"
 	"github.com/gptscript-ai/knowledge/pkg/flows"
 	types2 "github.com/gptscript-ai/knowledge/pkg/index/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 )
 
 type IngestWorkspaceOpts struct {
@@ -17,6 +18,7 @@ type SharedIngestionOpts struct {
 	IngestionFlows      []flows.IngestionFlow
 	IsDuplicateFuncName string
 	Metadata            map[string]string
+	ACL                 *types2.ACL // Default ACL for ingested files, can be overridden per file via metadata
 }
 
 type IngestPathsOpts struct {
@@ -36,17 +38,25 @@ type Client interface {
 	CreateDataset(ctx context.Context, datasetID string, opts *types2.DatasetCreateOpts) (*types2.Dataset, error)
 	DeleteDataset(ctx context.Context, datasetID string) error
 	GetDataset(ctx context.Context, datasetID string) (*types2.Dataset, error)
+	DatasetStats(ctx context.Context, datasetID string) (*dstypes.DatasetStats, error)
 	FindFile(ctx context.Context, searchFile types2.File) (*types2.File, error)
 	DeleteFile(ctx context.Context, datasetID, fileID string) error
 	ListDatasets(ctx context.Context) ([]types2.Dataset, error)
 	Ingest(ctx context.Context, datasetID string, name string, data []byte, opts datastore.IngestOpts) ([]string, error)
 	IngestPaths(ctx context.Context, datasetID string, opts *IngestPathsOpts, paths ...string) (int, int, error) // returns number of files ingested, number of files skipped and first encountered error
+	WatchPath(ctx context.Context, datasetID string, opts *WatchPathOpts, path string) error                     // ingests the path and keeps it in sync until the context is canceled
 	AskDirectory(ctx context.Context, path string, query string, opts *IngestPathsOpts, ropts *datastore.RetrieveOpts) (*dstypes.RetrievalResponse, error)
 	PrunePath(ctx context.Context, datasetID string, path string, keep []string) ([]types2.File, error)
+	PruneFileVersions(ctx context.Context, datasetID string, opts datastore.PruneVersionsOpts) ([]types2.File, error)
 	DeleteDocuments(ctx context.Context, datasetID string, documentIDs ...string) error
 	Retrieve(ctx context.Context, datasetIDs []string, query string, opts datastore.RetrieveOpts) (*dstypes.RetrievalResponse, error)
 	ExportDatasets(ctx context.Context, path string, datasets ...string) error
 	ImportDatasets(ctx context.Context, path string, datasets ...string) error
 	UpdateDataset(ctx context.Context, dataset types2.Dataset, opts *datastore.UpdateDatasetOpts) (*types2.Dataset, error)
+	CopyDataset(ctx context.Context, sourceID, targetID string) (*types2.Dataset, error)
+	MergeDatasets(ctx context.Context, sourceID, targetID string, opts datastore.MergeDatasetsOpts) (int, int, error) // returns number of files merged and number of files skipped
+	RenameDataset(ctx context.Context, oldID, newID string) (*types2.Dataset, error)
+	BuildVectorIndex(ctx context.Context, datasetID string, config *vs.IndexConfig, rebuild bool) error
+	BenchmarkQuantization(ctx context.Context, datasetID string, opts datastore.QuantizationBenchmarkOpts) (*dstypes.QuantizationBenchmark, error)
 	Close() error
 }
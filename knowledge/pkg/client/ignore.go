@@ -13,16 +13,21 @@ import (
 const DefaultIgnoreFile = ".knowignore"
 
 var DefaultIgnorePatterns = []gitignore.Pattern{
-	gitignore.ParsePattern(DefaultIgnoreFile, nil), // Default ignore patterns
-	gitignore.ParsePattern(MetadataFilename, nil),  // Knowledge Metadata file
-	gitignore.ParsePattern("~$*", nil),             // MS Office temp files
-	gitignore.ParsePattern("$*", nil),              // Likely hidden/tempfiles
+	gitignore.ParsePattern(DefaultIgnoreFile, nil),         // Default ignore patterns
+	gitignore.ParsePattern(MetadataFilename, nil),          // Knowledge Metadata file
+	gitignore.ParsePattern("*"+MetadataSidecarSuffix, nil), // Knowledge Metadata sidecar files
+	gitignore.ParsePattern("~$*", nil),                     // MS Office temp files
+	gitignore.ParsePattern("$*", nil),                      // Likely hidden/tempfiles
 }
 
 func isIgnored(ignore gitignore.Matcher, path string) bool {
 	return ignore.Match(strings.Split(path, string(filepath.Separator)), false)
 }
 
+func isIgnoredDir(ignore gitignore.Matcher, path string) bool {
+	return ignore.Match(strings.Split(path, string(filepath.Separator)), true)
+}
+
 func readDefaultIgnoreFile(dirPath string) ([]gitignore.Pattern, error) {
 	ignoreFilePath := filepath.Join(dirPath, DefaultIgnoreFile)
 	_, err := os.Stat(ignoreFilePath)
@@ -6,10 +6,21 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/mitchellh/mapstructure"
 )
 
 const MetadataFilename = ".knowledge.json"
 
+// MetadataSidecarSuffix is appended to a file's name for its metadata sidecar (e.g. report.pdf.knowledge.json), which holds
+// the metadata of just that file, e.g. written by data source connectors.
+const MetadataSidecarSuffix = ".knowledge.json"
+
+// MetadataKeyACL is the metadata key that may hold a file-level ACL (see types.ACL), e.g. set by data source connectors.
+const MetadataKeyACL = "acl"
+
 type Metadata struct {
 	MetadataFileAbsPath string
 	Metadata            map[string]FileMetadata `json:"metadata"` // Map of file paths to metadata
@@ -47,6 +58,46 @@ func loadDirMetadata(dirPath string) (*Metadata, error) {
 	return metadata, nil
 }
 
+// loadSidecarMetadata reads the metadata sidecar of the file, if there is one.
+func loadSidecarMetadata(path string) (FileMetadata, error) {
+	sidecarPath := path + MetadataSidecarSuffix
+	fileContent, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read metadata sidecar %s: %w", sidecarPath, err)
+	}
+	return parseSidecarMetadata(sidecarPath, fileContent)
+}
+
+// parseSidecarMetadata decodes the content of the metadata sidecar at the given path.
+func parseSidecarMetadata(sidecarPath string, content []byte) (FileMetadata, error) {
+	var metadata FileMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata sidecar %s: %w", sidecarPath, err)
+	}
+	return metadata, nil
+}
+
+// sidecarTarget returns the file a metadata sidecar belongs to.
+func sidecarTarget(path string) (string, bool) {
+	if filepath.Base(path) == MetadataFilename {
+		return "", false
+	}
+	return strings.CutSuffix(path, MetadataSidecarSuffix)
+}
+
+// modifiedAt returns the later of the file's and its metadata sidecar's modification time, as the file has to be
+// ingested again when either changes, and files are only replaced if they're newer than the ingested ones.
+func modifiedAt(path string, modTime time.Time) time.Time {
+	if sidecar, err := os.Stat(path + MetadataSidecarSuffix); err == nil && sidecar.ModTime().After(modTime) {
+		return sidecar.ModTime()
+	}
+	return modTime
+}
+
+// findMetadata merges the metadata of the file from the directory metadata files (outermost first), its sidecar and the global metadata.
 func findMetadata(path string, metadataStack []Metadata, globalMetadata map[string]string) (FileMetadata, error) {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -65,9 +116,36 @@ func findMetadata(path string, metadataStack []Metadata, globalMetadata map[stri
 		}
 	}
 
+	sidecarMetadata, err := loadSidecarMetadata(absPath)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range sidecarMetadata {
+		metadata[k] = v
+	}
+
 	for k, v := range globalMetadata {
 		metadata[k] = v
 	}
 
 	return metadata, nil
 }
+
+// extractACL removes the ACL entry from the file metadata (if any) and returns it, so it doesn't end up as
+// plain document metadata. If there's no file-level ACL, the fallback is returned.
+func extractACL(metadata map[string]any, fallback *types.ACL) (*types.ACL, error) {
+	raw, ok := metadata[MetadataKeyACL]
+	if !ok {
+		return fallback, nil
+	}
+	delete(metadata, MetadataKeyACL)
+
+	acl := &types.ACL{}
+	if err := mapstructure.Decode(raw, acl); err != nil {
+		return nil, fmt.Errorf("failed to decode ACL from metadata: %w", err)
+	}
+	if acl.IsEmpty() {
+		return fallback, nil
+	}
+	return acl, nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoadSidecarMetadata(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "report.pdf")
+
+	metadata, err := loadSidecarMetadata(file)
+	require.NoError(t, err)
+	assert.Nil(t, metadata, "no sidecar")
+
+	writeFile(t, file+MetadataSidecarSuffix, `{"url": "https://example.com/report.pdf", "acl": {"owner": "alice"}}`)
+	metadata, err = loadSidecarMetadata(file)
+	require.NoError(t, err)
+	assert.Equal(t, FileMetadata{"url": "https://example.com/report.pdf", "acl": map[string]any{"owner": "alice"}}, metadata)
+
+	writeFile(t, file+MetadataSidecarSuffix, `{"url": `)
+	_, err = loadSidecarMetadata(file)
+	assert.ErrorContains(t, err, "failed to unmarshal metadata sidecar")
+}
+
+func TestSidecarTarget(t *testing.T) {
+	tests := []struct {
+		path, target string
+		ok           bool
+	}{
+		{"/docs/report.pdf.knowledge.json", "/docs/report.pdf", true},
+		{"/docs/.knowledge.json", "", false}, // directory metadata
+		{"/docs/report.pdf", "/docs/report.pdf", false},
+	}
+	for _, test := range tests {
+		target, ok := sidecarTarget(test.path)
+		assert.Equal(t, test.ok, ok, test.path)
+		if ok {
+			assert.Equal(t, test.target, target, test.path)
+		}
+	}
+}
+
+func TestFindMetadataWithSidecar(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "sub", "report.pdf")
+	writeFile(t, file, "content")
+	writeFile(t, filepath.Join(root, MetadataFilename), `{"metadata": {"sub/report.pdf": {"team": "docs", "source": "dir"}}}`)
+	writeFile(t, file+MetadataSidecarSuffix, `{"source": "sidecar", "url": "https://example.com/report.pdf"}`)
+
+	// directory metadata < sidecar < global metadata
+	metadata, err := watchFileMetadata(root, file, map[string]string{"url": "global"})
+	require.NoError(t, err)
+	assert.Equal(t, FileMetadata{"team": "docs", "source": "sidecar", "url": "global"}, metadata)
+}
+
+func TestModifiedAt(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "report.pdf")
+	writeFile(t, file, "content")
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	assert.Equal(t, modTime, modifiedAt(file, modTime), "no sidecar")
+
+	writeFile(t, file+MetadataSidecarSuffix, `{}`)
+	sidecarTime := modTime.Add(30 * time.Minute)
+	require.NoError(t, os.Chtimes(file+MetadataSidecarSuffix, sidecarTime, sidecarTime))
+	assert.Equal(t, sidecarTime, modifiedAt(file, modTime), "newer sidecar")
+
+	assert.Equal(t, sidecarTime.Add(time.Minute), modifiedAt(file, sidecarTime.Add(time.Minute)), "older sidecar")
+}
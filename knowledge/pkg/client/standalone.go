@@ -2,16 +2,20 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gptscript-ai/go-gptscript"
 	"github.com/gptscript-ai/knowledge/pkg/datastore"
 	dstypes "github.com/gptscript-ai/knowledge/pkg/datastore/types"
 	types2 "github.com/gptscript-ai/knowledge/pkg/index/types"
 	"github.com/gptscript-ai/knowledge/pkg/log"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 )
 
 type StandaloneClient struct {
@@ -57,6 +61,10 @@ func (c *StandaloneClient) GetDataset(ctx context.Context, datasetID string) (*t
 	return c.Datastore.GetDataset(ctx, datasetID)
 }
 
+func (c *StandaloneClient) DatasetStats(ctx context.Context, datasetID string) (*dstypes.DatasetStats, error) {
+	return c.Datastore.DatasetStats(ctx, datasetID)
+}
+
 func (c *StandaloneClient) ListDatasets(ctx context.Context) ([]types2.Dataset, error) {
 	ds, err := c.Datastore.ListDatasets(ctx)
 	if err != nil {
@@ -86,15 +94,32 @@ func (c *StandaloneClient) IngestFromWorkspace(ctx context.Context, datasetID st
 	}
 
 	file = strings.TrimPrefix(file, "ws://")
+	if strings.HasSuffix(file, MetadataSidecarSuffix) {
+		// metadata files are merged into the files they belong to, not ingested themselves
+		slog.Debug("Not ingesting metadata file", "path", file)
+		return nil
+	}
+
+	finfo, err := c.GPTScript.StatFileInWorkspace(ctx, file)
+	if err != nil {
+		return fmt.Errorf("failed to stat file %q: %w", file, err)
+	}
 
-	meta := make(map[string]any, len(opts.Metadata))
+	// the sidecar's metadata is overridden by the metadata given explicitly, as it is for local files
+	meta, modTime, err := c.workspaceSidecarMetadata(ctx, file, finfo.ModTime)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		meta = make(map[string]any, len(opts.Metadata))
+	}
 	for k, v := range opts.Metadata {
 		meta[k] = v
 	}
 
-	finfo, err := c.GPTScript.StatFileInWorkspace(ctx, file)
+	acl, err := extractACL(meta, opts.ACL)
 	if err != nil {
-		return fmt.Errorf("failed to stat file %q: %w", file, err)
+		return fmt.Errorf("failed to get ACL for %q: %w", file, err)
 	}
 
 	fileContent, err := c.GPTScript.ReadFileInWorkspace(ctx, file)
@@ -107,11 +132,12 @@ func (c *StandaloneClient) IngestFromWorkspace(ctx context.Context, datasetID st
 			Name:         finfo.Name,
 			AbsolutePath: fmt.Sprintf("ws://%s/%s", finfo.WorkspaceID, file),
 			Size:         finfo.Size,
-			ModifiedAt:   finfo.ModTime,
+			ModifiedAt:   modTime,
 		},
 		IsDuplicateFuncName: opts.IsDuplicateFuncName,
 		ExtraMetadata:       meta,
 		IngestionFlows:      opts.IngestionFlows,
+		ACL:                 acl,
 	}
 
 	_, err = c.Ingest(log.ToCtx(ctx, log.FromCtx(ctx).With("filepath", file).With("absolute_path", iopts.FileMetadata.AbsolutePath)), datasetID, finfo.Name, fileContent, iopts)
@@ -119,6 +145,34 @@ func (c *StandaloneClient) IngestFromWorkspace(ctx context.Context, datasetID st
 	return err
 }
 
+// workspaceSidecarMetadata reads the metadata sidecar of the workspace file, if there is one, and returns it together
+// with the later of the file's and the sidecar's modification time (see modifiedAt).
+func (c *StandaloneClient) workspaceSidecarMetadata(ctx context.Context, file string, modTime time.Time) (FileMetadata, time.Time, error) {
+	sidecarPath := file + MetadataSidecarSuffix
+	sidecar, err := c.GPTScript.StatFileInWorkspace(ctx, sidecarPath)
+	if err != nil {
+		var notFound *gptscript.NotFoundInWorkspaceError
+		if errors.As(err, &notFound) {
+			return nil, modTime, nil
+		}
+		return nil, modTime, fmt.Errorf("failed to stat metadata sidecar %q: %w", sidecarPath, err)
+	}
+
+	content, err := c.GPTScript.ReadFileInWorkspace(ctx, sidecarPath)
+	if err != nil {
+		return nil, modTime, fmt.Errorf("failed to read metadata sidecar %q: %w", sidecarPath, err)
+	}
+	metadata, err := parseSidecarMetadata(sidecarPath, content)
+	if err != nil {
+		return nil, modTime, err
+	}
+
+	if sidecar.ModTime.After(modTime) {
+		modTime = sidecar.ModTime
+	}
+	return metadata, modTime, nil
+}
+
 func (c *StandaloneClient) IngestPaths(ctx context.Context, datasetID string, opts *IngestPathsOpts, paths ...string) (int, int, error) {
 	if strings.HasPrefix(paths[0], "ws://") {
 		if len(paths) > 1 {
@@ -136,45 +190,72 @@ func (c *StandaloneClient) IngestPaths(ctx context.Context, datasetID string, op
 	}
 
 	ingestFile := func(path string, extraMetadata map[string]any) error {
-		// Gather metadata
-		finfo, err := os.Stat(path)
-		if err != nil {
-			return fmt.Errorf("failed to stat file %s: %w", path, err)
-		}
+		return c.ingestFile(ctx, datasetID, &opts.SharedIngestionOpts, path, extraMetadata)
+	}
 
-		abspath, err := filepath.Abs(path)
-		if err != nil {
-			return fmt.Errorf("failed to get absolute path for %s: %w", path, err)
-		}
+	return ingestPaths(ctx, c, opts, datasetID, ingestFile, paths...)
+}
 
-		file, err := os.ReadFile(path)
-		if err != nil {
-			return fmt.Errorf("failed to open file %s: %w", path, err)
-		}
+func (c *StandaloneClient) WatchPath(ctx context.Context, datasetID string, opts *WatchPathOpts, path string) error {
+	if strings.HasPrefix(path, "ws://") {
+		return fmt.Errorf("cannot watch workspace paths")
+	}
 
-		filename := filepath.Base(path)
-
-		iopts := datastore.IngestOpts{
-			FileMetadata: &types2.FileMetadata{
-				Name:         filepath.Base(path),
-				AbsolutePath: abspath,
-				Size:         finfo.Size(),
-				ModifiedAt:   finfo.ModTime(),
-			},
-			IsDuplicateFuncName: opts.IsDuplicateFuncName,
-			ExtraMetadata:       extraMetadata,
-		}
+	_, err := getOrCreateDataset(ctx, c, datasetID, !opts.NoCreateDataset)
+	if err != nil {
+		return err
+	}
 
-		if opts != nil {
-			iopts.IngestionFlows = opts.IngestionFlows
-		}
+	ingestFile := func(path string, extraMetadata map[string]any) error {
+		return c.ingestFile(ctx, datasetID, &opts.SharedIngestionOpts, path, extraMetadata)
+	}
 
-		_, err = c.Ingest(log.ToCtx(ctx, log.FromCtx(ctx).With("filepath", path).With("absolute_path", iopts.FileMetadata.AbsolutePath)), datasetID, filename, file, iopts)
+	return watchPath(ctx, c, opts, datasetID, ingestFile, path)
+}
 
-		return err
+func (c *StandaloneClient) ingestFile(ctx context.Context, datasetID string, opts *SharedIngestionOpts, path string, extraMetadata map[string]any) error {
+	// Gather metadata
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat file %s: %w", path, err)
 	}
 
-	return ingestPaths(ctx, c, opts, datasetID, ingestFile, paths...)
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+
+	filename := filepath.Base(path)
+
+	acl, err := extractACL(extraMetadata, opts.ACL)
+	if err != nil {
+		return fmt.Errorf("failed to get ACL for %s: %w", path, err)
+	}
+
+	iopts := datastore.IngestOpts{
+		FileMetadata: &types2.FileMetadata{
+			Name:         filepath.Base(path),
+			AbsolutePath: abspath,
+			Size:         finfo.Size(),
+			ModifiedAt:   modifiedAt(abspath, finfo.ModTime()),
+		},
+		IsDuplicateFuncName: opts.IsDuplicateFuncName,
+		ExtraMetadata:       extraMetadata,
+		ACL:                 acl,
+	}
+
+	if opts != nil {
+		iopts.IngestionFlows = opts.IngestionFlows
+	}
+
+	_, err = c.Ingest(log.ToCtx(ctx, log.FromCtx(ctx).With("filepath", path).With("absolute_path", iopts.FileMetadata.AbsolutePath)), datasetID, filename, file, iopts)
+
+	return err
 }
 
 func (c *StandaloneClient) PrunePath(ctx context.Context, datasetID string, path string, keep []string) ([]types2.File, error) {
@@ -185,6 +266,10 @@ func (c *StandaloneClient) PrunePath(ctx context.Context, datasetID string, path
 	return c.Datastore.PruneFiles(ctx, datasetID, abs, keep)
 }
 
+func (c *StandaloneClient) PruneFileVersions(ctx context.Context, datasetID string, opts datastore.PruneVersionsOpts) ([]types2.File, error) {
+	return c.Datastore.PruneFileVersions(ctx, datasetID, opts)
+}
+
 func (c *StandaloneClient) DeleteDocuments(ctx context.Context, datasetID string, documentIDs ...string) error {
 	for _, id := range documentIDs {
 		err := c.Datastore.DeleteDocument(ctx, datasetID, id)
@@ -215,6 +300,26 @@ func (c *StandaloneClient) UpdateDataset(ctx context.Context, dataset types2.Dat
 	return c.Datastore.UpdateDataset(ctx, dataset, opts)
 }
 
+func (c *StandaloneClient) CopyDataset(ctx context.Context, sourceID, targetID string) (*types2.Dataset, error) {
+	return c.Datastore.CopyDataset(ctx, sourceID, targetID)
+}
+
+func (c *StandaloneClient) MergeDatasets(ctx context.Context, sourceID, targetID string, opts datastore.MergeDatasetsOpts) (int, int, error) {
+	return c.Datastore.MergeDatasets(ctx, sourceID, targetID, opts)
+}
+
+func (c *StandaloneClient) RenameDataset(ctx context.Context, oldID, newID string) (*types2.Dataset, error) {
+	return c.Datastore.RenameDataset(ctx, oldID, newID)
+}
+
+func (c *StandaloneClient) BuildVectorIndex(ctx context.Context, datasetID string, config *vs.IndexConfig, rebuild bool) error {
+	return c.Datastore.BuildVectorIndex(ctx, datasetID, config, rebuild)
+}
+
+func (c *StandaloneClient) BenchmarkQuantization(ctx context.Context, datasetID string, opts datastore.QuantizationBenchmarkOpts) (*dstypes.QuantizationBenchmark, error) {
+	return c.Datastore.BenchmarkQuantization(ctx, datasetID, opts)
+}
+
 func (c *StandaloneClient) Close() error {
 	return c.Datastore.Close()
 }
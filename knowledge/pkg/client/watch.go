@@ -0,0 +1,408 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/documentloader"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultWatchDebounce is the default time to wait for a burst of filesystem events to settle before processing them.
+const DefaultWatchDebounce = 2 * time.Second
+
+// maxDebounceFactor limits the wait for a burst that doesn't settle (e.g. a file that is written continuously): its
+// events are processed at the latest after this many debounce intervals since the first one.
+const maxDebounceFactor = 10
+
+type WatchPathOpts struct {
+	IngestPathsOpts
+	Debounce time.Duration
+}
+
+// watchPath ingests the given directory once and then keeps watching it for changes until the context is canceled.
+// Created and modified files are (re-)ingested, removed files are deleted from the dataset.
+func watchPath(ctx context.Context, c Client, opts *WatchPathOpts, datasetID string, ingestionFunc func(path string, metadata map[string]any) error, path string) error {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path for %s: %w", path, err)
+	}
+
+	finfo, err := os.Stat(root)
+	if err != nil {
+		return fmt.Errorf("failed to get file info for %s: %w", root, err)
+	}
+	if !finfo.IsDir() {
+		return fmt.Errorf("watch mode requires a directory, but %q is a file", root)
+	}
+
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+
+	l := log.FromCtx(ctx).With("watch", root)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create filesystem watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	ignore, err := watchIgnoreMatcher(&opts.IngestPathsOpts, root)
+	if err != nil {
+		return err
+	}
+
+	// Start watching before the initial ingestion, so we don't miss anything that changes in the meantime
+	if err := addWatches(watcher, root, root, opts.Recursive, ignore); err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+	ingested, skippedUnsupported, err := ingestPaths(ctx, c, &opts.IngestPathsOpts, datasetID, ingestionFunc, root)
+	if err != nil {
+		l.Error("Initial ingestion failed", "error", err, "succeeded", ingested, "skippedUnsupported", skippedUnsupported)
+		if opts.ExitOnFailedFile {
+			return fmt.Errorf("initial ingestion failed: %w", err)
+		}
+	} else {
+		l.Info("Initial ingestion finished - watching for changes", "ingested", ingested, "skippedUnsupported", skippedUnsupported, "took", time.Since(startTime))
+	}
+
+	pending := map[string]fsnotify.Op{}
+	var batchStart time.Time
+	debounce := time.NewTimer(opts.Debounce)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.Info("Stopped watching for changes")
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			l.Error("Filesystem watcher error", "error", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			slog.Debug("Filesystem event", "path", event.Name, "op", event.Op.String())
+			if len(pending) == 0 {
+				batchStart = time.Now()
+			}
+			pending[event.Name] |= event.Op
+			debounce.Reset(min(opts.Debounce, time.Until(batchStart.Add(maxDebounceFactor*opts.Debounce))))
+		case <-debounce.C:
+			batch := pending
+			pending = map[string]fsnotify.Op{}
+			if err := syncChanges(ctx, c, watcher, opts, datasetID, ingestionFunc, root, batch); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addWatches adds a watch for the given directory below root and, if recursive, all of its subdirectories that aren't ignored.
+func addWatches(watcher *fsnotify.Watcher, root, dir string, recursive bool, ignore gitignore.Matcher) error {
+	if !recursive {
+		return watcher.Add(dir)
+	}
+	return filepath.WalkDir(dir, func(subPath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if rel, err := filepath.Rel(root, subPath); err == nil && rel != "." && isIgnoredDir(ignore, rel) {
+				slog.Debug("Not watching ignored directory", "path", subPath)
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(subPath); err != nil {
+				return fmt.Errorf("failed to watch directory %s: %w", subPath, err)
+			}
+		}
+		return nil
+	})
+}
+
+// syncChanges applies a batch of (debounced) filesystem events to the dataset.
+func syncChanges(ctx context.Context, c Client, watcher *fsnotify.Watcher, opts *WatchPathOpts, datasetID string, ingestionFunc func(path string, metadata map[string]any) error, root string, changes map[string]fsnotify.Op) error {
+	startTime := time.Now()
+
+	ignore, err := watchIgnoreMatcher(&opts.IngestPathsOpts, root)
+	if err != nil {
+		return err
+	}
+
+	var (
+		toIngest  []string
+		toDelete  []string
+		toReplace []string
+	)
+
+	for path := range changes {
+		if target, ok := sidecarTarget(path); ok {
+			// the metadata of a file changed (or was removed), so it has to be ingested again
+			if _, err := os.Stat(target); err != nil {
+				continue
+			}
+			toIngest = append(toIngest, target)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				// without the sidecar, the file isn't newer than the ingested one, so it has to go first
+				toReplace = append(toReplace, target)
+			}
+			continue
+		}
+
+		finfo, err := os.Stat(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to get file info for %s: %w", path, err)
+			}
+			// Removed or renamed (the new name comes with its own create event)
+			toDelete = append(toDelete, path)
+			continue
+		}
+
+		if finfo.IsDir() {
+			if !opts.Recursive {
+				continue
+			}
+			// New directory (e.g. moved in): watch it and ingest everything that's already in there
+			if err := addWatches(watcher, root, path, true, ignore); err != nil {
+				return err
+			}
+			err = filepath.WalkDir(path, func(subPath string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if rel, err := filepath.Rel(root, subPath); err == nil && isIgnoredDir(ignore, rel) {
+						return filepath.SkipDir
+					}
+				} else {
+					toIngest = append(toIngest, subPath)
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to walk new directory %s: %w", path, err)
+			}
+			continue
+		}
+
+		toIngest = append(toIngest, path)
+	}
+
+	slices.Sort(toIngest)
+	toIngest = slices.Compact(toIngest)
+	toIngest = slices.DeleteFunc(toIngest, func(path string) bool {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || isIgnored(ignore, rel) {
+			slog.Debug("Ignoring file", "path", path, "ignorefile", opts.IgnoreFile, "ignoreExtensions", opts.IgnoreExtensions)
+			return true
+		}
+		return false
+	})
+
+	deleted := 0
+	for _, path := range toDelete {
+		n, err := deletePath(ctx, c, datasetID, path)
+		if err != nil {
+			return err
+		}
+		deleted += n
+	}
+	for _, path := range toReplace {
+		if !slices.Contains(toIngest, path) {
+			continue
+		}
+		if _, err := deletePath(ctx, c, datasetID, path); err != nil {
+			return err
+		}
+	}
+
+	var (
+		mu                 sync.Mutex
+		ingested           int
+		skippedUnsupported int
+		failed             int
+	)
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 10
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+
+	for _, path := range toIngest {
+		g.Go(func() error {
+			if gctx.Err() != nil {
+				return gctx.Err()
+			}
+
+			fileMeta, err := watchFileMetadata(root, path, opts.Metadata)
+			if err != nil {
+				return fmt.Errorf("failed to find metadata for %s: %w", path, err)
+			}
+
+			slog.Debug("Ingesting file", "absPath", path, "metadata", fileMeta)
+
+			err = ingestionFunc(path, fileMeta)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				ingested++
+			case errors.Is(err, &documentloader.UnsupportedFileTypeError{}) && !opts.ErrOnUnsupportedFile:
+				skippedUnsupported++
+			case errors.Is(err, os.ErrNotExist):
+				// removed again before we got to it - the remove event will follow
+			default:
+				failed++
+				slog.Error("Failed to ingest file", "path", path, "error", err)
+				if opts.ExitOnFailedFile {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	slog.Info("Synced changes into dataset", "source", root, "dataset", datasetID, "ingested", ingested, "deleted", deleted, "skippedUnsupported", skippedUnsupported, "failed", failed, "took", time.Since(startTime))
+
+	return nil
+}
+
+// deletePath removes the file at path (with all of its versions) - or all files below it, if it was a directory - from the dataset.
+// It returns the number of removed files.
+func deletePath(ctx context.Context, c Client, datasetID, path string) (int, error) {
+	file, err := c.FindFile(ctx, types.File{Dataset: datasetID, FileMetadata: types.FileMetadata{AbsolutePath: path}})
+	if err != nil && !errors.Is(err, types.ErrDBFileNotFound) {
+		return 0, fmt.Errorf("failed to find file %s: %w", path, err)
+	}
+	if file != nil {
+		if err := c.DeleteFile(ctx, datasetID, file.ID); err != nil {
+			return 0, fmt.Errorf("failed to delete file %s: %w", path, err)
+		}
+		// the file is gone, so are its superseded versions (some of which may have been pruned already)
+		for version := file.Version - 1; version > 0; version-- {
+			old, err := c.FindFile(ctx, types.File{Dataset: datasetID, FileMetadata: types.FileMetadata{AbsolutePath: path}, Version: version})
+			if errors.Is(err, types.ErrDBFileNotFound) {
+				continue
+			} else if err != nil {
+				return 0, fmt.Errorf("failed to find version %d of file %s: %w", version, path, err)
+			}
+			if err := c.DeleteFile(ctx, datasetID, old.ID); err != nil {
+				return 0, fmt.Errorf("failed to delete version %d of file %s: %w", version, path, err)
+			}
+		}
+		slog.Debug("Deleted removed file", "path", path, "id", file.ID, "versions", file.Version)
+		return 1, nil
+	}
+
+	// Not a known file, so it may have been a directory: remove all files (and versions) below it.
+	// The separator is part of the prefix, so that siblings with the same name prefix (e.g. /x/foobar.md for /x/foo) are kept.
+	ds, err := c.GetDataset(ctx, datasetID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dataset %s: %w", datasetID, err)
+	}
+	if ds == nil {
+		return 0, nil
+	}
+	prefix := path + string(filepath.Separator)
+	removed := map[string]struct{}{}
+	for _, f := range ds.Files {
+		if !strings.HasPrefix(f.AbsolutePath, prefix) {
+			continue
+		}
+		if err := c.DeleteFile(ctx, datasetID, f.ID); err != nil {
+			return len(removed), fmt.Errorf("failed to delete file %s: %w", f.AbsolutePath, err)
+		}
+		removed[f.AbsolutePath] = struct{}{}
+	}
+	if len(removed) > 0 {
+		slog.Debug("Deleted files below removed directory", "path", path, "files", len(removed))
+	}
+	return len(removed), nil
+}
+
+// watchIgnoreMatcher builds the same ignore matcher that ingestPaths uses for the root path.
+// It's re-built for every batch of changes, so that edits to the .knowignore file are picked up.
+func watchIgnoreMatcher(opts *IngestPathsOpts, root string) (gitignore.Matcher, error) {
+	patterns, err := useDefaultIgnoreFileIfExists(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use default ignore file: %w", err)
+	}
+
+	if opts.IgnoreFile != "" {
+		ignoreFilePatterns, err := readIgnoreFile(opts.IgnoreFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ignore file %q: %w", opts.IgnoreFile, err)
+		}
+		patterns = append(patterns, ignoreFilePatterns...)
+	}
+
+	for _, ext := range opts.IgnoreExtensions {
+		if ext != "" {
+			patterns = append(patterns, gitignore.ParsePattern("*."+strings.TrimPrefix(ext, "."), nil))
+		}
+	}
+
+	patterns = append(patterns, DefaultIgnorePatterns...)
+
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// watchFileMetadata collects the metadata for the file at path from all metadata files between root and the file's directory.
+func watchFileMetadata(root, path string, globalMetadata map[string]string) (FileMetadata, error) {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{root}
+	if rel != "." {
+		dir := root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			dir = filepath.Join(dir, part)
+			dirs = append(dirs, dir)
+		}
+	}
+
+	var metadataStack []Metadata
+	for _, dir := range dirs {
+		m, err := loadDirMetadata(dir)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			metadataStack = append(metadataStack, *m)
+		}
+	}
+
+	return findMetadata(path, metadataStack, globalMetadata)
+}
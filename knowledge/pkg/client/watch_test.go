@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gptscript-ai/knowledge/pkg/datastore"
+	"github.com/gptscript-ai/knowledge/pkg/index"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore/hnsw"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns a standalone client with an empty dataset "dataset".
+func newTestClient(t *testing.T) (*StandaloneClient, index.Index, *hnsw.VectorStore) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	idx, err := index.New(ctx, "sqlite://"+filepath.Join(dir, "index.db"), true)
+	require.NoError(t, err)
+	require.NoError(t, idx.AutoMigrate())
+	vsdb, err := hnsw.New(ctx, "hnsw://"+filepath.Join(dir, "hnsw"), func(context.Context, string) ([]float32, error) {
+		return []float32{1, 0}, nil
+	})
+	require.NoError(t, err)
+	c := &StandaloneClient{Datastore: &datastore.Datastore{Index: idx, Vectorstore: vsdb}}
+	t.Cleanup(func() { c.Close() })
+
+	_, err = c.CreateDataset(ctx, "dataset", nil)
+	require.NoError(t, err)
+	return c, idx, vsdb
+}
+
+func TestSyncChangesSidecars(t *testing.T) {
+	c, idx, _ := newTestClient(t)
+	root := t.TempDir()
+	file := filepath.Join(root, "report.md")
+	sidecar := file + MetadataSidecarSuffix
+	writeFile(t, file, "# Report")
+	writeFile(t, sidecar, `{"url": "https://example.com/report"}`)
+
+	var (
+		mu       sync.Mutex
+		ingested map[string]map[string]any
+	)
+	ingest := func(path string, metadata map[string]any) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ingested[path] = metadata
+		return nil
+	}
+	syncBatch := func(changes map[string]fsnotify.Op) map[string]map[string]any {
+		t.Helper()
+		ingested = map[string]map[string]any{}
+		require.NoError(t, syncChanges(context.Background(), c, nil, &WatchPathOpts{}, "dataset", ingest, root, changes))
+		return ingested
+	}
+
+	// a changed sidecar ingests its file again, with the new metadata, but isn't ingested itself
+	assert.Equal(t, map[string]map[string]any{file: {"url": "https://example.com/report"}}, syncBatch(map[string]fsnotify.Op{sidecar: fsnotify.Write}))
+
+	// so does a removed sidecar, without its metadata, replacing the ingested file (which is newer than the file itself)
+	require.NoError(t, idx.CreateFile(context.Background(), types.File{
+		ID:           "report",
+		Dataset:      "dataset",
+		FileMetadata: types.FileMetadata{Name: "report.md", AbsolutePath: file, ModifiedAt: time.Now().Add(time.Hour)},
+		Version:      1,
+	}))
+	require.NoError(t, os.Remove(sidecar))
+	assert.Equal(t, map[string]map[string]any{file: {}}, syncBatch(map[string]fsnotify.Op{sidecar: fsnotify.Remove}))
+	_, err := c.FindFile(context.Background(), types.File{Dataset: "dataset", FileMetadata: types.FileMetadata{AbsolutePath: file}})
+	assert.ErrorIs(t, err, types.ErrDBFileNotFound)
+
+	// changes of the file and its sidecar ingest it once
+	writeFile(t, sidecar, `{"url": "https://example.com/report-v2"}`)
+	assert.Equal(t, map[string]map[string]any{file: {"url": "https://example.com/report-v2"}}, syncBatch(map[string]fsnotify.Op{file: fsnotify.Write, sidecar: fsnotify.Create}))
+
+	// the sidecar of a removed file is ignored
+	orphan := filepath.Join(root, "removed.md") + MetadataSidecarSuffix
+	writeFile(t, orphan, `{}`)
+	assert.Empty(t, syncBatch(map[string]fsnotify.Op{orphan: fsnotify.Create}))
+}
+
+func TestAddWatchesSkipsIgnoredDirectories(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, DefaultIgnoreFile), "node_modules/\n")
+	for _, dir := range []string{"docs/guides", "node_modules/pkg", "docs/node_modules"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+
+	ignore, err := watchIgnoreMatcher(&IngestPathsOpts{}, root)
+	require.NoError(t, err)
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(t, err)
+	defer watcher.Close()
+	require.NoError(t, addWatches(watcher, root, root, true, ignore))
+
+	// removing a watch fails for directories that aren't watched
+	for _, dir := range []string{"", "docs", "docs/guides"} {
+		assert.NoError(t, watcher.Remove(filepath.Join(root, dir)), "%s is watched", dir)
+	}
+	for _, dir := range []string{"node_modules", "node_modules/pkg", "docs/node_modules"} {
+		assert.Error(t, watcher.Remove(filepath.Join(root, dir)), "%s is ignored", dir)
+	}
+}
+
+func TestWatchDebounceLimit(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "log.md")
+	writeFile(t, file, "0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ingested := make(chan string, 100)
+	ingest := func(path string, _ map[string]any) error {
+		ingested <- path
+		return nil
+	}
+	done := make(chan error)
+	go func() {
+		done <- watchPath(ctx, nil, &WatchPathOpts{Debounce: 50 * time.Millisecond}, "dataset", ingest, root)
+	}()
+	require.Equal(t, file, <-ingested, "initial ingestion")
+
+	// a file that is written continuously is still ingested, after at most 10 debounce intervals
+	stop := time.After(5 * time.Second)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		select {
+		case path := <-ingested:
+			assert.Equal(t, file, path)
+			cancel()
+			require.NoError(t, <-done)
+			return
+		case <-stop:
+			t.Fatal("expected the changes to be ingested while the file is being written")
+		case <-ticker.C:
+			require.NoError(t, os.WriteFile(file, []byte{byte(i)}, 0644))
+		}
+	}
+}
+
+func TestDeletePathVersions(t *testing.T) {
+	ctx := context.Background()
+	c, idx, _ := newTestClient(t)
+	superseded := time.Now()
+	for _, f := range []types.File{
+		{ID: "v1", FileMetadata: types.FileMetadata{AbsolutePath: "/docs/a.md"}, Version: 1, SupersededAt: &superseded},
+		// version 2 was pruned
+		{ID: "v3", FileMetadata: types.FileMetadata{AbsolutePath: "/docs/a.md"}, Version: 3, SupersededAt: &superseded},
+		{ID: "v4", FileMetadata: types.FileMetadata{AbsolutePath: "/docs/a.md"}, Version: 4},
+		{ID: "other", FileMetadata: types.FileMetadata{AbsolutePath: "/docs/a.md.bak"}, Version: 1},
+	} {
+		f.Dataset, f.Name = "dataset", filepath.Base(f.AbsolutePath)
+		require.NoError(t, idx.CreateFile(ctx, f))
+	}
+
+	n, err := deletePath(ctx, c, "dataset", "/docs/a.md")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	ds, err := c.GetDataset(ctx, "dataset")
+	require.NoError(t, err)
+	require.Len(t, ds.Files, 1)
+	assert.Equal(t, "other", ds.Files[0].ID)
+}
+
+func TestDeletePathDirectory(t *testing.T) {
+	ctx := context.Background()
+	c, idx, vsdb := newTestClient(t)
+	for _, path := range []string{"/x/foo/a.md", "/x/foo/sub/b.md", "/x/foobar.md"} {
+		ids, err := vsdb.AddDocuments(ctx, []vs.Document{{ID: path, Content: path, Metadata: map[string]any{"absPath": path}}}, "dataset")
+		require.NoError(t, err)
+		require.NoError(t, idx.CreateFile(ctx, types.File{
+			ID:           path,
+			Dataset:      "dataset",
+			Documents:    []types.Document{{ID: ids[0], FileID: path, Dataset: "dataset"}},
+			FileMetadata: types.FileMetadata{Name: filepath.Base(path), AbsolutePath: path},
+			Version:      1,
+		}))
+	}
+
+	n, err := deletePath(ctx, c, "dataset", "/x/foo")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// the sibling with the same name prefix is kept, and the documents of the removed files are gone from the vector store
+	ds, err := c.GetDataset(ctx, "dataset")
+	require.NoError(t, err)
+	require.Len(t, ds.Files, 1)
+	assert.Equal(t, "/x/foobar.md", ds.Files[0].AbsolutePath)
+	docs, err := vsdb.GetDocuments(ctx, "dataset", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "/x/foobar.md", docs[0].ID)
+}
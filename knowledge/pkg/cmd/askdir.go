@@ -59,6 +59,7 @@ func (s *ClientAskDir) Run(cmd *cobra.Command, args []string) error {
 	retrieveOpts := &datastore.RetrieveOpts{
 		TopK:     s.TopK,
 		Keywords: s.Keywords,
+		Where:    s.Filter,
 	}
 
 	if s.FlowsFile != "" {
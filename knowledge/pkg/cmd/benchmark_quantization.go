@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+type ClientBenchmarkQuantization struct {
+	Client
+	TopK          int      `usage:"Number of results per query to compare" short:"k" default:"10"`
+	Query         []string `usage:"Query to benchmark with (can be repeated) - by default, documents of the sample are used as queries"`
+	NumQueries    int      `usage:"Number of sampled documents to use as queries, if no queries are given" default:"50"`
+	SampleSize    int      `usage:"Maximum number of documents to embed for the benchmark" default:"1000"`
+	RescoreFactor int      `usage:"Number of candidates per result to rescore" default:"4"`
+	OutputFormat  string   `name:"format" usage:"Choose an output format (table, json)" default:"table"`
+}
+
+func (s *ClientBenchmarkQuantization) Customize(cmd *cobra.Command) {
+	cmd.Use = "benchmark-quantization <dataset-id>"
+	cmd.Short = "Measure the recall of quantized embeddings on a sample of a dataset"
+	cmd.Long = `Measure how many of the exact (full precision) top k results are found with int8 and binary quantized embeddings,
+with and without rescoring, along with the storage size per embedding.
+A sample of the dataset's documents is embedded again for this, so it causes embedding API calls.`
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (s *ClientBenchmarkQuantization) Run(cmd *cobra.Command, args []string) error {
+	if !slices.Contains([]string{"table", "json"}, s.OutputFormat) {
+		return fmt.Errorf("unsupported output format %q", s.OutputFormat)
+	}
+
+	c, err := s.getClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	res, err := c.BenchmarkQuantization(cmd.Context(), args[0], datastore.QuantizationBenchmarkOpts{
+		TopK:          s.TopK,
+		Queries:       s.Query,
+		NumQueries:    s.NumQueries,
+		SampleSize:    s.SampleSize,
+		RescoreFactor: s.RescoreFactor,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to benchmark quantization: %w", err)
+	}
+
+	if s.OutputFormat == "json" {
+		jsonOutput, err := json.Marshal(res)
+		if err != nil {
+			return fmt.Errorf("failed to marshal benchmark results: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+		return nil
+	}
+
+	fmt.Printf("Dataset %q: %d documents, %d queries, top %d, %d dimensions\n\n", res.Dataset, res.Documents, res.Queries, res.TopK, res.Dimensions)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "QUANTIZATION\tRESCORE\tBYTES/VECTOR\tRECALL")
+	for _, r := range res.Results {
+		fmt.Fprintf(w, "%s\t%t\t%d\t%.3f\n", r.Quantization, r.Rescore, r.BytesPerVector, r.Recall)
+	}
+	return nil
+}
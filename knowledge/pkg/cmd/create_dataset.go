@@ -4,12 +4,33 @@ import (
 	"fmt"
 
 	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 	"github.com/spf13/cobra"
 )
 
 type ClientCreateDataset struct {
 	Client
-	ErrOnExists bool `usage:"Return an error if the dataset already exists"`
+	ErrOnExists   bool     `usage:"Return an error if the dataset already exists"`
+	Owner         string   `usage:"Owner of the dataset (restricts read access if set)"`
+	AllowedGroups []string `usage:"Groups that are allowed to read the dataset"`
+	ClientVersioningOpts
+	Quantization  string `usage:"Store quantized embeddings to save storage: none, int8 or binary (sqlite-vec and pgvector only, can't be changed later)" default:"none"`
+	Rescore       bool   `usage:"Keep full precision embeddings to rescore the results found with quantized embeddings (improves recall, saves less storage)"`
+	RescoreFactor int    `usage:"Number of candidates per result to rescore (default 4)"`
+}
+
+type ClientVersioningOpts struct {
+	Versioning       bool `usage:"Keep previous versions of re-ingested files"`
+	KeepLastVersions int  `usage:"Number of versions to keep per file, including the current one (implies --versioning, 0 = unlimited)"`
+	KeepVersionsDays int  `usage:"Number of days to keep superseded file versions for (implies --versioning, 0 = unlimited)"`
+}
+
+// versionRetention returns the retention policy set by the flags, or nil if versioning was not requested.
+func (o ClientVersioningOpts) versionRetention() *types.VersionRetention {
+	if !o.Versioning && o.KeepLastVersions <= 0 && o.KeepVersionsDays <= 0 {
+		return nil
+	}
+	return &types.VersionRetention{KeepLast: o.KeepLastVersions, KeepDays: o.KeepVersionsDays}
 }
 
 func (s *ClientCreateDataset) Customize(cmd *cobra.Command) {
@@ -27,11 +48,28 @@ func (s *ClientCreateDataset) Run(cmd *cobra.Command, args []string) error {
 
 	datasetID := args[0]
 
-	ds, err := c.CreateDataset(cmd.Context(), datasetID, &types.DatasetCreateOpts{ErrOnExists: s.ErrOnExists})
+	quantization := &vs.QuantizationConfig{Type: s.Quantization, Rescore: s.Rescore, RescoreFactor: s.RescoreFactor}
+	if err := quantization.Validate(); err != nil {
+		return err
+	}
+
+	ds, err := c.CreateDataset(cmd.Context(), datasetID, &types.DatasetCreateOpts{ErrOnExists: s.ErrOnExists, Quantization: quantization})
 	if err != nil {
 		return err
 	}
 
+	acl := &types.ACL{Owner: s.Owner, Groups: s.AllowedGroups}
+	retention := s.versionRetention()
+	if !acl.IsEmpty() || retention != nil {
+		update := types.Dataset{ID: ds.ID, VersionRetention: retention}
+		if !acl.IsEmpty() {
+			update.ACL = acl
+		}
+		if _, err := c.UpdateDataset(cmd.Context(), update, nil); err != nil {
+			return fmt.Errorf("failed to configure dataset %q: %w", ds.ID, err)
+		}
+	}
+
 	fmt.Printf("Created dataset %q\n", ds.ID)
 	return nil
 }
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/acorn-io/cmd"
+	"github.com/gptscript-ai/knowledge/pkg/datastore"
+	"github.com/spf13/cobra"
+)
+
+type ClientDataset struct {
+	Client
+}
+
+func NewDataset() *cobra.Command {
+	d := &ClientDataset{}
+	return cmd.Command(d,
+		&ClientDatasetCopy{parent: d},
+		&ClientDatasetMerge{parent: d},
+		&ClientDatasetRename{parent: d},
+	)
+}
+
+func (s *ClientDataset) Customize(cmd *cobra.Command) {
+	cmd.Use = "dataset"
+	cmd.Short = "Copy, merge and rename datasets (without re-computing embeddings)"
+	cmd.Args = cobra.NoArgs
+}
+
+func (s *ClientDataset) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
+
+type ClientDatasetCopy struct {
+	parent *ClientDataset
+}
+
+func (s *ClientDatasetCopy) Customize(cmd *cobra.Command) {
+	cmd.Use = "copy <source-dataset-id> <target-dataset-id>"
+	cmd.Short = "Copy a dataset with all its files and documents to a new dataset"
+	cmd.Args = cobra.ExactArgs(2)
+}
+
+func (s *ClientDatasetCopy) Run(cmd *cobra.Command, args []string) error {
+	c, err := s.parent.getClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	ds, err := c.CopyDataset(cmd.Context(), args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("failed to copy dataset: %w", err)
+	}
+
+	fmt.Printf("Copied dataset %q to %q (%d files)\n", args[0], ds.ID, len(ds.Files))
+	return nil
+}
+
+type ClientDatasetMerge struct {
+	parent    *ClientDataset
+	Overwrite bool `usage:"Replace files in the target dataset that have the same path as files in the source dataset (default: skip them)"`
+	Force     bool `usage:"Merge even if the datasets were embedded with different models or dimensions"`
+}
+
+func (s *ClientDatasetMerge) Customize(cmd *cobra.Command) {
+	cmd.Use = "merge <source-dataset-id> <target-dataset-id>"
+	cmd.Short = "Merge the files and documents of a dataset into another one - the source dataset is kept"
+	cmd.Args = cobra.ExactArgs(2)
+}
+
+func (s *ClientDatasetMerge) Run(cmd *cobra.Command, args []string) error {
+	c, err := s.parent.getClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	merged, skipped, err := c.MergeDatasets(cmd.Context(), args[0], args[1], datastore.MergeDatasetsOpts{
+		Overwrite: s.Overwrite,
+		Force:     s.Force,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to merge datasets: %w", err)
+	}
+
+	fmt.Printf("Merged %d files from dataset %q into %q (skipped %d existing files)\n", merged, args[0], args[1], skipped)
+	return nil
+}
+
+type ClientDatasetRename struct {
+	parent *ClientDataset
+}
+
+func (s *ClientDatasetRename) Customize(cmd *cobra.Command) {
+	cmd.Use = "rename <dataset-id> <new-dataset-id>"
+	cmd.Short = "Rename a dataset"
+	cmd.Args = cobra.ExactArgs(2)
+}
+
+func (s *ClientDatasetRename) Run(cmd *cobra.Command, args []string) error {
+	c, err := s.parent.getClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if _, err := c.RenameDataset(cmd.Context(), args[0], args[1]); err != nil {
+		return fmt.Errorf("failed to rename dataset: %w", err)
+	}
+
+	fmt.Printf("Renamed dataset %q to %q\n", args[0], args[1])
+	return nil
+}
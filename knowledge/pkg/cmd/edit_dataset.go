@@ -14,6 +14,11 @@ type ClientEditDataset struct {
 	ResetMetadata   bool              `usage:"reset metadata to default (empty)"`
 	UpdateMetadata  map[string]string `usage:"update metadata key-value pairs (existing metadata will be updated/preserved)"`
 	ReplaceMetadata map[string]string `usage:"replace metadata with key-value pairs (existing metadata will be removed)"`
+	Owner           string            `usage:"set the owner of the dataset (restricts read access)"`
+	AllowedGroups   []string          `usage:"set the groups that are allowed to read the dataset"`
+	ResetACL        bool              `usage:"remove all access restrictions from the dataset" name:"reset-acl"`
+	ClientVersioningOpts
+	DisableVersioning bool `usage:"stop keeping previous file versions (existing ones are removed by the next prune-versions)"`
 }
 
 func (s *ClientEditDataset) Customize(cmd *cobra.Command) {
@@ -21,6 +26,11 @@ func (s *ClientEditDataset) Customize(cmd *cobra.Command) {
 	cmd.Short = "Edit an existing dataset"
 	cmd.Args = cobra.ExactArgs(1)
 	cmd.MarkFlagsMutuallyExclusive("reset-metadata", "update-metadata", "replace-metadata")
+	cmd.MarkFlagsMutuallyExclusive("reset-acl", "owner")
+	cmd.MarkFlagsMutuallyExclusive("reset-acl", "allowed-groups")
+	cmd.MarkFlagsMutuallyExclusive("disable-versioning", "versioning")
+	cmd.MarkFlagsMutuallyExclusive("disable-versioning", "keep-last-versions")
+	cmd.MarkFlagsMutuallyExclusive("disable-versioning", "keep-versions-days")
 }
 
 func (s *ClientEditDataset) Run(cmd *cobra.Command, args []string) error {
@@ -60,7 +70,28 @@ func (s *ClientEditDataset) Run(cmd *cobra.Command, args []string) error {
 
 	updatedDataset.Metadata = metadata
 
-	dataset, err = c.UpdateDataset(cmd.Context(), updatedDataset, &datastore.UpdateDatasetOpts{ReplaceMedata: s.ResetMetadata || len(s.ReplaceMetadata) > 0})
+	if s.ResetACL {
+		updatedDataset.ACL = &types.ACL{}
+	} else if s.Owner != "" || len(s.AllowedGroups) > 0 {
+		acl := types.ACL{}
+		if dataset.ACL != nil {
+			acl = *dataset.ACL
+		}
+		if s.Owner != "" {
+			acl.Owner = s.Owner
+		}
+		if len(s.AllowedGroups) > 0 {
+			acl.Groups = s.AllowedGroups
+		}
+		updatedDataset.ACL = &acl
+	}
+
+	updatedDataset.VersionRetention = s.versionRetention()
+
+	dataset, err = c.UpdateDataset(cmd.Context(), updatedDataset, &datastore.UpdateDatasetOpts{
+		ReplaceMedata:     s.ResetMetadata || len(s.ReplaceMetadata) > 0,
+		DisableVersioning: s.DisableVersioning,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to update dataset: %w", err)
 	}
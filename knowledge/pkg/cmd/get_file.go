@@ -16,6 +16,7 @@ import (
 type ClientGetFile struct {
 	Client
 	Dataset string `usage:"Target Dataset ID" short:"d"`
+	Version int    `usage:"Get a specific version of the file (default: current version)"`
 }
 
 func (s *ClientGetFile) Customize(cmd *cobra.Command) {
@@ -39,6 +40,7 @@ func (s *ClientGetFile) Run(cmd *cobra.Command, args []string) error {
 
 	searchFile := types.File{
 		Dataset: s.Dataset,
+		Version: s.Version,
 	}
 
 	if strings.HasPrefix(fileRef, "/") {
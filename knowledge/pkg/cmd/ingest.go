@@ -17,12 +17,16 @@ import (
 
 	"github.com/gptscript-ai/knowledge/pkg/client"
 	flowconfig "github.com/gptscript-ai/knowledge/pkg/flows/config"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
 )
 
 type ClientIngest struct {
 	Client
 	Dataset string `usage:"Target Dataset ID" short:"d" env:"KNOW_DATASET"`
 	Prune   bool   `usage:"Prune deleted files" env:"KNOW_INGEST_PRUNE"`
+	Watch   bool   `usage:"Keep watching the directory and continuously ingest changes (created/modified files are ingested, removed files are deleted)" env:"KNOW_INGEST_WATCH"`
+	// WatchDebounce is a string, since the flag builder doesn't support durations
+	WatchDebounce string `usage:"Time to wait for a burst of filesystem changes to settle before ingesting them" default:"2s" env:"KNOW_INGEST_WATCH_DEBOUNCE"`
 	ClientIngestOpts
 	ClientFlowsConfig
 }
@@ -39,6 +43,8 @@ type ClientIngestOpts struct {
 	ExitOnFailedFile      bool              `usage:"Exit directly on failed file" default:"false" env:"KNOW_INGEST_EXIT_ON_FAILED_FILE"`
 	Metadata              map[string]string `usage:"Metadata to attach to the ingested files" env:"KNOW_INGEST_METADATA"`
 	MetadataJSON          string            `usage:"Metadata to attach to the loaded files in JSON format" env:"METADATA_JSON"`
+	Owner                 string            `usage:"Owner of the ingested files (restricts read access if set)" env:"KNOW_INGEST_OWNER"`
+	AllowedGroups         []string          `usage:"Groups that are allowed to read the ingested files" env:"KNOW_INGEST_ALLOWED_GROUPS"`
 }
 
 func (s *ClientIngest) Customize(cmd *cobra.Command) {
@@ -113,6 +119,10 @@ func (s *ClientIngest) run(ctx context.Context, filePath string) error {
 		ExitOnFailedFile:     s.ExitOnFailedFile,
 	}
 
+	if acl := (&types.ACL{Owner: s.Owner, Groups: s.AllowedGroups}); !acl.IsEmpty() {
+		ingestOpts.ACL = acl
+	}
+
 	if s.FlowsFile != "" {
 		slog.Debug("Loading ingestion flows from config", "flows_file", s.FlowsFile, "dataset", datasetID)
 
@@ -146,6 +156,20 @@ func (s *ClientIngest) run(ctx context.Context, filePath string) error {
 	}
 
 	ctx = log.ToCtx(ctx, slog.With("flow", "ingestion").With("rootPath", filePath))
+
+	if s.Watch {
+		debounce, err := time.ParseDuration(s.WatchDebounce)
+		if err != nil {
+			return fmt.Errorf("invalid watch debounce %q: %w", s.WatchDebounce, err)
+		}
+		// we can't tell which of the files were ingested before but have been removed in the meantime otherwise
+		ingestOpts.Prune = true
+		// unsupported files shouldn't stop the watch (the single-file check above doesn't apply, as we only watch directories)
+		ingestOpts.ErrOnUnsupportedFile = false
+		slog.Info("Watching for changes", "source", filePath, "dataset", datasetID, "debounce", debounce)
+		return c.WatchPath(ctx, datasetID, &client.WatchPathOpts{IngestPathsOpts: *ingestOpts, Debounce: debounce}, filePath)
+	}
+
 	startTime := time.Now()
 
 	filesIngested, skippedUnsupported, err := c.IngestPaths(ctx, datasetID, ingestOpts, filePath)
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/acorn-io/cmd"
+	"github.com/gptscript-ai/knowledge/pkg/config"
+	"github.com/gptscript-ai/knowledge/pkg/datastore"
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
+	"github.com/spf13/cobra"
+)
+
+type ClientMigrate struct {
+	Component string `usage:"Only migrate this database (index, pgvector) - required for down and for up with a target version"`
+
+	config.DatabaseConfig
+	config.VectorDBConfig
+}
+
+func NewMigrate() *cobra.Command {
+	m := &ClientMigrate{}
+	return cmd.Command(m,
+		&ClientMigrateStatus{parent: m},
+		&ClientMigrateUp{parent: m},
+		&ClientMigrateDown{parent: m},
+	)
+}
+
+func (s *ClientMigrate) Customize(cmd *cobra.Command) {
+	cmd.Use = "migrate"
+	cmd.Short = "Manage the schema migrations of the index and vector store databases"
+	cmd.Args = cobra.NoArgs
+}
+
+func (s *ClientMigrate) Run(cmd *cobra.Command, _ []string) error {
+	return cmd.Help()
+}
+
+// migrators returns the migrators of the selected databases - they have to be closed by the caller.
+func (s *ClientMigrate) migrators(cmd *cobra.Command) ([]migrate.Migrator, error) {
+	migrators, err := datastore.NewMigrators(cmd.Context(), s.DatabaseConfig.DSN, s.VectorDBConfig.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if s.Component == "" {
+		return migrators, nil
+	}
+
+	var components []string
+	for _, m := range migrators {
+		if m.Component() == s.Component {
+			closeMigrators(slices.DeleteFunc(migrators, func(o migrate.Migrator) bool { return o == m }))
+			return []migrate.Migrator{m}, nil
+		}
+		components = append(components, m.Component())
+	}
+	closeMigrators(migrators)
+	return nil, fmt.Errorf("unknown component %q - available: %s", s.Component, strings.Join(components, ", "))
+}
+
+func closeMigrators(migrators []migrate.Migrator) {
+	for _, m := range migrators {
+		_ = m.Close()
+	}
+}
+
+type ClientMigrateStatus struct {
+	parent       *ClientMigrate
+	OutputFormat string `name:"format" usage:"Choose an output format (table, json)" default:"table"`
+}
+
+func (s *ClientMigrateStatus) Customize(cmd *cobra.Command) {
+	cmd.Use = "status"
+	cmd.Short = "Show the applied and pending schema migrations"
+	cmd.Args = cobra.NoArgs
+}
+
+func (s *ClientMigrateStatus) Run(cmd *cobra.Command, _ []string) error {
+	if !slices.Contains([]string{"table", "json"}, s.OutputFormat) {
+		return fmt.Errorf("unsupported output format %q", s.OutputFormat)
+	}
+
+	migrators, err := s.parent.migrators(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeMigrators(migrators)
+
+	var statuses []*migrate.Status
+	for _, m := range migrators {
+		status, err := m.Status(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get %s migration status: %w", m.Component(), err)
+		}
+		statuses = append(statuses, status)
+	}
+
+	if s.OutputFormat == "json" {
+		jsonOutput, err := json.Marshal(statuses)
+		if err != nil {
+			return fmt.Errorf("failed to marshal migration status: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w, "COMPONENT\tVERSION\tSTATE\tAPPLIED AT\tDESCRIPTION")
+	for _, status := range statuses {
+		for _, a := range status.Applied {
+			state := "applied"
+			if a.Version > status.Latest {
+				state = "unknown (newer)"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", status.Component, a.Version, state, a.AppliedAt.Local().Format("2006-01-02 15:04:05"), a.Description)
+		}
+		for _, p := range status.Pending {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", status.Component, p.Version, "pending", "-", p.Description)
+		}
+	}
+	return nil
+}
+
+type ClientMigrateUp struct {
+	parent *ClientMigrate
+	To     int `usage:"Target version (default: latest)"`
+}
+
+func (s *ClientMigrateUp) Customize(cmd *cobra.Command) {
+	cmd.Use = "up"
+	cmd.Short = "Apply pending schema migrations"
+	cmd.Args = cobra.NoArgs
+}
+
+func (s *ClientMigrateUp) Run(cmd *cobra.Command, _ []string) error {
+	if s.To > 0 && s.parent.Component == "" {
+		return fmt.Errorf("--to requires --component, as the versions differ between the databases")
+	}
+
+	migrators, err := s.parent.migrators(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeMigrators(migrators)
+
+	for _, m := range migrators {
+		if err := m.Up(cmd.Context(), s.To); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", m.Component(), err)
+		}
+		fmt.Printf("Migrated %s\n", m.Component())
+	}
+	return nil
+}
+
+type ClientMigrateDown struct {
+	parent *ClientMigrate
+	To     int `usage:"Target version - all migrations after it are reverted (0 drops all tables!)" default:"-1"`
+}
+
+func (s *ClientMigrateDown) Customize(cmd *cobra.Command) {
+	cmd.Use = "down"
+	cmd.Short = "Revert schema migrations - this may delete data"
+	cmd.Args = cobra.NoArgs
+}
+
+func (s *ClientMigrateDown) Run(cmd *cobra.Command, _ []string) error {
+	if s.parent.Component == "" || s.To < 0 {
+		return fmt.Errorf("--component and --to are required to revert migrations")
+	}
+
+	migrators, err := s.parent.migrators(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeMigrators(migrators)
+
+	for _, m := range migrators {
+		if err := m.Down(cmd.Context(), s.To); err != nil {
+			return fmt.Errorf("failed to migrate %s down: %w", m.Component(), err)
+		}
+		fmt.Printf("Migrated %s down to version %d\n", m.Component(), s.To)
+	}
+	return nil
+}
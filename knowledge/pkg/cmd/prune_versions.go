@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/spf13/cobra"
+)
+
+type ClientPruneVersions struct {
+	Client
+	KeepLast int  `usage:"Override the dataset's retention policy: number of versions to keep per file, including the current one"`
+	KeepDays int  `usage:"Override the dataset's retention policy: number of days to keep superseded versions for"`
+	DryRun   bool `usage:"Only print the file versions that would be removed"`
+}
+
+func (s *ClientPruneVersions) Customize(cmd *cobra.Command) {
+	cmd.Use = "prune-versions <dataset-id>"
+	cmd.Short = "Remove previous file versions that exceed the dataset's retention policy"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (s *ClientPruneVersions) Run(cmd *cobra.Command, args []string) error {
+	c, err := s.getClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	datasetID := args[0]
+
+	opts := datastore.PruneVersionsOpts{DryRun: s.DryRun}
+	if s.KeepLast > 0 || s.KeepDays > 0 {
+		opts.Retention = &types.VersionRetention{KeepLast: s.KeepLast, KeepDays: s.KeepDays}
+	}
+
+	pruned, err := c.PruneFileVersions(cmd.Context(), datasetID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to prune file versions: %w", err)
+	}
+
+	for i := range pruned {
+		pruned[i].Documents = nil // Don't print documents
+	}
+
+	jsonOutput, err := json.Marshal(pruned)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pruned files: %w", err)
+	}
+
+	if s.DryRun {
+		fmt.Printf("Would prune %d file versions:\n%s\n", len(pruned), string(jsonOutput))
+	} else {
+		fmt.Printf("Pruned %d file versions:\n%s\n", len(pruned), string(jsonOutput))
+	}
+
+	return nil
+}
@@ -5,25 +5,37 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gptscript-ai/knowledge/pkg/datastore"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/retrievers"
 	flowconfig "github.com/gptscript-ai/knowledge/pkg/flows/config"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
 	vserr "github.com/gptscript-ai/knowledge/pkg/vectorstore/errors"
 	"github.com/spf13/cobra"
 )
 
 type ClientRetrieve struct {
 	Client
-	Datasets []string `usage:"Target Dataset IDs" short:"d" env:"KNOW_DATASETS" name:"dataset"`
-	Archive  string   `usage:"Path to the archive file"`
+	Datasets []string          `usage:"Target Dataset IDs" short:"d" env:"KNOW_DATASETS" name:"dataset"`
+	Archive  string            `usage:"Path to the archive file"`
+	AsOf     string            `usage:"Retrieve from the file versions that were current at the given time (RFC3339 or YYYY-MM-DD) - requires dataset versioning"`
+	Fusion   string            `usage:"How to rank the results of multiple datasets against each other: score (raw similarity scores, default), minmax (normalize scores per dataset) or rrf (reciprocal rank fusion)"`
+	Weight   map[string]string `usage:"Per-dataset weights (dataset=weight) multiplied with the fused scores" name:"dataset-weight"`
+	Quota    map[string]string `usage:"Maximum number of results per dataset (dataset=count)" name:"dataset-quota"`
+	Explain  bool              `usage:"Add the queries and candidate documents (with scores) after each stage of the retrieval flow to the output, to see which stage dropped or reordered a document"`
 	ClientRetrieveOpts
 	ClientFlowsConfig
 }
 
 type ClientRetrieveOpts struct {
-	TopK     int      `usage:"Number of sources to retrieve" short:"k" default:"10"`
-	Keywords []string `usage:"Keywords that retrieved documents must contain" short:"w" name:"keyword" env:"KNOW_RETRIEVE_KEYWORDS"`
+	TopK         int               `usage:"Number of sources to retrieve" short:"k" default:"10"`
+	Keywords     []string          `usage:"Keywords that retrieved documents must contain" short:"w" name:"keyword" env:"KNOW_RETRIEVE_KEYWORDS"`
+	Filter       map[string]string `usage:"Metadata key=value pairs that retrieved documents must match" env:"KNOW_RETRIEVE_FILTER"`
+	CallerUser   string            `usage:"User on whose behalf to retrieve - enables access control filtering" env:"KNOW_RETRIEVE_CALLER_USER"`
+	CallerGroups []string          `usage:"Groups of the caller - enables access control filtering" env:"KNOW_RETRIEVE_CALLER_GROUPS"`
 }
 
 func (s *ClientRetrieve) Customize(cmd *cobra.Command) {
@@ -60,6 +72,24 @@ func (s *ClientRetrieve) Run(cmd *cobra.Command, args []string) error {
 	retrieveOpts := datastore.RetrieveOpts{
 		TopK:     s.TopK,
 		Keywords: s.Keywords,
+		Where:    s.Filter,
+		Explain:  s.Explain,
+	}
+
+	if s.AsOf != "" {
+		retrieveOpts.AsOf, err = parseTime(s.AsOf)
+		if err != nil {
+			return fmt.Errorf("invalid --as-of: %w", err)
+		}
+	}
+
+	retrieveOpts.Fusion, err = s.datasetFusion()
+	if err != nil {
+		return err
+	}
+
+	if s.CallerUser != "" || len(s.CallerGroups) > 0 {
+		retrieveOpts.Caller = &types.Identity{User: s.CallerUser, Groups: s.CallerGroups}
 	}
 
 	if s.FlowsFile != "" {
@@ -121,3 +151,43 @@ func (s *ClientRetrieve) Run(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// datasetFusion returns the dataset fusion override given via flags, if any.
+func (s *ClientRetrieve) datasetFusion() (*retrievers.DatasetFusion, error) {
+	if s.Fusion == "" && len(s.Weight) == 0 && len(s.Quota) == 0 {
+		return nil, nil
+	}
+	fusion := &retrievers.DatasetFusion{Method: s.Fusion}
+	for ds, w := range s.Weight {
+		weight, err := strconv.ParseFloat(w, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --dataset-weight for dataset %q: %w", ds, err)
+		}
+		if fusion.Weights == nil {
+			fusion.Weights = map[string]float32{}
+		}
+		fusion.Weights[ds] = float32(weight)
+	}
+	for ds, q := range s.Quota {
+		quota, err := strconv.Atoi(q)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --dataset-quota for dataset %q: %w", ds, err)
+		}
+		if fusion.Quotas == nil {
+			fusion.Quotas = map[string]int{}
+		}
+		fusion.Quotas[ds] = quota
+	}
+	if err := fusion.Validate(); err != nil {
+		return nil, err
+	}
+	return fusion, nil
+}
+
+// parseTime parses a point in time given either as RFC3339 timestamp or as date (YYYY-MM-DD, local time).
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(time.DateOnly, s, time.Local)
+}
@@ -22,16 +22,22 @@ func New() *cobra.Command {
 		new(ClientCreateDataset),
 		new(ClientGetDataset),
 		new(ClientListDatasets),
+		new(ClientStats),
 		new(ClientIngest),
 		new(ClientDeleteDataset),
 		new(ClientDeleteFile),
 		new(ClientGetFile),
+		new(ClientPruneVersions),
+		new(ClientBuildVectorIndex),
+		new(ClientBenchmarkQuantization),
 		new(ClientRetrieve),
 		new(ClientAskDir),
 		new(ClientExportDatasets),
 		new(ClientImportDatasets),
 		new(ClientEditDataset),
+		NewDataset(),
 		new(ClientLoad),
+		NewMigrate(),
 		new(Version),
 	)
 }
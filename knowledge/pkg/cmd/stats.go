@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dstypes "github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	"github.com/spf13/cobra"
+)
+
+type ClientStats struct {
+	Client
+	Archive      string `usage:"Path to the archive file"`
+	OutputFormat string `name:"format" usage:"Choose an output format (table, json)" default:"table"`
+}
+
+func (s *ClientStats) Customize(cmd *cobra.Command) {
+	cmd.Use = "stats [<dataset-id>...]"
+	cmd.Short = "Show statistics about datasets (all datasets if none are given)"
+}
+
+func (s *ClientStats) Run(cmd *cobra.Command, args []string) error {
+	if !slices.Contains([]string{"table", "json"}, s.OutputFormat) {
+		return fmt.Errorf("unsupported output format %q", s.OutputFormat)
+	}
+
+	c, err := s.getClient(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	datasetIDs := args
+	if len(datasetIDs) == 0 {
+		datasets, err := c.ListDatasets(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to list datasets: %w", err)
+		}
+		for _, ds := range datasets {
+			datasetIDs = append(datasetIDs, ds.ID)
+		}
+	}
+
+	stats := make([]dstypes.DatasetStats, 0, len(datasetIDs))
+	for _, id := range datasetIDs {
+		st, err := c.DatasetStats(cmd.Context(), id)
+		if err != nil {
+			return fmt.Errorf("failed to get stats for dataset %q: %w", id, err)
+		}
+		stats = append(stats, *st)
+	}
+
+	if s.OutputFormat == "json" {
+		jsonOutput, err := json.Marshal(stats)
+		if err != nil {
+			return fmt.Errorf("failed to marshal stats: %w", err)
+		}
+		fmt.Println(string(jsonOutput))
+		return nil
+	}
+
+	if len(stats) == 0 {
+		fmt.Println("no datasets found")
+		return nil
+	}
+
+	for i, st := range stats {
+		if i > 0 {
+			fmt.Println()
+		}
+		printStatsTable(st)
+	}
+	return nil
+}
+
+func printStatsTable(st dstypes.DatasetStats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fileTypes := make([]string, 0, len(st.FilesByType))
+	for _, ext := range slices.Sorted(maps.Keys(st.FilesByType)) {
+		fileTypes = append(fileTypes, fmt.Sprintf("%s=%d", ext, st.FilesByType[ext]))
+	}
+
+	tokens := fmt.Sprintf("avg %.1f / min %d / max %d", st.ChunkTokens.Average, st.ChunkTokens.Min, st.ChunkTokens.Max)
+	if st.ChunkTokens.Uncounted > 0 {
+		tokens += fmt.Sprintf(" (%d chunks not counted)", st.ChunkTokens.Uncounted)
+	}
+
+	lastIngested := "-"
+	if st.LastIngestedAt != nil {
+		lastIngested = st.LastIngestedAt.Format(time.RFC3339)
+	}
+
+	fmt.Fprintf(w, "Dataset:\t%s\n", st.ID)
+	fmt.Fprintf(w, "Files:\t%d\n", st.Files)
+	fmt.Fprintf(w, "Files by type:\t%s\n", strings.Join(fileTypes, ", "))
+	fmt.Fprintf(w, "Chunks:\t%d\n", st.Chunks)
+	fmt.Fprintf(w, "Chunk tokens:\t%s\n", tokens)
+	fmt.Fprintf(w, "Embedding dimensions:\t%d\n", st.EmbeddingDimensions)
+	fmt.Fprintf(w, "Embedding quantization:\t%s\n", st.EmbeddingQuantization)
+	fmt.Fprintf(w, "Vector store size:\t%s\n", formatBytes(st.VectorStoreSizeBytes))
+	fmt.Fprintf(w, "Last ingestion:\t%s\n", lastIngested)
+	fmt.Fprintf(w, "Files without documents:\t%d\n", len(st.EmptyFiles))
+	for _, f := range st.EmptyFiles {
+		fmt.Fprintf(w, "\t- %s\n", f)
+	}
+}
+
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,286 @@
+package datastore
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultBenchmarkTopK       = 10
+	defaultBenchmarkQueries    = 50
+	defaultBenchmarkSampleSize = 1000
+
+	benchmarkEmbeddingConcurrency = 10
+)
+
+type QuantizationBenchmarkOpts struct {
+	TopK int
+	// Queries to run - if empty, NumQueries documents of the sample are used as queries (excluding themselves from the results)
+	Queries    []string
+	NumQueries int
+	// SampleSize is the maximum number of documents to (re-)embed for the benchmark
+	SampleSize    int
+	RescoreFactor int
+}
+
+// BenchmarkQuantization measures how well quantized embeddings retain the results of a full precision search
+// on a sample of the dataset's documents: the documents are embedded once and searched exhaustively with the
+// full precision and each of the quantized embeddings (the way sqlite-vec stores them), with and without rescoring.
+// This is independent of the vector store's configuration and ANN index, so it can be used to choose a quantization
+// before (re-)creating the dataset.
+func (s *Datastore) BenchmarkQuantization(ctx context.Context, datasetID string, opts QuantizationBenchmarkOpts) (*types.QuantizationBenchmark, error) {
+	if opts.TopK <= 0 {
+		opts.TopK = defaultBenchmarkTopK
+	}
+	if opts.NumQueries <= 0 {
+		opts.NumQueries = defaultBenchmarkQueries
+	}
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = defaultBenchmarkSampleSize
+	}
+	if opts.RescoreFactor <= 0 {
+		opts.RescoreFactor = vs.DefaultRescoreFactor
+	}
+
+	ds, err := s.GetDataset(ctx, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	if ds == nil {
+		return nil, fmt.Errorf("dataset %q not found", datasetID)
+	}
+
+	ef, err := s.datasetEmbeddingFunc(ds)
+	if err != nil {
+		return nil, err
+	}
+	if ef == nil {
+		if ef, err = s.EmbeddingModelProvider.EmbeddingFunc(); err != nil {
+			return nil, fmt.Errorf("failed to create embedding function: %w", err)
+		}
+	}
+
+	docs, err := s.Vectorstore.GetDocuments(ctx, datasetID, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents: %w", err)
+	}
+	if len(docs) <= opts.TopK {
+		return nil, fmt.Errorf("dataset %q has too few documents (%d) for a benchmark with top k = %d", datasetID, len(docs), opts.TopK)
+	}
+
+	// Fixed seed, so that repeated runs use the same sample
+	rng := rand.New(rand.NewPCG(uint64(len(docs)), 0))
+	rng.Shuffle(len(docs), func(i, j int) { docs[i], docs[j] = docs[j], docs[i] })
+	docs = docs[:min(len(docs), opts.SampleSize)]
+
+	texts := make([]string, 0, len(docs)+len(opts.Queries))
+	for _, doc := range docs {
+		texts = append(texts, doc.Content)
+	}
+	texts = append(texts, opts.Queries...)
+
+	slog.Info("Embedding documents for the quantization benchmark", "dataset", datasetID, "documents", len(docs), "queries", len(opts.Queries))
+	vectors := make([][]float32, len(texts))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(benchmarkEmbeddingConcurrency)
+	for i, text := range texts {
+		g.Go(func() error {
+			emb, err := ef(gctx, text)
+			if err != nil {
+				return fmt.Errorf("failed to embed document: %w", err)
+			}
+			vectors[i] = vs.NormalizeVector(emb)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	docVectors := vectors[:len(docs)]
+	var (
+		queryVectors [][]float32
+		// queryDocs are the indexes of the documents used as queries, which are excluded from their results
+		queryDocs []int
+	)
+	if len(opts.Queries) > 0 {
+		queryVectors = vectors[len(docs):]
+	} else {
+		for i := range min(opts.NumQueries, len(docs)) {
+			queryVectors = append(queryVectors, docVectors[i])
+			queryDocs = append(queryDocs, i)
+		}
+	}
+
+	return runQuantizationBenchmark(datasetID, docVectors, queryVectors, queryDocs, opts.TopK, opts.RescoreFactor), nil
+}
+
+func runQuantizationBenchmark(datasetID string, docs, queries [][]float32, queryDocs []int, topK, rescoreFactor int) *types.QuantizationBenchmark {
+	dims := len(docs[0])
+
+	int8Docs := make([][]int8, len(docs))
+	binaryDocs := make([][]uint64, len(docs))
+	for i, d := range docs {
+		int8Docs[i] = quantizeInt8(d)
+		binaryDocs[i] = quantizeBinary(d)
+	}
+
+	type variant struct {
+		quantization string
+		rescore      bool
+		bytes        int64
+		// distance between the query (by index) and a document (by index)
+		distance func(q, d int) float64
+	}
+
+	int8Queries := make([][]int8, len(queries))
+	binaryQueries := make([][]uint64, len(queries))
+	for i, q := range queries {
+		int8Queries[i] = quantizeInt8(q)
+		binaryQueries[i] = quantizeBinary(q)
+	}
+
+	exactDistance := func(q, d int) float64 { return 1 - dot(queries[q], docs[d]) }
+	int8Distance := func(q, d int) float64 { return cosineDistanceInt8(int8Queries[q], int8Docs[d]) }
+	binaryDistance := func(q, d int) float64 { return float64(hammingDistance(binaryQueries[q], binaryDocs[d])) }
+
+	fullBytes := int64(dims) * 4
+	variants := []variant{
+		{vs.QuantizationInt8, false, int64(dims), int8Distance},
+		{vs.QuantizationInt8, true, int64(dims) + fullBytes, int8Distance},
+		{vs.QuantizationBinary, false, int64(dims+7) / 8, binaryDistance},
+		{vs.QuantizationBinary, true, int64(dims+7)/8 + fullBytes, binaryDistance},
+	}
+
+	result := &types.QuantizationBenchmark{
+		Dataset:    datasetID,
+		Documents:  len(docs),
+		Queries:    len(queries),
+		TopK:       topK,
+		Dimensions: dims,
+		Results:    []types.QuantizationBenchmarkResult{{Quantization: vs.QuantizationNone, BytesPerVector: fullBytes, Recall: 1}},
+	}
+
+	candidatesFor := func(q int) []int {
+		candidates := make([]int, 0, len(docs))
+		for d := range docs {
+			if q < len(queryDocs) && queryDocs[q] == d {
+				continue
+			}
+			candidates = append(candidates, d)
+		}
+		return candidates
+	}
+
+	for _, v := range variants {
+		var found, total int
+		for q := range queries {
+			candidates := candidatesFor(q)
+			exact := nearest(candidates, topK, func(d int) float64 { return exactDistance(q, d) })
+
+			var results []int
+			if v.rescore {
+				results = nearest(candidates, topK*rescoreFactor, func(d int) float64 { return v.distance(q, d) })
+				results = nearest(results, topK, func(d int) float64 { return exactDistance(q, d) })
+			} else {
+				results = nearest(candidates, topK, func(d int) float64 { return v.distance(q, d) })
+			}
+
+			for _, d := range results {
+				if slices.Contains(exact, d) {
+					found++
+				}
+			}
+			total += len(exact)
+		}
+
+		result.Results = append(result.Results, types.QuantizationBenchmarkResult{
+			Quantization:   v.quantization,
+			Rescore:        v.rescore,
+			BytesPerVector: v.bytes,
+			Recall:         float64(found) / float64(max(total, 1)),
+		})
+	}
+
+	return result
+}
+
+// nearest returns the (up to) k candidates with the smallest distance.
+func nearest(candidates []int, k int, distance func(d int) float64) []int {
+	type scored struct {
+		d    int
+		dist float64
+	}
+	all := make([]scored, len(candidates))
+	for i, d := range candidates {
+		all[i] = scored{d, distance(d)}
+	}
+	slices.SortStableFunc(all, func(a, b scored) int { return cmp.Compare(a.dist, b.dist) })
+
+	res := make([]int, 0, k)
+	for _, s := range all[:min(k, len(all))] {
+		res = append(res, s.d)
+	}
+	return res
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// quantizeInt8 maps values in [-1, 1] to int8, like sqlite-vec's vec_quantize_int8(v, 'unit') does with the normalized
+// vectors the store passes in (see vs.NormalizeVector).
+func quantizeInt8(v []float32) []int8 {
+	const step = 2.0 / 255
+	res := make([]int8, len(v))
+	for i, x := range v {
+		res[i] = int8(max(-128, min(127, (float64(x)+1)/step-128)))
+	}
+	return res
+}
+
+func cosineDistanceInt8(a, b []int8) float64 {
+	var dotProduct, normA, normB float64
+	for i := range a {
+		dotProduct += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 1
+	}
+	return 1 - dotProduct/math.Sqrt(normA*normB)
+}
+
+// quantizeBinary sets a bit for every positive value, like sqlite-vec's vec_quantize_binary and pgvector's binary_quantize.
+func quantizeBinary(v []float32) []uint64 {
+	res := make([]uint64, (len(v)+63)/64)
+	for i, x := range v {
+		if x > 0 {
+			res[i/64] |= 1 << (i % 64)
+		}
+	}
+	return res
+}
+
+func hammingDistance(a, b []uint64) int {
+	var dist int
+	for i := range a {
+		dist += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return dist
+}
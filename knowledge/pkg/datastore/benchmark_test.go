@@ -0,0 +1,41 @@
+package datastore
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunQuantizationBenchmark(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	docs := make([][]float32, 200)
+	for i := range docs {
+		v := make([]float32, 64)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		docs[i] = vs.NormalizeVector(v)
+	}
+	queryDocs := []int{0, 1, 2, 3, 4}
+	queries := docs[:len(queryDocs)]
+
+	res := runQuantizationBenchmark("test", docs, queries, queryDocs, 10, 4)
+	require.Len(t, res.Results, 5)
+	require.Equal(t, 64, res.Dimensions)
+
+	recall := map[string]float64{}
+	for _, r := range res.Results {
+		require.GreaterOrEqual(t, r.Recall, 0.0)
+		require.LessOrEqual(t, r.Recall, 1.0)
+		key := r.Quantization
+		if r.Rescore {
+			key += "+rescore"
+		}
+		recall[key] = r.Recall
+	}
+	require.Equal(t, 1.0, recall[vs.QuantizationNone])
+	require.Greater(t, recall[vs.QuantizationInt8], 0.8)
+	require.GreaterOrEqual(t, recall[vs.QuantizationBinary+"+rescore"], recall[vs.QuantizationBinary])
+}
@@ -0,0 +1,309 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings"
+	etypes "github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore"
+)
+
+type MergeDatasetsOpts struct {
+	// Overwrite replaces files of the target dataset that have the same path as a file of the source dataset - by default, those are skipped
+	Overwrite bool
+	// Force merges the datasets even if they were embedded with different models, which makes similarity scores meaningless
+	Force bool
+}
+
+// CopyDataset creates the target dataset as a copy of the source dataset, including its settings, files and documents.
+// The embeddings are copied from the vector store instead of being re-computed.
+func (s *Datastore) CopyDataset(ctx context.Context, sourceID, targetID string) (*types.Dataset, error) {
+	src, err := s.getDatasetsForCopy(ctx, sourceID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.createDatasetLike(ctx, src, targetID); err != nil {
+		return nil, err
+	}
+
+	if err := s.copyFiles(ctx, sourceID, targetID, src.Files, nil); err != nil {
+		if derr := s.DeleteDataset(ctx, targetID); derr != nil {
+			slog.Error("Failed to remove incomplete dataset copy", "dataset", targetID, "error", derr)
+		}
+		return nil, err
+	}
+
+	slog.Info("Copied dataset", "source", sourceID, "target", targetID, "files", len(src.Files))
+	return s.GetDataset(ctx, targetID)
+}
+
+// RenameDataset renames a dataset. If the vector store can't rename collections in place,
+// the dataset is copied to the new ID (with new document IDs where the store requires them) and removed afterwards.
+func (s *Datastore) RenameDataset(ctx context.Context, oldID, newID string) (*types.Dataset, error) {
+	src, err := s.getDatasetsForCopy(ctx, oldID, newID)
+	if err != nil {
+		return nil, err
+	}
+
+	renamer, ok := s.Vectorstore.(vectorstore.CollectionRenamer)
+	if !ok {
+		ds, err := s.CopyDataset(ctx, oldID, newID)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.DeleteDataset(ctx, oldID); err != nil {
+			return nil, fmt.Errorf("copied dataset %q to %q, but failed to remove it: %w", oldID, newID, err)
+		}
+		slog.Info("Renamed dataset", "old", oldID, "new", newID)
+		return ds, nil
+	}
+
+	target := *src
+	target.ID = newID
+	target.Files = nil
+	if err := s.Index.CreateDataset(ctx, target, &types.DatasetCreateOpts{ErrOnExists: true}); err != nil {
+		return nil, err
+	}
+
+	if err := renamer.RenameCollection(ctx, oldID, newID); err != nil {
+		if derr := s.Index.DeleteDataset(ctx, newID); derr != nil {
+			slog.Error("Failed to remove renamed dataset from index", "dataset", newID, "error", derr)
+		}
+		return nil, fmt.Errorf("failed to rename collection: %w", err)
+	}
+
+	// The document IDs are kept, so the files and documents are just moved over in the index
+	if err := s.createFiles(ctx, newID, src.Files, nil, nil); err != nil {
+		if rerr := renamer.RenameCollection(ctx, newID, oldID); rerr != nil {
+			slog.Error("Failed to revert collection rename", "old", oldID, "new", newID, "error", rerr)
+		} else if derr := s.Index.DeleteDataset(ctx, newID); derr != nil {
+			slog.Error("Failed to remove renamed dataset from index", "dataset", newID, "error", derr)
+		}
+		return nil, err
+	}
+
+	if err := s.Index.DeleteDataset(ctx, oldID); err != nil {
+		return nil, fmt.Errorf("renamed dataset %q to %q, but failed to remove the old one from the index: %w", oldID, newID, err)
+	}
+
+	slog.Info("Renamed dataset", "old", oldID, "new", newID)
+	return s.GetDataset(ctx, newID)
+}
+
+// MergeDatasets copies the files and documents of the source dataset into the target dataset, without re-computing
+// the embeddings. Files whose path already exists in the target dataset are skipped, unless opts.Overwrite is set.
+// The source dataset is left unchanged. Returns the number of merged and skipped files.
+func (s *Datastore) MergeDatasets(ctx context.Context, sourceID, targetID string, opts MergeDatasetsOpts) (int, int, error) {
+	if sourceID == targetID {
+		return 0, 0, fmt.Errorf("cannot merge dataset %q into itself", sourceID)
+	}
+
+	src, err := s.GetDataset(ctx, sourceID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if src == nil {
+		return 0, 0, fmt.Errorf("dataset not found: %s", sourceID)
+	}
+	dst, err := s.GetDataset(ctx, targetID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if dst == nil {
+		return 0, 0, fmt.Errorf("dataset not found: %s", targetID)
+	}
+
+	if err := checkEmbeddingsCompatible(src, dst); err != nil {
+		if !opts.Force {
+			return 0, 0, fmt.Errorf("%w - use force to merge anyway", err)
+		}
+		slog.Warn("Merging datasets with incompatible embeddings", "source", sourceID, "target", targetID, "reason", err)
+	}
+
+	takenIDs := make(map[string]bool, len(dst.Files))
+	targetPaths := map[string][]types.File{}
+	for _, f := range dst.Files {
+		takenIDs[f.ID] = true
+		if f.AbsolutePath != "" {
+			targetPaths[f.AbsolutePath] = append(targetPaths[f.AbsolutePath], f)
+		}
+	}
+
+	var (
+		files   []types.File
+		skipped int
+	)
+	for _, f := range src.Files {
+		existing := targetPaths[f.AbsolutePath]
+		if len(existing) > 0 && !opts.Overwrite {
+			slog.Debug("Skipping file that already exists in target dataset", "path", f.AbsolutePath, "dataset", targetID)
+			skipped++
+			continue
+		}
+		for _, e := range existing {
+			if err := s.DeleteFile(ctx, targetID, e.ID); err != nil {
+				return 0, skipped, fmt.Errorf("failed to remove file %q from dataset %q: %w", e.AbsolutePath, targetID, err)
+			}
+			delete(takenIDs, e.ID)
+		}
+		delete(targetPaths, f.AbsolutePath)
+		files = append(files, f)
+	}
+
+	if err := s.copyFiles(ctx, sourceID, targetID, files, takenIDs); err != nil {
+		return 0, skipped, err
+	}
+
+	// A target dataset without documents may not have an embeddings config yet - it's now embedded like the source
+	if dst.EmbeddingsProviderConfig == nil && src.EmbeddingsProviderConfig != nil && len(files) > 0 {
+		if _, err := s.UpdateDataset(ctx, types.Dataset{ID: targetID, EmbeddingsProviderConfig: src.EmbeddingsProviderConfig, EmbeddingDimensions: src.EmbeddingDimensions}, nil); err != nil {
+			return len(files), skipped, fmt.Errorf("failed to update embeddings config of dataset %q: %w", targetID, err)
+		}
+	}
+
+	slog.Info("Merged datasets", "source", sourceID, "target", targetID, "files", len(files), "skipped", skipped)
+	return len(files), skipped, nil
+}
+
+// getDatasetsForCopy returns the source dataset, making sure that the target dataset doesn't exist yet.
+func (s *Datastore) getDatasetsForCopy(ctx context.Context, sourceID, targetID string) (*types.Dataset, error) {
+	if targetID == "" {
+		return nil, fmt.Errorf("target dataset ID is required")
+	}
+
+	src, err := s.GetDataset(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, fmt.Errorf("dataset not found: %s", sourceID)
+	}
+
+	dst, err := s.GetDataset(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if dst != nil {
+		return nil, fmt.Errorf("dataset already exists: %s", targetID)
+	}
+	return src, nil
+}
+
+// createDatasetLike creates a dataset with the settings of the given one, including the quantization of its collection.
+func (s *Datastore) createDatasetLike(ctx context.Context, src *types.Dataset, targetID string) error {
+	stats, err := s.Vectorstore.CollectionStats(ctx, src.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get collection stats of dataset %q: %w", src.ID, err)
+	}
+
+	target := *src
+	target.ID = targetID
+	target.Files = nil
+	return s.CreateDataset(ctx, target, &types.DatasetCreateOpts{ErrOnExists: true, Quantization: stats.Quantization})
+}
+
+// copyFiles copies the files with their documents and embeddings from the source into the target dataset.
+// Files keep their IDs, unless they're taken in the target dataset. On error, the copied files are removed again.
+// Documents only carry the principals of their file's ACL, which is copied along, so the target dataset's ACL applies.
+func (s *Datastore) copyFiles(ctx context.Context, sourceID, targetID string, files []types.File, takenIDs map[string]bool) error {
+	var docIDs []string
+	for _, f := range files {
+		for _, d := range f.Documents {
+			docIDs = append(docIDs, d.ID)
+		}
+	}
+	if len(docIDs) == 0 {
+		// An empty list would copy all documents
+		return s.createFiles(ctx, targetID, files, map[string]string{}, takenIDs)
+	}
+
+	copied, err := s.Vectorstore.CopyDocuments(ctx, sourceID, targetID, docIDs)
+	if err != nil {
+		return fmt.Errorf("failed to copy documents from dataset %q to %q: %w", sourceID, targetID, err)
+	}
+
+	if err := s.createFiles(ctx, targetID, files, copied, takenIDs); err != nil {
+		for _, id := range copied {
+			if rerr := s.Vectorstore.RemoveDocument(ctx, id, targetID, nil, nil); rerr != nil {
+				slog.Error("Failed to remove copied document", "dataset", targetID, "document", id, "error", rerr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// createFiles records the files in the target dataset of the index, with the document IDs mapped by docIDs
+// (nil keeps them). On error, the files created so far are removed again.
+func (s *Datastore) createFiles(ctx context.Context, targetID string, files []types.File, docIDs map[string]string, takenIDs map[string]bool) error {
+	var created []string
+	for _, f := range files {
+		file := types.File{
+			ID:           f.ID,
+			Dataset:      targetID,
+			FileMetadata: f.FileMetadata,
+			ACL:          f.ACL,
+			Version:      f.Version,
+			IngestedAt:   f.IngestedAt,
+			SupersededAt: f.SupersededAt,
+		}
+		if takenIDs[file.ID] {
+			file.ID = uuid.NewString()
+		}
+
+		for _, d := range f.Documents {
+			id := d.ID
+			if docIDs != nil {
+				var ok bool
+				if id, ok = docIDs[d.ID]; !ok {
+					slog.Warn("Document not found in vector store - skipping it", "document", d.ID, "file", f.AbsolutePath)
+					continue
+				}
+			}
+			file.Documents = append(file.Documents, types.Document{ID: id, Dataset: targetID, FileID: file.ID, Index: d.Index, Tokens: d.Tokens})
+		}
+
+		if err := s.Index.CreateFile(ctx, file); err != nil {
+			var errs []error
+			for _, id := range created {
+				errs = append(errs, s.Index.DeleteFile(ctx, targetID, id))
+			}
+			if cerr := errors.Join(errs...); cerr != nil {
+				slog.Error("Failed to remove copied files from index", "dataset", targetID, "error", cerr)
+			}
+			return fmt.Errorf("failed to create file %q in dataset %q: %w", f.AbsolutePath, targetID, err)
+		}
+		created = append(created, file.ID)
+	}
+	return nil
+}
+
+// checkEmbeddingsCompatible returns an error if the documents of the datasets were embedded differently,
+// so that they can't be searched together.
+func checkEmbeddingsCompatible(source, target *types.Dataset) error {
+	if source.EmbeddingsProviderConfig == nil || target.EmbeddingsProviderConfig == nil {
+		return nil // at least one of them wasn't ingested into yet
+	}
+
+	sp, err := embeddings.ProviderFromConfig(*source.EmbeddingsProviderConfig)
+	if err != nil {
+		return fmt.Errorf("failed to get embeddings model provider of dataset %q: %w", source.ID, err)
+	}
+	tp, err := embeddings.ProviderFromConfig(*target.EmbeddingsProviderConfig)
+	if err != nil {
+		return fmt.Errorf("failed to get embeddings model provider of dataset %q: %w", target.ID, err)
+	}
+
+	if sp.Name() != tp.Name() || sp.EmbeddingModelName() != tp.EmbeddingModelName() || etypes.EmbeddingDimensions(sp) != etypes.EmbeddingDimensions(tp) {
+		return fmt.Errorf("dataset %q is embedded with %s/%s (%d dimensions), but dataset %q with %s/%s (%d dimensions)",
+			source.ID, sp.Name(), sp.EmbeddingModelName(), etypes.EmbeddingDimensions(sp),
+			target.ID, tp.Name(), tp.EmbeddingModelName(), etypes.EmbeddingDimensions(tp))
+	}
+	return nil
+}
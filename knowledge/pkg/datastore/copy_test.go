@@ -0,0 +1,188 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/knowledge/pkg/index"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore/hnsw"
+	sqlite_vec "github.com/gptscript-ai/knowledge/pkg/vectorstore/sqlite-vec"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEmbeddingFunc(_ context.Context, text string) ([]float32, error) {
+	return []float32{1, float32(len(text)), 0, 0, 0, 0, 0, 1}, nil
+}
+
+func newTestDatastore(t *testing.T, store string) *Datastore {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	idx, err := index.New(ctx, "sqlite://"+filepath.Join(dir, "index.db"), true)
+	require.NoError(t, err)
+	require.NoError(t, idx.AutoMigrate())
+
+	var vsdb vectorstore.VectorStore
+	switch store {
+	case "hnsw":
+		vsdb, err = hnsw.New(ctx, "hnsw://"+filepath.Join(dir, "hnsw"), testEmbeddingFunc)
+	case "sqlite-vec":
+		vsdb, err = sqlite_vec.New(ctx, "sqlite-vec://"+filepath.Join(dir, "vec.db"), testEmbeddingFunc)
+	}
+	require.NoError(t, err)
+
+	ds := &Datastore{Index: idx, Vectorstore: vsdb}
+	t.Cleanup(func() { _ = ds.Close() })
+	return ds
+}
+
+// addTestFile adds a file with the given number of documents to the dataset, bypassing the ingestion flow.
+func addTestFile(t *testing.T, ds *Datastore, datasetID, path string, numDocs int) {
+	t.Helper()
+	ctx := context.Background()
+
+	docs := make([]vs.Document, numDocs)
+	for i := range docs {
+		docs[i] = vs.Document{
+			ID:       fmt.Sprintf("%s-%s-%d", datasetID, path, i),
+			Content:  fmt.Sprintf("%s part %d", path, i),
+			Metadata: map[string]any{"absPath": path},
+		}
+	}
+	ids, err := ds.Vectorstore.AddDocuments(ctx, docs, datasetID)
+	require.NoError(t, err)
+
+	file := types.File{ID: fmt.Sprintf("%s-%s", datasetID, path), Dataset: datasetID, FileMetadata: types.FileMetadata{Name: path, AbsolutePath: path}, Version: 1}
+	for i, id := range ids {
+		file.Documents = append(file.Documents, types.Document{ID: id, Dataset: datasetID, FileID: file.ID, Index: i})
+	}
+	require.NoError(t, ds.Index.CreateFile(ctx, file))
+}
+
+// requireConsistent checks that the dataset's documents in the index match the ones in the vector store.
+func requireConsistent(t *testing.T, ds *Datastore, datasetID string, numFiles, numDocs int) {
+	t.Helper()
+	ctx := context.Background()
+
+	dataset, err := ds.GetDataset(ctx, datasetID)
+	require.NoError(t, err)
+	require.NotNil(t, dataset)
+	require.Len(t, dataset.Files, numFiles)
+
+	docs, err := ds.Vectorstore.GetDocuments(ctx, datasetID, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, numDocs)
+
+	stored := map[string]bool{}
+	for _, d := range docs {
+		stored[d.ID] = true
+	}
+	for _, f := range dataset.Files {
+		for _, d := range f.Documents {
+			assert.True(t, stored[d.ID], "document %s of file %s is missing in the vector store", d.ID, f.AbsolutePath)
+		}
+	}
+}
+
+func TestCopyMergeRenameDataset(t *testing.T) {
+	for _, store := range []string{"hnsw", "sqlite-vec"} {
+		t.Run(store, func(t *testing.T) {
+			ctx := context.Background()
+			ds := newTestDatastore(t, store)
+
+			require.NoError(t, ds.CreateDataset(ctx, types.Dataset{ID: "a", Metadata: map[string]any{"team": "x"}}, nil))
+			addTestFile(t, ds, "a", "/one", 2)
+			addTestFile(t, ds, "a", "/two", 3)
+
+			// Copy
+			copied, err := ds.CopyDataset(ctx, "a", "b")
+			require.NoError(t, err)
+			assert.Equal(t, "x", copied.Metadata["team"])
+			requireConsistent(t, ds, "b", 2, 5)
+			requireConsistent(t, ds, "a", 2, 5)
+
+			_, err = ds.CopyDataset(ctx, "a", "b")
+			require.ErrorContains(t, err, "already exists")
+
+			// Merge: files with the same path are skipped, unless they should be overwritten
+			require.NoError(t, ds.CreateDataset(ctx, types.Dataset{ID: "c"}, nil))
+			addTestFile(t, ds, "c", "/two", 1)
+			addTestFile(t, ds, "c", "/three", 1)
+
+			merged, skipped, err := ds.MergeDatasets(ctx, "c", "b", MergeDatasetsOpts{})
+			require.NoError(t, err)
+			assert.Equal(t, 1, merged)
+			assert.Equal(t, 1, skipped)
+			requireConsistent(t, ds, "b", 3, 6)
+
+			merged, skipped, err = ds.MergeDatasets(ctx, "c", "b", MergeDatasetsOpts{Overwrite: true})
+			require.NoError(t, err)
+			assert.Equal(t, 2, merged)
+			assert.Equal(t, 0, skipped)
+			requireConsistent(t, ds, "b", 3, 4)
+
+			// Rename
+			renamed, err := ds.RenameDataset(ctx, "b", "d")
+			require.NoError(t, err)
+			assert.Equal(t, "d", renamed.ID)
+			requireConsistent(t, ds, "d", 3, 4)
+
+			old, err := ds.GetDataset(ctx, "b")
+			require.NoError(t, err)
+			assert.Nil(t, old)
+			if docs, err := ds.Vectorstore.GetDocuments(ctx, "b", nil, nil); err == nil {
+				assert.Empty(t, docs) // some stores don't fail for unknown collections
+			}
+		})
+	}
+}
+
+func TestMergeDatasetsACL(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t, "hnsw")
+
+	require.NoError(t, ds.CreateDataset(ctx, types.Dataset{ID: "src", ACL: &types.ACL{Owner: "alice"}}, nil))
+	require.NoError(t, ds.CreateDataset(ctx, types.Dataset{ID: "dst", ACL: &types.ACL{Groups: []string{"eng"}}}, nil))
+	addTestFile(t, ds, "src", "/public", 1)
+
+	// a file with its own ACL, whose principals are stamped onto its documents on ingestion
+	fileACL := &types.ACL{Owner: "carol"}
+	ids, err := ds.Vectorstore.AddDocuments(ctx, []vs.Document{{
+		ID:       "restricted-0",
+		Content:  "/restricted part 0",
+		Metadata: map[string]any{"absPath": "/restricted", vs.DocMetadataKeyACLPrincipals: vs.EncodeACLPrincipals(fileACL.Principals())},
+	}}, "src")
+	require.NoError(t, err)
+	require.NoError(t, ds.Index.CreateFile(ctx, types.File{
+		ID: "restricted", Dataset: "src", FileMetadata: types.FileMetadata{Name: "/restricted", AbsolutePath: "/restricted"}, ACL: fileACL, Version: 1,
+		Documents: []types.Document{{ID: ids[0], Dataset: "src", FileID: "restricted"}},
+	}))
+
+	_, _, err = ds.MergeDatasets(ctx, "src", "dst", MergeDatasetsOpts{})
+	require.NoError(t, err)
+
+	// readers of the target dataset see the merged files, unless restricted by the file's own ACL
+	search := func(caller *types.Identity) []string {
+		readable, err := ds.filterReadableDatasets(ctx, []string{"dst"}, caller)
+		require.NoError(t, err)
+		var paths []string
+		for _, id := range readable {
+			docs, err := ds.Vectorstore.SimilaritySearch(vs.WithAccessFilter(ctx, caller.Principals()), "part", 10, id, nil, nil, testEmbeddingFunc)
+			require.NoError(t, err)
+			for _, doc := range docs {
+				paths = append(paths, doc.Metadata["absPath"].(string))
+			}
+		}
+		return paths
+	}
+	assert.Equal(t, []string{"/public"}, search(&types.Identity{User: "bob", Groups: []string{"eng"}}))
+	assert.ElementsMatch(t, []string{"/public", "/restricted"}, search(&types.Identity{User: "carol", Groups: []string{"eng"}}))
+	assert.Empty(t, search(&types.Identity{User: "alice"}))
+}
@@ -6,10 +6,13 @@ import (
 	"log/slog"
 
 	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 )
 
 type UpdateDatasetOpts struct {
-	ReplaceMedata bool
+	ReplaceMedata     bool
+	DisableVersioning bool // Stop keeping previous file versions (existing ones are removed on the next prune)
 }
 
 func (s *Datastore) CreateDataset(ctx context.Context, dataset types.Dataset, opts *types.DatasetCreateOpts) error {
@@ -79,6 +82,23 @@ func (s *Datastore) UpdateDataset(ctx context.Context, updatedDataset types.Data
 	if updatedDataset.EmbeddingsProviderConfig != nil {
 		origDS.EmbeddingsProviderConfig = updatedDataset.EmbeddingsProviderConfig
 	}
+	if updatedDataset.EmbeddingDimensions > 0 {
+		origDS.EmbeddingDimensions = updatedDataset.EmbeddingDimensions
+	}
+
+	// An empty ACL removes any existing access restrictions
+	if updatedDataset.ACL != nil {
+		origDS.ACL = updatedDataset.ACL
+		if origDS.ACL.IsEmpty() {
+			origDS.ACL = nil
+		}
+	}
+
+	if opts.DisableVersioning {
+		origDS.VersionRetention = nil
+	} else if updatedDataset.VersionRetention != nil {
+		origDS.VersionRetention = updatedDataset.VersionRetention
+	}
 
 	// Check if there is any other non-null field in the updatedDataset
 	if updatedDataset.Files != nil {
@@ -89,3 +109,22 @@ func (s *Datastore) UpdateDataset(ctx context.Context, updatedDataset types.Data
 
 	return origDS, s.Index.UpdateDataset(ctx, *origDS)
 }
+
+// BuildVectorIndex (re-)builds the approximate nearest neighbor index of the dataset in the vector store.
+// The config is merged into the dataset's current index configuration - nil keeps it as is.
+func (s *Datastore) BuildVectorIndex(ctx context.Context, datasetID string, config *vs.IndexConfig, rebuild bool) error {
+	ds, err := s.GetDataset(ctx, datasetID)
+	if err != nil {
+		return err
+	}
+	if ds == nil {
+		return fmt.Errorf("dataset not found: %s", datasetID)
+	}
+
+	builder, ok := s.Vectorstore.(vectorstore.IndexBuilder)
+	if !ok {
+		return fmt.Errorf("vector store %T does not support configurable indexes", s.Vectorstore)
+	}
+
+	return builder.BuildIndex(ctx, datasetID, config, rebuild)
+}
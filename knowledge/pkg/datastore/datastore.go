@@ -14,6 +14,7 @@ import (
 	"github.com/gptscript-ai/knowledge/pkg/config"
 	etypes "github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	"github.com/gptscript-ai/knowledge/pkg/log"
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
 	"github.com/gptscript-ai/knowledge/pkg/output"
 
 	"github.com/adrg/xdg"
@@ -277,3 +278,27 @@ func zipDir(src, dst string) error {
 		return nil
 	})
 }
+
+// NewMigrators opens the index and vector store without migrating them and returns their schema migrators.
+// Vector stores without versioned schema migrations are skipped.
+func NewMigrators(ctx context.Context, indexDSN, vectorDSN string) ([]migrate.Migrator, error) {
+	indexDSN, vectorDSN, _, err := GetDefaultDSNs(indexDSN, vectorDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine datastore paths: %w", err)
+	}
+
+	indexMigrator, err := index.NewMigrator(ctx, indexDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+
+	vectorMigrator, err := vectorstore.NewMigrator(ctx, vectorDSN)
+	if err != nil {
+		_ = indexMigrator.Close()
+		return nil, fmt.Errorf("failed to open vector store: %w", err)
+	}
+	if vectorMigrator == nil {
+		return []migrate.Migrator{indexMigrator}, nil
+	}
+	return []migrate.Migrator{indexMigrator, vectorMigrator}, nil
+}
@@ -57,6 +57,14 @@ func DedupeUpsert(ctx context.Context, d *Datastore, datasetID string, content [
 
 	// If incoming file is newer than the existing file, delete the existing file
 	if res.ModifiedAt.Before(opts.FileMetadata.ModifiedAt) {
+		ds, err := d.GetDataset(ctx, datasetID)
+		if err != nil {
+			return false, err
+		}
+		if ds.VersioningEnabled() {
+			slog.Debug("Upserting as new version of existing file", "file", res.ID, "absPath", res.AbsolutePath, "version", res.Version)
+			return false, nil
+		}
 		slog.Debug("Upserting by deleting existing file", "file", res.ID, "absPath", res.AbsolutePath, "modified_at", res.ModifiedAt, "new_modified_at", opts.FileMetadata.ModifiedAt)
 		err = d.DeleteFile(ctx, datasetID, res.ID)
 		if err != nil {
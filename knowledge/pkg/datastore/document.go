@@ -23,5 +23,15 @@ func (s *Datastore) DeleteDocument(ctx context.Context, documentID, datasetID st
 }
 
 func (s *Datastore) GetDocuments(ctx context.Context, datasetID string, where map[string]string, whereDocument []chromem.WhereDocument) ([]types.Document, error) {
-	return s.Vectorstore.GetDocuments(ctx, datasetID, where, whereDocument)
+	hidden, err := s.hiddenDocumentIDs(ctx, datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := s.Vectorstore.GetDocuments(ctx, datasetID, where, whereDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterDocumentVersions(docs, hidden, len(docs)), nil
 }
@@ -1,8 +1,11 @@
 package embeddings
 
 import (
+	"context"
+
 	"github.com/gptscript-ai/knowledge/pkg/config"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/openai"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/vertex"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/assert"
@@ -136,3 +139,39 @@ func TestExportConfigWithNilPointer(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "input must be a non-nil pointe")
 }
+
+func TestProviderDimensions(t *testing.T) {
+	p, err := ProviderFromConfig(config.ModelProviderConfig{
+		Type:   "ollama",
+		Config: map[string]any{"model": "nomic-embed-text", "dimensions": 256},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 256, types.EmbeddingDimensions(p))
+
+	// The dimensions are recorded with the dataset's provider config
+	cfg, err := AsEmbeddingModelProviderConfig(p, true)
+	require.NoError(t, err)
+	require.EqualValues(t, 256, cfg.Config["dimensions"])
+
+	p, err = ProviderFromConfig(config.ModelProviderConfig{Type: "cohere", Config: map[string]any{}})
+	require.NoError(t, err)
+	require.Equal(t, 0, types.EmbeddingDimensions(p))
+}
+
+func TestTruncateEmbeddingFunc(t *testing.T) {
+	ef := func(_ context.Context, _ string) ([]float32, error) {
+		return []float32{0.6, 0.8, 0, 0}, nil
+	}
+
+	emb, err := types.TruncateEmbeddingFunc(ef, 1)(context.Background(), "foo")
+	require.NoError(t, err)
+	require.Equal(t, []float32{1}, emb)
+
+	_, err = types.TruncateEmbeddingFunc(ef, 8)(context.Background(), "foo")
+	require.Error(t, err)
+
+	_, err = types.ValidateEmbeddingFunc(ef, 4)(context.Background(), "foo")
+	require.NoError(t, err)
+	_, err = types.ValidateEmbeddingFunc(ef, 2)(context.Background(), "foo")
+	require.Error(t, err)
+}
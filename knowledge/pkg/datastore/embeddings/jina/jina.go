@@ -6,12 +6,15 @@ import (
 
 	"dario.cat/mergo"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/load"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	cg "github.com/philippgille/chromem-go"
 )
 
 type EmbeddingProviderJina struct {
 	APIKey string `koanf:"apiKey" env:"JINA_API_KEY" export:"false"`
 	Model  string `koanf:"model" env:"JINA_MODEL" export:"required"`
+	// Dimensions reduces the embeddings to the given number of dimensions by truncation (for Matryoshka models), 0 = model default
+	Dimensions int `koanf:"dimensions" env:"JINA_DIMENSIONS"`
 }
 
 const EmbeddingProviderJinaName = "jina"
@@ -24,6 +27,14 @@ func (p *EmbeddingProviderJina) EmbeddingModelName() string {
 	return p.Model
 }
 
+func (p *EmbeddingProviderJina) EmbeddingDimensions() int {
+	return p.Dimensions
+}
+
+func (p *EmbeddingProviderJina) UseEmbeddingDimensions(dims int) {
+	p.Dimensions = dims
+}
+
 func (p *EmbeddingProviderJina) Name() string {
 	return EmbeddingProviderJinaName
 }
@@ -53,7 +64,10 @@ func (p *EmbeddingProviderJina) fillDefaults() error {
 }
 
 func (p *EmbeddingProviderJina) EmbeddingFunc() (cg.EmbeddingFunc, error) {
-	return cg.NewEmbeddingFuncJina(p.APIKey, cg.EmbeddingModelJina(p.Model)), nil
+	if p.Dimensions < 0 {
+		return nil, fmt.Errorf("invalid number of embedding dimensions: %d", p.Dimensions)
+	}
+	return types.TruncateEmbeddingFunc(cg.NewEmbeddingFuncJina(p.APIKey, cg.EmbeddingModelJina(p.Model)), p.Dimensions), nil
 }
 
 func (p *EmbeddingProviderJina) Config() any {
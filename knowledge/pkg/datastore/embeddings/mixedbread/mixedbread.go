@@ -6,12 +6,15 @@ import (
 
 	"dario.cat/mergo"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/load"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	cg "github.com/philippgille/chromem-go"
 )
 
 type EmbeddingProviderMixedbread struct {
 	APIKey string `koanf:"apiKey" env:"MIXEDBREAD_API_KEY" export:"false"`
 	Model  string `koanf:"model" env:"MIXEDBREAD_MODEL" export:"required"`
+	// Dimensions reduces the embeddings to the given number of dimensions by truncation (for Matryoshka models), 0 = model default
+	Dimensions int `koanf:"dimensions" env:"MIXEDBREAD_DIMENSIONS"`
 }
 
 func (p *EmbeddingProviderMixedbread) UseEmbeddingModel(model string) {
@@ -24,6 +27,14 @@ func (p *EmbeddingProviderMixedbread) EmbeddingModelName() string {
 	return p.Model
 }
 
+func (p *EmbeddingProviderMixedbread) EmbeddingDimensions() int {
+	return p.Dimensions
+}
+
+func (p *EmbeddingProviderMixedbread) UseEmbeddingDimensions(dims int) {
+	p.Dimensions = dims
+}
+
 func (p *EmbeddingProviderMixedbread) Name() string {
 	return EmbeddingProviderMixedbreadName
 }
@@ -53,7 +64,10 @@ func (p *EmbeddingProviderMixedbread) fillDefaults() error {
 }
 
 func (p *EmbeddingProviderMixedbread) EmbeddingFunc() (cg.EmbeddingFunc, error) {
-	return cg.NewEmbeddingFuncMixedbread(p.APIKey, cg.EmbeddingModelMixedbread(p.Model)), nil
+	if p.Dimensions < 0 {
+		return nil, fmt.Errorf("invalid number of embedding dimensions: %d", p.Dimensions)
+	}
+	return types.TruncateEmbeddingFunc(cg.NewEmbeddingFuncMixedbread(p.APIKey, cg.EmbeddingModelMixedbread(p.Model)), p.Dimensions), nil
 }
 
 func (p *EmbeddingProviderMixedbread) Config() any {
@@ -7,12 +7,15 @@ import (
 	"dario.cat/mergo"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/load"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/openai"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	cg "github.com/philippgille/chromem-go"
 )
 
 type EmbeddingProviderOllama struct {
 	BaseURL string `koanf:"baseURL" env:"OLLAMA_BASE_URL"`
 	Model   string `koanf:"model" env:"OLLAMA_MODEL" export:"required"`
+	// Dimensions reduces the embeddings to the given number of dimensions by truncation (for Matryoshka models), 0 = model default
+	Dimensions int `koanf:"dimensions" env:"OLLAMA_DIMENSIONS"`
 }
 
 func (p *EmbeddingProviderOllama) UseEmbeddingModel(model string) {
@@ -25,6 +28,14 @@ func (p *EmbeddingProviderOllama) EmbeddingModelName() string {
 	return p.Model
 }
 
+func (p *EmbeddingProviderOllama) EmbeddingDimensions() int {
+	return p.Dimensions
+}
+
+func (p *EmbeddingProviderOllama) UseEmbeddingDimensions(dims int) {
+	p.Dimensions = dims
+}
+
 func (p *EmbeddingProviderOllama) Name() string {
 	return EmbeddingProviderOllamaName
 }
@@ -55,8 +66,12 @@ func (p *EmbeddingProviderOllama) fillDefaults() error {
 }
 
 func (p *EmbeddingProviderOllama) EmbeddingFunc() (cg.EmbeddingFunc, error) {
+	if p.Dimensions < 0 {
+		return nil, fmt.Errorf("invalid number of embedding dimensions: %d", p.Dimensions)
+	}
 	cfg := openai.NewOpenAICompatConfig(p.BaseURL, "", p.Model)
-	return openai.NewEmbeddingFuncOpenAICompat(cfg), nil
+	// Ollama's OpenAI compatible API ignores the dimensions parameter, so we truncate the embeddings ourselves
+	return types.TruncateEmbeddingFunc(openai.NewEmbeddingFuncOpenAICompat(cfg), p.Dimensions), nil
 }
 
 func (p *EmbeddingProviderOllama) Config() any {
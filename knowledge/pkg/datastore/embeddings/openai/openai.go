@@ -37,6 +37,7 @@ type EmbeddingModelProviderOpenAI struct {
 	APIVersion        string            `usage:"OpenAI API version (for Azure)" default:"2024-02-01" env:"OPENAI_API_VERSION" koanf:"apiVersion"`
 	APIType           string            `usage:"OpenAI API type (OPEN_AI, AZURE, AZURE_AD, ...)" default:"OPEN_AI" env:"OPENAI_API_TYPE" koanf:"apiType"`
 	AzureOpenAIConfig AzureOpenAIConfig `koanf:"azure"`
+	Dimensions        int               `usage:"Number of embedding dimensions (text-embedding-3 models only, 0 = model default - text-embedding-3-large is reduced from 3072 to 2000 dimensions by default)" env:"OPENAI_EMBEDDING_DIMENSIONS" koanf:"dimensions"`
 }
 
 type OpenAIConfig struct {
@@ -77,6 +78,14 @@ func (p *EmbeddingModelProviderOpenAI) EmbeddingModelName() string {
 	return p.EmbeddingModel
 }
 
+func (p *EmbeddingModelProviderOpenAI) EmbeddingDimensions() int {
+	return p.Dimensions
+}
+
+func (p *EmbeddingModelProviderOpenAI) UseEmbeddingDimensions(dims int) {
+	p.Dimensions = dims
+}
+
 func (p *EmbeddingModelProviderOpenAI) Name() string {
 	return EmbeddingModelProviderOpenAIName
 }
@@ -120,6 +129,10 @@ func (p *EmbeddingModelProviderOpenAI) fillDefaults() error {
 func (p *EmbeddingModelProviderOpenAI) EmbeddingFunc() (cg.EmbeddingFunc, error) {
 	var embeddingFunc cg.EmbeddingFunc
 
+	if p.Dimensions < 0 {
+		return nil, fmt.Errorf("invalid number of embedding dimensions: %d", p.Dimensions)
+	}
+
 	switch strings.ToLower(p.APIType) {
 	// except for Azure, most other OpenAI API compatible providers only differ in the normalization of output vectors (apart from the obvious API endpoint, etc.)
 	case "azure", "azure_ad":
@@ -138,12 +151,11 @@ func (p *EmbeddingModelProviderOpenAI) EmbeddingFunc() (cg.EmbeddingFunc, error)
 
 		slog.Debug("Using Azure OpenAI API", "deploymentURL", deploymentURL.String(), "APIVersion", p.APIVersion)
 
-		embeddingFunc = NewEmbeddingFuncAzureOpenAI(
-			p.APIKey,
-			deploymentURL.String(),
-			p.APIVersion,
-			"",
-		)
+		cfg := NewOpenAICompatConfig(deploymentURL.String(), p.APIKey, "").
+			WithHeaders(map[string]string{"api-key": p.APIKey}).
+			WithQueryParams(map[string]string{"api-version": p.APIVersion}).
+			WithDimensions(p.Dimensions)
+		embeddingFunc = NewEmbeddingFuncOpenAICompat(cfg)
 	case "open_ai":
 		cfg := NewOpenAICompatConfig(
 			p.BaseURL,
@@ -151,7 +163,8 @@ func (p *EmbeddingModelProviderOpenAI) EmbeddingFunc() (cg.EmbeddingFunc, error)
 			p.EmbeddingModel,
 		).
 			WithNormalized(true).
-			WithEmbeddingsEndpoint(p.EmbeddingEndpoint)
+			WithEmbeddingsEndpoint(p.EmbeddingEndpoint).
+			WithDimensions(p.Dimensions)
 		embeddingFunc = NewEmbeddingFuncOpenAICompat(cfg)
 	default:
 		return nil, fmt.Errorf("unknown OpenAI API type: %q", p.APIType)
@@ -202,9 +215,12 @@ func NewEmbeddingFuncOpenAICompat(config *OpenAICompatConfig) cg.EmbeddingFunc {
 			EncodingFormat: "float",
 		}
 
-		// Only set dimensions for text-embedding-3-large
-		if config.model == "text-embedding-3-large" {
-			dims := 2000
+		// Reduce the dimensions of text-embedding-3-large by default, as pgvector's ANN indexes support at most 2000 dimensions
+		dims := config.dimensions
+		if dims == 0 && config.model == "text-embedding-3-large" {
+			dims = 2000
+		}
+		if dims > 0 {
 			embedReq.Dimensions = &dims
 		}
 
@@ -262,6 +278,9 @@ func NewEmbeddingFuncOpenAICompat(config *OpenAICompatConfig) cg.EmbeddingFunc {
 		}
 
 		v := embeddingResponse.Data[0].Embedding
+		if config.dimensions > 0 && len(v) != config.dimensions {
+			return nil, fmt.Errorf("embedding model %q returned %d dimensions instead of the requested %d - it may not support reducing the dimensions", config.model, len(v), config.dimensions)
+		}
 		if config.normalized != nil {
 			if *config.normalized {
 				return v, nil
@@ -376,6 +395,7 @@ type OpenAICompatConfig struct {
 	// Optional
 	normalized         *bool
 	embeddingsEndpoint string
+	dimensions         int
 	headers            map[string]string
 	queryParams        map[string]string
 }
@@ -405,6 +425,12 @@ func (c *OpenAICompatConfig) WithQueryParams(queryParams map[string]string) *Ope
 	return c
 }
 
+// WithDimensions requests embeddings with the given number of dimensions (0 = model default), which only some models support.
+func (c *OpenAICompatConfig) WithDimensions(dimensions int) *OpenAICompatConfig {
+	c.dimensions = dimensions
+	return c
+}
+
 func (c *OpenAICompatConfig) WithNormalized(normalized bool) *OpenAICompatConfig {
 	c.normalized = &normalized
 	return c
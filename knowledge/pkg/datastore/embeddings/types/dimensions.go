@@ -0,0 +1,61 @@
+package types
+
+import (
+	"context"
+	"fmt"
+
+	cg "github.com/philippgille/chromem-go"
+)
+
+// EmbeddingDimensionsProvider is implemented by providers that can produce embeddings with a reduced number of dimensions,
+// e.g. for Matryoshka embedding models like OpenAI's text-embedding-3 models.
+type EmbeddingDimensionsProvider interface {
+	// EmbeddingDimensions returns the configured number of dimensions - 0 means the model's default
+	EmbeddingDimensions() int
+	UseEmbeddingDimensions(dims int)
+}
+
+// EmbeddingDimensions returns the configured number of embedding dimensions of the provider - 0 means the model's default,
+// which is also the case for providers that don't support reducing the dimensions.
+func EmbeddingDimensions(p EmbeddingModelProvider) int {
+	if dp, ok := p.(EmbeddingDimensionsProvider); ok {
+		return dp.EmbeddingDimensions()
+	}
+	return 0
+}
+
+// TruncateEmbeddingFunc returns an embedding function that reduces the embeddings of ef to dims dimensions by truncating
+// and re-normalizing them, which is how Matryoshka embeddings are meant to be shortened. dims <= 0 returns ef as is.
+func TruncateEmbeddingFunc(ef cg.EmbeddingFunc, dims int) cg.EmbeddingFunc {
+	if dims <= 0 {
+		return ef
+	}
+	return func(ctx context.Context, text string) ([]float32, error) {
+		emb, err := ef(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		if len(emb) < dims {
+			return nil, fmt.Errorf("embedding model returned %d dimensions, which is less than the configured %d dimensions", len(emb), dims)
+		}
+		return cg.NormalizeVector(emb[:dims]), nil
+	}
+}
+
+// ValidateEmbeddingFunc returns an embedding function that fails if the embeddings of ef don't have exactly dims dimensions,
+// e.g. because the configured embedding model differs from the one a dataset was embedded with. dims <= 0 returns ef as is.
+func ValidateEmbeddingFunc(ef cg.EmbeddingFunc, dims int) cg.EmbeddingFunc {
+	if dims <= 0 {
+		return ef
+	}
+	return func(ctx context.Context, text string) ([]float32, error) {
+		emb, err := ef(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		if len(emb) != dims {
+			return nil, fmt.Errorf("embedding has %d dimensions, but %d dimensions are expected", len(emb), dims)
+		}
+		return emb, nil
+	}
+}
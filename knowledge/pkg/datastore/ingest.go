@@ -3,6 +3,7 @@ package datastore
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/gptscript-ai/knowledge/pkg/datastore/documentloader"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings"
+	etypes "github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	"github.com/gptscript-ai/knowledge/pkg/index/types"
 	"github.com/gptscript-ai/knowledge/pkg/log"
 	"github.com/gptscript-ai/knowledge/pkg/output"
@@ -27,6 +29,7 @@ type IngestOpts struct {
 	IsDuplicateFunc     IsDuplicateFunc
 	IngestionFlows      []flows.IngestionFlow
 	ExtraMetadata       map[string]any
+	ACL                 *types.ACL // File-level ACL - further restricts access to the file, on top of the dataset's ACL
 }
 
 // Ingest loads a document from a reader and adds it to the dataset.
@@ -83,6 +86,14 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 			}
 		}
 
+		// Embeddings with different dimensions can't be searched together, so we don't even try to add them
+		if dims, configuredDims := etypes.EmbeddingDimensions(dsEmbeddingProvider), etypes.EmbeddingDimensions(s.EmbeddingModelProvider); dims != configuredDims {
+			return nil, fmt.Errorf("dataset %q is embedded with %d dimensions, but the embeddings model provider is configured for %d dimensions (0 = model default)", datasetID, dims, configuredDims)
+		}
+		if configuredDims := etypes.EmbeddingDimensions(s.EmbeddingModelProvider); configuredDims > 0 && ds.EmbeddingDimensions > 0 && configuredDims != ds.EmbeddingDimensions {
+			return nil, fmt.Errorf("dataset %q is embedded with %d dimensions, but the embeddings model provider is configured for %d dimensions", datasetID, ds.EmbeddingDimensions, configuredDims)
+		}
+
 		if os.Getenv("KNOW_STRICT_EMBEDDING_CONFIG_CHECK") != "" {
 			err = embeddings.CompareRequiredFields(s.EmbeddingModelProvider.Config(), dsEmbeddingProvider.Config())
 			if err != nil {
@@ -165,6 +176,13 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 			metadata[k] = v
 		}
 	}
+
+	// Access Control: stamp the principals of the file-level ACL onto every document, so the vectorstore can filter on them.
+	// The dataset's ACL is not stamped, as it's checked on retrieval and may change after ingestion.
+	if !opts.ACL.IsEmpty() {
+		metadata[vs.DocMetadataKeyACLPrincipals] = vs.EncodeACLPrincipals(opts.ACL.Principals())
+	}
+
 	em := &transformers.ExtraMetadata{Metadata: metadata}
 	ingestionFlow.Transformations = append(ingestionFlow.Transformations, em)
 
@@ -182,14 +200,31 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 	// Sort documents
 	vs.SortAndEnsureDocIndex(docs)
 
-	// Before adding doc, we need to remove the existing documents for duplicates or old contents
-	statusLog.With("component", "vectorstore").With("action", "remove").Debug("Removing existing documents")
-	where := map[string]string{
-		"absPath": opts.FileMetadata.AbsolutePath,
-	}
-	if err := s.Vectorstore.RemoveDocument(ctx, "", datasetID, where, nil); err != nil {
-		statusLog.With("status", "failed").With("component", "vectorstore").Error("Failed to remove existing documents", "error", err)
-		return nil, err
+	// Versioning: keep the existing documents - the current version of the file is superseded after adding the new one
+	var (
+		previousVersion *types.File
+		latestVersion   int
+	)
+	if ds.VersioningEnabled() {
+		previousVersion, err = s.Index.FindFileByMetadata(ctx, datasetID, types.FileMetadata{AbsolutePath: opts.FileMetadata.AbsolutePath}, false)
+		if err != nil && !errors.Is(err, types.ErrDBFileNotFound) {
+			return nil, fmt.Errorf("failed to find previous version of file %q: %w", opts.FileMetadata.AbsolutePath, err)
+		}
+		// If the current version was deleted, the numbering continues after the versions that are still kept
+		latestVersion, err = s.Index.LatestFileVersion(ctx, datasetID, opts.FileMetadata.AbsolutePath)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Before adding doc, we need to remove the existing documents for duplicates or old contents
+		statusLog.With("component", "vectorstore").With("action", "remove").Debug("Removing existing documents")
+		where := map[string]string{
+			"absPath": opts.FileMetadata.AbsolutePath,
+		}
+		if err := s.Vectorstore.RemoveDocument(ctx, "", datasetID, where, nil); err != nil {
+			statusLog.With("status", "failed").With("component", "vectorstore").Error("Failed to remove existing documents", "error", err)
+			return nil, err
+		}
 	}
 
 	// Add documents to VectorStore -> This generates the embeddings
@@ -208,6 +243,7 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 	statusLog.Debug("Added documents to vectorstore", "duration", time.Since(startTime))
 
 	// Record file and documents in database
+	countTokens := tokenCounter()
 	dbDocs := make([]types.Document, len(docIDs))
 	for idx, docID := range docIDs {
 		dbDocs[idx] = types.Document{
@@ -216,6 +252,9 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 			Dataset: datasetID,
 			Index:   idx,
 		}
+		if countTokens != nil {
+			dbDocs[idx].Tokens = countTokens(docs[idx].Content)
+		}
 	}
 
 	dbFile := types.File{
@@ -225,6 +264,12 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 		FileMetadata: types.FileMetadata{
 			Name: filename,
 		},
+		Version:    latestVersion + 1,
+		IngestedAt: time.Now(),
+	}
+
+	if !opts.ACL.IsEmpty() {
+		dbFile.ACL = opts.ACL
 	}
 
 	if opts.FileMetadata != nil {
@@ -243,7 +288,38 @@ func (s *Datastore) Ingest(ctx context.Context, datasetID string, filename strin
 	}
 	iLog.Info("Created file in index", "duration", time.Since(startTime))
 
+	if ds.EmbeddingDimensions == 0 {
+		s.recordEmbeddingDimensions(ctx, datasetID)
+	}
+
+	if previousVersion != nil {
+		if err := s.supersedeFile(ctx, *previousVersion, dbFile.IngestedAt); err != nil {
+			iLog.With("status", "failed").With("error", err).Error("Failed to supersede previous file version")
+			return nil, fmt.Errorf("failed to supersede previous version of file %q: %w", opts.FileMetadata.AbsolutePath, err)
+		}
+		iLog.Info("Superseded previous file version", "version", previousVersion.Version)
+	}
+
 	statusLog.With("status", "finished").Info("Ingested document", "num_documents", len(docIDs), "absolute_path", dbFile.FileMetadata.AbsolutePath, "ingestionTime", time.Since(ingestionStart))
 
 	return docIDs, nil
 }
+
+// recordEmbeddingDimensions records the number of dimensions of the dataset's embeddings after its first ingestion,
+// so that later queries can be validated against them, even if the embeddings model's default dimensions were used.
+// Failures are only logged, as the dimensions are recorded on the next ingestion then.
+func (s *Datastore) recordEmbeddingDimensions(ctx context.Context, datasetID string) {
+	stats, err := s.Vectorstore.CollectionStats(ctx, datasetID)
+	if err != nil {
+		slog.Warn("Failed to get embedding dimensions of dataset", "dataset", datasetID, "error", err)
+		return
+	}
+	if stats.Dimensions == 0 {
+		return
+	}
+	if _, err := s.UpdateDataset(ctx, types.Dataset{ID: datasetID, EmbeddingDimensions: stats.Dimensions}, nil); err != nil {
+		slog.Warn("Failed to record embedding dimensions of dataset", "dataset", datasetID, "error", err)
+		return
+	}
+	slog.Debug("Recorded embedding dimensions of dataset", "dataset", datasetID, "dimensions", stats.Dimensions)
+}
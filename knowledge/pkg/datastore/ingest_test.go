@@ -3,12 +3,17 @@ package datastore
 import (
 	"context"
 	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/gptscript-ai/knowledge/pkg/config"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/transformers"
 	"github.com/gptscript-ai/knowledge/pkg/flows"
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -42,3 +47,36 @@ func TestExtractPDF(t *testing.T) {
 	})
 	require.NoError(t, err, "filepath.WalkDir() error = %v", err)
 }
+
+func TestEmbeddingDimensions(t *testing.T) {
+	ctx := context.Background()
+	ds := newTestDatastore(t, "hnsw")
+	require.NoError(t, ds.CreateDataset(ctx, types.Dataset{ID: "a"}, nil))
+	addTestFile(t, ds, "a", "/a.md", 2)
+
+	// the actual dimensions are recorded, although none are configured
+	ds.recordEmbeddingDimensions(ctx, "a")
+	dataset, err := ds.GetDataset(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, 8, dataset.EmbeddingDimensions)
+
+	// queries are validated against them - the model returns 4 dimensions by default now
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data": [{"embedding": [1, 0, 0, 0]}]}`))
+	}))
+	defer srv.Close()
+	ds.EmbeddingModelProvider, err = embeddings.ProviderFromConfig(config.ModelProviderConfig{
+		Type:   "openai",
+		Config: map[string]any{"baseURL": srv.URL, "apiKey": "sk-test", "embeddingModel": "text-embedding-3-small", "apiType": "OPEN_AI"},
+	})
+	require.NoError(t, err)
+	providerConfig, err := embeddings.AsEmbeddingModelProviderConfig(ds.EmbeddingModelProvider, true)
+	require.NoError(t, err)
+	dataset.EmbeddingsProviderConfig = &providerConfig
+
+	ef, err := ds.datasetEmbeddingFunc(dataset)
+	require.NoError(t, err)
+	require.NotNil(t, ef)
+	_, err = ef(ctx, "query")
+	require.ErrorContains(t, err, "8 dimensions are expected")
+}
@@ -0,0 +1,154 @@
+package postprocessors
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore/defaults"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+const MMRPostprocessorName = "mmr"
+
+// MMRPostprocessor selects the TopK documents by maximal marginal relevance, i.e. it trades off the relevance (similarity score)
+// of a document against its similarity to the documents selected before, so that near-duplicates (e.g. overlapping chunks)
+// don't crowd out other sources. It should get more candidates than TopK, e.g. by setting fetchK on the basic retriever.
+// The similarity of documents is computed from their embeddings, if the retriever returned them (embeddings option of the
+// basic retriever), else from the overlap of their words.
+type MMRPostprocessor struct {
+	// Lambda weighs relevance against diversity: 1 only considers relevance, 0 only diversity
+	Lambda float32
+	TopK   int
+	// MaxPerFile limits the number of documents from the same file - 0 means no limit
+	MaxPerFile int
+}
+
+func (s *MMRPostprocessor) Transform(_ context.Context, response *types.RetrievalResponse) error {
+	if s.Lambda < 0 || s.Lambda > 1 {
+		return fmt.Errorf("mmr lambda must be between 0 and 1, got %v", s.Lambda)
+	}
+	topK := s.TopK
+	if topK <= 0 {
+		topK = defaults.TopK
+	}
+
+	for i, resp := range response.Responses {
+		docs := resp.ResultDocuments
+		selected := s.selectDocuments(docs, topK)
+		slog.Debug("Selected documents by maximal marginal relevance", "candidates", len(docs), "selected", len(selected), "lambda", s.Lambda, "maxPerFile", s.MaxPerFile)
+		response.Responses[i].ResultDocuments = selected
+	}
+	return nil
+}
+
+func (s *MMRPostprocessor) selectDocuments(docs []vs.Document, topK int) []vs.Document {
+	similarity := newDocSimilarity(docs)
+
+	remaining := make([]int, len(docs))
+	for i := range docs {
+		remaining[i] = i
+	}
+	// maxSim holds the maximum similarity of each document to the selected ones
+	maxSim := make([]float32, len(docs))
+	perFile := map[string]int{}
+
+	var selected []vs.Document
+	for len(selected) < topK && len(remaining) > 0 {
+		best, bestScore := -1, float32(math.Inf(-1))
+		for j, idx := range remaining {
+			if s.MaxPerFile > 0 {
+				if file := vs.DocumentSource(docs[idx]); file != "" && perFile[file] >= s.MaxPerFile {
+					continue
+				}
+			}
+			score := s.Lambda*docs[idx].SimilarityScore - (1-s.Lambda)*maxSim[idx]
+			if score > bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best < 0 {
+			break // all remaining documents are from files that reached their limit
+		}
+
+		idx := remaining[best]
+		remaining = append(remaining[:best], remaining[best+1:]...)
+		selected = append(selected, docs[idx])
+		if file := vs.DocumentSource(docs[idx]); file != "" {
+			perFile[file]++
+		}
+		for _, other := range remaining {
+			maxSim[other] = max(maxSim[other], similarity(idx, other))
+		}
+	}
+	return selected
+}
+
+// newDocSimilarity returns a function for the similarity of two documents: the cosine similarity of their embeddings,
+// if all documents have comparable ones, else the Jaccard similarity of their words.
+func newDocSimilarity(docs []vs.Document) func(i, j int) float32 {
+	withEmbeddings := len(docs) > 0
+	for _, doc := range docs {
+		if len(doc.Embedding) == 0 || len(doc.Embedding) != len(docs[0].Embedding) {
+			withEmbeddings = false
+			break
+		}
+	}
+	if withEmbeddings {
+		return func(i, j int) float32 {
+			return cosineSimilarity(docs[i].Embedding, docs[j].Embedding)
+		}
+	}
+
+	words := make([]map[string]struct{}, len(docs))
+	for i, doc := range docs {
+		words[i] = wordSet(doc.Content)
+	}
+	return func(i, j int) float32 {
+		return jaccardSimilarity(words[i], words[j])
+	}
+}
+
+func cosineSimilarity(a, b []float32) float32 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
+
+func wordSet(content string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		set[w] = struct{}{}
+	}
+	return set
+}
+
+func jaccardSimilarity(a, b map[string]struct{}) float32 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for w := range a {
+		if _, ok := b[w]; ok {
+			intersection++
+		}
+	}
+	return float32(intersection) / float32(len(a)+len(b)-intersection)
+}
+
+func (s *MMRPostprocessor) Name() string {
+	return MMRPostprocessorName
+}
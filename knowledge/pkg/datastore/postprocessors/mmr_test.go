@@ -0,0 +1,49 @@
+package postprocessors
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mmrIDs(t *testing.T, pp *MMRPostprocessor, docs []vs.Document) []string {
+	t.Helper()
+	resp := &types.RetrievalResponse{Responses: []types.Response{{Query: "q", ResultDocuments: docs}}}
+	require.NoError(t, pp.Transform(context.Background(), resp))
+	var ids []string
+	for _, d := range resp.Responses[0].ResultDocuments {
+		ids = append(ids, d.ID)
+	}
+	return ids
+}
+
+func TestMMRPostprocessor(t *testing.T) {
+	// a and b are near-duplicates (e.g. overlapping chunks), c is less relevant but covers something else
+	embedded := []vs.Document{
+		{ID: "a", SimilarityScore: 0.9, Embedding: []float32{1, 0}, Metadata: map[string]any{"absPath": "/one"}},
+		{ID: "b", SimilarityScore: 0.89, Embedding: []float32{0.99, 0.1}, Metadata: map[string]any{"absPath": "/one"}},
+		{ID: "c", SimilarityScore: 0.8, Embedding: []float32{0, 1}, Metadata: map[string]any{"absPath": "/two"}},
+		{ID: "d", SimilarityScore: 0.7, Embedding: []float32{0.1, 1}, Metadata: map[string]any{"absPath": "/three"}},
+	}
+
+	assert.Equal(t, []string{"a", "b"}, mmrIDs(t, &MMRPostprocessor{Lambda: 1, TopK: 2}, embedded))
+	assert.Equal(t, []string{"a", "c"}, mmrIDs(t, &MMRPostprocessor{Lambda: 0.5, TopK: 2}, embedded))
+
+	// Per-file cap: b is skipped, even though only relevance counts
+	assert.Equal(t, []string{"a", "c", "d"}, mmrIDs(t, &MMRPostprocessor{Lambda: 1, TopK: 3, MaxPerFile: 1}, embedded))
+
+	// Without embeddings, the word overlap is used
+	lexical := []vs.Document{
+		{ID: "a", SimilarityScore: 0.9, Content: "the quick brown fox jumps"},
+		{ID: "b", SimilarityScore: 0.89, Content: "quick brown fox jumps over"},
+		{ID: "c", SimilarityScore: 0.8, Content: "a lazy dog sleeps"},
+	}
+	assert.Equal(t, []string{"a", "c"}, mmrIDs(t, &MMRPostprocessor{Lambda: 0.5, TopK: 2}, lexical))
+
+	resp := &types.RetrievalResponse{Responses: []types.Response{{ResultDocuments: lexical}}}
+	assert.Error(t, (&MMRPostprocessor{Lambda: 2}).Transform(context.Background(), resp))
+}
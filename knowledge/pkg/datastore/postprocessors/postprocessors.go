@@ -63,6 +63,7 @@ var PostprocessorMap = map[string]Postprocessor{
 	CohereRerankPostprocessorName:                &CohereRerankPostprocessor{},
 	ReducePostprocessorName:                      &ReducePostprocessor{},
 	BM25PostprocessorName:                        &BM25Postprocessor{},
+	MMRPostprocessorName:                         &MMRPostprocessor{Lambda: 0.5},
 }
 
 func GetPostprocessor(name string) (Postprocessor, error) {
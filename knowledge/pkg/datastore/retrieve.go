@@ -2,13 +2,18 @@ package datastore
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/gptscript-ai/knowledge/pkg/datastore/embeddings"
 	etypes "github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/retrievers"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	itypes "github.com/gptscript-ai/knowledge/pkg/index/types"
 	"github.com/gptscript-ai/knowledge/pkg/output"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore"
 	types2 "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 	"github.com/mitchellh/copystructure"
 	"github.com/philippgille/chromem-go"
@@ -20,9 +25,20 @@ import (
 )
 
 type RetrieveOpts struct {
-	TopK          int
-	Keywords      []string
+	TopK     int
+	Keywords []string
+	// Where filters documents by exact metadata values (e.g. as extracted by transformers)
+	Where         map[string]string
 	RetrievalFlow *flows.RetrievalFlow
+	// Caller is the identity on whose behalf the retrieval is performed.
+	// If set, only datasets and documents readable by the caller are considered.
+	Caller *itypes.Identity
+	// AsOf retrieves from the file versions that were current at the given time - zero means "now".
+	AsOf time.Time
+	// Fusion overrides how the retriever ranks the results of multiple datasets against each other.
+	Fusion *retrievers.DatasetFusion
+	// Explain adds the queries and candidate documents after each stage of the retrieval flow to the response.
+	Explain bool
 }
 
 func (s *Datastore) Retrieve(ctx context.Context, datasetIDs []string, query string, opts RetrieveOpts) (*types.RetrievalResponse, error) {
@@ -69,7 +85,50 @@ func (s *Datastore) Retrieve(ctx context.Context, datasetIDs []string, query str
 		}
 	}
 
-	return retrievalFlow.Run(ctx, s, query, datasetIDs, &flows.RetrievalFlowOpts{Where: nil, WhereDocument: whereDocs})
+	if opts.Caller != nil {
+		var err error
+		datasetIDs, err = s.filterReadableDatasets(ctx, datasetIDs, opts.Caller)
+		if err != nil {
+			return nil, err
+		}
+		if len(datasetIDs) == 0 {
+			slog.Info("Caller is not allowed to read any of the requested datasets", "caller", opts.Caller.User)
+			return &types.RetrievalResponse{Query: query, Datasets: datasetIDs, Responses: []types.Response{}}, nil
+		}
+		ctx = types2.WithAccessFilter(ctx, opts.Caller.Principals())
+	}
+
+	if !opts.AsOf.IsZero() {
+		ctx = withAsOf(ctx, opts.AsOf)
+	}
+
+	if opts.Fusion != nil {
+		if err := opts.Fusion.Validate(); err != nil {
+			return nil, err
+		}
+		ctx = retrievers.WithDatasetFusion(ctx, opts.Fusion)
+	}
+
+	return retrievalFlow.Run(ctx, s, query, datasetIDs, &flows.RetrievalFlowOpts{Where: opts.Where, WhereDocument: whereDocs, Explain: opts.Explain})
+}
+
+// filterReadableDatasets drops all datasets that the caller is not allowed to read. File-level ACLs can't grant access
+// to files of these datasets, they only restrict access further (enforced by the vector store's access filter).
+// Non-existent datasets are passed through, as the retrievers already know how to deal with them.
+func (s *Datastore) filterReadableDatasets(ctx context.Context, datasetIDs []string, caller *itypes.Identity) ([]string, error) {
+	var readable []string
+	for _, id := range datasetIDs {
+		ds, err := s.GetDataset(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if ds != nil && !ds.ACL.Allows(caller) {
+			slog.Debug("Caller is not allowed to read dataset", "dataset", id, "caller", caller.User)
+			continue
+		}
+		readable = append(readable, id)
+	}
+	return readable, nil
 }
 
 func (s *Datastore) SimilaritySearch(ctx context.Context, query string, numDocuments int, datasetID string, where map[string]string, whereDocument []chromem.WhereDocument) ([]types2.Document, error) {
@@ -77,28 +136,101 @@ func (s *Datastore) SimilaritySearch(ctx context.Context, query string, numDocum
 	if err != nil {
 		return nil, err
 	}
-	var ef cg.EmbeddingFunc
-	if ds.EmbeddingsProviderConfig != nil {
-		dsEmbeddingProvider, err := embeddings.ProviderFromConfig(*ds.EmbeddingsProviderConfig)
-		if err != nil {
+	ef, err := s.datasetEmbeddingFunc(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Documents of other file versions are filtered out afterwards, so we may have to fetch more
+	hidden, err := s.hiddenDocumentIDs(ctx, datasetID)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := searchDocumentVersions(hidden, numDocuments, func(k int) ([]types2.Document, error) {
+		return s.Vectorstore.SimilaritySearch(ctx, query, k, datasetID, where, whereDocument, ef)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if types2.EmbeddingsRequested(ctx) {
+		if err := s.attachEmbeddings(ctx, datasetID, docs); err != nil {
 			return nil, err
 		}
-		if s.EmbeddingModelProvider.EmbeddingModelName() != dsEmbeddingProvider.EmbeddingModelName() {
-			slog.Warn("Embeddings model mismatch", "dataset", datasetID, "attached", dsEmbeddingProvider.EmbeddingModelName(), "configured", s.EmbeddingModelProvider.EmbeddingModelName())
-			if os.Getenv("KNOW_PREFER_NEW_EMBEDDING_MODEL") == "" {
-				slog.Info("Using dataset's embeddings model", "model", dsEmbeddingProvider.EmbeddingModelName())
-				copied, err := copystructure.Copy(s.EmbeddingModelProvider)
-				if err != nil {
-					return nil, err
-				}
-				copied.(etypes.EmbeddingModelProvider).UseEmbeddingModel(dsEmbeddingProvider.EmbeddingModelName())
-				ef, err = copied.(etypes.EmbeddingModelProvider).EmbeddingFunc()
-				if err != nil {
-					return nil, err
-				}
-				slog.Debug("Using dataset specific embedding function", "dataset", datasetID, "model", dsEmbeddingProvider.Name(), "newProviderConfig", output.RedactSensitive(copied.(etypes.EmbeddingModelProvider)))
+	}
+
+	return docs, nil
+}
+
+// attachEmbeddings sets the stored embeddings of the documents, if the vector store can return them.
+func (s *Datastore) attachEmbeddings(ctx context.Context, datasetID string, docs []types2.Document) error {
+	getter, ok := s.Vectorstore.(vectorstore.EmbeddingsGetter)
+	if !ok || len(docs) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	embeddings, err := getter.GetEmbeddings(ctx, datasetID, ids)
+	if err != nil {
+		return fmt.Errorf("failed to get embeddings of search results: %w", err)
+	}
+	for i := range docs {
+		docs[i].Embedding = embeddings[docs[i].ID]
+	}
+	return nil
+}
+
+// datasetEmbeddingFunc returns the embedding function for the embeddings model (and dimensions) the dataset was created with,
+// if it differs from the configured one - nil means the vector store's default embedding function should be used.
+// If the dataset's embedding dimensions are known (recorded on first ingestion or configured), the returned function fails
+// for embeddings with other dimensions, as they can't be compared to the dataset's embeddings.
+func (s *Datastore) datasetEmbeddingFunc(ds *itypes.Dataset) (cg.EmbeddingFunc, error) {
+	if ds.EmbeddingsProviderConfig == nil {
+		return nil, nil
+	}
+	dsEmbeddingProvider, err := embeddings.ProviderFromConfig(*ds.EmbeddingsProviderConfig)
+	if err != nil {
+		return nil, err
+	}
+	dims := etypes.EmbeddingDimensions(dsEmbeddingProvider)
+
+	provider := s.EmbeddingModelProvider
+	modelMismatch := s.EmbeddingModelProvider.EmbeddingModelName() != dsEmbeddingProvider.EmbeddingModelName()
+	dimsMismatch := etypes.EmbeddingDimensions(s.EmbeddingModelProvider) != dims
+	if modelMismatch || dimsMismatch {
+		slog.Warn("Embeddings model mismatch", "dataset", ds.ID,
+			"attached", dsEmbeddingProvider.EmbeddingModelName(), "configured", s.EmbeddingModelProvider.EmbeddingModelName(),
+			"attachedDimensions", dims, "configuredDimensions", etypes.EmbeddingDimensions(s.EmbeddingModelProvider))
+		if os.Getenv("KNOW_PREFER_NEW_EMBEDDING_MODEL") == "" {
+			slog.Info("Using dataset's embeddings model", "model", dsEmbeddingProvider.EmbeddingModelName(), "dimensions", dims)
+			copied, err := copystructure.Copy(s.EmbeddingModelProvider)
+			if err != nil {
+				return nil, err
+			}
+			provider = copied.(etypes.EmbeddingModelProvider)
+			provider.UseEmbeddingModel(dsEmbeddingProvider.EmbeddingModelName())
+			if dp, ok := provider.(etypes.EmbeddingDimensionsProvider); ok {
+				dp.UseEmbeddingDimensions(dims)
 			}
+			slog.Debug("Using dataset specific embedding function", "dataset", ds.ID, "model", dsEmbeddingProvider.Name(), "newProviderConfig", output.RedactSensitive(provider))
 		}
 	}
-	return s.Vectorstore.SimilaritySearch(ctx, query, numDocuments, datasetID, where, whereDocument, ef)
+
+	// The recorded dimensions are the actual ones, also if the model's default dimensions were used
+	if ds.EmbeddingDimensions > 0 {
+		dims = ds.EmbeddingDimensions
+	}
+	if provider == s.EmbeddingModelProvider && dims == 0 {
+		return nil, nil
+	}
+
+	ef, err := provider.EmbeddingFunc()
+	if err != nil {
+		return nil, err
+	}
+	return etypes.ValidateEmbeddingFunc(ef, dims), nil
 }
@@ -0,0 +1,192 @@
+package retrievers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore/lib/scores"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+// Fusion methods for combining the results of multiple datasets
+const (
+	// FusionScore ranks all results by their raw similarity scores, which are only comparable if all datasets use the same embeddings model
+	FusionScore = "score"
+	// FusionMinMax normalizes the scores of each dataset to [0, 1] before ranking, which makes the scores of datasets
+	// embedded with different models comparable, but also ranks the best result of each dataset first
+	FusionMinMax = "minmax"
+	// FusionRRF ranks by reciprocal rank fusion, i.e. only the rank of a result within its dataset counts
+	FusionRRF = "rrf"
+
+	DefaultRRFK = 60
+)
+
+// Metadata keys for the provenance of retrieved documents - they're namespaced, so that they don't overwrite
+// the metadata of the ingested files (e.g. from a .knowledge.json)
+const (
+	DocMetadataKeyDataset        = "fusion.dataset"
+	DocMetadataKeyDatasetScore   = "fusion.datasetScore"
+	DocMetadataKeyDatasetRank    = "fusion.datasetRank"
+	DocMetadataKeyDatasetWeight  = "fusion.datasetWeight"
+	DocMetadataKeyFusionStrategy = "fusion.method"
+)
+
+// DatasetFusion configures how the results of multiple datasets are combined into a single ranking.
+type DatasetFusion struct {
+	// Method is one of FusionScore (default), FusionMinMax or FusionRRF
+	Method string `json:"method,omitempty" mapstructure:"method" yaml:"method"`
+	// Weights multiply the (fused) scores of a dataset's results - datasets without a weight have weight 1
+	Weights map[string]float32 `json:"weights,omitempty" mapstructure:"weights" yaml:"weights"`
+	// Quotas limit the number of results from a dataset
+	Quotas map[string]int `json:"quotas,omitempty" mapstructure:"quotas" yaml:"quotas"`
+	// RRFK is the rank constant of the reciprocal rank fusion (default 60) - higher values flatten the ranking
+	RRFK int `json:"rrfK,omitempty" mapstructure:"rrfK" yaml:"rrfK"`
+}
+
+// Merge returns a copy of the fusion config, overridden by the set fields of other.
+func (f DatasetFusion) Merge(other *DatasetFusion) DatasetFusion {
+	merged := f
+	merged.Weights = maps.Clone(f.Weights)
+	merged.Quotas = maps.Clone(f.Quotas)
+	if other == nil {
+		return merged
+	}
+	if other.Method != "" {
+		merged.Method = other.Method
+	}
+	if other.RRFK > 0 {
+		merged.RRFK = other.RRFK
+	}
+	if len(other.Weights) > 0 && merged.Weights == nil {
+		merged.Weights = map[string]float32{}
+	}
+	maps.Copy(merged.Weights, other.Weights)
+	if len(other.Quotas) > 0 && merged.Quotas == nil {
+		merged.Quotas = map[string]int{}
+	}
+	maps.Copy(merged.Quotas, other.Quotas)
+	return merged
+}
+
+func (f DatasetFusion) Validate() error {
+	switch f.Method {
+	case "", FusionMinMax, FusionRRF, FusionScore:
+	default:
+		return fmt.Errorf("unknown fusion method %q - supported: %s, %s, %s", f.Method, FusionScore, FusionMinMax, FusionRRF)
+	}
+	for ds, w := range f.Weights {
+		if w < 0 {
+			return fmt.Errorf("weight of dataset %q must not be negative", ds)
+		}
+	}
+	for ds, q := range f.Quotas {
+		if q < 0 {
+			return fmt.Errorf("quota of dataset %q must not be negative", ds)
+		}
+	}
+	return nil
+}
+
+func (f DatasetFusion) weight(datasetID string) float32 {
+	if w, ok := f.Weights[datasetID]; ok {
+		return w
+	}
+	return 1
+}
+
+// Quota returns the maximum number of results from the dataset - 0 means no limit.
+func (f DatasetFusion) Quota(datasetID string) int {
+	return f.Quotas[datasetID]
+}
+
+type datasetFusionCtxKey struct{}
+
+// WithDatasetFusion returns a context that overrides the dataset fusion configured for the retrievers.
+func WithDatasetFusion(ctx context.Context, fusion *DatasetFusion) context.Context {
+	return context.WithValue(ctx, datasetFusionCtxKey{}, fusion)
+}
+
+// DatasetFusionFromCtx returns the dataset fusion override set on the context, if any.
+func DatasetFusionFromCtx(ctx context.Context) *DatasetFusion {
+	fusion, _ := ctx.Value(datasetFusionCtxKey{}).(*DatasetFusion)
+	return fusion
+}
+
+// FuseDatasetResults combines the results of multiple datasets (each sorted by similarity) into a single ranking,
+// applying the per-dataset quotas and weights. The documents are annotated with their dataset and their original
+// score and rank within it. If there's only a single dataset, the original scores are kept.
+func FuseDatasetResults(results map[string][]vs.Document, datasetIDs []string, fusion DatasetFusion) []vs.Document {
+	method := fusion.Method
+	if method == "" {
+		method = FusionScore
+	}
+	rrfK := fusion.RRFK
+	if rrfK <= 0 {
+		rrfK = DefaultRRFK
+	}
+
+	datasetsWithResults := 0
+	for _, docs := range results {
+		if len(docs) > 0 {
+			datasetsWithResults++
+		}
+	}
+	single := datasetsWithResults <= 1 // nothing to fuse, so keep the original scores
+	if single {
+		method = FusionScore
+	}
+
+	var fused []vs.Document
+	seen := make(map[string]struct{}, len(datasetIDs))
+	for _, datasetID := range datasetIDs {
+		if _, ok := seen[datasetID]; ok {
+			continue
+		}
+		seen[datasetID] = struct{}{}
+
+		docs := results[datasetID]
+		if quota := fusion.Quota(datasetID); quota > 0 && len(docs) > quota {
+			docs = docs[:quota]
+		}
+		weight := fusion.weight(datasetID)
+		if single {
+			weight = 1
+		}
+
+		var minScore, maxScore float32
+		if method == FusionMinMax {
+			minScore, maxScore = scores.FindMinMaxScores(docs)
+		}
+
+		for rank, doc := range docs {
+			doc.Metadata = maps.Clone(doc.Metadata)
+			if doc.Metadata == nil {
+				doc.Metadata = map[string]any{}
+			}
+			doc.Metadata[DocMetadataKeyDataset] = datasetID
+			doc.Metadata[DocMetadataKeyDatasetScore] = doc.SimilarityScore
+			doc.Metadata[DocMetadataKeyDatasetRank] = rank + 1
+
+			switch method {
+			case FusionMinMax:
+				doc.SimilarityScore = scores.NormalizeScore(doc.SimilarityScore, minScore, maxScore)
+			case FusionRRF:
+				// scaled, so that the top result of a dataset scores 1 (times its weight), like with the other methods
+				doc.SimilarityScore = float32(rrfK+1) / float32(rrfK+rank+1)
+			}
+			if weight != 1 {
+				doc.Metadata[DocMetadataKeyDatasetWeight] = weight
+				doc.SimilarityScore *= weight
+			}
+			if method != FusionScore {
+				doc.Metadata[DocMetadataKeyFusionStrategy] = method
+			}
+			fused = append(fused, doc)
+		}
+	}
+
+	slices.SortStableFunc(fused, scores.SortBySimilarityScore)
+	return fused
+}
@@ -0,0 +1,82 @@
+package retrievers
+
+import (
+	"testing"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDocs(prefix string, scores ...float32) []vs.Document {
+	docs := make([]vs.Document, len(scores))
+	for i, s := range scores {
+		docs[i] = vs.Document{ID: prefix + string(rune('0'+i)), SimilarityScore: s}
+	}
+	return docs
+}
+
+func ids(docs []vs.Document) []string {
+	var res []string
+	for _, d := range docs {
+		res = append(res, d.ID)
+	}
+	return res
+}
+
+func TestFuseDatasetResults(t *testing.T) {
+	// dataset b uses an embeddings model with much lower scores
+	results := map[string][]vs.Document{
+		"a": testDocs("a", 0.9, 0.85, 0.8),
+		"b": testDocs("b", 0.4, 0.3, 0.1),
+	}
+	datasets := []string{"a", "b"}
+
+	t.Run("score", func(t *testing.T) {
+		fused := FuseDatasetResults(results, datasets, DatasetFusion{})
+		assert.Equal(t, []string{"a0", "a1", "a2", "b0", "b1", "b2"}, ids(fused))
+		assert.Equal(t, float32(0.9), fused[0].SimilarityScore)
+		assert.Equal(t, "a", fused[0].Metadata[DocMetadataKeyDataset])
+		assert.NotContains(t, fused[0].Metadata, DocMetadataKeyFusionStrategy)
+	})
+
+	t.Run("minmax", func(t *testing.T) {
+		fused := FuseDatasetResults(results, datasets, DatasetFusion{Method: FusionMinMax})
+		require.Len(t, fused, 6)
+		assert.ElementsMatch(t, []string{"a0", "b0"}, ids(fused[:2]))
+		assert.Equal(t, float32(1), fused[0].SimilarityScore)
+		assert.Equal(t, "b", fused[5].Metadata[DocMetadataKeyDataset])
+		assert.Equal(t, float32(0.1), fused[5].Metadata[DocMetadataKeyDatasetScore])
+		assert.Equal(t, FusionMinMax, fused[5].Metadata[DocMetadataKeyFusionStrategy])
+	})
+
+	t.Run("rrf with weights and quotas", func(t *testing.T) {
+		fused := FuseDatasetResults(results, datasets, DatasetFusion{
+			Method:  FusionRRF,
+			Weights: map[string]float32{"b": 2},
+			Quotas:  map[string]int{"a": 2},
+		})
+		assert.Equal(t, []string{"b0", "b1", "b2", "a0", "a1"}, ids(fused))
+		assert.Equal(t, float32(2), fused[0].SimilarityScore)
+		assert.Equal(t, 1, fused[0].Metadata[DocMetadataKeyDatasetRank])
+	})
+
+	t.Run("metadata of the files is kept", func(t *testing.T) {
+		docs := testDocs("a", 0.9)
+		docs[0].Metadata = map[string]any{"dataset": "handbook"}
+		fused := FuseDatasetResults(map[string][]vs.Document{"a": docs, "b": results["b"]}, datasets, DatasetFusion{})
+		require.Len(t, fused, 4)
+		assert.Equal(t, "handbook", fused[0].Metadata["dataset"])
+		assert.Equal(t, "a", fused[0].Metadata[DocMetadataKeyDataset])
+	})
+
+	t.Run("single dataset keeps scores", func(t *testing.T) {
+		fused := FuseDatasetResults(map[string][]vs.Document{"b": results["b"]}, datasets, DatasetFusion{Method: FusionMinMax, Weights: map[string]float32{"b": 2}})
+		assert.Equal(t, []string{"b0", "b1", "b2"}, ids(fused))
+		assert.Equal(t, float32(0.4), fused[0].SimilarityScore)
+		assert.Equal(t, "b", fused[0].Metadata[DocMetadataKeyDataset])
+		assert.Nil(t, results["b"][0].Metadata, "input documents must not be modified")
+	})
+
+	require.Error(t, DatasetFusion{Method: "foo"}.Validate())
+}
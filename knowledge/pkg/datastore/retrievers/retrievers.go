@@ -4,10 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"slices"
 	"strings"
 
-	"github.com/gptscript-ai/knowledge/pkg/datastore/lib/scores"
 	"github.com/gptscript-ai/knowledge/pkg/datastore/store"
 	"github.com/gptscript-ai/knowledge/pkg/output"
 	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
@@ -63,6 +61,13 @@ const BasicRetrieverName = "basic"
 
 type BasicRetriever struct {
 	TopK int
+	// FetchK over-fetches candidates: if greater than TopK, up to FetchK documents are returned,
+	// e.g. for the mmr postprocessor to select the TopK most diverse ones
+	FetchK int
+	// Embeddings adds the embeddings of the documents to the results (if the vector store can return them), e.g. for the mmr postprocessor
+	Embeddings bool
+	// Fusion configures how the results of multiple datasets are ranked against each other
+	Fusion DatasetFusion
 }
 
 func (r *BasicRetriever) Name() string {
@@ -82,7 +87,23 @@ func (r *BasicRetriever) Retrieve(ctx context.Context, store store.Store, query
 		return nil, fmt.Errorf("no dataset specified for retrieval")
 	}
 
-	var results []vs.Document
+	fusion := r.Fusion.Merge(DatasetFusionFromCtx(ctx))
+	if err := fusion.Validate(); err != nil {
+		return nil, err
+	}
+
+	log := slog.With("retriever", r.Name())
+	if r.TopK <= 0 {
+		log.Debug("[BasicRetriever] TopK not set, using default", "default", defaults.TopK)
+		r.TopK = defaults.TopK
+	}
+	topK := max(r.TopK, r.FetchK)
+
+	if r.Embeddings {
+		ctx = vs.WithEmbeddings(ctx)
+	}
+
+	results := make(map[string][]vs.Document, len(datasetIDs))
 	for _, dataset := range datasetIDs {
 		// TODO: make configurable via RetrieveOpts
 		// silently ignore non-existent datasets
@@ -97,26 +118,19 @@ func (r *BasicRetriever) Retrieve(ctx context.Context, store store.Store, query
 			continue
 		}
 
-		docs, err := store.SimilaritySearch(ctx, query, r.TopK, dataset, where, whereDocument)
+		docs, err := store.SimilaritySearch(ctx, query, topK, dataset, where, whereDocument)
 		if err != nil {
 			return nil, err
 		}
 
-		results = append(results, docs...)
+		results[dataset] = docs
 	}
 
-	slices.SortFunc(results, scores.SortBySimilarityScore)
-
-	log := slog.With("retriever", r.Name())
-	if r.TopK <= 0 {
-		log.Debug("[BasicRetriever] TopK not set, using default", "default", defaults.TopK)
-		r.TopK = defaults.TopK
-	}
+	fused := FuseDatasetResults(results, datasetIDs, fusion)
 
-	topK := r.TopK
-	if topK > len(results) {
-		topK = len(results)
+	if topK > len(fused) {
+		topK = len(fused)
 	}
 
-	return results[:topK], nil
+	return fused[:topK], nil
 }
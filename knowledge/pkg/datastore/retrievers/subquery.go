@@ -22,6 +22,8 @@ type SubqueryRetriever struct {
 	Model llm.LLMConfig
 	Limit int
 	TopK  int
+	// Fusion configures how the results of multiple datasets are ranked against each other
+	Fusion DatasetFusion
 }
 
 func (s *SubqueryRetriever) Name() string {
@@ -87,7 +89,12 @@ func (s *SubqueryRetriever) Retrieve(ctx context.Context, store store.Store, que
 
 	slog.Debug("SubqueryQueryRetriever generated subqueries", "queries", strings.Join(queries, " | "))
 
-	var resultDocs []vs.Document
+	fusion := s.Fusion.Merge(DatasetFusionFromCtx(ctx))
+	if err := fusion.Validate(); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string][]vs.Document, len(datasetIDs))
 	for _, dataset := range datasetIDs {
 		// TODO: make configurable via RetrieveOpts
 		// silently ignore non-existent datasets
@@ -102,6 +109,7 @@ func (s *SubqueryRetriever) Retrieve(ctx context.Context, store store.Store, que
 			continue
 		}
 
+		var resultDocs []vs.Document
 		for _, q := range queries {
 			docs, err := store.SimilaritySearch(ctx, q, s.TopK, dataset, where, whereDocument)
 			if err != nil {
@@ -123,9 +131,12 @@ func (s *SubqueryRetriever) Retrieve(ctx context.Context, store store.Store, que
 				resultDocs = append(resultDocs, doc)
 			}
 		}
+
+		slices.SortFunc(resultDocs, scores.SortBySimilarityScore)
+		results[dataset] = resultDocs
 	}
 
-	slices.SortFunc(resultDocs, scores.SortBySimilarityScore)
+	resultDocs := FuseDatasetResults(results, datasetIDs, fusion)
 
 	topK := s.TopK
 	if len(resultDocs) < topK {
@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore/defaults"
+	dstypes "github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// tokenCounter returns the function counting the tokens of a document's content for the stats, or nil if the tokenizer
+// is not available (it's downloaded on first use).
+var tokenCounter = sync.OnceValue(func() func(content string) int {
+	tk, err := tiktoken.GetEncoding(defaults.TokenEncoding)
+	if err != nil {
+		slog.Warn("Tokenizer not available - not counting the tokens of ingested documents", "encoding", defaults.TokenEncoding, "error", err)
+		return nil
+	}
+	return func(content string) int {
+		return len(tk.Encode(content, nil, nil))
+	}
+})
+
+// DatasetStats computes statistics about the current file versions of a dataset and their documents. They're aggregated
+// by the index, so the documents don't have to be loaded.
+func (s *Datastore) DatasetStats(ctx context.Context, datasetID string) (*dstypes.DatasetStats, error) {
+	fileStats, err := s.Index.FileStats(ctx, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	if fileStats == nil {
+		return nil, fmt.Errorf("dataset not found: %s", datasetID)
+	}
+
+	stats := &dstypes.DatasetStats{
+		ID:          datasetID,
+		Files:       fileStats.Files,
+		FilesByType: map[string]int{},
+		Chunks:      fileStats.Documents,
+		ChunkTokens: dstypes.TokenStats{
+			Average:   fileStats.TokensAvg,
+			Min:       fileStats.TokensMin,
+			Max:       fileStats.TokensMax,
+			Uncounted: fileStats.Documents - fileStats.CountedDocuments,
+		},
+		LastIngestedAt: fileStats.LastIngestedAt,
+		EmptyFiles:     fileStats.EmptyFiles,
+	}
+	for name, n := range fileStats.FilesByName {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+		if ext == "" {
+			ext = "(none)"
+		}
+		stats.FilesByType[ext] += n
+	}
+
+	colStats, err := s.Vectorstore.CollectionStats(ctx, datasetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vector store stats: %w", err)
+	}
+	stats.EmbeddingDimensions = colStats.Dimensions
+	stats.VectorStoreSizeBytes = colStats.SizeBytes
+	stats.EmbeddingQuantization = vs.QuantizationNone
+	if colStats.Quantization.Quantized() {
+		stats.EmbeddingQuantization = colStats.Quantization.Type
+		if colStats.Quantization.Rescore {
+			stats.EmbeddingQuantization += " (rescored)"
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,269 @@
+package transformers
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+// Extracted values are stored as comma-separated strings (like the keywords), as not all vector stores support lists in metadata.
+// As the metadata filters only match whole values, each value is also stored as "true" under its own key "<key>.<value>",
+// e.g. dates.2024-01-31, so that documents mentioning a value can be filtered by --filter dates.2024-01-31=true.
+
+const (
+	DateExtractorName  = "dates"
+	EmailExtractorName = "emails"
+	URLExtractorName   = "urls"
+	HeadingsPathName   = "headings_path"
+)
+
+// extractInto runs the extraction function on each document and stores the (de-duplicated) results under the given metadata key.
+func extractInto(docs []vs.Document, key string, maxValues int, extract func(content string) []string) []vs.Document {
+	for i, doc := range docs {
+		var values []string
+		for _, v := range extract(doc.Content) {
+			if !slices.Contains(values, v) {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if maxValues > 0 && len(values) > maxValues {
+			values = values[:maxValues]
+		}
+		if docs[i].Metadata == nil {
+			docs[i].Metadata = map[string]any{}
+		}
+		setListValues(docs[i].Metadata, key, values)
+	}
+	return docs
+}
+
+// setListValues stores the values comma-separated under the key and each value under its own key, so it can be filtered by.
+func setListValues(metadata map[string]any, key string, values []string) {
+	metadata[key] = strings.Join(values, ",")
+	for _, v := range values {
+		metadata[key+"."+v] = "true"
+	}
+}
+
+// DateExtractor extracts dates from the document content and stores them normalized to YYYY-MM-DD.
+// Supported formats are ISO 8601 (2024-01-31), written-out months (January 31, 2024 / 31 Jan 2024) and dd.mm.yyyy.
+// Ambiguous formats like 01/02/2024 are ignored.
+type DateExtractor struct {
+	MetadataKey string
+	MaxValues   int
+}
+
+var (
+	monthNames      = `(January|February|March|April|May|June|July|August|September|October|November|December|Jan|Feb|Mar|Apr|Jun|Jul|Aug|Sep|Sept|Oct|Nov|Dec)`
+	isoDateRegex    = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	mdyDateRegex    = regexp.MustCompile(`\b` + monthNames + `\.? (\d{1,2})(?:st|nd|rd|th)?,? (\d{4})\b`)
+	dmyDateRegex    = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th)?\.? ` + monthNames + `\.?,? (\d{4})\b`)
+	dottedDateRegex = regexp.MustCompile(`\b(\d{1,2})\.(\d{1,2})\.(\d{4})\b`)
+)
+
+func parseMonth(s string) (time.Month, bool) {
+	for m := time.January; m <= time.December; m++ {
+		if strings.HasPrefix(m.String(), s[:3]) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeDate(year, month, day int) (string, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return "", false // e.g. 2024-02-31
+	}
+	return t.Format(time.DateOnly), true
+}
+
+func extractDates(content string) []string {
+	type match struct {
+		pos  int
+		date string
+	}
+	var matches []match
+
+	add := func(pos, year, month, day int) {
+		if d, ok := normalizeDate(year, month, day); ok {
+			matches = append(matches, match{pos, d})
+		}
+	}
+	atoi := func(s string) int {
+		i, _ := strconv.Atoi(s)
+		return i
+	}
+
+	for _, m := range isoDateRegex.FindAllStringSubmatchIndex(content, -1) {
+		add(m[0], atoi(content[m[2]:m[3]]), atoi(content[m[4]:m[5]]), atoi(content[m[6]:m[7]]))
+	}
+	for _, m := range mdyDateRegex.FindAllStringSubmatchIndex(content, -1) {
+		if month, ok := parseMonth(content[m[2]:m[3]]); ok {
+			add(m[0], atoi(content[m[6]:m[7]]), int(month), atoi(content[m[4]:m[5]]))
+		}
+	}
+	for _, m := range dmyDateRegex.FindAllStringSubmatchIndex(content, -1) {
+		if month, ok := parseMonth(content[m[4]:m[5]]); ok {
+			add(m[0], atoi(content[m[6]:m[7]]), int(month), atoi(content[m[2]:m[3]]))
+		}
+	}
+	for _, m := range dottedDateRegex.FindAllStringSubmatchIndex(content, -1) {
+		add(m[0], atoi(content[m[6]:m[7]]), atoi(content[m[4]:m[5]]), atoi(content[m[2]:m[3]]))
+	}
+
+	// keep the order of appearance in the document
+	slices.SortStableFunc(matches, func(a, b match) int { return a.pos - b.pos })
+
+	dates := make([]string, len(matches))
+	for i, m := range matches {
+		dates[i] = m.date
+	}
+	return dates
+}
+
+func (d *DateExtractor) Transform(_ context.Context, docs []vs.Document) ([]vs.Document, error) {
+	key := d.MetadataKey
+	if key == "" {
+		key = "dates"
+	}
+	return extractInto(docs, key, d.MaxValues, extractDates), nil
+}
+
+func (d *DateExtractor) Name() string {
+	return DateExtractorName
+}
+
+// EmailExtractor extracts email addresses from the document content (lower-cased).
+type EmailExtractor struct {
+	MetadataKey string
+	MaxValues   int
+}
+
+var emailRegex = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+
+func (e *EmailExtractor) Transform(_ context.Context, docs []vs.Document) ([]vs.Document, error) {
+	key := e.MetadataKey
+	if key == "" {
+		key = "emails"
+	}
+	return extractInto(docs, key, e.MaxValues, func(content string) []string {
+		emails := emailRegex.FindAllString(content, -1)
+		for i := range emails {
+			emails[i] = strings.ToLower(emails[i])
+		}
+		return emails
+	}), nil
+}
+
+func (e *EmailExtractor) Name() string {
+	return EmailExtractorName
+}
+
+// URLExtractor extracts http(s) URLs from the document content.
+type URLExtractor struct {
+	MetadataKey string
+	MaxValues   int
+}
+
+var urlRegex = regexp.MustCompile(`https?://[^\s<>"'()\[\]{}]+`)
+
+func (u *URLExtractor) Transform(_ context.Context, docs []vs.Document) ([]vs.Document, error) {
+	key := u.MetadataKey
+	if key == "" {
+		key = "urls"
+	}
+	return extractInto(docs, key, u.MaxValues, func(content string) []string {
+		urls := urlRegex.FindAllString(content, -1)
+		for i := range urls {
+			// trailing punctuation most likely belongs to the sentence, not the URL
+			urls[i] = strings.TrimRight(urls[i], ".,;:!?")
+		}
+		return urls
+	}), nil
+}
+
+func (u *URLExtractor) Name() string {
+	return URLExtractorName
+}
+
+// HeadingsPath stores the path of Markdown headings (e.g. "Install > Linux > Debian") that a document (chunk) belongs to.
+// Documents are expected in their original order, as headings are carried over from previous chunks of the same file.
+type HeadingsPath struct {
+	MetadataKey string
+	Separator   string
+}
+
+var headingRegex = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+func (h *HeadingsPath) Transform(_ context.Context, docs []vs.Document) ([]vs.Document, error) {
+	key := h.MetadataKey
+	if key == "" {
+		key = "headingsPath"
+	}
+	sep := h.Separator
+	if sep == "" {
+		sep = " > "
+	}
+
+	var headings [6]string
+	inCodeBlock := false
+
+	currentPath := func() string {
+		var parts []string
+		for _, heading := range headings {
+			if heading != "" {
+				parts = append(parts, heading)
+			}
+		}
+		return strings.Join(parts, sep)
+	}
+
+	for i, doc := range docs {
+		path := ""
+		recorded := false
+		for _, line := range strings.Split(doc.Content, "\n") {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				inCodeBlock = !inCodeBlock
+			}
+			if !inCodeBlock {
+				if m := headingRegex.FindStringSubmatch(trimmed); m != nil {
+					level := len(m[1]) - 1
+					headings[level] = m[2]
+					clear(headings[level+1:])
+					continue
+				}
+			}
+			// the path of a chunk is the one that applies to its first line of actual content
+			if !recorded && trimmed != "" {
+				path = currentPath()
+				recorded = true
+			}
+		}
+		if !recorded {
+			path = currentPath()
+		}
+		if path == "" {
+			continue
+		}
+		if docs[i].Metadata == nil {
+			docs[i].Metadata = map[string]any{}
+		}
+		docs[i].Metadata[key] = path
+	}
+
+	return docs, nil
+}
+
+func (h *HeadingsPath) Name() string {
+	return HeadingsPathName
+}
@@ -0,0 +1,76 @@
+package transformers
+
+import (
+	"context"
+	"testing"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractors(t *testing.T) {
+	ctx := context.Background()
+	docs := []vs.Document{
+		{Content: "# Release Notes\n\n## v1.2\n\nReleased on 2024-03-05 (see https://example.com/releases/v1.2.) - contact Jane.Doe@Example.com.", Metadata: map[string]any{}},
+		{Content: "Planned for March 7th, 2024 or 8 Apr 2024, but not 2024-02-31 or 01/02/2024.\n\n```sh\n# not a heading\n```", Metadata: map[string]any{}},
+		{Content: "### Fixes\n\nDeadline 31.12.2024.", Metadata: map[string]any{}},
+	}
+
+	var err error
+	for _, tf := range []interface {
+		Transform(context.Context, []vs.Document) ([]vs.Document, error)
+	}{&DateExtractor{}, &EmailExtractor{}, &URLExtractor{}, &HeadingsPath{}} {
+		docs, err = tf.Transform(ctx, docs)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, "2024-03-05", docs[0].Metadata["dates"])
+	assert.Equal(t, "jane.doe@example.com", docs[0].Metadata["emails"])
+	assert.Equal(t, "https://example.com/releases/v1.2", docs[0].Metadata["urls"])
+	assert.Equal(t, "Release Notes > v1.2", docs[0].Metadata["headingsPath"])
+
+	assert.Equal(t, "2024-03-07,2024-04-08", docs[1].Metadata["dates"])
+	assert.Equal(t, "true", docs[1].Metadata["dates.2024-03-07"])
+	assert.Equal(t, "true", docs[1].Metadata["dates.2024-04-08"])
+	assert.NotContains(t, docs[1].Metadata, "emails")
+	assert.Equal(t, "Release Notes > v1.2", docs[1].Metadata["headingsPath"])
+
+	assert.Equal(t, "2024-12-31", docs[2].Metadata["dates"])
+	assert.Equal(t, "Release Notes > v1.2 > Fixes", docs[2].Metadata["headingsPath"])
+}
+
+func TestDetectLanguage(t *testing.T) {
+	assert.Equal(t, "en", DetectLanguage("This is a document that explains how the ingestion of files works."))
+	assert.Equal(t, "de", DetectLanguage("Das ist ein Dokument, das erklärt, wie die Aufnahme von Dateien funktioniert und was nicht."))
+	assert.Equal(t, "fr", DetectLanguage("Ceci est un document qui explique le fonctionnement de l'ingestion des fichiers dans la base."))
+	assert.Equal(t, "ru", DetectLanguage("Это документ, который объясняет, как работает загрузка файлов."))
+	assert.Equal(t, "ja", DetectLanguage("これはファイルの取り込みの仕組みを説明する文書です。"))
+	assert.Equal(t, LanguageUndetermined, DetectLanguage("foo bar 123"))
+}
+
+func TestParseSchemaValues(t *testing.T) {
+	props := map[string]map[string]any{
+		"title":    {"type": "string"},
+		"year":     {"type": "integer"},
+		"price":    {"type": "number"},
+		"public":   {"type": "boolean"},
+		"status":   {"type": "string", "enum": []any{"draft", "final"}},
+		"authors":  {"type": "array", "items": map[string]any{"type": "string"}},
+		"missing":  {"type": "string"},
+		"nullable": {"type": "string"},
+	}
+
+	values, err := ParseSchemaValues("```json\n{\"title\": \"Report\", \"year\": \"2024\", \"price\": 9.5, \"public\": \"true\", \"status\": \"wip\", \"authors\": [\"a\", \"b\"], \"nullable\": null, \"unknown\": 1}\n```", props)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"title":   "Report",
+		"year":    2024,
+		"price":   9.5,
+		"public":  true,
+		"authors": []string{"a", "b"},
+	}, values)
+
+	_, err = ParseSchemaValues("no json here", props)
+	require.Error(t, err)
+}
@@ -0,0 +1,179 @@
+package transformers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"unicode"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+const LanguageDetectorName = "language"
+
+// LanguageUndetermined is the ISO 639-2 code used if the language could not be detected.
+const LanguageUndetermined = "und"
+
+// LanguageDetector detects the language of the document content and stores its ISO 639-1 code (e.g. "en") in the metadata.
+// Detection is deterministic: non-Latin scripts are mapped to their most common language, Latin script text is scored
+// against stopword lists of common languages (en, de, fr, es, it, pt, nl).
+type LanguageDetector struct {
+	MetadataKey string
+	// PerChunk detects the language of each document (chunk) separately, instead of once for all documents of a file
+	PerChunk bool
+	// MaxChars is the maximum number of characters to look at (default: 10000)
+	MaxChars int
+}
+
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	lang   string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "was", "with", "as", "on", "are", "this", "be", "by", "not", "or", "have", "from", "which", "you", "can"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "des", "auf", "für", "im", "dem", "auch", "es", "von", "werden", "wird", "sind", "oder"},
+	"fr": {"le", "la", "les", "et", "des", "est", "un", "une", "du", "que", "en", "pour", "pas", "dans", "ce", "qui", "sur", "au", "avec", "sont", "par", "ne", "il", "elle"},
+	"es": {"el", "la", "los", "las", "y", "de", "que", "en", "un", "una", "es", "por", "con", "para", "del", "se", "no", "al", "lo", "como", "más", "pero", "sus", "está"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "una", "non", "sono", "del", "della", "con", "si", "le", "da", "gli", "è", "anche", "nel", "alla", "questo", "questa", "ha"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "não", "para", "com", "por", "se", "mais", "no", "na", "dos", "são", "é", "foi"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor", "met", "die", "er", "aan", "ook", "als", "wordt", "bij", "maar", "naar", "worden", "heeft"},
+}
+
+// stopwordIndex maps each stopword to the languages it belongs to
+var stopwordIndex = func() map[string][]string {
+	idx := map[string][]string{}
+	for lang, words := range stopwords {
+		for _, w := range words {
+			idx[w] = append(idx[w], lang)
+		}
+	}
+	return idx
+}()
+
+// DetectLanguage returns the ISO 639-1 code of the language of the given text or LanguageUndetermined.
+func DetectLanguage(text string) string {
+	var latin int
+	scriptCounts := make([]int, len(scriptLanguages))
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for i, sl := range scriptLanguages {
+			if unicode.Is(sl.script, r) {
+				scriptCounts[i]++
+				break
+			}
+		}
+	}
+
+	// Non-Latin scripts
+	best, bestCount, total := -1, 0, 0
+	for i, c := range scriptCounts {
+		total += c
+		if c > bestCount {
+			best, bestCount = i, c
+		}
+	}
+	if total > latin && best >= 0 {
+		lang := scriptLanguages[best].lang
+		// Japanese text commonly uses more Kanji (Han) than Kana
+		if lang == "zh" && scriptCounts[1]+scriptCounts[2] > 0 {
+			lang = "ja"
+		}
+		return lang
+	}
+
+	// Latin script -> score by stopwords
+	scores := map[string]int{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, w := range words {
+		for _, lang := range stopwordIndex[w] {
+			scores[lang]++
+		}
+	}
+
+	type langScore struct {
+		lang  string
+		score int
+	}
+	ranked := make([]langScore, 0, len(scores))
+	for lang, score := range scores {
+		ranked = append(ranked, langScore{lang, score})
+	}
+	slices.SortFunc(ranked, func(a, b langScore) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(a.lang, b.lang))
+	})
+
+	// require a minimum of evidence and a clear winner
+	if len(ranked) == 0 || ranked[0].score < 3 || (len(ranked) > 1 && ranked[1].score == ranked[0].score) {
+		return LanguageUndetermined
+	}
+	return ranked[0].lang
+}
+
+func (l *LanguageDetector) Transform(_ context.Context, docs []vs.Document) ([]vs.Document, error) {
+	key := l.MetadataKey
+	if key == "" {
+		key = "language"
+	}
+	maxChars := l.MaxChars
+	if maxChars <= 0 {
+		maxChars = 10000
+	}
+
+	truncate := func(s string) string {
+		if len(s) > maxChars {
+			return s[:maxChars]
+		}
+		return s
+	}
+
+	var fileLang string
+	if !l.PerChunk {
+		var sb strings.Builder
+		for _, doc := range docs {
+			if sb.Len() >= maxChars {
+				break
+			}
+			sb.WriteString(doc.Content)
+			sb.WriteString("\n")
+		}
+		fileLang = DetectLanguage(truncate(sb.String()))
+	}
+
+	for i, doc := range docs {
+		lang := fileLang
+		if l.PerChunk {
+			lang = DetectLanguage(truncate(doc.Content))
+		}
+		if docs[i].Metadata == nil {
+			docs[i].Metadata = map[string]any{}
+		}
+		docs[i].Metadata[key] = lang
+	}
+
+	return docs, nil
+}
+
+func (l *LanguageDetector) Name() string {
+	return LanguageDetectorName
+}
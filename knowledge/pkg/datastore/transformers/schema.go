@@ -0,0 +1,233 @@
+package transformers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gptscript-ai/knowledge/pkg/llm"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+const SchemaExtractorName = "schema_extractor"
+
+// SchemaExtractor prompts an LLM to fill a user-defined JSON schema (of type object) for each document (chunk).
+// The resulting values are validated and converted to the types declared in the schema, so that they can be used
+// in metadata filters at retrieval time. Supported property types are string, integer, number, boolean and
+// arrays of those (stored as comma-separated string). Values that don't match the schema are dropped.
+type SchemaExtractor struct {
+	Model  llm.LLMConfig
+	Schema map[string]any
+	// MetadataPrefix is prepended to all metadata keys, e.g. "extracted_"
+	MetadataPrefix string
+}
+
+var schemaExtractorTpl = `Extract the information described by the following JSON schema from the document below.
+Respond with a single JSON object that validates against the schema and nothing else. Use null for values that are not present in the document.
+
+JSON schema:
+{.schema}
+
+Document:
+{.content}
+`
+
+func (s *SchemaExtractor) properties() (map[string]map[string]any, error) {
+	rawProps, ok := s.Schema["properties"].(map[string]any)
+	if !ok || len(rawProps) == 0 {
+		return nil, fmt.Errorf("schema must be a JSON schema of type object with at least one property")
+	}
+	props := make(map[string]map[string]any, len(rawProps))
+	for name, p := range rawProps {
+		prop, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid schema for property %q: expected an object", name)
+		}
+		props[name] = prop
+	}
+	return props, nil
+}
+
+func (s *SchemaExtractor) Transform(ctx context.Context, docs []vs.Document) ([]vs.Document, error) {
+	props, err := s.properties()
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := json.Marshal(s.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	m, err := llm.NewFromConfig(s.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, doc := range docs {
+		result, err := m.Prompt(ctx, schemaExtractorTpl, map[string]any{"schema": string(schema), "content": strings.TrimSpace(doc.Content)})
+		if err != nil {
+			return nil, err
+		}
+
+		values, err := ParseSchemaValues(result, props)
+		if err != nil {
+			slog.Warn("Failed to parse schema extraction result - skipping document", "error", err, "result", result)
+			continue
+		}
+
+		slog.Debug("Extracted schema values", "values", values)
+
+		if docs[i].Metadata == nil {
+			docs[i].Metadata = map[string]any{}
+		}
+		for k, v := range values {
+			if list, ok := v.([]string); ok {
+				setListValues(docs[i].Metadata, s.MetadataPrefix+k, list)
+				continue
+			}
+			docs[i].Metadata[s.MetadataPrefix+k] = v
+		}
+	}
+
+	return docs, nil
+}
+
+func (s *SchemaExtractor) Name() string {
+	return SchemaExtractorName
+}
+
+// ParseSchemaValues parses the JSON object in the (LLM) response and converts its values to the types declared
+// in the given schema properties. Unknown properties, null values and values that don't match the schema are dropped.
+// Array values are returned as []string.
+func ParseSchemaValues(response string, props map[string]map[string]any) (map[string]any, error) {
+	response = strings.TrimSpace(response)
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object found in response")
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(response[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON object: %w", err)
+	}
+
+	values := make(map[string]any, len(raw))
+	for name, prop := range props {
+		v, ok := raw[name]
+		if !ok || v == nil {
+			continue
+		}
+
+		typ, _ := prop["type"].(string)
+		if typ == "array" {
+			items, _ := prop["items"].(map[string]any)
+			list, ok := v.([]any)
+			if !ok {
+				slog.Debug("Dropping schema value: expected array", "property", name, "value", v)
+				continue
+			}
+			var converted []string
+			for _, item := range list {
+				cv, err := convertSchemaValue(item, items)
+				if err != nil {
+					slog.Debug("Dropping schema array item", "property", name, "value", item, "error", err)
+					continue
+				}
+				converted = append(converted, fmt.Sprint(cv))
+			}
+			if len(converted) > 0 {
+				values[name] = converted
+			}
+			continue
+		}
+
+		cv, err := convertSchemaValue(v, prop)
+		if err != nil {
+			slog.Debug("Dropping schema value", "property", name, "value", v, "error", err)
+			continue
+		}
+		values[name] = cv
+	}
+
+	return values, nil
+}
+
+// convertSchemaValue converts a scalar JSON value to the type declared in the property schema.
+func convertSchemaValue(v any, prop map[string]any) (any, error) {
+	if v == nil {
+		return nil, fmt.Errorf("null value")
+	}
+
+	typ, _ := prop["type"].(string)
+
+	var converted any
+	switch typ {
+	case "integer":
+		switch t := v.(type) {
+		case float64:
+			if t != math.Trunc(t) {
+				return nil, fmt.Errorf("not an integer: %v", t)
+			}
+			converted = int(t)
+		case string:
+			i, err := strconv.Atoi(strings.TrimSpace(t))
+			if err != nil {
+				return nil, fmt.Errorf("not an integer: %q", t)
+			}
+			converted = i
+		default:
+			return nil, fmt.Errorf("not an integer: %v", v)
+		}
+	case "number":
+		switch t := v.(type) {
+		case float64:
+			converted = t
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+			if err != nil {
+				return nil, fmt.Errorf("not a number: %q", t)
+			}
+			converted = f
+		default:
+			return nil, fmt.Errorf("not a number: %v", v)
+		}
+	case "boolean":
+		switch t := v.(type) {
+		case bool:
+			converted = t
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(t))
+			if err != nil {
+				return nil, fmt.Errorf("not a boolean: %q", t)
+			}
+			converted = b
+		default:
+			return nil, fmt.Errorf("not a boolean: %v", v)
+		}
+	case "string", "":
+		switch t := v.(type) {
+		case string:
+			converted = t
+		case float64, bool:
+			converted = fmt.Sprint(t)
+		default:
+			return nil, fmt.Errorf("not a string: %v", v)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %q", typ)
+	}
+
+	if enum, ok := prop["enum"].([]any); ok && len(enum) > 0 {
+		if !slices.ContainsFunc(enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(converted) }) {
+			return nil, fmt.Errorf("value %v not in enum %v", converted, enum)
+		}
+	}
+
+	return converted, nil
+}
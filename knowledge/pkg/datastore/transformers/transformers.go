@@ -11,6 +11,12 @@ var TransformerMap = map[string]dstypes.DocumentTransformer{
 	FilterMarkdownDocsNoContentName: &FilterMarkdownDocsNoContent{},
 	KeywordExtractorName:            &KeywordExtractor{},
 	MetadataManipulatorName:         &MetadataManipulator{},
+	LanguageDetectorName:            &LanguageDetector{},
+	DateExtractorName:               &DateExtractor{},
+	EmailExtractorName:              &EmailExtractor{},
+	URLExtractorName:                &URLExtractor{},
+	HeadingsPathName:                &HeadingsPath{},
+	SchemaExtractorName:             &SchemaExtractor{},
 }
 
 func GetTransformer(name string) (dstypes.DocumentTransformer, error) {
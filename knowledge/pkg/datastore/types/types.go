@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"time"
 
 	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 )
@@ -41,4 +42,98 @@ type RetrievalResponse struct {
 	Datasets  []string   `json:"queriedDatasets"`
 	Responses []Response `json:"subqueryResults"`
 	Stats     Stats      `json:"stats,omitempty"`
+	// Explanation is only set if requested, see RetrieveOpts.Explain
+	Explanation *RetrievalExplanation `json:"explain,omitempty"`
+}
+
+// RetrievalExplanation records what each stage of a retrieval flow did, to debug poor retrieval results.
+type RetrievalExplanation struct {
+	Stages []ExplainStage `json:"stages"`
+}
+
+const (
+	ExplainStageQueryModifier = "queryModifier"
+	ExplainStageRetriever     = "retriever"
+	ExplainStagePostprocessor = "postprocessor"
+)
+
+// ExplainStage is the state after a stage (query modifier, retriever or postprocessor) of a retrieval flow.
+type ExplainStage struct {
+	Type            string  `json:"type"`
+	Name            string  `json:"name"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	// Queries are the queries produced by a query modifier
+	Queries []string `json:"queries,omitempty"`
+	// Results are the candidate documents per query after a retriever or postprocessor
+	Results []ExplainResult `json:"results,omitempty"`
+}
+
+type ExplainResult struct {
+	Query     string            `json:"subquery"`
+	Documents []ExplainDocument `json:"documents"`
+	// Removed are the documents that were dropped by this stage, with their rank and score before
+	Removed []ExplainDocument `json:"removed,omitempty"`
+}
+
+// Changes of a document by a postprocessor
+const (
+	ExplainChangeAdded    = "added"
+	ExplainChangeRemoved  = "removed"
+	ExplainChangeMoved    = "moved"
+	ExplainChangeRescored = "rescored"
+)
+
+type ExplainDocument struct {
+	ID     string  `json:"id"`
+	Source string  `json:"source,omitempty"`
+	Rank   int     `json:"rank"`
+	Score  float32 `json:"score"`
+	// Change, PreviousRank and PreviousScore are set if a postprocessor added, removed, moved or rescored the document
+	Change        string   `json:"change,omitempty"`
+	PreviousRank  int      `json:"previousRank,omitempty"`
+	PreviousScore *float32 `json:"previousScore,omitempty"`
+}
+
+// DatasetStats summarizes the contents of a dataset (i.e. the current versions of its files) across the index and the vector store.
+type DatasetStats struct {
+	ID                  string         `json:"id"`
+	Files               int            `json:"files"`
+	FilesByType         map[string]int `json:"filesByType"`
+	Chunks              int            `json:"chunks"`
+	ChunkTokens         TokenStats     `json:"chunkTokens"`
+	EmbeddingDimensions int            `json:"embeddingDimensions"`
+	// EmbeddingQuantization is the quantization of the stored embeddings ("none" for full precision)
+	EmbeddingQuantization string     `json:"embeddingQuantization,omitempty"`
+	VectorStoreSizeBytes  int64      `json:"vectorStoreSizeBytes"`
+	LastIngestedAt        *time.Time `json:"lastIngestedAt,omitempty"`
+	// EmptyFiles are the paths of files that didn't produce any documents
+	EmptyFiles []string `json:"emptyFiles"`
+}
+
+type TokenStats struct {
+	Average float64 `json:"average"`
+	Min     int     `json:"min"`
+	Max     int     `json:"max"`
+	// Uncounted is the number of chunks without a token count, which aren't included in the stats - they were ingested
+	// before token counts were recorded or while the tokenizer wasn't available
+	Uncounted int `json:"uncounted,omitempty"`
+}
+
+// QuantizationBenchmark compares the recall of quantized embeddings to full precision ones for a sample of a dataset.
+type QuantizationBenchmark struct {
+	Dataset    string                        `json:"dataset"`
+	Documents  int                           `json:"documents"`
+	Queries    int                           `json:"queries"`
+	TopK       int                           `json:"topK"`
+	Dimensions int                           `json:"dimensions"`
+	Results    []QuantizationBenchmarkResult `json:"results"`
+}
+
+type QuantizationBenchmarkResult struct {
+	Quantization string `json:"quantization"`
+	Rescore      bool   `json:"rescore"`
+	// BytesPerVector is the storage size of an embedding (including the full precision one, if rescored)
+	BytesPerVector int64 `json:"bytesPerVector"`
+	// Recall is the share of the exact top k results that were found with the quantized embeddings
+	Recall float64 `json:"recall"`
 }
@@ -0,0 +1,124 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+type asOfKey struct{}
+
+func withAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// asOfFromCtx returns the point in time to retrieve documents for - zero means "now".
+func asOfFromCtx(ctx context.Context) time.Time {
+	t, _ := ctx.Value(asOfKey{}).(time.Time)
+	return t
+}
+
+// hiddenDocumentIDs returns the IDs of all documents that belong to file versions which were not current at the
+// point in time set on the context.
+func (s *Datastore) hiddenDocumentIDs(ctx context.Context, datasetID string) (map[string]struct{}, error) {
+	return s.Index.HiddenDocumentIDs(ctx, datasetID, asOfFromCtx(ctx))
+}
+
+const (
+	// versionOverFetchFactor is the factor by which the number of fetched documents is increased if not enough of them
+	// belong to visible file versions
+	versionOverFetchFactor = 4
+	// maxVersionOverFetch is the maximum number of documents fetched to find enough documents of visible file versions
+	maxVersionOverFetch = 4096
+)
+
+// searchDocumentVersions runs the search for the numDocuments most similar documents that aren't hidden. It starts with
+// fetching twice as many documents at most and fetches more while too many of them are hidden - up to the number of hidden
+// documents more (or maxVersionOverFetch), so a search doesn't fetch all documents of old versions.
+func searchDocumentVersions(hidden map[string]struct{}, numDocuments int, search func(k int) ([]vs.Document, error)) ([]vs.Document, error) {
+	limit := max(numDocuments, min(numDocuments+len(hidden), maxVersionOverFetch))
+	k := min(numDocuments+min(len(hidden), numDocuments), limit)
+	for {
+		docs, err := search(k)
+		if err != nil {
+			return nil, err
+		}
+		filtered := filterDocumentVersions(docs, hidden, numDocuments)
+		if len(filtered) >= numDocuments || len(docs) < k || k >= limit {
+			return filtered, nil
+		}
+		k = min(k*versionOverFetchFactor, limit)
+		slog.Debug("Not enough documents of visible file versions found - increasing k", "found", len(filtered), "k", k)
+	}
+}
+
+func filterDocumentVersions(docs []vs.Document, hidden map[string]struct{}, limit int) []vs.Document {
+	if len(hidden) == 0 {
+		if len(docs) > limit {
+			docs = docs[:limit]
+		}
+		return docs
+	}
+
+	filtered := make([]vs.Document, 0, min(len(docs), limit))
+	for _, doc := range docs {
+		if len(filtered) >= limit {
+			break
+		}
+		if _, ok := hidden[doc.ID]; ok {
+			continue
+		}
+		filtered = append(filtered, doc)
+	}
+	return filtered
+}
+
+// supersedeFile marks the given file as superseded by a newer version.
+func (s *Datastore) supersedeFile(ctx context.Context, file types.File, at time.Time) error {
+	file.SupersededAt = &at
+	file.Documents = nil
+	return s.Index.UpdateFile(ctx, file)
+}
+
+type PruneVersionsOpts struct {
+	// Retention overrides the dataset's retention policy
+	Retention *types.VersionRetention
+	DryRun    bool
+}
+
+// PruneFileVersions removes all superseded file versions that exceed the retention policy of the dataset.
+// If the dataset doesn't have versioning enabled (anymore), all superseded versions are removed.
+func (s *Datastore) PruneFileVersions(ctx context.Context, datasetID string, opts PruneVersionsOpts) ([]types.File, error) {
+	ds, err := s.GetDataset(ctx, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	if ds == nil {
+		return nil, fmt.Errorf("dataset not found: %s", datasetID)
+	}
+
+	retention := ds.VersionRetention
+	if opts.Retention != nil {
+		retention = opts.Retention
+	}
+
+	expired := retention.ExpiredVersions(ds.Files, time.Now())
+
+	slog.Info("Pruning file versions", "dataset", datasetID, "count", len(expired), "retention", retention, "dryRun", opts.DryRun)
+
+	if opts.DryRun {
+		return expired, nil
+	}
+
+	for _, f := range expired {
+		if err := s.DeleteFile(ctx, datasetID, f.ID); err != nil {
+			return nil, fmt.Errorf("failed to prune version %d of file %q: %w", f.Version, f.AbsolutePath, err)
+		}
+	}
+
+	return expired, nil
+}
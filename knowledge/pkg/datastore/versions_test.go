@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"fmt"
+	"testing"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchDocumentVersions(t *testing.T) {
+	// 10000 documents ranked by similarity, of which every other one belongs to an old file version
+	docs := make([]vs.Document, 10000)
+	hidden := map[string]struct{}{}
+	for i := range docs {
+		docs[i] = vs.Document{ID: fmt.Sprintf("doc-%d", i)}
+		if i%2 == 0 {
+			hidden[docs[i].ID] = struct{}{}
+		}
+	}
+	var ks []int
+	search := func(docs []vs.Document) func(k int) ([]vs.Document, error) {
+		ks = nil
+		return func(k int) ([]vs.Document, error) {
+			ks = append(ks, k)
+			return docs[:min(k, len(docs))], nil
+		}
+	}
+
+	res, err := searchDocumentVersions(hidden, 5, search(docs))
+	require.NoError(t, err)
+	require.Len(t, res, 5)
+	require.Equal(t, "doc-1", res[0].ID)
+	require.Equal(t, []int{10}, ks, "at most twice as many documents are fetched first")
+
+	var onlyHidden, visible []vs.Document
+	for _, doc := range docs {
+		if _, ok := hidden[doc.ID]; ok {
+			onlyHidden = append(onlyHidden, doc)
+		} else {
+			visible = append(visible, doc)
+		}
+	}
+
+	// more documents are fetched while too many are hidden
+	res, err = searchDocumentVersions(hidden, 5, search(append(onlyHidden[:30:30], visible...)))
+	require.NoError(t, err)
+	require.Len(t, res, 5)
+	require.Equal(t, "doc-1", res[0].ID)
+	require.Equal(t, []int{10, 40}, ks)
+
+	// but not all hidden ones
+	res, err = searchDocumentVersions(hidden, 5, search(onlyHidden))
+	require.NoError(t, err)
+	require.Empty(t, res)
+	require.Equal(t, []int{10, 40, 160, 640, 2560, maxVersionOverFetch}, ks)
+
+	// the search stops when there are no more documents
+	res, err = searchDocumentVersions(hidden, 5, search(onlyHidden[:20]))
+	require.NoError(t, err)
+	require.Empty(t, res)
+	require.Equal(t, []int{10, 40}, ks)
+}
@@ -0,0 +1,106 @@
+package flows
+
+import (
+	"time"
+
+	dstypes "github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+// explainer records the state after each stage of a retrieval flow - it's a no-op if nil.
+type explainer struct {
+	explanation dstypes.RetrievalExplanation
+	previous    []dstypes.ExplainResult
+}
+
+func (e *explainer) queries(name string, start time.Time, queries []string) {
+	if e == nil {
+		return
+	}
+	e.explanation.Stages = append(e.explanation.Stages, dstypes.ExplainStage{
+		Type:            dstypes.ExplainStageQueryModifier,
+		Name:            name,
+		DurationSeconds: time.Since(start).Seconds(),
+		Queries:         append([]string(nil), queries...),
+	})
+}
+
+// results records the documents of the response. The documents must be snapshotted right away,
+// as postprocessors may modify the result slices in place.
+func (e *explainer) results(stageType, name string, start time.Time, response *dstypes.RetrievalResponse) {
+	if e == nil {
+		return
+	}
+	current := make([]dstypes.ExplainResult, len(response.Responses))
+	for i, resp := range response.Responses {
+		current[i] = dstypes.ExplainResult{Query: resp.Query, Documents: make([]dstypes.ExplainDocument, len(resp.ResultDocuments))}
+		for rank, doc := range resp.ResultDocuments {
+			current[i].Documents[rank] = explainDocument(doc, rank+1)
+		}
+	}
+
+	stage := dstypes.ExplainStage{
+		Type:            stageType,
+		Name:            name,
+		DurationSeconds: time.Since(start).Seconds(),
+		Results:         current,
+	}
+	if stageType == dstypes.ExplainStagePostprocessor {
+		stage.Results = diffResults(e.previous, current)
+	}
+	e.explanation.Stages = append(e.explanation.Stages, stage)
+	e.previous = current
+}
+
+func explainDocument(doc vs.Document, rank int) dstypes.ExplainDocument {
+	return dstypes.ExplainDocument{ID: doc.ID, Rank: rank, Score: doc.SimilarityScore, Source: vs.DocumentSource(doc)}
+}
+
+// diffResults annotates the current documents with the changes since the previous stage.
+// Results are matched by position, or by query if a postprocessor changed the number of results.
+func diffResults(previous, current []dstypes.ExplainResult) []dstypes.ExplainResult {
+	byQuery := make(map[string]dstypes.ExplainResult, len(previous))
+	for _, p := range previous {
+		byQuery[p.Query] = p
+	}
+
+	diffed := make([]dstypes.ExplainResult, len(current))
+	for i, cur := range current {
+		prev, ok := byQuery[cur.Query]
+		if len(previous) == len(current) {
+			prev, ok = previous[i], true
+		}
+
+		diffed[i] = dstypes.ExplainResult{Query: cur.Query, Documents: make([]dstypes.ExplainDocument, len(cur.Documents))}
+		prevDocs := make(map[string]dstypes.ExplainDocument, len(prev.Documents))
+		for _, d := range prev.Documents {
+			prevDocs[d.ID] = d
+		}
+
+		seen := make(map[string]struct{}, len(cur.Documents))
+		for j, doc := range cur.Documents {
+			seen[doc.ID] = struct{}{}
+			p, found := prevDocs[doc.ID]
+			switch {
+			case !ok:
+			case !found:
+				doc.Change = dstypes.ExplainChangeAdded
+			case p.Score != doc.Score:
+				doc.Change = dstypes.ExplainChangeRescored
+				doc.PreviousRank, doc.PreviousScore = p.Rank, &p.Score
+			case p.Rank != doc.Rank:
+				doc.Change = dstypes.ExplainChangeMoved
+				doc.PreviousRank = p.Rank
+			}
+			diffed[i].Documents[j] = doc
+		}
+
+		for _, d := range prev.Documents {
+			if _, kept := seen[d.ID]; !kept {
+				d.Change = dstypes.ExplainChangeRemoved
+				diffed[i].Removed = append(diffed[i].Removed, d)
+			}
+		}
+	}
+	return diffed
+}
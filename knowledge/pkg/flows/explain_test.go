@@ -0,0 +1,83 @@
+package flows
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gptscript-ai/knowledge/pkg/datastore/postprocessors"
+	"github.com/gptscript-ai/knowledge/pkg/datastore/store"
+	dstypes "github.com/gptscript-ai/knowledge/pkg/datastore/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/philippgille/chromem-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticRetriever struct {
+	docs []vs.Document
+}
+
+func (r *staticRetriever) Retrieve(_ context.Context, _ store.Store, _ string, _ []string, _ map[string]string, _ []chromem.WhereDocument) ([]vs.Document, error) {
+	return append([]vs.Document(nil), r.docs...), nil
+}
+
+func (r *staticRetriever) Name() string                        { return "static" }
+func (r *staticRetriever) DecodeConfig(_ map[string]any) error { return nil }
+func (r *staticRetriever) NormalizedScores() bool              { return true }
+
+type reversePostprocessor struct{}
+
+func (p *reversePostprocessor) Transform(_ context.Context, response *dstypes.RetrievalResponse) error {
+	for _, resp := range response.Responses {
+		docs := resp.ResultDocuments
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+	return nil
+}
+
+func (p *reversePostprocessor) Name() string { return "reverse" }
+
+func TestRetrievalFlowExplain(t *testing.T) {
+	flow := &RetrievalFlow{
+		Retriever: &staticRetriever{docs: []vs.Document{
+			{ID: "a", SimilarityScore: 0.9, Metadata: map[string]any{"absPath": "/a.md"}},
+			{ID: "b", SimilarityScore: 0.5},
+			{ID: "c", SimilarityScore: 0.2},
+		}},
+		Postprocessors: []postprocessors.Postprocessor{
+			&postprocessors.SimilarityPostprocessor{Threshold: 0.3},
+			&reversePostprocessor{},
+		},
+	}
+
+	resp, err := flow.Run(context.Background(), nil, "query", []string{"ds"}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, resp.Explanation)
+
+	resp, err = flow.Run(context.Background(), nil, "query", []string{"ds"}, &RetrievalFlowOpts{Explain: true})
+	require.NoError(t, err)
+	require.NotNil(t, resp.Explanation)
+
+	stages := resp.Explanation.Stages
+	require.Len(t, stages, 3)
+
+	assert.Equal(t, dstypes.ExplainStageRetriever, stages[0].Type)
+	require.Len(t, stages[0].Results, 1)
+	assert.Len(t, stages[0].Results[0].Documents, 3)
+	assert.Equal(t, "/a.md", stages[0].Results[0].Documents[0].Source)
+
+	similarity := stages[1].Results[0]
+	assert.Equal(t, postprocessors.SimilarityPostprocessorName, stages[1].Name)
+	assert.Len(t, similarity.Documents, 2)
+	require.Len(t, similarity.Removed, 1)
+	assert.Equal(t, "c", similarity.Removed[0].ID)
+	assert.Equal(t, dstypes.ExplainChangeRemoved, similarity.Removed[0].Change)
+
+	reversed := stages[2].Results[0]
+	assert.Equal(t, "b", reversed.Documents[0].ID)
+	assert.Equal(t, dstypes.ExplainChangeMoved, reversed.Documents[0].Change)
+	assert.Equal(t, 2, reversed.Documents[0].PreviousRank)
+	assert.Empty(t, reversed.Removed)
+}
@@ -202,6 +202,8 @@ func (f *RetrievalFlow) FillDefaults(topK int) {
 type RetrievalFlowOpts struct {
 	Where         map[string]string
 	WhereDocument []chromem.WhereDocument
+	// Explain records the queries and candidate documents after each stage in the response
+	Explain bool
 }
 
 func (f *RetrievalFlow) Run(ctx context.Context, store store.Store, query string, datasetIDs []string, opts *RetrievalFlowOpts) (*dstypes.RetrievalResponse, error) {
@@ -211,14 +213,21 @@ func (f *RetrievalFlow) Run(ctx context.Context, store store.Store, query string
 		opts = &RetrievalFlowOpts{}
 	}
 
+	var explain *explainer
+	if opts.Explain {
+		explain = &explainer{}
+	}
+
 	queries := []string{query}
 	for _, m := range f.QueryModifiers {
+		stageStartTime := time.Now()
 		mq, err := m.ModifyQueries(queries)
 		if err != nil {
 			return nil, fmt.Errorf("failed to modify queries %v with QueryModifier %q: %w", queries, m.Name(), err)
 		}
 		slog.Debug("Modified queries", "before", queries, "queryModifier", m.Name(), "after", mq)
 		queries = mq
+		explain.queries(m.Name(), stageStartTime, queries)
 	}
 	slog.Debug("Updated query set", "query", query, "modified_query_set", queries, "num_queries", len(queries))
 
@@ -227,6 +236,7 @@ func (f *RetrievalFlow) Run(ctx context.Context, store store.Store, query string
 		Datasets:  datasetIDs,
 		Responses: make([]dstypes.Response, len(queries)),
 	}
+	stageStartTime := time.Now()
 	for i, q := range queries {
 		docs, err := f.Retriever.Retrieve(ctx, store, q, datasetIDs, opts.Where, opts.WhereDocument)
 		if err != nil {
@@ -239,18 +249,24 @@ func (f *RetrievalFlow) Run(ctx context.Context, store store.Store, query string
 			ResultDocuments: docs,
 		}
 	}
+	explain.results(dstypes.ExplainStageRetriever, f.Retriever.Name(), stageStartTime, response)
 
 	for _, pp := range f.Postprocessors {
+		stageStartTime = time.Now()
 		err := pp.Transform(ctx, response)
 		if err != nil {
 			return nil, fmt.Errorf("failed to postprocess retrieval response with Postprocessor %q: %w", pp.Name(), err)
 		}
+		explain.results(dstypes.ExplainStagePostprocessor, pp.Name(), stageStartTime, response)
 	}
 	slog.Debug("Postprocessed RetrievalResponse", "num_responses", len(response.Responses), "original_query", query)
 
 	response.Stats = dstypes.Stats{
 		RetrievalTimeSeconds: time.Since(retrievalFlowStartTime).Seconds(),
 	}
+	if explain != nil {
+		response.Explanation = &explain.explanation
+	}
 
 	return response, nil
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/gptscript-ai/knowledge/pkg/index/postgres"
 	"github.com/gptscript-ai/knowledge/pkg/index/sqlite"
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
@@ -46,3 +47,12 @@ func New(ctx context.Context, dsn string, autoMigrate bool) (Index, error) {
 
 	return indexDB, nil
 }
+
+// NewMigrator opens the index at dsn without migrating it and returns its migrator - closing it closes the index.
+func NewMigrator(ctx context.Context, dsn string) (migrate.Migrator, error) {
+	idx, err := New(ctx, dsn, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Migrator(), nil
+}
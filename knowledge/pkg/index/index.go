@@ -2,13 +2,16 @@ package index
 
 import (
 	"context"
+	"time"
 
 	"github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
 )
 
 type Index interface {
 	// Database Ops
 	AutoMigrate() error
+	Migrator() migrate.Migrator
 
 	// Fundamental Dataset Operations
 	CreateDataset(ctx context.Context, dataset types.Dataset, opts *types.DatasetCreateOpts) error
@@ -26,9 +29,15 @@ type Index interface {
 	DeleteFile(ctx context.Context, datasetID, fileID string) error
 	FindFile(ctx context.Context, searchFile types.File) (*types.File, error)
 	FindFileByMetadata(ctx context.Context, dataset string, metadata types.FileMetadata, includeDocuments bool) (*types.File, error)
+	UpdateFile(ctx context.Context, file types.File) error
+
+	// File Version Operations
+	HiddenDocumentIDs(ctx context.Context, datasetID string, asOf time.Time) (map[string]struct{}, error)
+	LatestFileVersion(ctx context.Context, datasetID, absolutePath string) (int, error)
 
 	// Advanced File Operations
 	PruneFiles(ctx context.Context, datasetID string, pathPrefix string, keep []string) ([]types.File, error)
+	FileStats(ctx context.Context, datasetID string) (*types.FileStats, error)
 
 	// Fundamental Document Operations
 	DeleteDocument(ctx context.Context, documentID, datasetID string) error
@@ -83,10 +83,26 @@ func (i *Index) PruneFiles(ctx context.Context, datasetID string, pathPrefix str
 	return i.DB.PruneFiles(ctx, datasetID, pathPrefix, keep)
 }
 
+func (i *Index) UpdateFile(ctx context.Context, file types.File) error {
+	return i.DB.UpdateFile(ctx, file)
+}
+
 func (i *Index) FindFileByMetadata(ctx context.Context, dataset string, metadata types.FileMetadata, includeDocuments bool) (*types.File, error) {
 	return i.DB.FindFileByMetadata(ctx, dataset, metadata, includeDocuments)
 }
 
+func (i *Index) HiddenDocumentIDs(ctx context.Context, datasetID string, asOf time.Time) (map[string]struct{}, error) {
+	return i.DB.HiddenDocumentIDs(ctx, datasetID, asOf)
+}
+
+func (i *Index) LatestFileVersion(ctx context.Context, datasetID, absolutePath string) (int, error) {
+	return i.DB.LatestFileVersion(ctx, datasetID, absolutePath)
+}
+
+func (i *Index) FileStats(ctx context.Context, datasetID string) (*types.FileStats, error) {
+	return i.DB.FileStats(ctx, datasetID)
+}
+
 func (i *Index) DeleteDocument(ctx context.Context, documentID, datasetID string) error {
 	return i.DB.DeleteDocument(ctx, documentID, datasetID)
 }
@@ -0,0 +1,93 @@
+package types
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	PrincipalPrefixUser  = "user:"
+	PrincipalPrefixGroup = "group:"
+)
+
+// ACL describes who may read a dataset or a file.
+// An empty ACL (or no ACL at all) means that there are no restrictions.
+type ACL struct {
+	Owner  string   `json:"owner,omitempty" mapstructure:"owner"`
+	Groups []string `json:"groups,omitempty" mapstructure:"groups"`
+	// SourcePermissions are the principals that were granted access in the source system (e.g. a OneDrive sharing link).
+	// They're carried in by data source connectors. Entries without a "user:" or "group:" prefix are treated as users.
+	SourcePermissions []string `json:"sourcePermissions,omitempty" mapstructure:"sourcePermissions"`
+}
+
+// IsEmpty returns true if the ACL does not restrict access.
+func (a *ACL) IsEmpty() bool {
+	return a == nil || (a.Owner == "" && len(a.Groups) == 0 && len(a.SourcePermissions) == 0)
+}
+
+// Principals returns the sorted, de-duplicated list of principals that are allowed to read.
+func (a *ACL) Principals() []string {
+	if a.IsEmpty() {
+		return nil
+	}
+
+	var principals []string
+	if a.Owner != "" {
+		principals = append(principals, PrincipalPrefixUser+a.Owner)
+	}
+	for _, g := range a.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			principals = append(principals, PrincipalPrefixGroup+g)
+		}
+	}
+	for _, p := range a.SourcePermissions {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, PrincipalPrefixUser) && !strings.HasPrefix(p, PrincipalPrefixGroup) {
+			p = PrincipalPrefixUser + p
+		}
+		principals = append(principals, p)
+	}
+
+	slices.Sort(principals)
+	return slices.Compact(principals)
+}
+
+// Allows returns true if the given caller may read whatever is protected by this ACL.
+// A nil caller is not subject to access control.
+func (a *ACL) Allows(caller *Identity) bool {
+	if caller == nil || a.IsEmpty() {
+		return true
+	}
+	principals := a.Principals()
+	for _, p := range caller.Principals() {
+		if slices.Contains(principals, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Identity describes the caller of a retrieval request.
+type Identity struct {
+	User   string   `json:"user,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Principals returns the list of principals the caller acts as.
+func (i *Identity) Principals() []string {
+	if i == nil {
+		return nil
+	}
+	var principals []string
+	if i.User != "" {
+		principals = append(principals, PrincipalPrefixUser+i.User)
+	}
+	for _, g := range i.Groups {
+		if g = strings.TrimSpace(g); g != "" {
+			principals = append(principals, PrincipalPrefixGroup+g)
+		}
+	}
+	return principals
+}
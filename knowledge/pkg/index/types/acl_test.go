@@ -0,0 +1,49 @@
+package types
+
+import (
+	"testing"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACLAllows(t *testing.T) {
+	acl := &ACL{
+		Owner:             "alice",
+		Groups:            []string{"eng"},
+		SourcePermissions: []string{"bob@example.com", "group:sales"},
+	}
+
+	require.Equal(t, []string{"group:eng", "group:sales", "user:alice", "user:bob@example.com"}, acl.Principals())
+
+	require.True(t, acl.Allows(nil))
+	require.True(t, acl.Allows(&Identity{User: "alice"}))
+	require.True(t, acl.Allows(&Identity{User: "bob@example.com"}))
+	require.True(t, acl.Allows(&Identity{User: "carol", Groups: []string{"sales"}}))
+	require.False(t, acl.Allows(&Identity{User: "carol", Groups: []string{"marketing"}}))
+	require.False(t, acl.Allows(&Identity{}))
+
+	var empty *ACL
+	require.True(t, empty.Allows(&Identity{User: "carol"}))
+	require.True(t, (&ACL{}).Allows(&Identity{User: "carol"}))
+}
+
+func TestDocumentAllowed(t *testing.T) {
+	acl := &ACL{Owner: "alice", Groups: []string{"eng"}}
+	metadata := map[string]any{vs.DocMetadataKeyACLPrincipals: vs.EncodeACLPrincipals(acl.Principals())}
+
+	require.True(t, vs.DocumentAllowed(metadata, (&Identity{User: "alice"}).Principals()))
+	require.True(t, vs.DocumentAllowed(metadata, (&Identity{User: "bob", Groups: []string{"eng"}}).Principals()))
+	require.False(t, vs.DocumentAllowed(metadata, (&Identity{User: "ali"}).Principals()))
+	require.False(t, vs.DocumentAllowed(metadata, (&Identity{User: "bob", Groups: []string{"en"}}).Principals()))
+	require.True(t, vs.DocumentAllowed(map[string]any{}, (&Identity{User: "bob"}).Principals()))
+
+	// separators and wildcards in principals only match themselves
+	acl = &ACL{Owner: "a_b", Groups: []string{"eng,user:mallory", "100%"}}
+	metadata = map[string]any{vs.DocMetadataKeyACLPrincipals: vs.EncodeACLPrincipals(acl.Principals())}
+	require.True(t, vs.DocumentAllowed(metadata, (&Identity{User: "a_b"}).Principals()))
+	require.True(t, vs.DocumentAllowed(metadata, (&Identity{Groups: []string{"eng,user:mallory"}}).Principals()))
+	require.True(t, vs.DocumentAllowed(metadata, (&Identity{Groups: []string{"100%"}}).Principals()))
+	require.False(t, vs.DocumentAllowed(metadata, (&Identity{User: "mallory"}).Principals()))
+	require.False(t, vs.DocumentAllowed(metadata, (&Identity{User: "a%5Fb"}).Principals()))
+}
@@ -0,0 +1,228 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
+	"gorm.io/gorm"
+)
+
+const (
+	migrationComponent = "index"
+
+	// pgLockIDIndexMigrations is used for an advisory lock, so that only one knowledge process
+	// migrates the index at a time when they share a Postgres database.
+	pgLockIDIndexMigrations = 1573678846307946500
+)
+
+// schemaMigration is a row of the index's migration table.
+type schemaMigration struct {
+	Version     int `gorm:"primaryKey;autoIncrement:false"`
+	Description string
+	AppliedAt   time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "index_schema_migrations"
+}
+
+// indexMigrations are the schema migrations of the index - append new ones and never change released ones.
+// The first migration creates the tables from the current models (which also upgrades databases from before the
+// migrations were versioned), so later migrations must be idempotent, e.g. only add a column if it doesn't exist yet.
+var indexMigrations = []migrate.Step[*gorm.DB]{
+	{
+		Migration: migrate.Migration{Version: 1, Description: "create datasets, files and documents tables"},
+		Up: func(_ context.Context, tx *gorm.DB) error {
+			return tx.AutoMigrate(&Dataset{}, &File{}, &Document{})
+		},
+		Down: func(_ context.Context, tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&Document{}, &File{}, &Dataset{})
+		},
+	},
+	{
+		Migration: migrate.Migration{Version: 2, Description: "add embedding dimensions to datasets"},
+		Up: func(_ context.Context, tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&Dataset{}, "EmbeddingDimensions") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&Dataset{}, "EmbeddingDimensions")
+		},
+		Down: func(_ context.Context, tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Dataset{}, "EmbeddingDimensions")
+		},
+	},
+	{
+		Migration: migrate.Migration{Version: 3, Description: "add token counts to documents"},
+		Up: func(_ context.Context, tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&Document{}, "Tokens") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&Document{}, "Tokens")
+		},
+		Down: func(_ context.Context, tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&Document{}, "Tokens")
+		},
+	},
+}
+
+// DoAutoMigrate applies all pending migrations if auto migration is enabled. Otherwise, it only makes sure that
+// the schema isn't newer than this version of knowledge supports.
+func (db *DB) DoAutoMigrate() error {
+	ctx := context.Background()
+
+	if db.AutoMigrate {
+		return db.Migrator().Up(ctx, 0)
+	}
+
+	status, err := db.Migrator().Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := migrate.CheckVersion(migrationComponent, status.Current, status.Latest); err != nil {
+		return err
+	}
+	if len(status.Pending) > 0 {
+		slog.Warn("Index schema is not up to date and auto migration is disabled - run 'knowledge migrate up'", "current", status.Current, "latest", status.Latest)
+	}
+	return nil
+}
+
+// Migrator returns the migrator of the index - closing it closes the database.
+func (db *DB) Migrator() migrate.Migrator {
+	return &indexMigrator{db: db}
+}
+
+type indexMigrator struct {
+	db *DB
+}
+
+func (m *indexMigrator) Component() string {
+	return migrationComponent
+}
+
+func (m *indexMigrator) Close() error {
+	return m.db.Close()
+}
+
+func (m *indexMigrator) Status(ctx context.Context) (*migrate.Status, error) {
+	applied, err := appliedMigrations(m.db.GormDB.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewStatus(migrationComponent, indexMigrations, applied), nil
+}
+
+func (m *indexMigrator) Up(ctx context.Context, target int) error {
+	return m.run(ctx, true, func(current int) ([]migrate.Step[*gorm.DB], error) {
+		return migrate.PlanUp(indexMigrations, current, target)
+	})
+}
+
+func (m *indexMigrator) Down(ctx context.Context, target int) error {
+	return m.run(ctx, false, func(current int) ([]migrate.Step[*gorm.DB], error) {
+		return migrate.PlanDown(indexMigrations, current, target)
+	})
+}
+
+// run applies or reverts the planned migrations in a single transaction, which is serialized across processes:
+// Postgres uses an advisory lock, SQLite only allows a single writer.
+func (m *indexMigrator) run(ctx context.Context, up bool, plan func(current int) ([]migrate.Step[*gorm.DB], error)) error {
+	if err := migrate.Validate(indexMigrations); err != nil {
+		return err
+	}
+
+	gdb := m.db.GormDB.WithContext(ctx)
+	sqlite := gdb.Dialector.Name() == "sqlite"
+
+	if sqlite {
+		// Create the table outside the transaction: the first statement of the transaction has to be a write, so that it
+		// waits for concurrent migrations (busy_timeout) instead of failing when upgrading from a read to a write lock.
+		if err := createMigrationsTable(gdb); err != nil {
+			return err
+		}
+	}
+
+	return gdb.Transaction(func(tx *gorm.DB) error {
+		if sqlite {
+			if err := tx.Exec("UPDATE index_schema_migrations SET version = version WHERE version < 0").Error; err != nil {
+				return fmt.Errorf("failed to lock index migrations: %w", err)
+			}
+		} else {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", pgLockIDIndexMigrations).Error; err != nil {
+				return fmt.Errorf("failed to lock index migrations: %w", err)
+			}
+			if err := createMigrationsTable(tx); err != nil {
+				return err
+			}
+		}
+
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		status := migrate.NewStatus(migrationComponent, indexMigrations, applied)
+		if err := migrate.CheckVersion(migrationComponent, status.Current, status.Latest); err != nil {
+			return err
+		}
+
+		steps, err := plan(status.Current)
+		if err != nil {
+			return err
+		}
+
+		for _, step := range steps {
+			if up {
+				slog.Info("Applying index migration", "version", step.Version, "description", step.Description)
+				if err := step.Up(ctx, tx); err != nil {
+					return fmt.Errorf("failed to apply index migration %d (%s): %w", step.Version, step.Description, err)
+				}
+				if err := tx.Create(&schemaMigration{Version: step.Version, Description: step.Description, AppliedAt: time.Now()}).Error; err != nil {
+					return fmt.Errorf("failed to record index migration %d: %w", step.Version, err)
+				}
+			} else {
+				slog.Info("Reverting index migration", "version", step.Version, "description", step.Description)
+				if err := step.Down(ctx, tx); err != nil {
+					return fmt.Errorf("failed to revert index migration %d (%s): %w", step.Version, step.Description, err)
+				}
+				if err := tx.Delete(&schemaMigration{}, "version = ?", step.Version).Error; err != nil {
+					return fmt.Errorf("failed to remove index migration %d: %w", step.Version, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func createMigrationsTable(tx *gorm.DB) error {
+	if err := tx.Exec(`CREATE TABLE IF NOT EXISTS index_schema_migrations (
+	version integer PRIMARY KEY,
+	description text,
+	applied_at timestamp)`).Error; err != nil {
+		return fmt.Errorf("failed to create index migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied migrations ordered by version - none if the migration table doesn't exist yet.
+func appliedMigrations(tx *gorm.DB) ([]migrate.AppliedMigration, error) {
+	if !tx.Migrator().HasTable(&schemaMigration{}) {
+		return nil, nil
+	}
+
+	var rows []schemaMigration
+	if err := tx.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get applied index migrations: %w", err)
+	}
+
+	applied := make([]migrate.AppliedMigration, 0, len(rows))
+	for _, r := range rows {
+		applied = append(applied, migrate.AppliedMigration{
+			Migration: migrate.Migration{Version: r.Version, Description: r.Description},
+			AppliedAt: r.AppliedAt,
+		})
+	}
+	return applied, nil
+}
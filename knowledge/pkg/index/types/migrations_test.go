@@ -0,0 +1,71 @@
+package types
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T, path string) *DB {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(path+"?_pragma=busy_timeout(5000)"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	sqlDB, err := gdb.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return &DB{GormDB: gdb, SqlDB: sqlDB, AutoMigrate: true}
+}
+
+func TestIndexMigrations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "index.db")
+
+	// Concurrent processes starting up must not race
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		db := openTestDB(t, path)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = db.DoAutoMigrate()
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	db := openTestDB(t, path)
+	m := db.Migrator()
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Equal(t, len(indexMigrations), status.Current)
+	require.Len(t, status.Applied, len(indexMigrations))
+	require.Empty(t, status.Pending)
+	require.True(t, db.GormDB.Migrator().HasTable(&Dataset{}))
+
+	require.NoError(t, m.Down(ctx, 0))
+	require.False(t, db.GormDB.Migrator().HasTable(&Dataset{}))
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, status.Current)
+	require.Len(t, status.Pending, len(indexMigrations))
+
+	require.NoError(t, m.Up(ctx, 0))
+	require.True(t, db.GormDB.Migrator().HasTable(&Dataset{}))
+
+	// Refuse to work with a schema migrated by a newer version
+	require.NoError(t, db.GormDB.Create(&schemaMigration{Version: len(indexMigrations) + 1, Description: "future"}).Error)
+	require.ErrorIs(t, m.Up(ctx, 0), migrate.ErrSchemaTooNew)
+	db.AutoMigrate = false
+	require.ErrorIs(t, db.DoAutoMigrate(), migrate.ErrSchemaTooNew)
+}
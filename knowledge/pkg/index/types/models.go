@@ -4,10 +4,13 @@ import (
 	"time"
 
 	"github.com/gptscript-ai/knowledge/pkg/config"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 )
 
 type DatasetCreateOpts struct {
 	ErrOnExists bool
+	// Quantization configures how the dataset's embeddings are stored by the vector store (nil = full precision)
+	Quantization *vs.QuantizationConfig
 }
 
 // Dataset refers to a VectorDB data space.
@@ -17,6 +20,10 @@ type Dataset struct {
 	EmbeddingsProviderConfig *config.ModelProviderConfig `json:"embeddingsProviderConfig,omitempty" gorm:"serializer:json"`
 	Files                    []File                      `gorm:"foreignKey:Dataset;references:ID;constraint:OnDelete:CASCADE;"`
 	Metadata                 map[string]any              `json:"metadata,omitempty" gorm:"serializer:json"`
+	ACL                      *ACL                        `json:"acl,omitempty" gorm:"serializer:json"`
+	VersionRetention         *VersionRetention           `json:"versionRetention,omitempty" gorm:"serializer:json"`
+	// EmbeddingDimensions is the number of dimensions of the dataset's embeddings, recorded on first ingestion - 0 means unknown
+	EmbeddingDimensions int `json:"embeddingDimensions,omitempty"`
 }
 
 type File struct {
@@ -25,6 +32,13 @@ type File struct {
 	Documents []Document `gorm:"foreignKey:FileID,Dataset;references:ID,Dataset;constraint:OnDelete:CASCADE;"`
 	// File metadata, commonly used for deduplication
 	FileMetadata `json:",inline"`
+	// ACL restricts who may read this file, in addition to the dataset's ACL - if unset, only the dataset's ACL applies
+	ACL *ACL `json:"acl,omitempty" gorm:"serializer:json"`
+	// Version of the file at AbsolutePath, starting at 1 - only incremented if the dataset has versioning enabled
+	Version    int       `gorm:"default:1" json:"version"`
+	IngestedAt time.Time `json:"ingested_at"`
+	// SupersededAt is set once a newer version of the file was ingested - nil means this is the current version
+	SupersededAt *time.Time `gorm:"index" json:"superseded_at,omitempty"`
 }
 
 type FileMetadata struct {
@@ -39,4 +53,6 @@ type Document struct {
 	Dataset string `gorm:"primaryKey" json:"dataset"` // Foreign key to Dataset, part of composite primary key with FileID
 	FileID  string `gorm:"primaryKey" json:"file_id"` // Foreign key to File, part of composite primary key with Dataset
 	Index   int    `gorm:"index" json:"index"`        // Index of the document in the file (~ location within file, 0-based)
+	// Tokens is the number of tokens of the document's content - 0 for documents ingested before they were counted
+	Tokens int `json:"tokens,omitempty"`
 }
@@ -0,0 +1,94 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FileStats aggregates the current file versions of a dataset and their documents.
+type FileStats struct {
+	Files int
+	// FilesByName is the number of files by their name
+	FilesByName    map[string]int
+	LastIngestedAt *time.Time
+	// EmptyFiles are the paths of files without documents, sorted
+	EmptyFiles []string
+
+	Documents int
+	// CountedDocuments is the number of documents with a token count, which the token stats are computed from
+	CountedDocuments int
+	TokensMin        int
+	TokensMax        int
+	TokensAvg        float64
+}
+
+// FileStats computes the statistics of the current file versions of the dataset in the database, without loading them.
+// It returns nil if the dataset doesn't exist.
+func (db *DB) FileStats(ctx context.Context, datasetID string) (*FileStats, error) {
+	var datasets int64
+	if err := db.WithContext(ctx).Model(&Dataset{}).Where("id = ?", datasetID).Count(&datasets).Error; err != nil {
+		return nil, fmt.Errorf("failed to get dataset %q from DB: %w", datasetID, err)
+	}
+	if datasets == 0 {
+		return nil, nil
+	}
+
+	stats := &FileStats{FilesByName: map[string]int{}}
+	current := func() *gorm.DB {
+		return db.WithContext(ctx).Model(&File{}).Where("files.dataset = ? AND files.superseded_at IS NULL", datasetID)
+	}
+
+	var byName []struct {
+		Name  string
+		Count int
+	}
+	if err := current().Select("name, COUNT(*) AS count").Group("name").Scan(&byName).Error; err != nil {
+		return nil, fmt.Errorf("failed to count files: %w", err)
+	}
+	for _, n := range byName {
+		stats.FilesByName[n.Name] = n.Count
+		stats.Files += n.Count
+	}
+
+	var lastIngested []time.Time
+	if err := current().Order("ingested_at DESC").Limit(1).Pluck("ingested_at", &lastIngested).Error; err != nil {
+		return nil, fmt.Errorf("failed to get last ingestion: %w", err)
+	}
+	if len(lastIngested) > 0 && !lastIngested[0].IsZero() {
+		stats.LastIngestedAt = &lastIngested[0]
+	}
+
+	docs := db.WithContext(ctx).Model(&Document{}).
+		Joins("JOIN files ON files.id = documents.file_id AND files.dataset = documents.dataset").
+		Where("documents.dataset = ? AND files.superseded_at IS NULL", datasetID)
+	var tokens struct {
+		Documents        int
+		CountedDocuments int
+		TokensMin        *int
+		TokensMax        *int
+		TokensAvg        *float64
+	}
+	err := docs.Select("COUNT(*) AS documents, COUNT(NULLIF(documents.tokens, 0)) AS counted_documents, " +
+		"MIN(NULLIF(documents.tokens, 0)) AS tokens_min, MAX(documents.tokens) AS tokens_max, AVG(NULLIF(documents.tokens, 0)) AS tokens_avg").
+		Scan(&tokens).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+	stats.Documents, stats.CountedDocuments = tokens.Documents, tokens.CountedDocuments
+	if tokens.TokensMin != nil {
+		stats.TokensMin, stats.TokensMax, stats.TokensAvg = *tokens.TokensMin, *tokens.TokensMax, *tokens.TokensAvg
+	}
+
+	err = current().
+		Joins("LEFT JOIN documents ON documents.file_id = files.id AND documents.dataset = files.dataset").
+		Where("documents.id IS NULL").
+		Order("files.absolute_path").
+		Pluck("files.absolute_path", &stats.EmptyFiles).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files without documents: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStats(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(t.TempDir(), "index.db"))
+	require.NoError(t, db.DoAutoMigrate())
+	require.NoError(t, db.CreateDataset(ctx, Dataset{ID: "ds"}, nil))
+	require.NoError(t, db.CreateDataset(ctx, Dataset{ID: "other"}, nil))
+
+	stats, err := db.FileStats(ctx, "missing")
+	require.NoError(t, err)
+	require.Nil(t, stats)
+
+	stats, err = db.FileStats(ctx, "ds")
+	require.NoError(t, err)
+	require.Equal(t, &FileStats{FilesByName: map[string]int{}, EmptyFiles: []string{}}, stats)
+
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	file := func(id, dataset, path string, ingestedAt time.Time, supersededAt *time.Time, tokens ...int) File {
+		f := File{
+			ID:           id,
+			Dataset:      dataset,
+			FileMetadata: FileMetadata{Name: filepath.Base(path), AbsolutePath: path},
+			IngestedAt:   ingestedAt,
+			SupersededAt: supersededAt,
+		}
+		for i, n := range tokens {
+			f.Documents = append(f.Documents, Document{ID: id + "-" + string(rune('a'+i)), FileID: id, Dataset: dataset, Index: i, Tokens: n})
+		}
+		return f
+	}
+	for _, f := range []File{
+		file("a1", "ds", "/docs/a.md", t1, &t2, 1000, 1000), // superseded
+		file("a2", "ds", "/docs/a.md", t2, nil, 10, 30),
+		file("b", "ds", "/docs/sub/a.md", t1, nil, 20, 0), // the second document was ingested before tokens were counted
+		file("c", "ds", "/docs/c.pdf", t1, nil),
+		file("d", "other", "/docs/d.md", t2.Add(time.Hour), nil, 5),
+	} {
+		require.NoError(t, db.CreateFile(ctx, f))
+	}
+
+	stats, err = db.FileStats(ctx, "ds")
+	require.NoError(t, err)
+	require.Equal(t, 3, stats.Files)
+	require.Equal(t, map[string]int{"a.md": 2, "c.pdf": 1}, stats.FilesByName)
+	require.NotNil(t, stats.LastIngestedAt)
+	require.True(t, t2.Equal(*stats.LastIngestedAt))
+	require.Equal(t, []string{"/docs/c.pdf"}, stats.EmptyFiles)
+	require.Equal(t, 4, stats.Documents)
+	require.Equal(t, 3, stats.CountedDocuments)
+	require.Equal(t, 10, stats.TokensMin)
+	require.Equal(t, 30, stats.TokensMax)
+	require.InDelta(t, 20, stats.TokensAvg, 0.001)
+}
@@ -16,18 +16,6 @@ type DB struct {
 	AutoMigrate bool
 }
 
-func (db *DB) DoAutoMigrate() error {
-	if !db.AutoMigrate {
-		return nil
-	}
-
-	return db.GormDB.AutoMigrate(
-		&Dataset{},
-		&File{},
-		&Document{},
-	)
-}
-
 func (db *DB) UpdateDataset(ctx context.Context, dataset Dataset) error {
 	gdb := db.GormDB.WithContext(ctx)
 
@@ -157,14 +145,22 @@ func (db *DB) FindFile(ctx context.Context, searchFile File) (*File, error) {
 	}
 
 	var file File
-	var tx *gorm.DB
+	tx := db.WithContext(ctx).Preload("Documents").Where("dataset = ?", searchFile.Dataset)
 	if searchFile.ID != "" {
-		tx = db.WithContext(ctx).Preload("Documents").Where("dataset = ? AND id = ?", searchFile.Dataset, searchFile.ID).First(&file)
+		tx = tx.Where("id = ?", searchFile.ID)
 	} else if searchFile.AbsolutePath != "" {
-		tx = db.WithContext(ctx).Preload("Documents").Where("dataset = ? AND absolute_path = ?", searchFile.Dataset, searchFile.AbsolutePath).First(&file)
+		tx = tx.Where("absolute_path = ?", searchFile.AbsolutePath)
+		if searchFile.Version <= 0 {
+			// without an explicit version, the path refers to the current version of the file
+			tx = tx.Where("superseded_at IS NULL")
+		}
 	} else {
 		return nil, fmt.Errorf("either fileID or fileAbsPath must be provided")
 	}
+	if searchFile.Version > 0 {
+		tx = tx.Where("version = ?", searchFile.Version)
+	}
+	tx = tx.First(&file)
 	if tx.Error != nil {
 		return nil, ErrDBFileNotFound
 	}
@@ -172,13 +168,14 @@ func (db *DB) FindFile(ctx context.Context, searchFile File) (*File, error) {
 	return &file, nil
 }
 
+// FindFileByMetadata returns the current version of the file matching the given metadata.
 func (db *DB) FindFileByMetadata(ctx context.Context, dataset string, metadata FileMetadata, includeDocuments bool) (*File, error) {
 	var file File
 	tx := db.WithContext(ctx)
 	if includeDocuments {
 		tx = tx.Preload("Documents")
 	}
-	tx = tx.Where("dataset = ?", dataset)
+	tx = tx.Where("dataset = ? AND superseded_at IS NULL", dataset)
 
 	if metadata.Name != "" {
 		tx = tx.Where("name = ?", metadata.Name)
@@ -245,3 +242,16 @@ func (db *DB) CreateFile(ctx context.Context, file File) error {
 	gdb.Commit()
 	return nil
 }
+
+func (db *DB) UpdateFile(ctx context.Context, file File) error {
+	gdb := db.GormDB.WithContext(ctx)
+
+	slog.Debug("Updating file in DB", "id", file.ID, "version", file.Version, "superseded_at", file.SupersededAt)
+	err := gdb.Omit("Documents").Save(&file).Error
+	if err != nil {
+		return err
+	}
+
+	gdb.Commit()
+	return nil
+}
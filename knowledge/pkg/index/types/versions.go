@@ -0,0 +1,120 @@
+package types
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// VersionRetention enables file versioning for a dataset: when a file is re-ingested, its previous version is
+// kept (marked as superseded) instead of being deleted, so that it can still be retrieved as of an earlier time.
+// Superseded versions are removed by pruning as soon as they exceed any of the configured limits.
+// Zero values mean "no limit".
+type VersionRetention struct {
+	// KeepLast is the maximum number of versions (including the current one) to keep per file
+	KeepLast int `json:"keepLast,omitempty"`
+	// KeepDays is the number of days a superseded version is kept for
+	KeepDays int `json:"keepDays,omitempty"`
+}
+
+// VersioningEnabled returns true if previous file versions should be kept for the dataset.
+func (d *Dataset) VersioningEnabled() bool {
+	return d != nil && d.VersionRetention != nil
+}
+
+// IsCurrent returns true if the file is the current (latest) version.
+func (f *File) IsCurrent() bool {
+	return f.SupersededAt == nil
+}
+
+// ValidAt returns true if this version of the file was the current one at the given time.
+// A zero time refers to "now".
+func (f *File) ValidAt(t time.Time) bool {
+	if t.IsZero() {
+		return f.IsCurrent()
+	}
+	// Files ingested before versioning was introduced don't have an ingestion timestamp
+	if !f.IngestedAt.IsZero() && f.IngestedAt.After(t) {
+		return false
+	}
+	return f.SupersededAt == nil || f.SupersededAt.After(t)
+}
+
+// ExpiredVersions returns the superseded file versions that violate the retention policy at the given time.
+// A nil policy keeps no superseded versions at all. Current versions are never returned.
+func (r *VersionRetention) ExpiredVersions(files []File, now time.Time) []File {
+	byPath := map[string][]File{}
+	for _, f := range files {
+		byPath[f.AbsolutePath] = append(byPath[f.AbsolutePath], f)
+	}
+
+	var expired []File
+	for _, versions := range byPath {
+		// newest first
+		slices.SortFunc(versions, func(a, b File) int {
+			return cmp.Compare(b.Version, a.Version)
+		})
+		for idx, f := range versions {
+			if f.IsCurrent() {
+				continue
+			}
+			switch {
+			case r == nil:
+				expired = append(expired, f)
+			case r.KeepLast > 0 && idx >= r.KeepLast:
+				expired = append(expired, f)
+			case r.KeepDays > 0 && f.SupersededAt.Before(now.AddDate(0, 0, -r.KeepDays)):
+				expired = append(expired, f)
+			}
+		}
+	}
+
+	slices.SortFunc(expired, func(a, b File) int {
+		return cmp.Or(cmp.Compare(a.AbsolutePath, b.AbsolutePath), cmp.Compare(a.Version, b.Version))
+	})
+
+	return expired
+}
+
+// HiddenDocumentIDs returns the IDs of all documents that belong to file versions which were not current at the
+// given time (a zero time refers to "now"), see File.ValidAt.
+func (db *DB) HiddenDocumentIDs(ctx context.Context, datasetID string, asOf time.Time) (map[string]struct{}, error) {
+	tx := db.WithContext(ctx).Model(&Document{}).
+		Joins("JOIN files ON files.id = documents.file_id AND files.dataset = documents.dataset").
+		Where("documents.dataset = ?", datasetID)
+	if asOf.IsZero() {
+		tx = tx.Where("files.superseded_at IS NOT NULL")
+	} else {
+		tx = tx.Where("files.superseded_at <= ? OR files.ingested_at > ?", asOf, asOf)
+	}
+
+	var ids []string
+	if err := tx.Pluck("documents.id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to get documents of other file versions: %w", err)
+	}
+
+	hidden := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		hidden[id] = struct{}{}
+	}
+	return hidden, nil
+}
+
+// LatestFileVersion returns the highest version of the file at the given path that is still kept in the dataset,
+// including superseded versions - 0 means there is none.
+func (db *DB) LatestFileVersion(ctx context.Context, datasetID, absolutePath string) (int, error) {
+	var version *int
+	err := db.WithContext(ctx).Model(&File{}).
+		Where("dataset = ? AND absolute_path = ?", datasetID, absolutePath).
+		Select("MAX(version)").
+		Scan(&version).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest version of file %q: %w", absolutePath, err)
+	}
+	if version == nil {
+		return 0, nil
+	}
+	return *version, nil
+}
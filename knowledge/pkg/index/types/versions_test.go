@@ -0,0 +1,107 @@
+package types
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileValidAt(t *testing.T) {
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+
+	v1 := File{Version: 1, IngestedAt: t1, SupersededAt: &t2}
+	v2 := File{Version: 2, IngestedAt: t2}
+
+	require.False(t, v1.ValidAt(time.Time{}))
+	require.True(t, v2.ValidAt(time.Time{}))
+
+	require.False(t, v1.ValidAt(t1.Add(-time.Hour)))
+	require.True(t, v1.ValidAt(t1.Add(time.Hour)))
+	require.False(t, v2.ValidAt(t1.Add(time.Hour)))
+
+	require.False(t, v1.ValidAt(t2))
+	require.True(t, v2.ValidAt(t2))
+
+	// legacy files without ingestion timestamp are valid until superseded
+	require.True(t, (&File{}).ValidAt(t1))
+}
+
+func TestExpiredVersions(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	superseded := func(daysAgo int) *time.Time {
+		ts := now.AddDate(0, 0, -daysAgo)
+		return &ts
+	}
+
+	files := []File{
+		{ID: "a1", Version: 1, FileMetadata: FileMetadata{AbsolutePath: "/a"}, SupersededAt: superseded(30)},
+		{ID: "a2", Version: 2, FileMetadata: FileMetadata{AbsolutePath: "/a"}, SupersededAt: superseded(10)},
+		{ID: "a3", Version: 3, FileMetadata: FileMetadata{AbsolutePath: "/a"}, SupersededAt: superseded(1)},
+		{ID: "a4", Version: 4, FileMetadata: FileMetadata{AbsolutePath: "/a"}},
+		{ID: "b1", Version: 1, FileMetadata: FileMetadata{AbsolutePath: "/b"}},
+	}
+
+	ids := func(files []File) []string {
+		var res []string
+		for _, f := range files {
+			res = append(res, f.ID)
+		}
+		return res
+	}
+
+	var noRetention *VersionRetention
+	require.Equal(t, []string{"a1", "a2", "a3"}, ids(noRetention.ExpiredVersions(files, now)))
+	require.Empty(t, (&VersionRetention{}).ExpiredVersions(files, now))
+	require.Equal(t, []string{"a1", "a2"}, ids((&VersionRetention{KeepLast: 2}).ExpiredVersions(files, now)))
+	require.Equal(t, []string{"a1"}, ids((&VersionRetention{KeepDays: 14}).ExpiredVersions(files, now)))
+	require.Equal(t, []string{"a1", "a2"}, ids((&VersionRetention{KeepLast: 3, KeepDays: 7}).ExpiredVersions(files, now)))
+}
+
+func TestFileVersionQueries(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(t.TempDir(), "index.db"))
+	require.NoError(t, db.DoAutoMigrate())
+	require.NoError(t, db.CreateDataset(ctx, Dataset{ID: "ds"}, nil))
+
+	t1 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	file := func(id string, version int, ingestedAt time.Time, supersededAt *time.Time) File {
+		return File{
+			ID:           id,
+			Dataset:      "ds",
+			Documents:    []Document{{ID: id + "-doc", FileID: id, Dataset: "ds"}},
+			FileMetadata: FileMetadata{AbsolutePath: "/a"},
+			Version:      version,
+			IngestedAt:   ingestedAt,
+			SupersededAt: supersededAt,
+		}
+	}
+	require.NoError(t, db.CreateFile(ctx, file("a1", 1, t1, &t2)))
+	require.NoError(t, db.CreateFile(ctx, file("a2", 2, t2, nil)))
+
+	hidden, err := db.HiddenDocumentIDs(ctx, "ds", time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"a1-doc": {}}, hidden)
+
+	hidden, err = db.HiddenDocumentIDs(ctx, "ds", t1.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"a2-doc": {}}, hidden)
+
+	hidden, err = db.HiddenDocumentIDs(ctx, "ds", t2)
+	require.NoError(t, err)
+	require.Equal(t, map[string]struct{}{"a1-doc": {}}, hidden)
+
+	// the numbering continues after the kept versions, even if the current version was deleted
+	require.NoError(t, db.DeleteFile(ctx, "ds", "a2"))
+	version, err := db.LatestFileVersion(ctx, "ds", "/a")
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+
+	version, err = db.LatestFileVersion(ctx, "ds", "/b")
+	require.NoError(t, err)
+	require.Equal(t, 0, version)
+}
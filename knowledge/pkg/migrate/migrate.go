@@ -0,0 +1,129 @@
+// Package migrate provides versioned schema migrations for the databases used by knowledge (index and vector store).
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrSchemaTooNew is returned if a database was migrated by a newer version of knowledge, which this version can't work with.
+var ErrSchemaTooNew = errors.New("database schema is newer than supported by this version of knowledge - please upgrade knowledge")
+
+// Migration is a versioned schema change. Versions start at 1 and increase by one.
+type Migration struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+}
+
+// AppliedMigration is a migration recorded in a database's migration table.
+type AppliedMigration struct {
+	Migration `json:",inline"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// Status describes the migration state of a database.
+type Status struct {
+	Component string             `json:"component"`
+	Current   int                `json:"current"`
+	Latest    int                `json:"latest"`
+	Applied   []AppliedMigration `json:"applied"`
+	Pending   []Migration        `json:"pending"`
+}
+
+// Migrator applies and reverts the migrations of one database.
+type Migrator interface {
+	// Component names the migrated database, e.g. "index" or "pgvector"
+	Component() string
+	Status(ctx context.Context) (*Status, error)
+	// Up applies all migrations up to and including the target version - target <= 0 means the latest version
+	Up(ctx context.Context, target int) error
+	// Down reverts all migrations after the target version - target 0 reverts everything
+	Down(ctx context.Context, target int) error
+	Close() error
+}
+
+// Step is a migration with its implementation for a database handle of type T (e.g. a transaction).
+type Step[T any] struct {
+	Migration
+	Up   func(ctx context.Context, tx T) error
+	Down func(ctx context.Context, tx T) error
+}
+
+// Latest returns the latest version of the steps.
+func Latest[T any](steps []Step[T]) int {
+	if len(steps) == 0 {
+		return 0
+	}
+	return steps[len(steps)-1].Version
+}
+
+// Validate makes sure that the steps are numbered consecutively, starting at 1.
+func Validate[T any](steps []Step[T]) error {
+	for i, s := range steps {
+		if s.Version != i+1 {
+			return fmt.Errorf("migration %d (%s) is out of order, expected version %d", s.Version, s.Description, i+1)
+		}
+		if s.Up == nil || s.Down == nil {
+			return fmt.Errorf("migration %d (%s) is missing its up or down implementation", s.Version, s.Description)
+		}
+	}
+	return nil
+}
+
+// CheckVersion returns ErrSchemaTooNew if the current version of the database is unknown to this version of knowledge.
+func CheckVersion(component string, current, latest int) error {
+	if current > latest {
+		return fmt.Errorf("%s schema version %d > %d: %w", component, current, latest, ErrSchemaTooNew)
+	}
+	return nil
+}
+
+// PlanUp returns the steps to apply to get from the current to the target version (<= 0 means latest).
+func PlanUp[T any](steps []Step[T], current, target int) ([]Step[T], error) {
+	latest := Latest(steps)
+	if target <= 0 {
+		target = latest
+	}
+	if target > latest {
+		return nil, fmt.Errorf("unknown target version %d, latest is %d", target, latest)
+	}
+	if target < current {
+		return nil, fmt.Errorf("target version %d is lower than the current version %d - migrate down instead", target, current)
+	}
+	return steps[current:target], nil
+}
+
+// PlanDown returns the steps to revert (in order) to get from the current to the target version.
+func PlanDown[T any](steps []Step[T], current, target int) ([]Step[T], error) {
+	if target < 0 {
+		return nil, fmt.Errorf("invalid target version %d", target)
+	}
+	if target > current {
+		return nil, fmt.Errorf("target version %d is higher than the current version %d - migrate up instead", target, current)
+	}
+	var plan []Step[T]
+	for i := current - 1; i >= target; i-- {
+		plan = append(plan, steps[i])
+	}
+	return plan, nil
+}
+
+// NewStatus builds the status from the applied migrations (ordered by version).
+func NewStatus[T any](component string, steps []Step[T], applied []AppliedMigration) *Status {
+	status := &Status{
+		Component: component,
+		Latest:    Latest(steps),
+		Applied:   applied,
+	}
+	if len(applied) > 0 {
+		status.Current = applied[len(applied)-1].Version
+	}
+	for _, s := range steps {
+		if s.Version > status.Current {
+			status.Pending = append(status.Pending, s.Migration)
+		}
+	}
+	return status
+}
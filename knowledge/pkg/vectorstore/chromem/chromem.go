@@ -7,6 +7,7 @@ import (
 	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -64,6 +65,10 @@ func New(dsn string, embeddingFunc chromem.EmbeddingFunc) (*ChromemStore, error)
 }
 
 func (s *ChromemStore) CreateCollection(_ context.Context, name string, opts *dbtypes.DatasetCreateOpts) error {
+	if opts != nil && opts.Quantization.Quantized() {
+		return fmt.Errorf("chromem does not support quantization")
+	}
+
 	_, err := s.db.CreateCollection(name, nil, s.embeddingFunc)
 	if err != nil {
 		return err
@@ -174,7 +179,15 @@ func (s *ChromemStore) SimilaritySearch(ctx context.Context, query string, numDo
 
 	slog.Debug("filtering documents", "where", where, "whereDocument", whereDocument)
 
-	qr, err := col.Query(ctx, query, numDocuments, where, whereDocument)
+	// chromem-go can only filter by metadata equality, so to apply an access filter we have to rank all
+	// documents and drop the ones the caller may not read afterwards (it's an exhaustive search anyway).
+	principals, filterAccess := vs.AccessFilterFromCtx(ctx)
+	nResults := numDocuments
+	if filterAccess {
+		nResults = col.Count()
+	}
+
+	qr, err := col.Query(ctx, query, nResults, where, whereDocument)
 	if err != nil {
 		return nil, err
 	}
@@ -186,9 +199,16 @@ func (s *ChromemStore) SimilaritySearch(ctx context.Context, query string, numDo
 	var sDocs []vs.Document
 
 	for _, qrd := range qr {
+		if len(sDocs) >= numDocuments {
+			break
+		}
+		metadata := convertStringMapToAnyMap(qrd.Metadata)
+		if filterAccess && !vs.DocumentAllowed(metadata, principals) {
+			continue
+		}
 		sDocs = append(sDocs, vs.Document{
 			ID:              qrd.ID,
-			Metadata:        convertStringMapToAnyMap(qrd.Metadata),
+			Metadata:        metadata,
 			SimilarityScore: qrd.Similarity,
 			Content:         qrd.Content,
 		})
@@ -244,14 +264,112 @@ func (s *ChromemStore) GetDocuments(ctx context.Context, collection string, wher
 		return nil, err
 	}
 
+	principals, filterAccess := vs.AccessFilterFromCtx(ctx)
+
 	var docs []vs.Document
 	for _, doc := range cdocs {
+		metadata := convertStringMapToAnyMap(doc.Metadata)
+		if filterAccess && !vs.DocumentAllowed(metadata, principals) {
+			continue
+		}
 		docs = append(docs, vs.Document{
 			ID:       doc.ID,
-			Metadata: convertStringMapToAnyMap(doc.Metadata),
+			Metadata: metadata,
 			Content:  doc.Content,
 		})
 	}
 
 	return docs, nil
 }
+
+// GetEmbeddings returns the embeddings of the given documents by their ID.
+func (s *ChromemStore) GetEmbeddings(ctx context.Context, collection string, ids []string) (map[string][]float32, error) {
+	col := s.db.GetCollection(collection, s.embeddingFunc)
+	if col == nil {
+		return nil, fmt.Errorf("%w: %q", errors.ErrCollectionNotFound, collection)
+	}
+
+	embeddings := make(map[string][]float32, len(ids))
+	for _, id := range ids {
+		doc, err := col.GetByID(ctx, id)
+		if err != nil {
+			continue // not found
+		}
+		embeddings[id] = slices.Clone(doc.Embedding)
+	}
+	return embeddings, nil
+}
+
+// CopyDocuments copies the given (or all) documents with their embeddings into the target collection, keeping their IDs.
+func (s *ChromemStore) CopyDocuments(ctx context.Context, source, target string, ids []string) (map[string]string, error) {
+	src := s.db.GetCollection(source, s.embeddingFunc)
+	if src == nil {
+		return nil, fmt.Errorf("%w: %q", errors.ErrCollectionNotFound, source)
+	}
+	dst := s.db.GetCollection(target, s.embeddingFunc)
+	if dst == nil {
+		return nil, fmt.Errorf("%w: %q", errors.ErrCollectionNotFound, target)
+	}
+
+	cdocs, err := src.GetDocuments(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected map[string]bool
+	if len(ids) > 0 {
+		selected = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			selected[id] = true
+		}
+	}
+
+	copied := make(map[string]string, len(cdocs))
+	docs := make([]chromem.Document, 0, len(cdocs))
+	for _, doc := range cdocs {
+		if selected != nil && !selected[doc.ID] {
+			continue
+		}
+		// The embedding is set, so chromem-go doesn't compute it again
+		docs = append(docs, chromem.Document{
+			ID:        doc.ID,
+			Metadata:  maps.Clone(doc.Metadata),
+			Embedding: slices.Clone(doc.Embedding),
+			Content:   doc.Content,
+		})
+		copied[doc.ID] = doc.ID
+	}
+	if len(docs) == 0 {
+		return copied, nil
+	}
+
+	if err := dst.AddDocuments(ctx, docs, env.GetIntFromEnvOrDefault(VsChromemEmbeddingParallelThread, 100)); err != nil {
+		return nil, fmt.Errorf("failed to copy documents into collection %q: %w", target, err)
+	}
+	return copied, nil
+}
+
+func (s *ChromemStore) CollectionStats(ctx context.Context, collection string) (*vs.CollectionStats, error) {
+	col := s.db.GetCollection(collection, s.embeddingFunc)
+	if col == nil {
+		return nil, fmt.Errorf("%w: %q", errors.ErrCollectionNotFound, collection)
+	}
+
+	cdocs, err := col.GetDocuments(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &vs.CollectionStats{Documents: len(cdocs)}
+	for _, doc := range cdocs {
+		if stats.Dimensions == 0 {
+			stats.Dimensions = len(doc.Embedding)
+		}
+		stats.SizeBytes += int64(len(doc.ID) + len(doc.Content) + 4*len(doc.Embedding)) // float32 embeddings
+		for k, v := range doc.Metadata {
+			stats.SizeBytes += int64(len(k) + len(v))
+		}
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,694 @@
+package hnsw
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+const (
+	configFileName   = "config.json"
+	vectorFileName   = "vectors.f32"
+	logFileName      = "docs.log"
+	snapshotFileName = "graph.gob"
+
+	// snapshotInterval is the number of log operations after which the graph is snapshotted, so that it doesn't
+	// have to be rebuilt from the log on the next start
+	snapshotInterval = 50_000
+	// compactionMinDeleted is the minimum number of deleted documents before a collection is compacted on close
+	compactionMinDeleted = 1_000
+
+	// compactDirSuffix and oldDirSuffix are appended to the directory of a collection that is being compacted.
+	// Escaped collection names never contain a % that isn't followed by two hex digits, so they can't collide.
+	compactDirSuffix = "%compact"
+	oldDirSuffix     = "%old"
+)
+
+// collectionConfig is stored with the collection.
+type collectionConfig struct {
+	// Dimensions of the embeddings - 0 until the first document is added
+	Dimensions     int `json:"dimensions"`
+	M              int `json:"m"`
+	EfConstruction int `json:"efConstruction"`
+	EfSearch       int `json:"efSearch"`
+}
+
+// logEntry is a record in the append-only document log, which is the source of truth for a collection:
+// the vector file and the graph can be restored from it (apart from the vectors themselves).
+type logEntry struct {
+	Op       string         `json:"op"`
+	ID       string         `json:"id"`
+	Slot     uint32         `json:"slot"`
+	Content  string         `json:"content,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+const (
+	opAdd    = "add"
+	opDelete = "del"
+)
+
+// docRecord locates a document in the log. Metadata is kept in memory for filtering, content is read from the log when needed.
+type docRecord struct {
+	slot     uint32
+	offset   int64
+	length   uint32
+	metadata map[string]any
+}
+
+type graphSnapshot struct {
+	// LogOffset is the size of the log when the snapshot was taken - later operations are replayed on load
+	LogOffset int64
+	Graph     *graph
+}
+
+type collection struct {
+	mu sync.RWMutex
+
+	dir     string
+	config  collectionConfig
+	vectors *vectorFile
+	log     *os.File
+	logSize int64
+	graph   *graph
+
+	docs map[string]*docRecord
+	// slotIDs maps slots to document IDs - deleted slots map to ""
+	slotIDs          []string
+	deleted          int
+	opsSinceSnapshot int
+}
+
+func createCollection(dir string, config collectionConfig) (*collection, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create collection directory: %w", err)
+	}
+	if err := writeJSONFile(filepath.Join(dir, configFileName), config); err != nil {
+		return nil, err
+	}
+	return openCollection(dir)
+}
+
+func openCollection(dir string) (*collection, error) {
+	c := &collection{
+		dir:  dir,
+		docs: map[string]*docRecord{},
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, configFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection config: %w", err)
+	}
+	if err := json.Unmarshal(raw, &c.config); err != nil {
+		return nil, fmt.Errorf("failed to parse collection config: %w", err)
+	}
+
+	if c.config.Dimensions > 0 {
+		if c.vectors, err = openVectorFile(filepath.Join(dir, vectorFileName), c.config.Dimensions); err != nil {
+			return nil, err
+		}
+	}
+
+	c.log, err = os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		_ = c.closeFiles()
+		return nil, fmt.Errorf("failed to open document log: %w", err)
+	}
+
+	if err := c.load(); err != nil {
+		_ = c.closeFiles()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// replayedOp is an operation read from the log, to be applied to the graph.
+type replayedOp struct {
+	offset int64
+	op     string
+	slot   uint32
+}
+
+// load restores the documents from the log and the graph from the latest snapshot plus the operations logged after it.
+func (c *collection) load() error {
+	var ops []replayedOp
+
+	r := bufio.NewReader(c.log)
+	if _, err := c.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var offset int64
+	for {
+		entry, length, err := readLogEntry(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				// Incomplete last entry, e.g. after a crash - drop it
+				slog.Warn("Dropping incomplete entry at the end of the document log", "dir", c.dir, "offset", offset)
+				if err := c.log.Truncate(offset); err != nil {
+					return fmt.Errorf("failed to truncate document log: %w", err)
+				}
+				break
+			}
+			return fmt.Errorf("failed to read document log at offset %d: %w", offset, err)
+		}
+
+		switch entry.Op {
+		case opAdd:
+			c.applyAdd(entry, offset, length)
+			ops = append(ops, replayedOp{offset, opAdd, entry.Slot})
+		case opDelete:
+			if rec, ok := c.docs[entry.ID]; ok {
+				c.applyDelete(entry.ID, rec)
+				ops = append(ops, replayedOp{offset, opDelete, rec.slot})
+			}
+		}
+		offset += length
+	}
+	c.logSize = offset
+
+	c.graph = newGraph(c.config.M, c.config.EfConstruction, c.vector)
+
+	var snapshotOffset int64
+	snap, err := c.readSnapshot()
+	if err != nil {
+		slog.Warn("Failed to read graph snapshot - rebuilding the graph from the document log", "dir", c.dir, "error", err)
+	} else if snap != nil && snap.LogOffset <= c.logSize {
+		c.graph = snap.Graph
+		c.graph.init(c.vector)
+		snapshotOffset = snap.LogOffset
+	}
+
+	for _, op := range ops {
+		if op.offset < snapshotOffset {
+			continue
+		}
+		c.opsSinceSnapshot++
+		switch op.op {
+		case opAdd:
+			c.graph.insert(op.slot)
+		case opDelete:
+			c.graph.Nodes[op.slot].Deleted = true
+		}
+	}
+
+	// Slots can be reused after a crash in between writing the vector and logging the document - make sure they're known
+	for int(c.nextSlot()) > len(c.graph.Nodes) {
+		c.graph.Nodes = append(c.graph.Nodes, node{})
+	}
+
+	return nil
+}
+
+func (c *collection) applyAdd(entry *logEntry, offset, length int64) {
+	if old, ok := c.docs[entry.ID]; ok {
+		c.applyDelete(entry.ID, old)
+	}
+	for int(entry.Slot) >= len(c.slotIDs) {
+		c.slotIDs = append(c.slotIDs, "")
+	}
+	c.slotIDs[entry.Slot] = entry.ID
+	c.docs[entry.ID] = &docRecord{
+		slot:     entry.Slot,
+		offset:   offset,
+		length:   uint32(length),
+		metadata: entry.Metadata,
+	}
+}
+
+func (c *collection) applyDelete(id string, rec *docRecord) {
+	delete(c.docs, id)
+	c.slotIDs[rec.slot] = ""
+	c.deleted++
+}
+
+func (c *collection) nextSlot() uint32 {
+	return uint32(len(c.slotIDs))
+}
+
+func (c *collection) vector(slot uint32) []float32 {
+	return c.vectors.get(slot)
+}
+
+// readLogEntry reads a length-prefixed JSON entry and returns it together with its total size in the log.
+func readLogEntry(r io.Reader) (*logEntry, int64, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	var entry logEntry
+	if err := json.Unmarshal(buf, &entry); err != nil {
+		return nil, 0, err
+	}
+	return &entry, int64(size) + 4, nil
+}
+
+func (c *collection) appendLog(entry logEntry) (int64, int64, error) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+	buf := make([]byte, 4+len(raw))
+	binary.LittleEndian.PutUint32(buf, uint32(len(raw)))
+	copy(buf[4:], raw)
+
+	offset := c.logSize
+	if _, err := c.log.Write(buf); err != nil {
+		return 0, 0, fmt.Errorf("failed to write to document log: %w", err)
+	}
+	c.logSize += int64(len(buf))
+	c.opsSinceSnapshot++
+	return offset, int64(len(buf)), nil
+}
+
+// readEntry reads the log entry of a document (for its content).
+func (c *collection) readEntry(rec *docRecord) (*logEntry, error) {
+	buf := make([]byte, rec.length)
+	if _, err := c.log.ReadAt(buf, rec.offset); err != nil {
+		return nil, fmt.Errorf("failed to read document from log: %w", err)
+	}
+	var entry logEntry
+	if err := json.Unmarshal(buf[4:], &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse document from log: %w", err)
+	}
+	return &entry, nil
+}
+
+// normalize returns the vector scaled to unit length, so that the cosine similarity is the dot product.
+func normalize(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+	normalized := make([]float32, len(vec))
+	if norm == 0 {
+		return normalized
+	}
+	for i, v := range vec {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+// add stores the documents with their embeddings - documents with existing IDs are replaced.
+func (c *collection) add(docs []logEntry, embeddings [][]float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, doc := range docs {
+		vec := embeddings[i]
+		if c.vectors == nil {
+			c.config.Dimensions = len(vec)
+			if err := writeJSONFile(filepath.Join(c.dir, configFileName), c.config); err != nil {
+				return err
+			}
+			var err error
+			if c.vectors, err = openVectorFile(filepath.Join(c.dir, vectorFileName), c.config.Dimensions); err != nil {
+				return err
+			}
+		}
+		if len(vec) != c.config.Dimensions {
+			return fmt.Errorf("embedding of document %s has %d dimensions, but the collection has %d", doc.ID, len(vec), c.config.Dimensions)
+		}
+
+		if old, ok := c.docs[doc.ID]; ok {
+			if err := c.deleteLocked(doc.ID, old); err != nil {
+				return err
+			}
+		}
+
+		// Write the vector first: if we crash before the document is logged, the slot is just reused
+		doc.Op = opAdd
+		doc.Slot = c.nextSlot()
+		if err := c.vectors.set(doc.Slot, normalize(vec)); err != nil {
+			return fmt.Errorf("failed to store embedding of document %s: %w", doc.ID, err)
+		}
+		offset, length, err := c.appendLog(doc)
+		if err != nil {
+			return err
+		}
+		c.applyAdd(&doc, offset, length)
+		c.graph.insert(doc.Slot)
+	}
+
+	if err := c.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync document log: %w", err)
+	}
+
+	if c.opsSinceSnapshot >= snapshotInterval {
+		return c.writeSnapshot()
+	}
+	return nil
+}
+
+func (c *collection) deleteLocked(id string, rec *docRecord) error {
+	if _, _, err := c.appendLog(logEntry{Op: opDelete, ID: id}); err != nil {
+		return err
+	}
+	c.applyDelete(id, rec)
+	c.graph.Nodes[rec.slot].Deleted = true
+	return nil
+}
+
+// remove deletes the documents with the given IDs and returns the number of deleted documents.
+func (c *collection) remove(ids ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, id := range ids {
+		rec, ok := c.docs[id]
+		if !ok {
+			continue
+		}
+		if err := c.deleteLocked(id, rec); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	if removed > 0 {
+		if err := c.log.Sync(); err != nil {
+			return removed, fmt.Errorf("failed to sync document log: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// result is a document found by a search.
+type result struct {
+	entry      *logEntry
+	similarity float32
+}
+
+// search returns up to k documents closest to the (not normalized) query vector that match the filter.
+func (c *collection) search(query []float32, k int, filter *docFilter) ([]result, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.docs) == 0 {
+		return nil, nil
+	}
+	if len(query) != c.config.Dimensions {
+		return nil, fmt.Errorf("query embedding has %d dimensions, but the collection has %d", len(query), c.config.Dimensions)
+	}
+	query = normalize(query)
+
+	var (
+		accept   func(slot uint32) bool
+		entries  = map[uint32]*logEntry{}
+		matchErr error
+	)
+	if !filter.empty() {
+		accept = func(slot uint32) bool {
+			rec := c.docs[c.slotIDs[slot]]
+			if rec == nil || !filter.matchesMetadata(rec.metadata) {
+				return false
+			}
+			if !filter.needsContent() {
+				return true
+			}
+			entry, err := c.readEntry(rec)
+			if err != nil {
+				matchErr = err
+				return false
+			}
+			entries[slot] = entry
+			return filter.matchesContent(entry.Content)
+		}
+	}
+
+	// Filters and deletions are applied to the candidates the graph search returns, so for filtered searches (or if
+	// there are deleted documents, e.g. the previous chunks of a re-ingested file, which are the nearest neighbors) we
+	// keep increasing the number of candidates until we found k matches or have seen all documents.
+	ef := max(c.config.EfSearch, k)
+	if accept != nil {
+		ef = max(ef, k*4)
+	}
+	var found []candidate
+	for {
+		found = c.graph.search(query, k, ef, accept)
+		if matchErr != nil {
+			return nil, matchErr
+		}
+		if len(found) >= k || (accept == nil && c.deleted == 0) || ef >= len(c.graph.Nodes) {
+			break
+		}
+		ef = min(ef*4, len(c.graph.Nodes))
+	}
+
+	results := make([]result, 0, len(found))
+	for _, f := range found {
+		entry, ok := entries[f.slot]
+		if !ok {
+			var err error
+			if entry, err = c.readEntry(c.docs[c.slotIDs[f.slot]]); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, result{entry: entry, similarity: 1 - f.dist})
+	}
+	return results, nil
+}
+
+// list returns all documents that match the filter, in the order they were added.
+func (c *collection) list(filter *docFilter) ([]*logEntry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	recs := make([]*docRecord, 0, len(c.docs))
+	for _, rec := range c.docs {
+		if filter.matchesMetadata(rec.metadata) {
+			recs = append(recs, rec)
+		}
+	}
+	slices.SortFunc(recs, func(a, b *docRecord) int { return int(a.slot) - int(b.slot) })
+
+	entries := make([]*logEntry, 0, len(recs))
+	for _, rec := range recs {
+		entry, err := c.readEntry(rec)
+		if err != nil {
+			return nil, err
+		}
+		if filter.matchesContent(entry.Content) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// embedding returns a copy of the (normalized) embedding of the document.
+func (c *collection) embedding(id string) []float32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	rec, ok := c.docs[id]
+	if !ok {
+		return nil
+	}
+	return slices.Clone(c.vectors.get(rec.slot))
+}
+
+func (c *collection) count() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.docs)
+}
+
+func (c *collection) readSnapshot() (*graphSnapshot, error) {
+	f, err := os.Open(filepath.Join(c.dir, snapshotFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var snap graphSnapshot
+	if err := gob.NewDecoder(bufio.NewReader(f)).Decode(&snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// writeSnapshot persists the graph, so that it doesn't have to be rebuilt on the next start.
+func (c *collection) writeSnapshot() error {
+	if c.vectors != nil {
+		if err := c.vectors.sync(); err != nil {
+			return fmt.Errorf("failed to sync vector file: %w", err)
+		}
+	}
+
+	path := filepath.Join(c.dir, snapshotFileName)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create graph snapshot: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	if err := gob.NewEncoder(w).Encode(graphSnapshot{LogOffset: c.logSize, Graph: c.graph}); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write graph snapshot: %w", err)
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write graph snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write graph snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace graph snapshot: %w", err)
+	}
+	c.opsSinceSnapshot = 0
+	return nil
+}
+
+// close snapshots the graph if needed and closes all files. If a large share of the documents was deleted,
+// the collection is compacted first, which rebuilds it from the remaining documents.
+func (c *collection) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.deleted >= compactionMinDeleted && c.deleted > len(c.docs) {
+		if err := c.compact(); err != nil {
+			slog.Error("Failed to compact collection", "dir", c.dir, "error", err)
+		} else {
+			return nil // compact closes the files
+		}
+	}
+
+	if c.opsSinceSnapshot > 0 {
+		if err := c.writeSnapshot(); err != nil {
+			_ = c.closeFiles()
+			return err
+		}
+	}
+	return c.closeFiles()
+}
+
+func (c *collection) closeFiles() error {
+	var errs []error
+	if c.vectors != nil {
+		errs = append(errs, c.vectors.close())
+		c.vectors = nil
+	}
+	if c.log != nil {
+		errs = append(errs, c.log.Close())
+		c.log = nil
+	}
+	return errors.Join(errs...)
+}
+
+// compact rewrites the collection without the deleted documents and closes it.
+func (c *collection) compact() error {
+	slog.Info("Compacting collection", "dir", c.dir, "documents", len(c.docs), "deleted", c.deleted)
+
+	tmpDir := c.dir + compactDirSuffix
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return err
+	}
+	compacted, err := createCollection(tmpDir, c.config)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range c.slotIDs {
+		if id == "" {
+			continue
+		}
+		rec := c.docs[id]
+		entry, err := c.readEntry(rec)
+		if err != nil {
+			_ = compacted.closeFiles()
+			return err
+		}
+		if err := compacted.add([]logEntry{*entry}, [][]float32{c.vectors.get(rec.slot)}); err != nil {
+			_ = compacted.closeFiles()
+			return err
+		}
+	}
+	if err := compacted.writeSnapshot(); err != nil {
+		_ = compacted.closeFiles()
+		return err
+	}
+	if err := compacted.closeFiles(); err != nil {
+		return err
+	}
+	if err := c.closeFiles(); err != nil {
+		return err
+	}
+
+	// If the process dies between the renames, recoverCompaction restores the old directory on the next open
+	oldDir := c.dir + oldDirSuffix
+	if err := os.Rename(c.dir, oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, c.dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(oldDir)
+}
+
+// recoverCompaction cleans up after a compaction of the collection in dir that was interrupted: if the collection's
+// directory was already moved away, it's restored (the compaction is retried on the next close), and leftover
+// directories of the compaction are removed.
+func recoverCompaction(dir string) error {
+	oldDir, tmpDir := dir+oldDirSuffix, dir+compactDirSuffix
+	if _, err := os.Stat(filepath.Join(dir, configFileName)); os.IsNotExist(err) {
+		if _, err := os.Stat(filepath.Join(oldDir, configFileName)); err == nil {
+			slog.Warn("Restoring collection after interrupted compaction", "dir", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+			if err := os.Rename(oldDir, dir); err != nil {
+				return fmt.Errorf("failed to restore collection after interrupted compaction: %w", err)
+			}
+		}
+	}
+	return errors.Join(os.RemoveAll(oldDir), os.RemoveAll(tmpDir))
+}
+
+// drop closes the files of a collection that is removed. Concurrent searches that still hold it wait for the lock
+// and find it empty afterwards.
+func (c *collection) drop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.docs = map[string]*docRecord{}
+	c.slotIDs = nil
+	return c.closeFiles()
+}
+
+func writeJSONFile(path string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,79 @@
+package hnsw
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/philippgille/chromem-go"
+)
+
+// docFilter combines the metadata, content and access filters of a request.
+// Metadata values are compared as strings, like chromem-go does.
+type docFilter struct {
+	where         map[string]string
+	whereDocument []chromem.WhereDocument
+	principals    []string
+	filterAccess  bool
+}
+
+func newDocFilter(ctx context.Context, where map[string]string, whereDocument []chromem.WhereDocument) (*docFilter, error) {
+	for _, wd := range whereDocument {
+		if err := wd.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid where document filter: %w", err)
+		}
+	}
+	f := &docFilter{where: where, whereDocument: whereDocument}
+	f.principals, f.filterAccess = vs.AccessFilterFromCtx(ctx)
+	return f, nil
+}
+
+func (f *docFilter) empty() bool {
+	return f == nil || (len(f.where) == 0 && len(f.whereDocument) == 0 && !f.filterAccess)
+}
+
+func (f *docFilter) needsContent() bool {
+	return f != nil && len(f.whereDocument) > 0
+}
+
+func (f *docFilter) matchesMetadata(metadata map[string]any) bool {
+	if f == nil {
+		return true
+	}
+	for k, v := range f.where {
+		if metadataString(metadata[k]) != v {
+			return false
+		}
+	}
+	return !f.filterAccess || vs.DocumentAllowed(metadata, f.principals)
+}
+
+func (f *docFilter) matchesContent(content string) bool {
+	if f == nil {
+		return true
+	}
+	doc := &chromem.Document{Content: content}
+	for _, wd := range f.whereDocument {
+		if !wd.Matches(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataString converts a metadata value to the string that's compared to the where filter.
+func metadataString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,259 @@
+package hnsw
+
+import (
+	"cmp"
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// graph is a Hierarchical Navigable Small World graph (https://arxiv.org/abs/1603.09320) over the vectors of a collection.
+// Nodes are identified by the slot of their vector in the vector file. Deleted nodes are kept for navigation
+// (tombstones) but never returned as results, until the collection is compacted.
+type graph struct {
+	M              int
+	EfConstruction int
+	// Nodes are indexed by slot
+	Nodes      []node
+	EntryPoint uint32
+	MaxLevel   int
+	// Empty is true as long as no node was inserted (the entry point is invalid)
+	Empty bool
+
+	levelMult float64
+	rng       *rand.Rand
+	vector    func(slot uint32) []float32
+}
+
+type node struct {
+	// Friends holds the neighbors of the node per level (0 to the node's level)
+	Friends [][]uint32
+	Deleted bool
+	// Inserted is false for slots that were allocated but never inserted (e.g. after a crash)
+	Inserted bool
+}
+
+func newGraph(m, efConstruction int, vector func(slot uint32) []float32) *graph {
+	g := &graph{
+		M:              m,
+		EfConstruction: efConstruction,
+		Empty:          true,
+	}
+	g.init(vector)
+	return g
+}
+
+// init sets the fields that aren't persisted.
+func (g *graph) init(vector func(slot uint32) []float32) {
+	g.levelMult = 1 / math.Log(float64(max(g.M, 2)))
+	g.rng = rand.New(rand.NewPCG(uint64(len(g.Nodes)), 0x9e3779b97f4a7c15))
+	g.vector = vector
+}
+
+// distance is the cosine distance of two normalized vectors.
+func distance(a, b []float32) float32 {
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return 1 - dot
+}
+
+func (g *graph) maxFriends(level int) int {
+	if level == 0 {
+		return 2 * g.M
+	}
+	return g.M
+}
+
+func (g *graph) randomLevel() int {
+	return int(math.Floor(-math.Log(1-g.rng.Float64()) * g.levelMult))
+}
+
+// candidate is a node with its distance to the query.
+type candidate struct {
+	slot uint32
+	dist float32
+}
+
+// minHeap pops the closest candidate first.
+type minHeap []candidate
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return h[i].dist < h[j].dist }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+func sortCandidates(c []candidate) {
+	slices.SortFunc(c, func(a, b candidate) int { return cmp.Compare(a.dist, b.dist) })
+}
+
+// maxHeap pops the farthest candidate first.
+type maxHeap struct{ minHeap }
+
+func (h maxHeap) Less(i, j int) bool { return h.minHeap[i].dist > h.minHeap[j].dist }
+
+// searchLayer returns (up to) the ef closest nodes to the query on the given level, starting from the entry points.
+func (g *graph) searchLayer(query []float32, entryPoints []candidate, ef, level int) []candidate {
+	visited := make(map[uint32]struct{}, ef*4)
+	candidates := &minHeap{}
+	results := &maxHeap{}
+	for _, ep := range entryPoints {
+		visited[ep.slot] = struct{}{}
+		heap.Push(candidates, ep)
+		heap.Push(results, ep)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(candidate)
+		if results.Len() >= ef && c.dist > results.minHeap[0].dist {
+			break // all remaining candidates are farther away than the worst result
+		}
+
+		friends := g.Nodes[c.slot].Friends
+		if level >= len(friends) {
+			continue
+		}
+		for _, f := range friends[level] {
+			if _, ok := visited[f]; ok {
+				continue
+			}
+			visited[f] = struct{}{}
+
+			d := distance(query, g.vector(f))
+			if results.Len() < ef || d < results.minHeap[0].dist {
+				heap.Push(candidates, candidate{f, d})
+				heap.Push(results, candidate{f, d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	res := []candidate(results.minHeap)
+	sortCandidates(res)
+	return res
+}
+
+// selectNeighbors picks up to m neighbors from the candidates (sorted by distance) using the heuristic from the paper:
+// a candidate is only selected if it's closer to the base node than to any of the already selected neighbors,
+// which keeps the graph connected across clusters. Remaining slots are filled with the closest discarded candidates.
+func (g *graph) selectNeighbors(candidates []candidate, m int) []uint32 {
+	if len(candidates) <= m {
+		selected := make([]uint32, len(candidates))
+		for i, c := range candidates {
+			selected[i] = c.slot
+		}
+		return selected
+	}
+
+	selected := make([]uint32, 0, m)
+	var discarded []uint32
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		good := true
+		cv := g.vector(c.slot)
+		for _, s := range selected {
+			if distance(cv, g.vector(s)) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, c.slot)
+		} else {
+			discarded = append(discarded, c.slot)
+		}
+	}
+	for _, d := range discarded {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, d)
+	}
+	return selected
+}
+
+// insert adds the node for the vector at slot to the graph.
+func (g *graph) insert(slot uint32) {
+	for int(slot) >= len(g.Nodes) {
+		g.Nodes = append(g.Nodes, node{})
+	}
+
+	level := g.randomLevel()
+	g.Nodes[slot] = node{Friends: make([][]uint32, level+1), Inserted: true}
+
+	if g.Empty {
+		g.EntryPoint, g.MaxLevel, g.Empty = slot, level, false
+		return
+	}
+
+	query := g.vector(slot)
+	ep := []candidate{{g.EntryPoint, distance(query, g.vector(g.EntryPoint))}}
+
+	// Greedy search down to the node's level
+	for l := g.MaxLevel; l > level; l-- {
+		ep = g.searchLayer(query, ep, 1, l)[:1]
+	}
+
+	for l := min(level, g.MaxLevel); l >= 0; l-- {
+		candidates := g.searchLayer(query, ep, g.EfConstruction, l)
+		neighbors := g.selectNeighbors(candidates, g.M)
+		g.Nodes[slot].Friends[l] = neighbors
+
+		// Add backlinks and shrink the neighbors' friend lists if they got too long
+		for _, n := range neighbors {
+			friends := append(g.Nodes[n].Friends[l], slot)
+			if maxFriends := g.maxFriends(l); len(friends) > maxFriends {
+				nv := g.vector(n)
+				fc := make([]candidate, len(friends))
+				for i, f := range friends {
+					fc[i] = candidate{f, distance(nv, g.vector(f))}
+				}
+				sortCandidates(fc)
+				friends = g.selectNeighbors(fc, maxFriends)
+			}
+			g.Nodes[n].Friends[l] = friends
+		}
+		ep = candidates
+	}
+
+	if level > g.MaxLevel {
+		g.EntryPoint, g.MaxLevel = slot, level
+	}
+}
+
+// search returns up to k of the closest nodes to the query that are not deleted and accepted by the filter (nil accepts all).
+// ef is the size of the dynamic candidate list - the larger, the more accurate (and slower) the search.
+func (g *graph) search(query []float32, k, ef int, accept func(slot uint32) bool) []candidate {
+	if g.Empty {
+		return nil
+	}
+
+	ep := []candidate{{g.EntryPoint, distance(query, g.vector(g.EntryPoint))}}
+	for l := g.MaxLevel; l > 0; l-- {
+		ep = g.searchLayer(query, ep, 1, l)[:1]
+	}
+
+	var results []candidate
+	for _, c := range g.searchLayer(query, ep, max(ef, k), 0) {
+		if len(results) >= k {
+			break
+		}
+		if g.Nodes[c.slot].Deleted || (accept != nil && !accept(c.slot)) {
+			continue
+		}
+		results = append(results, c)
+	}
+	return results
+}
@@ -0,0 +1,666 @@
+package hnsw
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/knowledge/pkg/env"
+	dbtypes "github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/log"
+	vserr "github.com/gptscript-ai/knowledge/pkg/vectorstore/errors"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/philippgille/chromem-go"
+	"golang.org/x/sync/errgroup"
+)
+
+// VsHNSWEmbeddingConcurrency can be set as an environment variable to control the number of parallel API calls to create embeddings for documents. Default is 100
+const VsHNSWEmbeddingConcurrency = "VS_HNSW_EMBEDDING_CONCURRENCY"
+
+// Default HNSW parameters
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 64
+)
+
+const exportFileName = "hnsw-export.gob"
+
+// VectorStore is an embedded, persistent vector store with an HNSW index per collection.
+// Each collection lives in its own directory, holding an append-only document log (content and metadata),
+// a memory-mapped vector file and a snapshot of the HNSW graph.
+type VectorStore struct {
+	dir           string
+	defaults      collectionConfig
+	embeddingFunc chromem.EmbeddingFunc
+
+	mu          sync.Mutex
+	collections map[string]*collection
+}
+
+// New creates a new HNSW vector store from a DSN like hnsw://path/to/dir?m=16&ef_construction=200&ef_search=64.
+// The parameters are used for new collections.
+func New(_ context.Context, dsn string, embeddingFunc chromem.EmbeddingFunc) (*VectorStore, error) {
+	dsn = strings.TrimPrefix(dsn, "hnsw://")
+
+	dir, rawQuery, _ := strings.Cut(dsn, "?")
+	if dir == "" {
+		return nil, fmt.Errorf("missing directory in hnsw DSN")
+	}
+
+	defaults := collectionConfig{
+		M:              DefaultM,
+		EfConstruction: DefaultEfConstruction,
+		EfSearch:       DefaultEfSearch,
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse hnsw DSN parameters: %w", err)
+	}
+	for key, target := range map[string]*int{
+		"m":               &defaults.M,
+		"ef_construction": &defaults.EfConstruction,
+		"ef_search":       &defaults.EfSearch,
+	} {
+		if v := params.Get(key); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil || i <= 0 {
+				return nil, fmt.Errorf("invalid value for hnsw DSN parameter %q: %q", key, v)
+			}
+			*target = i
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create hnsw directory: %w", err)
+	}
+
+	return &VectorStore{
+		dir:           dir,
+		defaults:      defaults,
+		embeddingFunc: embeddingFunc,
+		collections:   map[string]*collection{},
+	}, nil
+}
+
+// collectionDir returns the directory of the collection, after recovering it from an interrupted compaction.
+// Names that would escape the store's directory are rejected.
+func (s *VectorStore) collectionDir(name string) (string, error) {
+	if name == "" || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid collection name %q", name)
+	}
+	dir := filepath.Join(s.dir, url.PathEscape(name))
+	if err := recoverCompaction(dir); err != nil {
+		return "", fmt.Errorf("failed to recover collection %q: %w", name, err)
+	}
+	return dir, nil
+}
+
+// getCollection returns the (lazily opened) collection or ErrCollectionNotFound.
+func (s *VectorStore) getCollection(name string) (*collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.collections[name]; ok {
+		return c, nil
+	}
+
+	dir, err := s.collectionDir(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, configFileName)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %q", vserr.ErrCollectionNotFound, name)
+		}
+		return nil, err
+	}
+
+	c, err := openCollection(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open collection %q: %w", name, err)
+	}
+	s.collections[name] = c
+	return c, nil
+}
+
+func (s *VectorStore) CreateCollection(_ context.Context, name string, opts *dbtypes.DatasetCreateOpts) error {
+	if opts != nil && opts.Quantization.Quantized() {
+		return fmt.Errorf("hnsw does not support quantization")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, err := s.collectionDir(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, configFileName)); err == nil {
+		return nil
+	}
+
+	c, err := createCollection(dir, s.defaults)
+	if err != nil {
+		return fmt.Errorf("failed to create collection %q: %w", name, err)
+	}
+	s.collections[name] = c
+	return nil
+}
+
+func (s *VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, collection string) ([]string, error) {
+	l := log.FromCtx(ctx).With("stage", "vectorstore").With("vectorstore", "hnsw")
+
+	col, err := s.getCollection(collection)
+	if err != nil {
+		l.With("status", "failed").With("error", err.Error()).Error("Collection not found", "collection", collection)
+		return nil, err
+	}
+
+	l.With("status", "starting").Info("Adding documents to collection (generating embeddings)")
+
+	ids := make([]string, len(docs))
+	entries := make([]logEntry, len(docs))
+	embeddings := make([][]float32, len(docs))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(env.GetIntFromEnvOrDefault(VsHNSWEmbeddingConcurrency, 100))
+	for i, doc := range docs {
+		if len(doc.Content) == 0 {
+			slog.Debug("Document has no content", "id", doc.ID, "index", i)
+			doc.Content = "<no content>"
+		}
+		ids[i] = doc.ID
+		entries[i] = logEntry{ID: doc.ID, Content: doc.Content, Metadata: maps.Clone(doc.Metadata)}
+		g.Go(func() error {
+			emb, err := s.embeddingFunc(gctx, doc.Content)
+			if err != nil {
+				return fmt.Errorf("failed to create embedding for document %s: %w", doc.ID, err)
+			}
+			embeddings[i] = emb
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		l.With("status", "failed").With("error", err.Error()).Error("Failed to add documents to collection (generate embeddings)")
+		return nil, err
+	}
+
+	if err := col.add(entries, embeddings); err != nil {
+		l.With("status", "failed").With("error", err.Error()).Error("Failed to add documents to collection")
+		return nil, err
+	}
+
+	l.With("status", "completed").Info("Added documents to collection (generated embeddings)")
+
+	return ids, nil
+}
+
+func (s *VectorStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, collection string, where map[string]string, whereDocument []chromem.WhereDocument, embeddingFunc chromem.EmbeddingFunc) ([]vs.Document, error) {
+	ef := s.embeddingFunc
+	if embeddingFunc != nil {
+		ef = embeddingFunc
+		slog.Debug("Using custom embedding function")
+	}
+
+	col, err := s.getCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if col.count() == 0 {
+		return nil, fmt.Errorf("%w: %q", vserr.ErrCollectionEmpty, collection)
+	}
+
+	filter, err := newDocFilter(ctx, where, whereDocument)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := ef(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding for query: %w", err)
+	}
+
+	results, err := col.search(q, numDocuments, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []vs.Document
+	for _, r := range results {
+		docs = append(docs, vs.Document{
+			ID:              r.entry.ID,
+			Content:         r.entry.Content,
+			Metadata:        metadataOrEmpty(r.entry.Metadata),
+			SimilarityScore: r.similarity,
+		})
+	}
+	return docs, nil
+}
+
+func metadataOrEmpty(m map[string]any) map[string]any {
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
+
+func (s *VectorStore) RemoveCollection(_ context.Context, collection string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, err := s.collectionDir(collection)
+	if err != nil {
+		return err
+	}
+	if c, ok := s.collections[collection]; ok {
+		_ = c.drop()
+		delete(s.collections, collection)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove collection %q: %w", collection, err)
+	}
+	return nil
+}
+
+func (s *VectorStore) RemoveDocument(ctx context.Context, documentID string, collection string, where map[string]string, whereDocument []chromem.WhereDocument) error {
+	col, err := s.getCollection(collection)
+	if err != nil {
+		return err
+	}
+
+	if documentID != "" {
+		_, err := col.remove(documentID)
+		return err
+	}
+
+	if len(where) == 0 && len(whereDocument) == 0 {
+		return fmt.Errorf("either documentID, where or whereDocument must be set")
+	}
+	filter, err := newDocFilter(ctx, where, whereDocument)
+	if err != nil {
+		return err
+	}
+	entries, err := col.list(filter)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	_, err = col.remove(ids...)
+	return err
+}
+
+func (s *VectorStore) GetDocuments(ctx context.Context, collection string, where map[string]string, whereDocument []chromem.WhereDocument) ([]vs.Document, error) {
+	col, err := s.getCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := newDocFilter(ctx, where, whereDocument)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := col.list(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]vs.Document, len(entries))
+	for i, e := range entries {
+		docs[i] = vs.Document{
+			ID:       e.ID,
+			Content:  e.Content,
+			Metadata: metadataOrEmpty(e.Metadata),
+		}
+	}
+	return docs, nil
+}
+
+// GetEmbeddings returns the embeddings of the given documents by their ID.
+func (s *VectorStore) GetEmbeddings(_ context.Context, collection string, ids []string) (map[string][]float32, error) {
+	col, err := s.getCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make(map[string][]float32, len(ids))
+	for _, id := range ids {
+		if e := col.embedding(id); e != nil {
+			embeddings[id] = e
+		}
+	}
+	return embeddings, nil
+}
+
+// CopyDocuments copies the given (or all) documents with their embeddings into the target collection, keeping their IDs.
+func (s *VectorStore) CopyDocuments(ctx context.Context, source, target string, ids []string) (map[string]string, error) {
+	src, err := s.getCollection(source)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := s.getCollection(target)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := src.list(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected map[string]bool
+	if len(ids) > 0 {
+		selected = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			selected[id] = true
+		}
+	}
+
+	const batchSize = 1000
+	var (
+		batch      []logEntry
+		embeddings [][]float32
+	)
+	copied := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if selected != nil && !selected[e.ID] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch = append(batch, logEntry{ID: e.ID, Content: e.Content, Metadata: e.Metadata})
+		embeddings = append(embeddings, src.embedding(e.ID))
+		copied[e.ID] = e.ID
+		if len(batch) >= batchSize {
+			if err := dst.add(batch, embeddings); err != nil {
+				return nil, fmt.Errorf("failed to copy documents into collection %q: %w", target, err)
+			}
+			batch, embeddings = batch[:0], embeddings[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := dst.add(batch, embeddings); err != nil {
+			return nil, fmt.Errorf("failed to copy documents into collection %q: %w", target, err)
+		}
+	}
+	return copied, nil
+}
+
+// RenameCollection moves the collection's directory - the target collection must not exist.
+func (s *VectorStore) RenameCollection(_ context.Context, oldName, newName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldDir, err := s.collectionDir(oldName)
+	if err != nil {
+		return err
+	}
+	newDir, err := s.collectionDir(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(oldDir, configFileName)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %q", vserr.ErrCollectionNotFound, oldName)
+		}
+		return err
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		return fmt.Errorf("collection %q already exists", newName)
+	}
+
+	if c, ok := s.collections[oldName]; ok {
+		if err := c.close(); err != nil {
+			return fmt.Errorf("failed to close collection %q: %w", oldName, err)
+		}
+		delete(s.collections, oldName)
+	}
+	if err := os.Rename(oldDir, newDir); err != nil {
+		return fmt.Errorf("failed to rename collection %q to %q: %w", oldName, newName, err)
+	}
+	return nil
+}
+
+func (s *VectorStore) CollectionStats(_ context.Context, collection string) (*vs.CollectionStats, error) {
+	col, err := s.getCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	col.mu.RLock()
+	defer col.mu.RUnlock()
+
+	stats := &vs.CollectionStats{
+		Documents:  len(col.docs),
+		Dimensions: col.config.Dimensions,
+	}
+	entries, err := os.ReadDir(col.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection directory: %w", err)
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !info.IsDir() {
+			stats.SizeBytes += info.Size()
+		}
+	}
+	return stats, nil
+}
+
+// exportHeader precedes the documents of a collection in an export file.
+type exportHeader struct {
+	Name      string
+	Config    collectionConfig
+	Documents int
+}
+
+type exportDocument struct {
+	ID      string
+	Content string
+	// Metadata is JSON encoded, as gob can't encode arbitrary values in map[string]any
+	Metadata  []byte
+	Embedding []float32
+}
+
+// ExportCollectionsToFile writes the given (or all) collections to a gzip compressed gob file.
+// If path is a directory, the file is created in it.
+func (s *VectorStore) ExportCollectionsToFile(ctx context.Context, path string, collections ...string) error {
+	finfo, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("couldn't stat file %q: %w", path, err)
+	}
+	if finfo != nil && finfo.IsDir() {
+		path = filepath.Join(path, exportFileName)
+	}
+
+	if len(collections) == 0 {
+		if collections, err = s.listCollections(); err != nil {
+			return err
+		}
+	}
+
+	slog.Debug("Exporting collections to file", "path", path, "collections", collections)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := gob.NewEncoder(zw)
+	for _, name := range collections {
+		if err := s.exportCollection(ctx, enc, name); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	return f.Close()
+}
+
+func (s *VectorStore) exportCollection(ctx context.Context, enc *gob.Encoder, name string) error {
+	col, err := s.getCollection(name)
+	if err != nil {
+		return err
+	}
+	entries, err := col.list(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := enc.Encode(exportHeader{Name: name, Config: col.config, Documents: len(entries)}); err != nil {
+		return fmt.Errorf("failed to export collection %q: %w", name, err)
+	}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		metadata, err := json.Marshal(e.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metadata of document %s: %w", e.ID, err)
+		}
+		if err := enc.Encode(exportDocument{ID: e.ID, Content: e.Content, Metadata: metadata, Embedding: col.embedding(e.ID)}); err != nil {
+			return fmt.Errorf("failed to export document %s: %w", e.ID, err)
+		}
+	}
+	return nil
+}
+
+// ImportCollectionsFromFile imports the given (or all) collections from a file written by ExportCollectionsToFile.
+// Existing collections with the same name are replaced.
+func (s *VectorStore) ImportCollectionsFromFile(ctx context.Context, path string, collections ...string) error {
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("couldn't stat file %q: %w", path, err)
+	}
+	if finfo.IsDir() {
+		return fmt.Errorf("path %q is a directory", path)
+	}
+	slog.Debug("Importing collections from file", "path", path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+	dec := gob.NewDecoder(zr)
+
+	const batchSize = 1000
+	for {
+		var header exportHeader
+		if err := dec.Decode(&header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read import file: %w", err)
+		}
+
+		var col *collection
+		if len(collections) == 0 || slices.Contains(collections, header.Name) {
+			if err := s.RemoveCollection(ctx, header.Name); err != nil {
+				return err
+			}
+			// Keep the parameters of the exported collection, the dimensions are set on the first insert
+			config := header.Config
+			config.Dimensions = 0
+			s.mu.Lock()
+			var dir string
+			if dir, err = s.collectionDir(header.Name); err == nil {
+				col, err = createCollection(dir, config)
+			}
+			if err == nil {
+				s.collections[header.Name] = col
+			}
+			s.mu.Unlock()
+			if err != nil {
+				return fmt.Errorf("failed to create collection %q: %w", header.Name, err)
+			}
+		}
+
+		var (
+			entries    []logEntry
+			embeddings [][]float32
+		)
+		for i := 0; i < header.Documents; i++ {
+			var doc exportDocument
+			if err := dec.Decode(&doc); err != nil {
+				return fmt.Errorf("failed to read document of collection %q from import file: %w", header.Name, err)
+			}
+			if col == nil {
+				continue
+			}
+			var metadata map[string]any
+			if err := json.Unmarshal(doc.Metadata, &metadata); err != nil {
+				return fmt.Errorf("failed to parse metadata of document %s: %w", doc.ID, err)
+			}
+			entries = append(entries, logEntry{ID: doc.ID, Content: doc.Content, Metadata: metadata})
+			embeddings = append(embeddings, doc.Embedding)
+			if len(entries) >= batchSize || i == header.Documents-1 {
+				if err := col.add(entries, embeddings); err != nil {
+					return fmt.Errorf("failed to import documents into collection %q: %w", header.Name, err)
+				}
+				entries, embeddings = entries[:0], embeddings[:0]
+			}
+		}
+	}
+}
+
+func (s *VectorStore) listCollections() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hnsw directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(s.dir, e.Name(), configFileName)); err != nil {
+			continue
+		}
+		name, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Close snapshots and closes all open collections.
+func (s *VectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for name, c := range s.collections {
+		if err := c.close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close collection %q: %w", name, err))
+		}
+		delete(s.collections, name)
+	}
+	return errors.Join(errs...)
+}
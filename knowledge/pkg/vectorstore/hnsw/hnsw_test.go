@@ -0,0 +1,274 @@
+package hnsw
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	vserr "github.com/gptscript-ai/knowledge/pkg/vectorstore/errors"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	cg "github.com/philippgille/chromem-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEmbeddingFunc derives a pseudo-random (but deterministic) vector from the first word of the text,
+// so that the query "doc-<n>" is closest to the document "doc-<n> ...".
+func testEmbeddingFunc(_ context.Context, text string) ([]float32, error) {
+	var word string
+	_, _ = fmt.Sscanf(text, "%s", &word)
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(word))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+	vec := make([]float32, 16)
+	for i := range vec {
+		vec[i] = rng.Float32()*2 - 1
+	}
+	return vec, nil
+}
+
+func addTestDocs(t *testing.T, store *VectorStore, numDocs int) {
+	t.Helper()
+	docs := make([]vs.Document, numDocs)
+	for i := range docs {
+		content := fmt.Sprintf("doc-%d", i)
+		if i%10 == 9 {
+			content += " needle"
+		}
+		docs[i] = vs.Document{
+			ID:       fmt.Sprintf("id-%d", i),
+			Content:  content,
+			Metadata: map[string]any{"group": fmt.Sprintf("g%d", i%3), "num": i},
+		}
+	}
+	_, err := store.AddDocuments(context.Background(), docs, "test")
+	require.NoError(t, err)
+}
+
+func TestVectorStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := New(ctx, "hnsw://"+dir+"?m=8&ef_construction=100", testEmbeddingFunc)
+	require.NoError(t, err)
+	assert.Equal(t, 8, store.defaults.M)
+
+	_, err = store.SimilaritySearch(ctx, "doc-1", 1, "test", nil, nil, nil)
+	require.ErrorIs(t, err, vserr.ErrCollectionNotFound)
+
+	require.NoError(t, store.CreateCollection(ctx, "test", nil))
+	_, err = store.SimilaritySearch(ctx, "doc-1", 1, "test", nil, nil, nil)
+	require.ErrorIs(t, err, vserr.ErrCollectionEmpty)
+
+	addTestDocs(t, store, 500)
+
+	docs, err := store.SimilaritySearch(ctx, "doc-42", 5, "test", nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 5)
+	assert.Equal(t, "id-42", docs[0].ID)
+	assert.InDelta(t, 1, docs[0].SimilarityScore, 1e-5)
+
+	// Filters
+	docs, err = store.SimilaritySearch(ctx, "doc-42", 10, "test", map[string]string{"group": "g1", "num": "7"}, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "id-7", docs[0].ID)
+
+	docs, err = store.SimilaritySearch(ctx, "doc-42", 100, "test", nil, []cg.WhereDocument{{Operator: cg.WhereDocumentOperatorContains, Value: "needle"}}, nil)
+	require.NoError(t, err)
+	assert.Len(t, docs, 50)
+
+	// Deletes and replacements
+	require.NoError(t, store.RemoveDocument(ctx, "id-42", "test", nil, nil))
+	require.NoError(t, store.RemoveDocument(ctx, "", "test", map[string]string{"group": "g2"}, nil))
+	_, err = store.AddDocuments(ctx, []vs.Document{{ID: "id-1", Content: "doc-42 replaced"}}, "test")
+	require.NoError(t, err)
+
+	check := func(store *VectorStore) {
+		t.Helper()
+		docs, err := store.SimilaritySearch(ctx, "doc-42", 3, "test", nil, nil, nil)
+		require.NoError(t, err)
+		require.NotEmpty(t, docs)
+		assert.Equal(t, "id-1", docs[0].ID)
+		assert.Equal(t, "doc-42 replaced", docs[0].Content)
+
+		all, err := store.GetDocuments(ctx, "test", nil, nil)
+		require.NoError(t, err)
+		assert.Len(t, all, 500-1-166)
+
+		stats, err := store.CollectionStats(ctx, "test")
+		require.NoError(t, err)
+		assert.Equal(t, 500-1-166, stats.Documents)
+		assert.Equal(t, 16, stats.Dimensions)
+	}
+	check(store)
+
+	// Persistence
+	require.NoError(t, store.Close())
+	store, err = New(ctx, "hnsw://"+dir, testEmbeddingFunc)
+	require.NoError(t, err)
+	check(store)
+
+	// Export / import
+	exportDir := t.TempDir()
+	require.NoError(t, store.ExportCollectionsToFile(ctx, exportDir, "test"))
+	require.NoError(t, store.Close())
+
+	imported, err := New(ctx, "hnsw://"+t.TempDir(), testEmbeddingFunc)
+	require.NoError(t, err)
+	defer imported.Close()
+	require.NoError(t, imported.ImportCollectionsFromFile(ctx, filepath.Join(exportDir, exportFileName)))
+	check(imported)
+}
+
+func TestRecall(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(ctx, "hnsw://"+t.TempDir(), testEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.CreateCollection(ctx, "test", nil))
+	addTestDocs(t, store, 2000)
+
+	col, err := store.getCollection("test")
+	require.NoError(t, err)
+
+	const k = 10
+	hits := 0
+	for i := 0; i < 50; i++ {
+		q, _ := testEmbeddingFunc(ctx, fmt.Sprintf("query-%d", i))
+		q = normalize(q)
+
+		// Exact search
+		exact := make([]candidate, 0, len(col.graph.Nodes))
+		for slot := range col.graph.Nodes {
+			exact = append(exact, candidate{uint32(slot), distance(q, col.vector(uint32(slot)))})
+		}
+		sortCandidates(exact)
+		want := map[uint32]bool{}
+		for _, c := range exact[:k] {
+			want[c.slot] = true
+		}
+
+		for _, c := range col.graph.search(q, k, DefaultEfSearch, nil) {
+			if want[c.slot] {
+				hits++
+			}
+		}
+	}
+	assert.GreaterOrEqual(t, float64(hits)/(50*k), 0.95)
+}
+
+func TestSearchAfterReingest(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(ctx, "hnsw://"+t.TempDir(), testEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.CreateCollection(ctx, "test", nil))
+
+	// re-ingest the same chunks under new IDs, so the nearest neighbors of any query are deleted documents
+	const numDocs = 300
+	for version := 0; version < 4; version++ {
+		if version > 0 {
+			require.NoError(t, store.RemoveDocument(ctx, "", "test", map[string]string{"version": fmt.Sprint(version - 1)}, nil))
+		}
+		docs := make([]vs.Document, numDocs)
+		for i := range docs {
+			docs[i] = vs.Document{
+				ID:       fmt.Sprintf("id-%d-%d", version, i),
+				Content:  fmt.Sprintf("doc-%d", i%30),
+				Metadata: map[string]any{"version": fmt.Sprint(version)},
+			}
+		}
+		_, err = store.AddDocuments(ctx, docs, "test")
+		require.NoError(t, err)
+	}
+
+	const k = DefaultEfSearch
+	docs, err := store.SimilaritySearch(ctx, "doc-7", k, "test", nil, nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, k)
+	for _, doc := range docs {
+		assert.Equal(t, "3", doc.Metadata["version"])
+	}
+}
+
+func TestCollectionNames(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := New(ctx, "hnsw://"+filepath.Join(dir, "vectors"), testEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for _, name := range []string{"", ".", ".."} {
+		require.Error(t, store.CreateCollection(ctx, name, nil), name)
+		require.Error(t, store.RemoveCollection(ctx, name), name)
+	}
+	require.DirExists(t, dir)
+
+	// the directories of a compaction aren't collections
+	require.NoError(t, store.CreateCollection(ctx, "test.old", nil))
+	names, err := store.listCollections()
+	require.NoError(t, err)
+	require.Equal(t, []string{"test.old"}, names)
+}
+
+func TestRecoverInterruptedCompaction(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "vectors")
+	store, err := New(ctx, "hnsw://"+dir, testEmbeddingFunc)
+	require.NoError(t, err)
+	require.NoError(t, store.CreateCollection(ctx, "test", nil))
+	addTestDocs(t, store, 20)
+	require.NoError(t, store.Close())
+
+	// the process died after moving the collection away, before moving the compacted one in place
+	colDir := filepath.Join(dir, "test")
+	require.NoError(t, os.Rename(colDir, colDir+oldDirSuffix))
+	require.NoError(t, os.MkdirAll(colDir+compactDirSuffix, 0o755))
+
+	store, err = New(ctx, "hnsw://"+dir, testEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+	docs, err := store.GetDocuments(ctx, "test", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 20)
+	require.NoDirExists(t, colDir+oldDirSuffix)
+	require.NoDirExists(t, colDir+compactDirSuffix)
+}
+
+func TestRemoveCollectionWhileSearching(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(ctx, "hnsw://"+filepath.Join(t.TempDir(), "vectors"), testEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.CreateCollection(ctx, "test", nil))
+	addTestDocs(t, store, 100)
+
+	col, err := store.getCollection("test")
+	require.NoError(t, err)
+	query, _ := testEmbeddingFunc(ctx, "doc-1")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			if _, err := col.search(query, 5, nil); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	require.NoError(t, store.RemoveCollection(ctx, "test"))
+	wg.Wait()
+
+	// searches on the removed collection find nothing
+	results, err := col.search(query, 5, nil)
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
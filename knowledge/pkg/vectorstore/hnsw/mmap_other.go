@@ -0,0 +1,36 @@
+//go:build !unix
+
+package hnsw
+
+import (
+	"fmt"
+	"io"
+)
+
+// remap grows the file to the given capacity and loads it into memory, as mmap isn't supported on this platform.
+func (vf *vectorFile) remap(capacity int64) error {
+	if err := vf.f.Truncate(capacity); err != nil {
+		return fmt.Errorf("failed to grow vector file: %w", err)
+	}
+	data := make([]byte, capacity)
+	if _, err := vf.f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read vector file: %w", err)
+	}
+	vf.data = data
+	return nil
+}
+
+// written writes the changed range of the in-memory copy back to the file.
+func (vf *vectorFile) written(offset, length int64) error {
+	_, err := vf.f.WriteAt(vf.data[offset:offset+length], offset)
+	return err
+}
+
+func (vf *vectorFile) sync() error {
+	return vf.f.Sync()
+}
+
+func (vf *vectorFile) close() error {
+	vf.data = nil
+	return vf.f.Close()
+}
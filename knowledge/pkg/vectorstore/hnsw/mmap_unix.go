@@ -0,0 +1,46 @@
+//go:build unix
+
+package hnsw
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// remap grows the file to the given capacity and maps it into memory.
+func (vf *vectorFile) remap(capacity int64) error {
+	if vf.data != nil {
+		if err := syscall.Munmap(vf.data); err != nil {
+			return fmt.Errorf("failed to unmap vector file: %w", err)
+		}
+		vf.data = nil
+	}
+	if err := vf.f.Truncate(capacity); err != nil {
+		return fmt.Errorf("failed to grow vector file: %w", err)
+	}
+	data, err := syscall.Mmap(int(vf.f.Fd()), 0, int(capacity), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("failed to map vector file: %w", err)
+	}
+	vf.data = data
+	return nil
+}
+
+// written is called after a vector was written to the mapped memory - nothing to do, the mapping is shared with the file.
+func (vf *vectorFile) written(_, _ int64) error {
+	return nil
+}
+
+func (vf *vectorFile) sync() error {
+	return vf.f.Sync()
+}
+
+func (vf *vectorFile) close() error {
+	if vf.data != nil {
+		if err := syscall.Munmap(vf.data); err != nil {
+			return err
+		}
+		vf.data = nil
+	}
+	return vf.f.Close()
+}
@@ -0,0 +1,62 @@
+package hnsw
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// vectorFile stores fixed-size float32 vectors by slot. The file is memory-mapped where supported, so that the
+// OS can page vectors in and out as needed, instead of keeping all of them on the heap.
+type vectorFile struct {
+	f    *os.File
+	dims int
+	// data is the mapped (or, if mmap isn't supported, loaded) content of the file - its length is the file's capacity
+	data []byte
+}
+
+const minVectorFileCapacity = 1 << 20 // 1 MiB
+
+func openVectorFile(path string, dims int) (*vectorFile, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vector file: %w", err)
+	}
+	finfo, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to stat vector file: %w", err)
+	}
+
+	vf := &vectorFile{f: f, dims: dims}
+	if err := vf.remap(max(finfo.Size(), minVectorFileCapacity)); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return vf, nil
+}
+
+func (vf *vectorFile) vectorSize() int64 {
+	return int64(vf.dims) * 4
+}
+
+// get returns the vector at slot - the returned slice is only valid until the next call to set or close.
+func (vf *vectorFile) get(slot uint32) []float32 {
+	offset := int64(slot) * vf.vectorSize()
+	return unsafe.Slice((*float32)(unsafe.Pointer(&vf.data[offset])), vf.dims)
+}
+
+// set stores the vector at slot, growing the file if needed.
+func (vf *vectorFile) set(slot uint32, vec []float32) error {
+	if len(vec) != vf.dims {
+		return fmt.Errorf("vector has %d dimensions, expected %d", len(vec), vf.dims)
+	}
+	end := (int64(slot) + 1) * vf.vectorSize()
+	if end > int64(len(vf.data)) {
+		if err := vf.remap(max(end, int64(len(vf.data))*2)); err != nil {
+			return err
+		}
+	}
+	copy(vf.get(slot), vec)
+	return vf.written(int64(slot)*vf.vectorSize(), vf.vectorSize())
+}
@@ -0,0 +1,196 @@
+package pgvector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	migrationComponent = "pgvector"
+
+	// pgLockIDMigrations is used for an advisory lock, so that only one knowledge process migrates the tables at a time.
+	pgLockIDMigrations = 1573678846307946498
+)
+
+// migrations are the schema migrations of the vector store's tables - append new ones and never change released ones.
+// The first migration is idempotent, so that it also adopts tables created before the migrations were versioned.
+func (v VectorStore) migrations() []migrate.Step[pgx.Tx] {
+	return []migrate.Step[pgx.Tx]{
+		{
+			Migration: migrate.Migration{Version: 1, Description: "create vector extension, collection and embedding tables"},
+			Up: func(ctx context.Context, tx pgx.Tx) error {
+				if err := v.createVectorExtensionIfNotExists(ctx, tx); err != nil {
+					return err
+				}
+				if err := v.createCollectionTableIfNotExists(ctx, tx); err != nil {
+					return err
+				}
+				return v.createEmbeddingTableIfNotExists(ctx, tx)
+			},
+			Down: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s, %s`, v.embeddingTableName, v.collectionTableName))
+				return err
+			},
+		},
+		{
+			Migration: migrate.Migration{Version: 2, Description: "add columns for quantized embeddings"},
+			Up:        v.addQuantizedColumns,
+			Down: func(ctx context.Context, tx pgx.Tx) error {
+				_, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS %s, DROP COLUMN IF EXISTS %s`, v.embeddingTableName, halfvecColumn, bitColumn))
+				return err
+			},
+		},
+	}
+}
+
+func (v VectorStore) migrationsTableName() string {
+	return "knowledge_vector_schema_migrations"
+}
+
+// NewMigrator connects to the database without migrating it - closing the migrator closes the connection.
+func NewMigrator(ctx context.Context, dsn string) (migrate.Migrator, error) {
+	store, err := open(ctx, dsn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return store.Migrator(), nil
+}
+
+// Migrator returns the migrator of the vector store's tables - closing it closes the vector store.
+func (v VectorStore) Migrator() migrate.Migrator {
+	return &migrator{v: v}
+}
+
+type migrator struct {
+	v VectorStore
+}
+
+func (m *migrator) Component() string {
+	return migrationComponent
+}
+
+func (m *migrator) Close() error {
+	return m.v.Close()
+}
+
+func (m *migrator) Status(ctx context.Context) (*migrate.Status, error) {
+	tx, err := m.v.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // read-only
+
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.NewStatus(migrationComponent, m.v.migrations(), applied), nil
+}
+
+func (m *migrator) Up(ctx context.Context, target int) error {
+	steps := m.v.migrations()
+	return m.run(ctx, true, func(current int) ([]migrate.Step[pgx.Tx], error) {
+		return migrate.PlanUp(steps, current, target)
+	})
+}
+
+func (m *migrator) Down(ctx context.Context, target int) error {
+	steps := m.v.migrations()
+	return m.run(ctx, false, func(current int) ([]migrate.Step[pgx.Tx], error) {
+		return migrate.PlanDown(steps, current, target)
+	})
+}
+
+// run applies or reverts the planned migrations in a single transaction, guarded by an advisory lock,
+// so that concurrently starting knowledge processes don't race.
+func (m *migrator) run(ctx context.Context, up bool, plan func(current int) ([]migrate.Step[pgx.Tx], error)) error {
+	steps := m.v.migrations()
+	if err := migrate.Validate(steps); err != nil {
+		return err
+	}
+
+	tx, err := m.v.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // rollback on error (noop after commit)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", pgLockIDMigrations); err != nil {
+		return fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+
+	sql := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version integer PRIMARY KEY,
+	description varchar,
+	applied_at timestamptz NOT NULL DEFAULT now())`, m.v.migrationsTableName())
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return err
+	}
+	status := migrate.NewStatus(migrationComponent, steps, applied)
+	if err := migrate.CheckVersion(migrationComponent, status.Current, status.Latest); err != nil {
+		return err
+	}
+
+	planned, err := plan(status.Current)
+	if err != nil {
+		return err
+	}
+
+	for _, step := range planned {
+		if up {
+			slog.Info("Applying vector store migration", "version", step.Version, "description", step.Description, "store", "pgvector")
+			if err := step.Up(ctx, tx); err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %w", step.Version, step.Description, err)
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (version, description) VALUES ($1, $2)`, m.v.migrationsTableName()), step.Version, step.Description); err != nil {
+				return fmt.Errorf("failed to record migration %d: %w", step.Version, err)
+			}
+		} else {
+			slog.Info("Reverting vector store migration", "version", step.Version, "description", step.Description, "store", "pgvector")
+			if err := step.Down(ctx, tx); err != nil {
+				return fmt.Errorf("failed to revert migration %d (%s): %w", step.Version, step.Description, err)
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, m.v.migrationsTableName()), step.Version); err != nil {
+				return fmt.Errorf("failed to remove migration %d: %w", step.Version, err)
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// applied returns the applied migrations ordered by version - none if the migrations table doesn't exist yet.
+func (m *migrator) applied(ctx context.Context, tx pgx.Tx) ([]migrate.AppliedMigration, error) {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, m.v.migrationsTableName()).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check for migrations table: %w", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT version, description, applied_at FROM %s ORDER BY version`, m.v.migrationsTableName()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []migrate.AppliedMigration
+	for rows.Next() {
+		var a migrate.AppliedMigration
+		if err := rows.Scan(&a.Version, &a.Description, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
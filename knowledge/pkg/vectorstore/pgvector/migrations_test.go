@@ -0,0 +1,19 @@
+package pgvector
+
+import (
+	"testing"
+
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	steps := VectorStore{embeddingTableName: "knowledge_embeddings", collectionTableName: "knowledge_collections"}.migrations()
+	require.NoError(t, migrate.Validate(steps))
+
+	// Reverting the quantized columns keeps the tables
+	planned, err := migrate.PlanDown(steps, len(steps), 1)
+	require.NoError(t, err)
+	require.Len(t, planned, 1)
+	require.Equal(t, "add columns for quantized embeddings", planned[0].Description)
+}
@@ -4,9 +4,11 @@ package pgvector
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -37,6 +39,10 @@ const (
 	// creation of the collection. The same value represents the same lock.
 	pgLockIDCreateCollection = 1573678846307946497
 
+	// pgLockIDBuildIndex is used for advisor lock to fix issue arising from concurrent
+	// creation of the ANN index of a collection. The same value represents the same lock.
+	pgLockIDBuildIndex = 1573678846307946499
+
 	// VsPgvectorEmbeddingConcurrency can be set as an environment variable to control the number of parallel API calls to create embedding for documents. Default is 100
 	VsPgvectorEmbeddingConcurrency = "VS_PGVECTOR_EMBEDDING_CONCURRENCY"
 )
@@ -69,39 +75,33 @@ type VectorStore struct {
 	embeddingTableName   string
 	collectionTableName  string
 	vectorDimensions     int
-	hnswIndex            *HNSWIndex
-}
-
-// HNSWIndex lets you specify the HNSW index parameters.
-// See here for more details: https://github.com/pgvector/pgvector#hnsw
-//
-// m: he max number of connections per layer (16 by default)
-// efConstruction: the size of the dynamic candidate list for constructing the graph (64 by default)
-// distanceFunction: the distance function to use (l2 by default).
-type HNSWIndex struct {
-	m                int
-	efConstruction   int
-	distanceFunction string
+	// defaultIndex is the ANN index configuration for new collections (and old ones that don't have any)
+	defaultIndex vs.IndexConfig
 }
 
-var DefaultHNSWIndex = &HNSWIndex{
-	m:                16,
-	efConstruction:   64,
-	distanceFunction: "vector_l2_ops",
+func New(ctx context.Context, dsn string, embeddingFunc cg.EmbeddingFunc) (*VectorStore, error) {
+	store, err := open(ctx, dsn, embeddingFunc)
+	if err != nil {
+		return nil, err
+	}
+	return store, store.init(ctx)
 }
 
-func New(ctx context.Context, dsn string, embeddingFunc cg.EmbeddingFunc) (*VectorStore, error) {
-	dsn = "postgres://" + strings.TrimPrefix(dsn, "pgvector://")
+// open connects to the database without creating or migrating the tables.
+func open(ctx context.Context, dsn string, embeddingFunc cg.EmbeddingFunc) (*VectorStore, error) {
+	dsn, defaultIndex, err := parseIndexConfigFromDSN("postgres://" + strings.TrimPrefix(dsn, "pgvector://"))
+	if err != nil {
+		return nil, err
+	}
 
 	store := &VectorStore{
 		embeddingTableName:   "knowledge_embeddings",
 		collectionTableName:  "knowledge_collections",
 		embeddingFunc:        embeddingFunc,
 		embeddingConcurrency: env.GetIntFromEnvOrDefault(VsPgvectorEmbeddingConcurrency, 100),
-		hnswIndex:            nil,
+		defaultIndex:         defaultIndex,
 	}
 
-	var err error
 	store.conn, err = pgxpool.New(ctx, dsn)
 	if err != nil {
 		return nil, err
@@ -111,26 +111,12 @@ func New(ctx context.Context, dsn string, embeddingFunc cg.EmbeddingFunc) (*Vect
 		return nil, err
 	}
 
-	return store, store.init(ctx)
+	return store, nil
 }
 
+// init creates or migrates the tables to the latest schema version.
 func (v VectorStore) init(ctx context.Context) error {
-	tx, err := v.conn.Begin(ctx)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback(ctx) // rollback on error (noop after commit)
-	if err := v.createVectorExtensionIfNotExists(ctx, tx); err != nil {
-		return err
-	}
-	if err := v.createCollectionTableIfNotExists(ctx, tx); err != nil {
-		return err
-	}
-	if err := v.createEmbeddingTableIfNotExists(ctx, tx); err != nil {
-		return err
-	}
-
-	return tx.Commit(ctx)
+	return v.Migrator().Up(ctx, 0)
 }
 
 func (v VectorStore) createVectorExtensionIfNotExists(ctx context.Context, tx pgx.Tx) error {
@@ -207,20 +193,6 @@ func (v VectorStore) createEmbeddingTableIfNotExists(ctx context.Context, tx pgx
 		return err
 	}
 
-	// See this for more details on HNSW indexes: https://github.com/pgvector/pgvector#hnsw
-	if v.hnswIndex != nil {
-		sql = fmt.Sprintf(
-			`CREATE INDEX IF NOT EXISTS %s_embedding_hnsw ON %s USING hnsw (embedding %s)`,
-			v.embeddingTableName, v.embeddingTableName, v.hnswIndex.distanceFunction,
-		)
-		if v.hnswIndex.m > 0 && v.hnswIndex.efConstruction > 0 {
-			sql = fmt.Sprintf("%s WITH (m=%d, ef_construction = %d)", sql, v.hnswIndex.m, v.hnswIndex.efConstruction)
-		}
-		if _, err := tx.Exec(ctx, sql); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
@@ -258,7 +230,24 @@ func (v VectorStore) CreateCollection(ctx context.Context, collection string, op
 		return fmt.Errorf("failed to acquire advisory lock: %w", err)
 	}
 
-	_, err = tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (uuid, name) VALUES($1, $2)`, v.collectionTableName), uuid.New().String(), collection)
+	var quantization *vs.QuantizationConfig
+	if opts.Quantization.Quantized() {
+		quantization = opts.Quantization
+		if err := quantization.Validate(); err != nil {
+			return err
+		}
+		if err := v.ensureQuantizedColumns(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	// Keep the index configuration the collection was created with, even if the store's default changes later on
+	meta, err := json.Marshal(collectionMetadata{Index: &v.defaultIndex, Quantization: quantization})
+	if err != nil {
+		return fmt.Errorf("failed to marshal collection metadata: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (uuid, name, cmetadata) VALUES($1, $2, $3)`, v.collectionTableName), uuid.New().String(), collection, meta)
 	var pgErr *pgconn.PgError
 	if err != nil {
 		if ok := errors.As(err, &pgErr); ok && pgErr != nil && pgErr.Code == "23505" {
@@ -274,7 +263,7 @@ func (v VectorStore) CreateCollection(ctx context.Context, collection string, op
 }
 
 func (v VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, collection string) ([]string, error) {
-	cid, err := v.getCollectionUUID(ctx, collection)
+	cid, meta, err := v.getCollection(ctx, collection)
 	if err != nil {
 		return nil, err
 	}
@@ -304,6 +293,15 @@ func (v VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, colle
 
 	sql := fmt.Sprintf(`INSERT INTO %s (uuid, document, embedding, cmetadata, collection_id)
 		VALUES($1, $2, $3, $4, $5)`, v.embeddingTableName)
+	if meta.Quantization.Quantized() {
+		// Only keep the full precision embedding if it's needed for rescoring
+		embeddingExpr := "NULL"
+		if rescored(meta.Quantization) {
+			embeddingExpr = "$3::vector"
+		}
+		sql = fmt.Sprintf(`INSERT INTO %s (uuid, document, embedding, %s, cmetadata, collection_id)
+		VALUES($1, $2, %s, %s, $4, $5)`, v.embeddingTableName, searchColumn(meta.Quantization), embeddingExpr, quantizeExpr(meta.Quantization, "$3"))
+	}
 
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, v.embeddingConcurrency)
@@ -342,7 +340,147 @@ func (v VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, colle
 		return nil, sharedErr
 	}
 
-	return ids, v.conn.SendBatch(ctx, b).Close()
+	if err := v.conn.SendBatch(ctx, b).Close(); err != nil {
+		return nil, err
+	}
+
+	if len(docs) > 0 {
+		if err := v.ensureIndex(ctx, collection, meta); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// ensureIndex builds the collection's index after the first documents were added, if it doesn't exist yet.
+// HNSW indexes can be built right away and are updated incrementally, while IVFFlat indexes should be built
+// once the collection contains (most of) its data, as the lists are computed from the existing rows.
+func (v VectorStore) ensureIndex(ctx context.Context, collection string, meta collectionMetadata) error {
+	if meta.IndexDimensions != 0 {
+		return nil
+	}
+	switch v.indexConfig(meta).Type {
+	case vs.IndexTypeHNSW:
+		if err := v.BuildIndex(ctx, collection, nil, false); err != nil {
+			return fmt.Errorf("failed to build index: %w", err)
+		}
+	case vs.IndexTypeIVFFlat:
+		slog.Info("IVFFlat index not built yet - build it once all documents are ingested", "collection", collection, "store", "pgvector")
+	}
+	return nil
+}
+
+// GetEmbeddings returns the embeddings of the given documents by their ID - the full precision ones are always kept.
+func (v VectorStore) GetEmbeddings(ctx context.Context, collection string, ids []string) (map[string][]float32, error) {
+	cid, _, err := v.getCollection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make(map[string][]float32, len(ids))
+	if len(ids) == 0 {
+		return embeddings, nil
+	}
+
+	sql := fmt.Sprintf(`SELECT uuid::text, embedding::text FROM %s WHERE collection_id = $1 AND uuid = ANY($2::uuid[])`, v.embeddingTableName)
+	rows, err := v.conn.Query(ctx, sql, cid, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var embedding pgvector.Vector
+		if err := rows.Scan(&id, &embedding); err != nil {
+			return nil, err
+		}
+		embeddings[id] = embedding.Slice()
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
+	}
+	return embeddings, nil
+}
+
+// CopyDocuments copies the given (or all) documents with their stored embeddings into the target collection.
+// Document IDs are unique across collections, so the copies get new IDs.
+func (v VectorStore) CopyDocuments(ctx context.Context, source, target string, ids []string) (map[string]string, error) {
+	srcID, srcMeta, err := v.getCollection(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	dstID, dstMeta, err := v.getCollection(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if searchColumn(srcMeta.Quantization) != searchColumn(dstMeta.Quantization) || rescored(srcMeta.Quantization) != rescored(dstMeta.Quantization) {
+		return nil, fmt.Errorf("cannot copy documents from collection %q to %q: the quantization differs", source, target)
+	}
+
+	columns := "embedding"
+	if srcMeta.Quantization.Quantized() {
+		columns += ", " + searchColumn(srcMeta.Quantization)
+	}
+
+	// The CTE is materialized, so each copy keeps the UUID generated for it
+	args := []any{srcID, dstID}
+	filter := ""
+	if len(ids) > 0 {
+		filter = " AND uuid = ANY($3::uuid[])"
+		args = append(args, ids)
+	}
+	sql := fmt.Sprintf(`WITH src AS MATERIALIZED (
+		SELECT uuid AS old_uuid, gen_random_uuid() AS new_uuid, document, cmetadata, %[2]s FROM %[1]s WHERE collection_id = $1%[3]s
+	), copied AS (
+		INSERT INTO %[1]s (uuid, collection_id, document, cmetadata, %[2]s) SELECT new_uuid, $2, document, cmetadata, %[2]s FROM src
+	)
+	SELECT old_uuid::text, new_uuid::text FROM src`, v.embeddingTableName, columns, filter)
+	slog.Debug("Copy documents", "sql", sql, "store", "pgvector")
+
+	rows, err := v.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy documents from collection %q to %q: %w", source, target, err)
+	}
+	defer rows.Close()
+
+	copied := map[string]string{}
+	for rows.Next() {
+		var oldID, newID string
+		if err := rows.Scan(&oldID, &newID); err != nil {
+			return nil, err
+		}
+		copied[oldID] = newID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to copy documents from collection %q to %q: %w", source, target, err)
+	}
+
+	if len(copied) > 0 {
+		if err := v.ensureIndex(ctx, target, dstMeta); err != nil {
+			return nil, err
+		}
+	}
+	return copied, nil
+}
+
+// RenameCollection renames the collection in place - its documents and index are kept, as they refer to the collection's UUID.
+func (v VectorStore) RenameCollection(ctx context.Context, oldName, newName string) error {
+	slog.Debug("Renaming collection", "collection", oldName, "name", newName, "store", "pgvector")
+
+	tag, err := v.conn.Exec(ctx, fmt.Sprintf(`UPDATE %s SET name = $2 WHERE name = $1`, v.collectionTableName), oldName, newName)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return fmt.Errorf("collection %q already exists", newName)
+		}
+		return fmt.Errorf("failed to rename collection %q to %q: %w", oldName, newName, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("collection %q not found", oldName)
+	}
+	return nil
 }
 
 /*
@@ -355,6 +493,10 @@ SimilaritySearch performs a similarity search on the given query and returns the
 *   - `<+>` - L1 distance (added in 0.7.0)
 *   - `<~>` - Hamming distance (binary vectors, added in 0.7.0)
 *   - `<%>` - Jaccard distance (binary vectors, added in 0.7.0)
+* The distance function (cosine, inner product or L2) is configured per collection, see vs.IndexConfig.
+* Scores are normalized to the cosine similarity (for normalized embeddings), like in the other vector stores.
+* Quantized collections search the halfvec or (by hamming distance) the bit column and optionally re-rank
+* the candidates by their full precision embeddings.
 */
 func (v VectorStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, collection string, where map[string]string, whereDocument []cg.WhereDocument, embeddingFunc cg.EmbeddingFunc) ([]vs.Document, error) {
 	slog.Debug("Similarity search", "query", query, "numDocuments", numDocuments, "collection", collection, "where", where, "whereDocument", whereDocument, "store", "pgvector")
@@ -368,47 +510,81 @@ func (v VectorStore) SimilaritySearch(ctx context.Context, query string, numDocu
 		return nil, fmt.Errorf("pgvector does not support whereDocument")
 	}
 
+	cid, meta, err := v.getCollection(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection %q: %w", collection, err)
+	}
+	cfg := v.indexConfig(meta)
+
 	queryEmbedding, err := ef(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	dims := len(queryEmbedding)
 
+	// The ANN index is on an expression, so the query has to use the exact same expression for the index to be used
+	q := meta.Quantization
+	embeddingExpr := searchColumn(q)
+	indexed := cfg.Type != vs.IndexTypeNone && meta.IndexDimensions == dims
+	if indexed {
+		embeddingExpr = castExpr(q, dims)
+	} else if cfg.Type != vs.IndexTypeNone {
+		slog.Debug("ANN index not available for query - using exact search", "collection", collection, "indexDimensions", meta.IndexDimensions, "queryDimensions", dims, "store", "pgvector")
+	}
+	distanceExpr := fmt.Sprintf("%s %s %s", embeddingExpr, quantizedDistanceOperator(q, cfg.Distance), quantizeExpr(q, "$2"))
+
 	whereClause, args, err := buildWhereClause([]any{dims, pgvector.NewVector(queryEmbedding), numDocuments}, where)
 	if err != nil {
 		return nil, err
 	}
-	sql := fmt.Sprintf(`WITH filtered_embedding_dims AS MATERIALIZED (
-    SELECT
-        *
-    FROM
-        %s
-    WHERE
-        vector_dims (
-                embedding
-        ) = $1
-)
-SELECT
-	data.uuid,
-	data.document,
-	data.cmetadata,
-	data.similarity
-FROM (
-	SELECT
-		filtered_embedding_dims.*,
-		1 - (embedding <=> $2) AS similarity
-	FROM
-		filtered_embedding_dims
-		JOIN %s ON filtered_embedding_dims.collection_id=%s.uuid WHERE %s.name='%s') AS data
-WHERE %s
+	accessClause, args := buildAccessFilterClause(ctx, args)
+	whereClause = whereClause + " AND " + accessClause
+
+	limit, rescoreColumn := "$3", ""
+	if rescored(q) {
+		limit, rescoreColumn = strconv.Itoa(q.Candidates(numDocuments)), "embedding,"
+	}
+
+	// The collection ID is inlined (it's a UUID), so that the planner can match the partial index on it
+	sql := fmt.Sprintf(`SELECT
+	uuid,
+	document,
+	cmetadata,
+	%s
+	%s AS similarity
+FROM
+	%s
+WHERE
+	collection_id = '%s'
+	AND %s = $1
+	AND %s
 ORDER BY
-	data.similarity DESC
-LIMIT $3`, v.embeddingTableName,
-		v.collectionTableName, v.collectionTableName, v.collectionTableName, collection,
-		whereClause)
+	%s
+LIMIT %s`, rescoreColumn, quantizedSimilarityExpr(q, cfg.Distance, distanceExpr, dims), v.embeddingTableName, cid, dimsExpr(q), whereClause, distanceExpr, limit)
+
+	if rescored(q) {
+		// Re-rank the candidates found with the quantized embeddings by their full precision embeddings
+		fullDistanceExpr := fmt.Sprintf("embedding %s $2::vector", distanceOperator(cfg.Distance))
+		sql = fmt.Sprintf(`SELECT uuid, document, cmetadata, %s AS similarity
+FROM (%s) candidates
+ORDER BY %s
+LIMIT $3`, similarityExpr(cfg.Distance, fullDistanceExpr), sql, fullDistanceExpr)
+	}
+
+	tx, err := v.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // read-only, nothing to commit
+
+	if indexed {
+		if err := setSearchParams(ctx, tx, cfg, q.Candidates(numDocuments), len(where) > 0 || accessClause != "TRUE"); err != nil {
+			return nil, fmt.Errorf("failed to set index search parameters: %w", err)
+		}
+	}
 
 	slog.Debug("SimilaritySearch", "sql", sql, "store", "pgvector")
-	rows, err := v.conn.Query(ctx, sql, args...)
+	rows, err := tx.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query: %w", err)
 	}
@@ -435,6 +611,20 @@ func (v VectorStore) RemoveCollection(ctx context.Context, collection string) er
 		return err
 	}
 
+	defer tx.Rollback(ctx) // rollback on error (noop after commit)
+
+	cid, err := v.getCollectionUUID(ctx, collection)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s`, v.indexName(cid))); err != nil {
+		return fmt.Errorf("failed to drop index: %w", err)
+	}
+
 	// Deletion from the collection table will cascade to the embedding table
 	_, err = tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE name = $1`, v.collectionTableName), collection)
 	if err != nil {
@@ -495,6 +685,8 @@ func (v VectorStore) GetDocuments(ctx context.Context, collection string, where
 	if err != nil {
 		return nil, err
 	}
+	accessClause, args := buildAccessFilterClause(ctx, args)
+	whereClause = whereClause + " AND " + accessClause
 
 	sql := fmt.Sprintf(`SELECT uuid, document, cmetadata FROM %s WHERE collection_id = $1 AND %s`, v.embeddingTableName, whereClause)
 	slog.Debug("Get documents", "sql", sql, "store", "pgvector")
@@ -515,6 +707,28 @@ func (v VectorStore) GetDocuments(ctx context.Context, collection string, where
 	return docs, rows.Err()
 }
 
+func (v VectorStore) CollectionStats(ctx context.Context, collection string) (*vs.CollectionStats, error) {
+	cid, meta, err := v.getCollection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddingSize := "COALESCE(pg_column_size(embedding), 0)"
+	if meta.Quantization.Quantized() {
+		embeddingSize += fmt.Sprintf(" + COALESCE(pg_column_size(%s), 0)", searchColumn(meta.Quantization))
+	}
+
+	stats := &vs.CollectionStats{Quantization: meta.Quantization}
+	sql := fmt.Sprintf(`SELECT COUNT(*), COALESCE(MAX(%s), 0),
+	COALESCE(SUM(%s + pg_column_size(document) + pg_column_size(cmetadata)), 0)
+	FROM %s WHERE collection_id = $1`, dimsExpr(meta.Quantization), embeddingSize, v.embeddingTableName)
+	if err := v.conn.QueryRow(ctx, sql, cid).Scan(&stats.Documents, &stats.Dimensions, &stats.SizeBytes); err != nil {
+		return nil, fmt.Errorf("failed to get collection stats: %w", err)
+	}
+
+	return stats, nil
+}
+
 func (v VectorStore) ImportCollectionsFromFile(ctx context.Context, path string, collections ...string) error {
 	return fmt.Errorf("function ImportCollectionsFromFile not implemented for vectorstore pgvector")
 }
@@ -545,3 +759,21 @@ func buildWhereClause(args []any, where map[string]string) (string, []any, error
 	}
 	return whereClause, args, nil
 }
+
+// buildAccessFilterClause returns a clause that only matches documents readable by the principals set in the context.
+// If there's no access filter in the context, the clause is always true.
+func buildAccessFilterClause(ctx context.Context, args []any) (string, []any) {
+	principals, ok := vs.AccessFilterFromCtx(ctx)
+	if !ok {
+		return "TRUE", args
+	}
+
+	argIndex := len(args) + 1
+	clauses := []string{fmt.Sprintf("COALESCE(cmetadata ->> '%s', '') = ''", vs.DocMetadataKeyACLPrincipals)}
+	for _, p := range principals {
+		clauses = append(clauses, fmt.Sprintf("strpos(cmetadata ->> '%s', $%d) > 0", vs.DocMetadataKeyACLPrincipals, argIndex))
+		args = append(args, vs.ACLPrincipalToken(p))
+		argIndex++
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
@@ -0,0 +1,160 @@
+package pgvector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	"github.com/jackc/pgx/v5"
+)
+
+// Quantized embeddings are stored in separate columns of the embedding table, which are added by a migration if
+// pgvector 0.7.0+ is installed, or else when the first quantized collection is created after upgrading pgvector.
+// The full precision embedding column is only filled if the collection is rescored.
+const (
+	halfvecColumn = "embedding_half"
+	bitColumn     = "embedding_bit"
+)
+
+// halfvecSupported returns true if the installed pgvector version supports halfvec.
+func halfvecSupported(ctx context.Context, tx pgx.Tx) (bool, error) {
+	var supported bool
+	if err := tx.QueryRow(ctx, `SELECT to_regtype('halfvec') IS NOT NULL`).Scan(&supported); err != nil {
+		return false, fmt.Errorf("failed to check for halfvec support: %w", err)
+	}
+	return supported, nil
+}
+
+// addQuantizedColumns adds the columns for quantized embeddings to the embedding table, if they don't exist yet.
+// Older pgvector versions don't support halfvec, so the columns are skipped there and added by ensureQuantizedColumns
+// once pgvector was upgraded.
+func (v VectorStore) addQuantizedColumns(ctx context.Context, tx pgx.Tx) error {
+	supported, err := halfvecSupported(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		slog.Warn("pgvector doesn't support halfvec (requires 0.7.0+) - quantized datasets can't be created until it's upgraded", "store", "pgvector")
+		return nil
+	}
+
+	sql := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s halfvec, ADD COLUMN IF NOT EXISTS %s varbit`, v.embeddingTableName, halfvecColumn, bitColumn)
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("failed to add columns for quantized embeddings: %w", err)
+	}
+	return nil
+}
+
+// ensureQuantizedColumns adds the columns for quantized embeddings if they don't exist, because pgvector was too old
+// when the tables were migrated. It returns an error if pgvector still doesn't support halfvec.
+func (v VectorStore) ensureQuantizedColumns(ctx context.Context, tx pgx.Tx) error {
+	var columns int
+	err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM information_schema.columns WHERE table_name = $1 AND column_name IN ($2, $3)`,
+		v.embeddingTableName, halfvecColumn, bitColumn).Scan(&columns)
+	if err != nil {
+		return fmt.Errorf("failed to check for columns for quantized embeddings: %w", err)
+	}
+	if columns == 2 {
+		return nil
+	}
+
+	supported, err := halfvecSupported(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !supported {
+		return fmt.Errorf("quantization requires pgvector 0.7.0+")
+	}
+	return v.addQuantizedColumns(ctx, tx)
+}
+
+func quantizationType(q *vs.QuantizationConfig) string {
+	if !q.Quantized() {
+		return vs.QuantizationNone
+	}
+	return q.Type
+}
+
+func rescored(q *vs.QuantizationConfig) bool {
+	return q.Quantized() && q.Rescore
+}
+
+// searchColumn returns the column holding the embeddings that are searched (and indexed).
+func searchColumn(q *vs.QuantizationConfig) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return halfvecColumn
+	case vs.QuantizationBinary:
+		return bitColumn
+	default:
+		return "embedding"
+	}
+}
+
+// dimsExpr returns the expression for the number of dimensions of the searched embeddings.
+func dimsExpr(q *vs.QuantizationConfig) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return fmt.Sprintf("vector_dims(%s)", halfvecColumn)
+	case vs.QuantizationBinary:
+		return fmt.Sprintf("length(%s)", bitColumn)
+	default:
+		return "vector_dims(embedding)"
+	}
+}
+
+// castExpr casts the searched embeddings to a type with fixed dimensions, which is required for ANN indexes.
+func castExpr(q *vs.QuantizationConfig, dims int) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return fmt.Sprintf("%s::halfvec(%d)", halfvecColumn, dims)
+	case vs.QuantizationBinary:
+		return fmt.Sprintf("%s::bit(%d)", bitColumn, dims)
+	default:
+		return fmt.Sprintf("embedding::vector(%d)", dims)
+	}
+}
+
+// quantizeExpr converts a full precision vector parameter (e.g. "$2") into the representation of the searched embeddings.
+func quantizeExpr(q *vs.QuantizationConfig, param string) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return param + "::vector::halfvec"
+	case vs.QuantizationBinary:
+		return fmt.Sprintf("binary_quantize(%s::vector)", param)
+	default:
+		return param + "::vector"
+	}
+}
+
+// quantizedDistanceOperator returns the distance operator for the searched embeddings - binary embeddings
+// are always compared by their hamming distance.
+func quantizedDistanceOperator(q *vs.QuantizationConfig, distance string) string {
+	if quantizationType(q) == vs.QuantizationBinary {
+		return "<~>"
+	}
+	return distanceOperator(distance)
+}
+
+// quantizedDistanceOpClass returns the operator class of the ANN index on the searched embeddings.
+func quantizedDistanceOpClass(q *vs.QuantizationConfig, distance string) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return strings.Replace(distanceOpClass(distance), "vector_", "halfvec_", 1)
+	case vs.QuantizationBinary:
+		return "bit_hamming_ops"
+	default:
+		return distanceOpClass(distance)
+	}
+}
+
+// quantizedSimilarityExpr turns the distance expression on the searched embeddings into a similarity score.
+// For binary embeddings, the share of differing bits approximates the angle between the vectors (see SimHash).
+func quantizedSimilarityExpr(q *vs.QuantizationConfig, distance, distanceExpr string, dims int) string {
+	if quantizationType(q) == vs.QuantizationBinary {
+		return fmt.Sprintf("cos(pi() * (%s) / %d)", distanceExpr, max(dims, 1))
+	}
+	return similarityExpr(distance, distanceExpr)
+}
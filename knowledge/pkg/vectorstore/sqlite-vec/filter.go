@@ -0,0 +1,97 @@
+package sqlite_vec
+
+import (
+	"fmt"
+	"strings"
+
+	cg "github.com/philippgille/chromem-go"
+)
+
+// metadataPath returns the JSON path for a top-level metadata key, quoted so that keys may contain dots or spaces.
+func metadataPath(key string) string {
+	return `$."` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+// buildWhereFilter returns an SQL predicate (and its arguments) on the metadata column, matching documents whose metadata
+// has all the given key-value pairs. Values are compared as strings, the same way chromem does it.
+// Pairs with an empty key or value are ignored. If there's nothing to filter on, the predicate is always true.
+func buildWhereFilter(where map[string]string) (string, []any) {
+	var (
+		clauses []string
+		args    []any
+	)
+	for k, v := range where {
+		if strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+			continue
+		}
+		// booleans would be returned as 1/0 by ->>, numbers as integers/reals, so normalize to their JSON text
+		clauses = append(clauses, `(CASE json_type(metadata, ?) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(metadata ->> ? AS TEXT) END) = ?`)
+		args = append(args, metadataPath(k), metadataPath(k), v)
+	}
+	if len(clauses) == 0 {
+		return "TRUE", nil
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", args
+}
+
+// buildWhereDocumentFilter returns an SQL predicate (and its arguments) on the content column, matching documents that
+// satisfy all the given whereDocument filters. Matching is case-sensitive, like chromem's.
+func buildWhereDocumentFilter(whereDocuments []cg.WhereDocument) (string, []any, error) {
+	if len(whereDocuments) == 0 {
+		return "TRUE", nil, nil
+	}
+
+	var (
+		clauses []string
+		args    []any
+	)
+	for _, wd := range whereDocuments {
+		if err := wd.Validate(); err != nil {
+			return "", nil, fmt.Errorf("invalid whereDocument %#v: %w", wd, err)
+		}
+		clause, clauseArgs := whereDocumentClause(wd)
+		clauses = append(clauses, clause)
+		args = append(args, clauseArgs...)
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", args, nil
+}
+
+// whereDocumentClause translates a single (validated) whereDocument filter into SQL.
+func whereDocumentClause(wd cg.WhereDocument) (string, []any) {
+	switch wd.Operator {
+	case cg.WhereDocumentOperatorContains:
+		return "instr(content, ?) > 0", []any{wd.Value}
+	case cg.WhereDocumentOperatorNotContains:
+		return "instr(content, ?) = 0", []any{wd.Value}
+	}
+
+	sep := " AND "
+	if wd.Operator == cg.WhereDocumentOperatorOr {
+		sep = " OR "
+	}
+
+	var (
+		clauses []string
+		args    []any
+	)
+	for _, sub := range wd.WhereDocuments {
+		clause, subArgs := whereDocumentClause(sub)
+		clauses = append(clauses, clause)
+		args = append(args, subArgs...)
+	}
+	return "(" + strings.Join(clauses, sep) + ")", args
+}
+
+// buildFilter combines the metadata, content and access filters for queries on the embeddings table.
+func buildFilter(where map[string]string, whereDocuments []cg.WhereDocument, accessQuery string, accessArgs []any) (string, []any, error) {
+	whereQuery, args := buildWhereFilter(where)
+
+	whereDocQuery, whereDocArgs, err := buildWhereDocumentFilter(whereDocuments)
+	if err != nil {
+		return "", nil, err
+	}
+	args = append(args, whereDocArgs...)
+	args = append(args, accessArgs...)
+
+	return fmt.Sprintf("%s AND %s AND %s", whereQuery, whereDocQuery, accessQuery), args, nil
+}
@@ -0,0 +1,128 @@
+package sqlite_vec
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+)
+
+// collectionMetadata is stored in the collections table. Collections without an entry use full precision embeddings.
+type collectionMetadata struct {
+	Quantization *vs.QuantizationConfig `json:"quantization,omitempty"`
+}
+
+func (v *VectorStore) getCollectionMetadata(collection string) (collectionMetadata, error) {
+	var (
+		meta    collectionMetadata
+		rawMeta []byte
+	)
+	err := v.db.Raw(fmt.Sprintf(`SELECT metadata FROM [%s] WHERE id = ?`, v.collectionsTableName), collection).Row().Scan(&rawMeta)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return meta, nil
+		}
+		return meta, fmt.Errorf("failed to get metadata of collection %q: %w", collection, err)
+	}
+	if err := json.Unmarshal(rawMeta, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse metadata of collection %q: %w", collection, err)
+	}
+	return meta, nil
+}
+
+// vectorBlob is a serialized vector. It implements driver.Valuer, as gorm would otherwise expand byte slices
+// into lists of values if their placeholder follows an opening parenthesis, e.g. in vec_quantize_binary(?).
+type vectorBlob []byte
+
+func (b vectorBlob) Value() (driver.Value, error) {
+	return []byte(b), nil
+}
+
+// fullTableName is the table holding the full precision embeddings of a quantized collection for rescoring.
+func fullTableName(collection string) string {
+	return fmt.Sprintf("[%s_full]", collection)
+}
+
+// vectorColumnType returns the vec0 column definition for embeddings with the given quantization.
+func vectorColumnType(q *vs.QuantizationConfig, dims int) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return fmt.Sprintf("int8[%d] distance_metric=cosine", dims)
+	case vs.QuantizationBinary:
+		return fmt.Sprintf("bit[%d]", dims) // always uses the hamming distance
+	default:
+		return fmt.Sprintf("float[%d] distance_metric=cosine", dims)
+	}
+}
+
+// quantizeExpr returns the SQL expression turning a serialized float32 vector parameter into the stored representation.
+// int8 quantization assumes the values to be in [-1, 1], so the parameter has to be prepared with quantizeInput.
+func quantizeExpr(q *vs.QuantizationConfig) string {
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		return "vec_quantize_int8(?, 'unit')"
+	case vs.QuantizationBinary:
+		return "vec_quantize_binary(?)"
+	default:
+		return "?"
+	}
+}
+
+// quantizeInput prepares a vector for quantizeExpr: vec_quantize_int8 clips values outside of [-1, 1], so vectors that
+// are quantized to int8 are normalized first. The other representations don't depend on the vector's length.
+func quantizeInput(q *vs.QuantizationConfig, v []float32) []float32 {
+	if quantizationType(q) == vs.QuantizationInt8 {
+		return vs.NormalizeVector(v)
+	}
+	return v
+}
+
+// distanceFunc returns the SQL function computing the distance between two stored vectors.
+func distanceFunc(q *vs.QuantizationConfig) string {
+	if quantizationType(q) == vs.QuantizationBinary {
+		return "vec_distance_hamming"
+	}
+	return "vec_distance_cosine"
+}
+
+// similarityFunc returns a function converting the distances returned for the (quantized) vectors into similarity scores
+// that are consistent with the other vector stores, i.e. the cosine similarity.
+func similarityFunc(q *vs.QuantizationConfig, dims int) func(distance float32) float32 {
+	if quantizationType(q) == vs.QuantizationBinary && !q.Rescore {
+		// The share of differing bits approximates the angle between the vectors (see SimHash)
+		return func(distance float32) float32 {
+			return float32(math.Cos(math.Pi * float64(distance) / float64(dims)))
+		}
+	}
+	return func(distance float32) float32 {
+		return 1 - distance
+	}
+}
+
+// storedVectorSize returns the size of a stored vector in bytes.
+func storedVectorSize(q *vs.QuantizationConfig, dims int) int64 {
+	var size int64
+	switch quantizationType(q) {
+	case vs.QuantizationInt8:
+		size = int64(dims)
+	case vs.QuantizationBinary:
+		size = int64(dims+7) / 8
+	default:
+		return int64(dims) * 4
+	}
+	if q.Rescore {
+		size += int64(dims) * 4
+	}
+	return size
+}
+
+func quantizationType(q *vs.QuantizationConfig) string {
+	if !q.Quantized() {
+		return vs.QuantizationNone
+	}
+	return q.Type
+}
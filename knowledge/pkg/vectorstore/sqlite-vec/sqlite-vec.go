@@ -2,13 +2,19 @@ package sqlite_vec
 
 import (
 	"context"
+	"database/sql"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	sqlitevec "github.com/asg017/sqlite-vec-go-bindings/ncruces"
+	"github.com/google/uuid"
 	dbtypes "github.com/gptscript-ai/knowledge/pkg/index/types"
 	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
 	cg "github.com/philippgille/chromem-go"
@@ -21,6 +27,8 @@ type VectorStore struct {
 	embeddingFunc       cg.EmbeddingFunc
 	db                  *gorm.DB
 	embeddingsTableName string
+	// collectionsTableName holds per-collection settings, like the quantization of the embeddings
+	collectionsTableName string
 }
 
 func New(ctx context.Context, dsn string, embeddingFunc cg.EmbeddingFunc) (*VectorStore, error) {
@@ -42,9 +50,10 @@ PRAGMA busy_timeout = 5000;
 	}
 
 	store := &VectorStore{
-		embeddingFunc:       embeddingFunc,
-		db:                  db,
-		embeddingsTableName: "knowledge_embeddings",
+		embeddingFunc:        embeddingFunc,
+		db:                   db,
+		embeddingsTableName:  "knowledge_embeddings",
+		collectionsTableName: "knowledge_collections",
 	}
 
 	var sqliteVersion, vecVersion string
@@ -79,6 +88,16 @@ func (v *VectorStore) prepareTables(ctx context.Context) error {
 		return fmt.Errorf("failed to create embeddings table %q: %w", v.embeddingsTableName, err)
 	}
 
+	err = v.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS [%s]
+		(
+			id TEXT PRIMARY KEY,
+			metadata JSON
+		)
+	`, v.collectionsTableName)).Error
+	if err != nil {
+		return fmt.Errorf("failed to create collections table %q: %w", v.collectionsTableName, err)
+	}
+
 	return nil
 }
 
@@ -89,27 +108,78 @@ func (v *VectorStore) CreateCollection(ctx context.Context, collection string, o
 	}
 	dimensionality := len(emb) // FIXME: somehow allow to pass this in or set it globally
 
-	err = v.db.Exec(fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS [%s_vec] USING
-	vec0(
-		document_id TEXT PRIMARY KEY,
-		embedding float[%d] distance_metric=cosine
-	)
-    `, collection, dimensionality)).Error
-
-	if err != nil {
-		return fmt.Errorf("failed to create vector table: %w", err)
+	var quantization *vs.QuantizationConfig
+	if opts != nil && opts.Quantization.Quantized() {
+		quantization = opts.Quantization
+		if err := quantization.Validate(); err != nil {
+			return err
+		}
+		if quantization.Type == vs.QuantizationBinary && dimensionality%8 != 0 {
+			return fmt.Errorf("binary quantization requires the number of dimensions to be a multiple of 8, got %d", dimensionality)
+		}
 	}
 
-	return nil
+	return v.db.Transaction(func(tx *gorm.DB) error {
+		var exists bool
+		if err := tx.Raw(`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`, collection+"_vec").Row().Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check for vector table: %w", err)
+		}
+		if exists {
+			return nil // keep the existing quantization
+		}
+
+		err := tx.Exec(fmt.Sprintf(`CREATE VIRTUAL TABLE [%s_vec] USING
+		vec0(
+			document_id TEXT PRIMARY KEY,
+			embedding %s
+		)
+		`, collection, vectorColumnType(quantization, dimensionality))).Error
+		if err != nil {
+			return fmt.Errorf("failed to create vector table: %w", err)
+		}
+
+		if quantization == nil {
+			return nil
+		}
+
+		if quantization.Rescore {
+			err = tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+			(
+				document_id TEXT PRIMARY KEY,
+				embedding BLOB NOT NULL
+			)
+			`, fullTableName(collection))).Error
+			if err != nil {
+				return fmt.Errorf("failed to create full precision embeddings table: %w", err)
+			}
+		}
+
+		meta, err := json.Marshal(collectionMetadata{Quantization: quantization})
+		if err != nil {
+			return fmt.Errorf("failed to marshal collection metadata: %w", err)
+		}
+		err = tx.Exec(fmt.Sprintf(`INSERT OR REPLACE INTO [%s] (id, metadata) VALUES (?, ?)`, v.collectionsTableName), collection, string(meta)).Error
+		if err != nil {
+			return fmt.Errorf("failed to store collection metadata: %w", err)
+		}
+		return nil
+	})
 }
 
 func (v *VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, collection string) ([]string, error) {
 	ids := make([]string, len(docs))
 
-	err := v.db.Transaction(func(tx *gorm.DB) error {
+	meta, err := v.getCollectionMetadata(collection)
+	if err != nil {
+		return nil, err
+	}
+	rescore := meta.Quantization.Quantized() && meta.Quantization.Rescore
+
+	err = v.db.Transaction(func(tx *gorm.DB) error {
 		if len(docs) > 0 {
 			valuePlaceholders := make([]string, len(docs))
 			args := make([]interface{}, 0, len(docs)*2) // 2 args per doc: document_id and embedding
+			var fullArgs []any
 
 			for i, doc := range docs {
 				emb, err := v.embeddingFunc(ctx, doc.Content)
@@ -121,9 +191,16 @@ func (v *VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, coll
 				if err != nil {
 					return fmt.Errorf("failed to serialize embedding for document %s: %w", doc.ID, err)
 				}
+				quantizedEmb, err := sqlitevec.SerializeFloat32(quantizeInput(meta.Quantization, emb))
+				if err != nil {
+					return fmt.Errorf("failed to serialize embedding for document %s: %w", doc.ID, err)
+				}
 
-				valuePlaceholders[i] = "(?, ?)"
-				args = append(args, doc.ID, serializedEmb)
+				valuePlaceholders[i] = fmt.Sprintf("(?, %s)", quantizeExpr(meta.Quantization))
+				args = append(args, doc.ID, vectorBlob(quantizedEmb))
+				if rescore {
+					fullArgs = append(fullArgs, doc.ID, serializedEmb)
+				}
 
 				ids[i] = doc.ID
 			}
@@ -137,6 +214,16 @@ func (v *VectorStore) AddDocuments(ctx context.Context, docs []vs.Document, coll
 			if err := tx.Exec(query, args...).Error; err != nil {
 				return fmt.Errorf("failed to batch insert into vector table: %w", err)
 			}
+
+			if rescore {
+				query := fmt.Sprintf(`
+					INSERT OR REPLACE INTO %s (document_id, embedding)
+					VALUES %s
+				`, fullTableName(collection), strings.Repeat("(?, ?), ", len(docs)-1)+"(?, ?)")
+				if err := tx.Exec(query, fullArgs...).Error; err != nil {
+					return fmt.Errorf("failed to batch insert into full precision embeddings table: %w", err)
+				}
+			}
 		}
 
 		embs := make([]map[string]interface{}, len(docs))
@@ -179,68 +266,174 @@ func (v *VectorStore) SimilaritySearch(ctx context.Context, query string, numDoc
 		return nil, fmt.Errorf("failed to compute embedding: %w", err)
 	}
 
-	qv, err := sqlitevec.SerializeFloat32(q)
+	meta, err := v.getCollectionMetadata(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	// the query is quantized like the documents, rescoring with the cosine distance doesn't depend on its length
+	qv, err := sqlitevec.SerializeFloat32(quantizeInput(meta.Quantization, q))
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize query embedding: %w", err)
 	}
 
-	var docs []vs.Document
-	err = v.db.Transaction(func(tx *gorm.DB) error {
-		// Query matching document IDs and distances
-		rows, err := tx.Raw(fmt.Sprintf(`
-            SELECT document_id, distance 
-            FROM [%s_vec]
-            WHERE embedding MATCH ? 
-            ORDER BY distance 
-            LIMIT ?
-        `, collection), qv, numDocuments).Rows()
+	accessQuery, accessArgs := buildAccessFilter(ctx)
+	filterQuery, filterArgs, err := buildFilter(where, whereDocument, accessQuery, accessArgs)
+	if err != nil {
+		return nil, err
+	}
+	filtered := len(where) > 0 || len(whereDocument) > 0 || accessQuery != "TRUE"
+
+	// Quantized collections with rescoring fetch more candidates, to re-rank them with full precision
+	k := meta.Quantization.Candidates(numDocuments)
+
+	return overFetch(k, numDocuments, filtered,
+		func(k int) ([]vs.Document, error) {
+			return v.knnSearch(ctx, qv, k, numDocuments, collection, meta.Quantization, filterQuery, filterArgs)
+		},
+		func() (int, error) {
+			var total int
+			if err := v.db.Raw(fmt.Sprintf(`SELECT COUNT(*) FROM [%s_vec]`, collection)).Row().Scan(&total); err != nil {
+				return 0, fmt.Errorf("failed to count documents: %w", err)
+			}
+			return total, nil
+		},
+		func() ([]vs.Document, error) {
+			// Too many candidates for a KNN query - compute exact distances for the matching documents instead
+			slog.Debug("sqlite-vec: falling back to exact search on filtered documents", "collection", collection)
+			return v.filteredSearch(ctx, qv, numDocuments, collection, meta.Quantization, filterQuery, filterArgs)
+		},
+	)
+}
+
+// overFetch runs the KNN search for k candidates and returns up to numDocuments of them. Filters are applied to the
+// KNN results, so we have to fetch more candidates than requested to still end up with numDocuments results when
+// filtering. If that's not enough, we keep increasing k until we've seen all (count) documents of the collection.
+// If k exceeds what a KNN query supports, the exact search is used instead.
+func overFetch(k, numDocuments int, filtered bool, knn func(k int) ([]vs.Document, error), count func() (int, error), exact func() ([]vs.Document, error)) ([]vs.Document, error) {
+	if filtered {
+		k *= filterOverFetchFactor
+	}
+
+	var total int
+	for {
+		if k > maxKNN {
+			return exact()
+		}
+
+		docs, err := knn(k)
 		if err != nil {
-			return fmt.Errorf("failed to query vector table: %w", err)
+			return nil, err
+		}
+		if len(docs) >= numDocuments || !filtered {
+			return docs, nil
 		}
-		defer rows.Close()
 
-		for rows.Next() {
-			var docID string
-			var distance float32
-			if err := rows.Scan(&docID, &distance); err != nil {
-				return fmt.Errorf("failed to scan row: %w", err)
+		if total == 0 {
+			if total, err = count(); err != nil {
+				return nil, err
 			}
-			docs = append(docs, vs.Document{
-				ID:              docID,
-				SimilarityScore: 1 - distance, // Higher score means closer match
-			})
+		}
+		if k >= total {
+			return docs, nil // all candidates seen, there just aren't more matching documents
 		}
 
-		// Fetch content and metadata for each document
-		for i, doc := range docs {
-			var content string
-			var metadataJSON []byte
-			err := tx.Raw(fmt.Sprintf(`
-                SELECT content, metadata 
-                FROM [%s]
-                WHERE id = ?
-            `, v.embeddingsTableName), doc.ID).Row().Scan(&content, &metadataJSON)
-			if err != nil {
-				return fmt.Errorf("failed to query embeddings table for document %s: %w", doc.ID, err)
-			}
+		k = min(k*filterOverFetchFactor, max(total, numDocuments))
+		slog.Debug("sqlite-vec: not enough documents matched the filters - increasing k", "found", len(docs), "k", k)
+	}
+}
 
-			var metadata map[string]interface{}
-			if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
-				return fmt.Errorf("failed to parse metadata for document %s: %w", doc.ID, err)
-			}
+const (
+	// filterOverFetchFactor is the factor by which the number of KNN candidates is increased when filtering
+	filterOverFetchFactor = 4
+	// maxKNN is the maximum k supported by sqlite-vec KNN queries
+	maxKNN = 4096
+)
 
-			docs[i].Content = content
-			docs[i].Metadata = metadata
-		}
+// knnSearch runs a KNN query for the k nearest neighbors and returns up to limit of those that match the filter,
+// joined with their content and metadata. If the collection is quantized with rescoring, the candidates are
+// re-ranked by the distance of their full precision embeddings.
+func (v *VectorStore) knnSearch(ctx context.Context, qv []byte, k, limit int, collection string, quantization *vs.QuantizationConfig, filterQuery string, filterArgs []any) ([]vs.Document, error) {
+	args := []any{vectorBlob(qv), k}
+	distanceExpr, rescoreJoin := "knn.distance", ""
+	if quantization.Quantized() && quantization.Rescore {
+		distanceExpr = "vec_distance_cosine(f.embedding, ?)"
+		rescoreJoin = fmt.Sprintf("JOIN %s f ON f.document_id = knn.document_id", fullTableName(collection))
+		args = append(args, qv)
+	}
 
-		return nil
-	})
+	query := fmt.Sprintf(`
+		WITH knn AS (
+			SELECT document_id, distance
+			FROM [%s_vec]
+			WHERE embedding MATCH %s AND k = ?
+		)
+		SELECT e.id, e.content, e.metadata, %s AS distance
+		FROM knn
+		JOIN [%s] e ON e.id = knn.document_id
+		%s
+		WHERE e.collection_id = ? AND %s
+		ORDER BY distance
+		LIMIT ?
+	`, collection, quantizeExpr(quantization), distanceExpr, v.embeddingsTableName, rescoreJoin, filterQuery)
+
+	args = append(args, collection)
+	args = append(args, filterArgs...)
+	args = append(args, limit)
+
+	return v.scanSearchResults(ctx, query, args, similarityFunc(quantization, len(qv)/4))
+}
+
+// filteredSearch computes the distances of all documents that match the filter and returns the limit closest ones.
+// Quantized collections with rescoring use the full precision embeddings, so the results are exact.
+func (v *VectorStore) filteredSearch(ctx context.Context, qv []byte, limit int, collection string, quantization *vs.QuantizationConfig, filterQuery string, filterArgs []any) ([]vs.Document, error) {
+	distanceExpr := fmt.Sprintf("%s(vec.embedding, %s)", distanceFunc(quantization), quantizeExpr(quantization))
+	join := fmt.Sprintf("JOIN [%s_vec] vec ON vec.document_id = e.id", collection)
+	if quantization.Quantized() && quantization.Rescore {
+		distanceExpr = "vec_distance_cosine(f.embedding, ?)"
+		join = fmt.Sprintf("JOIN %s f ON f.document_id = e.id", fullTableName(collection))
+	}
 
+	query := fmt.Sprintf(`
+		SELECT e.id, e.content, e.metadata, %s AS distance
+		FROM [%s] e
+		%s
+		WHERE e.collection_id = ? AND %s
+		ORDER BY distance
+		LIMIT ?
+	`, distanceExpr, v.embeddingsTableName, join, filterQuery)
+
+	args := append([]any{vectorBlob(qv), collection}, filterArgs...)
+	args = append(args, limit)
+
+	return v.scanSearchResults(ctx, query, args, similarityFunc(quantization, len(qv)/4))
+}
+
+func (v *VectorStore) scanSearchResults(ctx context.Context, query string, args []any, similarity func(distance float32) float32) ([]vs.Document, error) {
+	rows, err := v.db.WithContext(ctx).Raw(query, args...).Rows()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to query documents: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []vs.Document
+	for rows.Next() {
+		var (
+			doc          vs.Document
+			metadataJSON []byte
+			distance     float32
+		)
+		if err := rows.Scan(&doc.ID, &doc.Content, &metadataJSON, &distance); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := json.Unmarshal(metadataJSON, &doc.Metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata for document %s: %w", doc.ID, err)
+		}
+		doc.SimilarityScore = similarity(distance) // Higher score means closer match
+		docs = append(docs, doc)
 	}
 
-	return docs, nil
+	return docs, rows.Err()
 }
 
 func (v *VectorStore) RemoveCollection(ctx context.Context, collection string) error {
@@ -249,40 +442,44 @@ func (v *VectorStore) RemoveCollection(ctx context.Context, collection string) e
 		return fmt.Errorf("failed to drop table: %w", err)
 	}
 
+	err = v.db.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, fullTableName(collection))).Error
+	if err != nil {
+		return fmt.Errorf("failed to drop table: %w", err)
+	}
+
 	err = v.db.Exec(fmt.Sprintf(`DELETE FROM [%s] WHERE collection_id = ?`, v.embeddingsTableName), collection).Error
 	if err != nil {
 		return fmt.Errorf("failed to delete documents: %w", err)
 	}
 
+	err = v.db.Exec(fmt.Sprintf(`DELETE FROM [%s] WHERE id = ?`, v.collectionsTableName), collection).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete collection metadata: %w", err)
+	}
+
 	return nil
 }
 
 func (v *VectorStore) RemoveDocument(ctx context.Context, documentID string, collection string, where map[string]string, whereDocument []cg.WhereDocument) error {
-	if len(whereDocument) > 0 {
-		return fmt.Errorf("sqlite-vec does not support whereDocument")
-	}
-
 	var ids []string
 
-	err := v.db.Transaction(func(tx *gorm.DB) error {
-		if len(where) > 0 {
-			whereQueries := make([]string, 0)
-			for k, v := range where {
-				if strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
-					continue
-				}
-				whereQueries = append(whereQueries, fmt.Sprintf("(metadata ->> '$.%s') = '%s'", k, v))
-			}
-			whereQuery := strings.Join(whereQueries, " AND ")
-			if len(whereQuery) == 0 {
-				whereQuery = "TRUE"
+	meta, err := v.getCollectionMetadata(collection)
+	if err != nil {
+		return err
+	}
+
+	err = v.db.Transaction(func(tx *gorm.DB) error {
+		if len(where) > 0 || len(whereDocument) > 0 {
+			filterQuery, filterArgs, err := buildFilter(where, whereDocument, "TRUE", nil)
+			if err != nil {
+				return err
 			}
 
-			err := tx.Raw(fmt.Sprintf(`
+			err = tx.Raw(fmt.Sprintf(`
                 SELECT id 
                 FROM [%s]
                 WHERE collection_id = ? AND %s
-            `, v.embeddingsTableName, whereQuery), collection).Scan(&ids).Error
+            `, v.embeddingsTableName, filterQuery), append([]any{collection}, filterArgs...)...).Scan(&ids).Error
 			if err != nil {
 				return fmt.Errorf("failed to query IDs: %w", err)
 			}
@@ -300,6 +497,12 @@ func (v *VectorStore) RemoveDocument(ctx context.Context, documentID string, col
 			return fmt.Errorf("failed to delete documents from vector table: %w", err)
 		}
 
+		if meta.Quantization.Quantized() && meta.Quantization.Rescore {
+			if err := tx.Table(fmt.Sprintf("%s_full", collection)).Where("document_id IN ?", ids).Delete(nil).Error; err != nil {
+				return fmt.Errorf("failed to delete documents from full precision embeddings table: %w", err)
+			}
+		}
+
 		if err := tx.Table(v.embeddingsTableName).Where("id IN ?", ids).Delete(nil).Error; err != nil {
 			return fmt.Errorf("failed to delete documents from embeddings table: %w", err)
 		}
@@ -315,34 +518,20 @@ func (v *VectorStore) RemoveDocument(ctx context.Context, documentID string, col
 }
 
 func (v *VectorStore) GetDocuments(ctx context.Context, collection string, where map[string]string, whereDocument []cg.WhereDocument) ([]vs.Document, error) {
-	if len(whereDocument) > 0 {
-		return nil, fmt.Errorf("sqlite-vec does not support whereDocument")
-	}
-
 	var docs []vs.Document
 
-	// Build metadata filter query
-	whereQueries := []string{}
-	args := []interface{}{collection}
-
-	for k, v := range where {
-		if strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
-			continue
-		}
-		whereQueries = append(whereQueries, fmt.Sprintf("(metadata ->> '$.%s') = ?", k))
-		args = append(args, v)
-	}
-
-	whereQuery := strings.Join(whereQueries, " AND ")
-	if len(whereQuery) > 0 {
-		whereQuery = " AND " + whereQuery
+	accessQuery, accessArgs := buildAccessFilter(ctx)
+	filterQuery, filterArgs, err := buildFilter(where, whereDocument, accessQuery, accessArgs)
+	if err != nil {
+		return nil, err
 	}
+	args := append([]any{collection}, filterArgs...)
 
 	query := fmt.Sprintf(`
         SELECT id, content, metadata
         FROM [%s]
-        WHERE collection_id = ?%s
-    `, v.embeddingsTableName, whereQuery)
+        WHERE collection_id = ? AND %s
+    `, v.embeddingsTableName, filterQuery)
 
 	rows, err := v.db.Raw(query, args...).Rows()
 	if err != nil {
@@ -369,6 +558,147 @@ func (v *VectorStore) GetDocuments(ctx context.Context, collection string, where
 	return docs, nil
 }
 
+// GetEmbeddings returns the full precision embeddings of the given documents by their ID.
+// Quantized collections only keep them if they're rescored.
+func (v *VectorStore) GetEmbeddings(ctx context.Context, collection string, ids []string) (map[string][]float32, error) {
+	meta, err := v.getCollectionMetadata(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	embeddings := make(map[string][]float32, len(ids))
+	if len(ids) == 0 {
+		return embeddings, nil
+	}
+
+	table := fmt.Sprintf("[%s_vec]", collection)
+	if meta.Quantization.Quantized() {
+		if !meta.Quantization.Rescore {
+			return embeddings, nil
+		}
+		table = fullTableName(collection)
+	}
+
+	rows, err := v.db.WithContext(ctx).Raw(fmt.Sprintf(`SELECT document_id, vec_to_json(embedding) FROM %s WHERE document_id IN ?`, table), ids).Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, embeddingJSON string
+		if err := rows.Scan(&id, &embeddingJSON); err != nil {
+			return nil, err
+		}
+		var embedding []float32
+		if err := json.Unmarshal([]byte(embeddingJSON), &embedding); err != nil {
+			return nil, fmt.Errorf("failed to decode embedding of document %s: %w", id, err)
+		}
+		embeddings[id] = embedding
+	}
+	return embeddings, rows.Err()
+}
+
+// CopyDocuments copies the given (or all) documents with their stored embeddings into the target collection.
+// Document IDs are unique across collections, so the copies get new IDs.
+func (v *VectorStore) CopyDocuments(ctx context.Context, source, target string, ids []string) (map[string]string, error) {
+	srcMeta, err := v.getCollectionMetadata(source)
+	if err != nil {
+		return nil, err
+	}
+	dstMeta, err := v.getCollectionMetadata(target)
+	if err != nil {
+		return nil, err
+	}
+	if quantizationType(srcMeta.Quantization) != quantizationType(dstMeta.Quantization) || srcMeta.Quantization.Quantized() && srcMeta.Quantization.Rescore != dstMeta.Quantization.Rescore {
+		return nil, fmt.Errorf("cannot copy documents from collection %q to %q: the quantization differs", source, target)
+	}
+	rescore := srcMeta.Quantization.Quantized() && srcMeta.Quantization.Rescore
+
+	var srcIDs []string
+	if err := v.db.WithContext(ctx).Table(v.embeddingsTableName).Where("collection_id = ?", source).Pluck("id", &srcIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query IDs: %w", err)
+	}
+	if len(ids) > 0 {
+		selected := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			selected[id] = true
+		}
+		srcIDs = slices.DeleteFunc(srcIDs, func(id string) bool { return !selected[id] })
+	}
+
+	copied := make(map[string]string, len(srcIDs))
+	err = v.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, id := range srcIDs {
+			newID := uuid.NewString()
+
+			// Raw queries for *_vec as gorm doesn't support virtual tables
+			err := tx.Exec(fmt.Sprintf(`INSERT INTO [%s_vec] (document_id, embedding) SELECT ?, embedding FROM [%s_vec] WHERE document_id = ?`, target, source), newID, id).Error
+			if err != nil {
+				return fmt.Errorf("failed to copy embedding of document %s: %w", id, err)
+			}
+
+			if rescore {
+				err := tx.Exec(fmt.Sprintf(`INSERT INTO %s (document_id, embedding) SELECT ?, embedding FROM %s WHERE document_id = ?`, fullTableName(target), fullTableName(source)), newID, id).Error
+				if err != nil {
+					return fmt.Errorf("failed to copy full precision embedding of document %s: %w", id, err)
+				}
+			}
+
+			err = tx.Exec(fmt.Sprintf(`INSERT INTO [%[1]s] (id, collection_id, content, metadata) SELECT ?, ?, content, metadata FROM [%[1]s] WHERE id = ?`, v.embeddingsTableName), newID, target, id).Error
+			if err != nil {
+				return fmt.Errorf("failed to copy document %s: %w", id, err)
+			}
+
+			copied[id] = newID
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+var vecDimensionsRegex = regexp.MustCompile(`(?:float|int8|bit)\[(\d+)\]`)
+
+func (v *VectorStore) CollectionStats(ctx context.Context, collection string) (*vs.CollectionStats, error) {
+	var tableSQL string
+	err := v.db.Raw(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`, collection+"_vec").Row().Scan(&tableSQL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// a dataset doesn't necessarily have a collection, e.g. if it was created with another vector store
+			return &vs.CollectionStats{}, nil
+		}
+		return nil, fmt.Errorf("failed to get vector table definition: %w", err)
+	}
+
+	stats := &vs.CollectionStats{}
+	if m := vecDimensionsRegex.FindStringSubmatch(tableSQL); m != nil {
+		stats.Dimensions, _ = strconv.Atoi(m[1])
+	}
+
+	var contentSize sql.NullInt64
+	err = v.db.Raw(fmt.Sprintf(`
+		SELECT COUNT(*), SUM(length(id) + length(content) + length(metadata))
+		FROM [%s]
+		WHERE collection_id = ?
+	`, v.embeddingsTableName), collection).Row().Scan(&stats.Documents, &contentSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collection stats: %w", err)
+	}
+
+	meta, err := v.getCollectionMetadata(collection)
+	if err != nil {
+		return nil, err
+	}
+	stats.Quantization = meta.Quantization
+	stats.SizeBytes = contentSize.Int64 + int64(stats.Documents)*storedVectorSize(meta.Quantization, stats.Dimensions)
+
+	return stats, nil
+}
+
 func (v *VectorStore) ImportCollectionsFromFile(ctx context.Context, path string, collections ...string) error {
 	return fmt.Errorf("not implemented")
 }
@@ -376,3 +706,19 @@ func (v *VectorStore) ImportCollectionsFromFile(ctx context.Context, path string
 func (v *VectorStore) ExportCollectionsToFile(ctx context.Context, path string, collections ...string) error {
 	return fmt.Errorf("not implemented")
 }
+
+// buildAccessFilter returns an SQL predicate (and its arguments) on the metadata column that only matches documents
+// readable by the principals set in the context. If there's no access filter in the context, the predicate is always true.
+func buildAccessFilter(ctx context.Context) (string, []any) {
+	principals, ok := vs.AccessFilterFromCtx(ctx)
+	if !ok {
+		return "TRUE", nil
+	}
+	clauses := []string{fmt.Sprintf("COALESCE(metadata ->> '$.%s', '') = ''", vs.DocMetadataKeyACLPrincipals)}
+	args := make([]any, 0, len(principals))
+	for _, p := range principals {
+		clauses = append(clauses, fmt.Sprintf("instr(metadata ->> '$.%s', ?) > 0", vs.DocMetadataKeyACLPrincipals))
+		args = append(args, vs.ACLPrincipalToken(p))
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
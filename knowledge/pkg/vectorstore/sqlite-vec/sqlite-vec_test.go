@@ -0,0 +1,361 @@
+package sqlite_vec
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlitevec "github.com/asg017/sqlite-vec-go-bindings/ncruces"
+	dbtypes "github.com/gptscript-ai/knowledge/pkg/index/types"
+	vs "github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
+	cg "github.com/philippgille/chromem-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEmbeddingFunc maps "doc-<n>" (and "query") to a point on a line, so that the distance to the query grows with n.
+func testEmbeddingFunc(_ context.Context, text string) ([]float32, error) {
+	var n int
+	if _, err := fmt.Sscanf(text, "doc-%d", &n); err != nil {
+		return []float32{1, 0, 0}, nil
+	}
+	return []float32{1, float32(n) / 10, 0}, nil
+}
+
+func newTestStore(t *testing.T, numDocs int) *VectorStore {
+	t.Helper()
+	ctx := context.Background()
+
+	store, err := New(ctx, "sqlite-vec://"+filepath.Join(t.TempDir(), "vec.db"), testEmbeddingFunc)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	require.NoError(t, store.CreateCollection(ctx, "test", nil))
+
+	docs := make([]vs.Document, numDocs)
+	for i := range docs {
+		content := fmt.Sprintf("doc-%d", i)
+		if i%10 == 9 {
+			content += " needle"
+		}
+		docs[i] = vs.Document{
+			ID:      fmt.Sprintf("id-%d", i),
+			Content: content,
+			Metadata: map[string]any{
+				"group": fmt.Sprintf("g%d", i%3),
+				"num":   i,
+				"even":  i%2 == 0,
+			},
+		}
+	}
+	_, err = store.AddDocuments(ctx, docs, "test")
+	require.NoError(t, err)
+
+	return store
+}
+
+func TestFilteredSearch(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, 100)
+
+	qv, err := sqlitevec.SerializeFloat32([]float32{1, 0, 0})
+	require.NoError(t, err)
+
+	search := func(limit int, where map[string]string, whereDocument []cg.WhereDocument) []string {
+		t.Helper()
+		filterQuery, filterArgs, err := buildFilter(where, whereDocument, "TRUE", nil)
+		require.NoError(t, err)
+		docs, err := store.filteredSearch(ctx, qv, limit, "test", nil, filterQuery, filterArgs)
+		require.NoError(t, err)
+		ids := make([]string, len(docs))
+		for i, doc := range docs {
+			ids[i] = doc.ID
+			assert.NotEmpty(t, doc.Metadata)
+		}
+		return ids
+	}
+
+	// Nearest documents first
+	assert.Equal(t, []string{"id-0", "id-1", "id-2"}, search(3, nil, nil))
+
+	// Keyword filter: the matching documents are far away from the query, but we still get all of them
+	assert.Equal(t, []string{"id-9", "id-19", "id-29"}, search(3, nil, []cg.WhereDocument{{Operator: cg.WhereDocumentOperatorContains, Value: "needle"}}))
+
+	// Nested keyword filters
+	assert.Equal(t, []string{"id-5", "id-7", "id-50"}, search(3, nil, []cg.WhereDocument{
+		{Operator: cg.WhereDocumentOperatorOr, WhereDocuments: []cg.WhereDocument{
+			{Operator: cg.WhereDocumentOperatorContains, Value: "doc-5"},
+			{Operator: cg.WhereDocumentOperatorContains, Value: "doc-7"},
+		}},
+		{Operator: cg.WhereDocumentOperatorNotContains, Value: "needle"},
+	}))
+
+	// Metadata filters on string, number and boolean values
+	assert.Equal(t, []string{"id-2", "id-8"}, search(2, map[string]string{"group": "g2", "even": "true"}, nil))
+	assert.Equal(t, []string{"id-42"}, search(5, map[string]string{"num": "42"}, nil))
+	assert.Empty(t, search(5, map[string]string{"group": "nope"}, nil))
+
+	// Invalid whereDocument
+	_, _, err = buildFilter(nil, []cg.WhereDocument{{Operator: "$regex", Value: "x"}}, "TRUE", nil)
+	assert.Error(t, err)
+}
+
+// TestOverFetch runs the over-fetching of SimilaritySearch on a simulated KNN query, since sqlite-vec's KNN queries
+// can't run in every environment: the k nearest neighbors are searched exactly and the filter is applied to them.
+func TestOverFetch(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, 100)
+
+	qv, err := sqlitevec.SerializeFloat32([]float32{1, 0, 0})
+	require.NoError(t, err)
+
+	var ks []int
+	knn := func(numDocuments int, match func(vs.Document) bool) func(k int) ([]vs.Document, error) {
+		return func(k int) ([]vs.Document, error) {
+			ks = append(ks, k)
+			candidates, err := store.filteredSearch(ctx, qv, k, "test", nil, "TRUE", nil)
+			if err != nil {
+				return nil, err
+			}
+			var docs []vs.Document
+			for _, doc := range candidates {
+				if match(doc) && len(docs) < numDocuments {
+					docs = append(docs, doc)
+				}
+			}
+			return docs, nil
+		}
+	}
+	count := func() (int, error) { return 100, nil }
+	exact := func() ([]vs.Document, error) { return nil, fmt.Errorf("unexpected exact search") }
+	needle := func(doc vs.Document) bool { return strings.Contains(doc.Content, "needle") }
+
+	// The filter rejects 9 of 10 nearest neighbors, so k is increased until there are enough results
+	ks = nil
+	docs, err := overFetch(5, 5, true, knn(5, needle), count, exact)
+	require.NoError(t, err)
+	require.Len(t, docs, 5)
+	assert.Equal(t, "id-49", docs[4].ID)
+	assert.Equal(t, []int{20, 80}, ks)
+
+	// Not enough matching documents: stop once all documents were candidates
+	ks = nil
+	docs, err = overFetch(5, 5, true, knn(5, func(doc vs.Document) bool { return doc.ID == "id-99" }), count, exact)
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, []int{20, 80, 100}, ks)
+
+	// Without filters, the first KNN search is final
+	ks = nil
+	docs, err = overFetch(5, 5, false, knn(5, func(vs.Document) bool { return true }), count, exact)
+	require.NoError(t, err)
+	require.Len(t, docs, 5)
+	assert.Equal(t, []int{5}, ks)
+
+	// Too many candidates for a KNN query: exact search
+	ks = nil
+	_, err = overFetch(maxKNN, 5, true, knn(5, needle), count, exact)
+	require.ErrorContains(t, err, "unexpected exact search")
+	assert.Empty(t, ks)
+}
+
+func TestGetDocumentsFilters(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, 30)
+
+	docs, err := store.GetDocuments(ctx, "test", map[string]string{"group": "g0"}, []cg.WhereDocument{{Operator: cg.WhereDocumentOperatorContains, Value: "needle"}})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "id-9", docs[0].ID)
+
+	require.NoError(t, store.RemoveDocument(ctx, "", "test", nil, []cg.WhereDocument{{Operator: cg.WhereDocumentOperatorContains, Value: "needle"}}))
+	docs, err = store.GetDocuments(ctx, "test", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, docs, 27)
+}
+
+// randomEmbeddingFunc derives a pseudo-random (but deterministic) unit vector from the first word of the text.
+func randomEmbeddingFunc(_ context.Context, text string) ([]float32, error) {
+	var word string
+	_, _ = fmt.Sscanf(text, "%s", &word)
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(word))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+	vec := make([]float32, 64)
+	var norm float64
+	for i := range vec {
+		vec[i] = rng.Float32()*2 - 1
+		norm += float64(vec[i] * vec[i])
+	}
+	for i := range vec {
+		vec[i] /= float32(math.Sqrt(norm))
+	}
+	return vec, nil
+}
+
+func TestQuantization(t *testing.T) {
+	ctx := context.Background()
+
+	for _, q := range []vs.QuantizationConfig{
+		{Type: vs.QuantizationInt8},
+		{Type: vs.QuantizationBinary},
+		{Type: vs.QuantizationBinary, Rescore: true},
+	} {
+		t.Run(fmt.Sprintf("%s-rescore=%t", q.Type, q.Rescore), func(t *testing.T) {
+			store, err := New(ctx, "sqlite-vec://"+filepath.Join(t.TempDir(), "vec.db"), randomEmbeddingFunc)
+			require.NoError(t, err)
+			defer store.Close()
+
+			require.NoError(t, store.CreateCollection(ctx, "test", &dbtypes.DatasetCreateOpts{Quantization: &q}))
+
+			docs := make([]vs.Document, 50)
+			for i := range docs {
+				docs[i] = vs.Document{ID: fmt.Sprintf("id-%d", i), Content: fmt.Sprintf("doc-%d", i), Metadata: map[string]any{}}
+			}
+			_, err = store.AddDocuments(ctx, docs, "test")
+			require.NoError(t, err)
+
+			emb, _ := randomEmbeddingFunc(ctx, "doc-7")
+			qv, err := sqlitevec.SerializeFloat32(emb)
+			require.NoError(t, err)
+
+			meta, err := store.getCollectionMetadata("test")
+			require.NoError(t, err)
+			require.Equal(t, q.Type, meta.Quantization.Type)
+
+			res, err := store.filteredSearch(ctx, qv, 3, "test", meta.Quantization, "TRUE", nil)
+			require.NoError(t, err)
+			require.Len(t, res, 3)
+			assert.Equal(t, "id-7", res[0].ID)
+			assert.InDelta(t, 1, res[0].SimilarityScore, 0.02)
+
+			stats, err := store.CollectionStats(ctx, "test")
+			require.NoError(t, err)
+			assert.Equal(t, 64, stats.Dimensions)
+			assert.Equal(t, q.Type, stats.Quantization.Type)
+
+			require.NoError(t, store.RemoveDocument(ctx, "id-7", "test", nil, nil))
+			res, err = store.filteredSearch(ctx, qv, 1, "test", meta.Quantization, "TRUE", nil)
+			require.NoError(t, err)
+			assert.NotEqual(t, "id-7", res[0].ID)
+
+			require.NoError(t, store.RemoveCollection(ctx, "test"))
+			meta, err = store.getCollectionMetadata("test")
+			require.NoError(t, err)
+			assert.Nil(t, meta.Quantization)
+		})
+	}
+}
+
+func TestCollectionStatsMissingCollection(t *testing.T) {
+	ctx := context.Background()
+	store, err := New(ctx, "sqlite-vec://"+filepath.Join(t.TempDir(), "vec.db"), randomEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+
+	stats, err := store.CollectionStats(ctx, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, &vs.CollectionStats{}, stats)
+}
+
+func TestQuantizationUnnormalized(t *testing.T) {
+	ctx := context.Background()
+	// embeddings that aren't normalized would be clipped by the int8 quantization
+	scaledEmbeddingFunc := func(ctx context.Context, text string) ([]float32, error) {
+		emb, err := randomEmbeddingFunc(ctx, text)
+		for i := range emb {
+			emb[i] *= 10
+		}
+		return emb, err
+	}
+	store, err := New(ctx, "sqlite-vec://"+filepath.Join(t.TempDir(), "vec.db"), scaledEmbeddingFunc)
+	require.NoError(t, err)
+	defer store.Close()
+
+	q := &vs.QuantizationConfig{Type: vs.QuantizationInt8}
+	require.NoError(t, store.CreateCollection(ctx, "test", &dbtypes.DatasetCreateOpts{Quantization: q}))
+	docs := make([]vs.Document, 20)
+	for i := range docs {
+		docs[i] = vs.Document{ID: fmt.Sprintf("doc-%d", i), Content: fmt.Sprintf("doc-%d", i), Metadata: map[string]any{}}
+	}
+	_, err = store.AddDocuments(ctx, docs, "test")
+	require.NoError(t, err)
+
+	query, _ := scaledEmbeddingFunc(ctx, "doc-3")
+	qv, err := sqlitevec.SerializeFloat32(quantizeInput(q, query))
+	require.NoError(t, err)
+	res, err := store.filteredSearch(ctx, qv, len(docs), "test", q, "TRUE", nil)
+	require.NoError(t, err)
+	require.Len(t, res, len(docs))
+	assert.Equal(t, "doc-3", res[0].ID)
+
+	// the scores are close to the cosine similarities of the full precision embeddings
+	normalizedQuery, _ := randomEmbeddingFunc(ctx, "doc-3")
+	for _, doc := range res {
+		emb, _ := randomEmbeddingFunc(ctx, doc.ID)
+		var cosine float64
+		for i := range emb {
+			cosine += float64(emb[i]) * float64(normalizedQuery[i])
+		}
+		assert.InDelta(t, cosine, doc.SimilarityScore, 0.02, doc.ID)
+	}
+}
+
+func TestCopyDocuments(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, 20)
+	require.NoError(t, store.CreateCollection(ctx, "copy", nil))
+
+	copied, err := store.CopyDocuments(ctx, "test", "copy", []string{"id-1", "id-2", "id-3"})
+	require.NoError(t, err)
+	require.Len(t, copied, 3)
+	for old, id := range copied {
+		assert.NotEqual(t, old, id, "document IDs are unique across collections")
+	}
+
+	docs, err := store.GetDocuments(ctx, "copy", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+
+	// The embeddings were copied along, so the copies are ranked like the originals
+	qv, err := sqlitevec.SerializeFloat32([]float32{1, 0, 0})
+	require.NoError(t, err)
+	found, err := store.filteredSearch(ctx, qv, 1, "copy", nil, "TRUE", nil)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, copied["id-1"], found[0].ID)
+	assert.Equal(t, "doc-1", found[0].Content)
+
+	// The source collection is unchanged
+	docs, err = store.GetDocuments(ctx, "test", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, docs, 20)
+
+	require.NoError(t, store.CreateCollection(ctx, "quantized", &dbtypes.DatasetCreateOpts{Quantization: &vs.QuantizationConfig{Type: vs.QuantizationInt8}}))
+	_, err = store.CopyDocuments(ctx, "test", "quantized", nil)
+	assert.ErrorContains(t, err, "quantization differs")
+}
+
+func TestGetEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, 5)
+
+	embeddings, err := store.GetEmbeddings(ctx, "test", []string{"id-1", "id-3", "missing"})
+	require.NoError(t, err)
+	require.Len(t, embeddings, 2)
+
+	expected, err := testEmbeddingFunc(ctx, "doc-1")
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, expected, embeddings["id-1"], 1e-6)
+
+	// Quantized embeddings without rescoring aren't returned
+	require.NoError(t, store.CreateCollection(ctx, "quantized", &dbtypes.DatasetCreateOpts{Quantization: &vs.QuantizationConfig{Type: vs.QuantizationInt8}}))
+	embeddings, err = store.GetEmbeddings(ctx, "quantized", []string{"id-1"})
+	require.NoError(t, err)
+	assert.Empty(t, embeddings)
+}
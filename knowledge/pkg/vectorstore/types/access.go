@@ -0,0 +1,67 @@
+package types
+
+import (
+	"context"
+	"strings"
+)
+
+// DocMetadataKeyACLPrincipals holds the principals that may read a document, encoded by EncodeACLPrincipals.
+// Documents without this key are readable by everyone.
+const DocMetadataKeyACLPrincipals = "aclPrincipals"
+
+type accessFilterKey struct{}
+
+// WithAccessFilter returns a context that makes vector stores only return documents readable by any of the given principals.
+func WithAccessFilter(ctx context.Context, principals []string) context.Context {
+	if principals == nil {
+		principals = []string{}
+	}
+	return context.WithValue(ctx, accessFilterKey{}, principals)
+}
+
+// AccessFilterFromCtx returns the principals set via WithAccessFilter.
+// The second return value is false if no access filter should be applied.
+func AccessFilterFromCtx(ctx context.Context) ([]string, bool) {
+	principals, ok := ctx.Value(accessFilterKey{}).([]string)
+	return principals, ok
+}
+
+// aclPrincipalEscaper escapes the separator and the SQL wildcard characters in principals, so that a principal
+// can neither span several entries nor match other principals in an encoded principals string.
+var aclPrincipalEscaper = strings.NewReplacer("%", "%25", ",", "%2C", "_", "%5F")
+
+// EncodeACLPrincipals encodes principals into a single string, so that it can be stored in flat metadata maps
+// and matched with a simple substring check (see ACLPrincipalToken).
+func EncodeACLPrincipals(principals []string) string {
+	if len(principals) == 0 {
+		return ""
+	}
+	escaped := make([]string, len(principals))
+	for i, p := range principals {
+		escaped[i] = aclPrincipalEscaper.Replace(p)
+	}
+	return "," + strings.Join(escaped, ",") + ","
+}
+
+// ACLPrincipalToken returns the token to look for in an encoded principals string.
+func ACLPrincipalToken(principal string) string {
+	return "," + aclPrincipalEscaper.Replace(principal) + ","
+}
+
+// DocumentAllowed returns true if the document metadata grants access to any of the given principals.
+func DocumentAllowed(metadata map[string]any, principals []string) bool {
+	v, ok := metadata[DocMetadataKeyACLPrincipals]
+	if !ok || v == nil {
+		return true
+	}
+	encoded, ok := v.(string)
+	if !ok || encoded == "" {
+		return true
+	}
+	for _, p := range principals {
+		if strings.Contains(encoded, ACLPrincipalToken(p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Approximate nearest neighbor (ANN) index types
+const (
+	IndexTypeNone    = "none"
+	IndexTypeHNSW    = "hnsw"
+	IndexTypeIVFFlat = "ivfflat"
+)
+
+// Distance metrics
+const (
+	DistanceCosine       = "cosine"
+	DistanceInnerProduct = "ip"
+	DistanceL2           = "l2"
+)
+
+// IndexConfig configures the ANN index and distance metric of a collection, for vector stores that support it.
+// Zero values mean "use the default".
+type IndexConfig struct {
+	Type     string `json:"type,omitempty"`
+	Distance string `json:"distance,omitempty"`
+	// HNSW: max. number of connections per layer, size of the candidate list when building and when searching
+	M              int `json:"m,omitempty"`
+	EfConstruction int `json:"efConstruction,omitempty"`
+	EfSearch       int `json:"efSearch,omitempty"`
+	// IVFFlat: number of lists when building and number of lists to search
+	Lists  int `json:"lists,omitempty"`
+	Probes int `json:"probes,omitempty"`
+}
+
+// Merge returns a copy of the config with all non-zero fields of the override applied.
+func (c IndexConfig) Merge(override *IndexConfig) IndexConfig {
+	if override == nil {
+		return c
+	}
+	if override.Type != "" {
+		c.Type = override.Type
+	}
+	if override.Distance != "" {
+		c.Distance = override.Distance
+	}
+	if override.M > 0 {
+		c.M = override.M
+	}
+	if override.EfConstruction > 0 {
+		c.EfConstruction = override.EfConstruction
+	}
+	if override.EfSearch > 0 {
+		c.EfSearch = override.EfSearch
+	}
+	if override.Lists > 0 {
+		c.Lists = override.Lists
+	}
+	if override.Probes > 0 {
+		c.Probes = override.Probes
+	}
+	return c
+}
+
+// Validate normalizes the index type and distance names and checks them.
+func (c *IndexConfig) Validate() error {
+	c.Type = strings.ToLower(c.Type)
+	switch c.Type {
+	case "":
+		c.Type = IndexTypeNone
+	case IndexTypeNone, IndexTypeHNSW, IndexTypeIVFFlat:
+	default:
+		return fmt.Errorf("unsupported index type %q (supported: %s, %s, %s)", c.Type, IndexTypeNone, IndexTypeHNSW, IndexTypeIVFFlat)
+	}
+
+	c.Distance = strings.ToLower(c.Distance)
+	switch c.Distance {
+	case "":
+		c.Distance = DistanceCosine
+	case "inner_product", "inner-product", "dot":
+		c.Distance = DistanceInnerProduct
+	case "euclidean":
+		c.Distance = DistanceL2
+	case DistanceCosine, DistanceInnerProduct, DistanceL2:
+	default:
+		return fmt.Errorf("unsupported distance %q (supported: %s, %s, %s)", c.Distance, DistanceCosine, DistanceInnerProduct, DistanceL2)
+	}
+
+	if c.M < 0 || c.EfConstruction < 0 || c.EfSearch < 0 || c.Lists < 0 || c.Probes < 0 {
+		return fmt.Errorf("index parameters must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Vector quantization types
+const (
+	// QuantizationNone stores full precision float32 embeddings
+	QuantizationNone = "none"
+	// QuantizationInt8 stores scalar quantized embeddings with 8 bits per dimension (16 bit halfvec in pgvector)
+	QuantizationInt8 = "int8"
+	// QuantizationBinary stores binary quantized embeddings with 1 bit per dimension (sign of each value)
+	QuantizationBinary = "binary"
+)
+
+// DefaultRescoreFactor is the factor by which the number of candidates is increased for rescoring.
+const DefaultRescoreFactor = 4
+
+// QuantizationConfig configures how the embeddings of a collection are stored.
+type QuantizationConfig struct {
+	Type string `json:"type,omitempty"`
+	// Rescore keeps the full precision embeddings alongside the quantized ones, to re-rank the candidates
+	// found with the quantized embeddings. This improves recall, but saves less storage.
+	Rescore bool `json:"rescore,omitempty"`
+	// RescoreFactor is the number of candidates per requested result that are rescored
+	RescoreFactor int `json:"rescoreFactor,omitempty"`
+}
+
+// Quantized returns true if the embeddings are stored quantized.
+func (c *QuantizationConfig) Quantized() bool {
+	return c != nil && c.Type != "" && c.Type != QuantizationNone
+}
+
+// Candidates returns the number of candidates to fetch from the quantized embeddings for numDocuments results.
+func (c *QuantizationConfig) Candidates(numDocuments int) int {
+	if c == nil || !c.Rescore {
+		return numDocuments
+	}
+	factor := c.RescoreFactor
+	if factor <= 0 {
+		factor = DefaultRescoreFactor
+	}
+	return numDocuments * factor
+}
+
+// Validate normalizes the configuration and checks that the values are supported.
+func (c *QuantizationConfig) Validate() error {
+	switch strings.ToLower(c.Type) {
+	case "", QuantizationNone, "float32":
+		c.Type = QuantizationNone
+	case QuantizationInt8, "scalar":
+		c.Type = QuantizationInt8
+	case QuantizationBinary, "bit":
+		c.Type = QuantizationBinary
+	default:
+		return fmt.Errorf("unsupported quantization %q (supported: %s, %s, %s)", c.Type, QuantizationNone, QuantizationInt8, QuantizationBinary)
+	}
+	if c.RescoreFactor < 0 {
+		return fmt.Errorf("rescore factor must not be negative")
+	}
+	if c.Type == QuantizationNone {
+		c.Rescore, c.RescoreFactor = false, 0
+	}
+	return nil
+}
+
+// NormalizeVector returns the vector scaled to unit length, which doesn't change its cosine distances.
+// Scalar quantization maps the values in [-1, 1] to int8, so vectors have to be normalized before quantizing them.
+func NormalizeVector(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	norm = math.Sqrt(norm)
+	res := make([]float32, len(v))
+	if norm == 0 {
+		return res
+	}
+	for i, x := range v {
+		res[i] = float32(float64(x) / norm)
+	}
+	return res
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"slices"
 )
 
@@ -9,6 +10,22 @@ type Document struct {
 	Content         string         `json:"content"`
 	Metadata        map[string]any `json:"metadata"`
 	SimilarityScore float32        `json:"similarity_score"`
+	// Embedding is only set for search results if requested via WithEmbeddings (and available in full precision)
+	Embedding []float32 `json:"-"`
+}
+
+type embeddingsKey struct{}
+
+// WithEmbeddings returns a context that makes similarity searches return the embeddings of the found documents,
+// e.g. to diversify the results by their similarity to each other.
+func WithEmbeddings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, embeddingsKey{}, true)
+}
+
+// EmbeddingsRequested returns true if the embeddings of search results were requested via WithEmbeddings.
+func EmbeddingsRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(embeddingsKey{}).(bool)
+	return requested
 }
 
 const (
@@ -16,6 +33,16 @@ const (
 	DocMetadataKeyDocsTotal = "docsTotal"
 )
 
+// DocumentSource returns the path (or URL) of the file the document belongs to, if known.
+func DocumentSource(doc Document) string {
+	for _, key := range []string{"absPath", "source", "filename"} {
+		if src, ok := doc.Metadata[key].(string); ok && src != "" {
+			return src
+		}
+	}
+	return ""
+}
+
 func mustInt(value any) int {
 	switch v := value.(type) {
 	case int:
@@ -56,3 +83,13 @@ func SortAndEnsureDocIndex(documents []Document) {
 		doc.Metadata[DocMetadataKeyDocsTotal] = l
 	}
 }
+
+// CollectionStats describes the contents of a vector store collection.
+type CollectionStats struct {
+	Documents  int `json:"documents"`
+	Dimensions int `json:"dimensions"`
+	// SizeBytes is the (approximate) storage size of the collection, including content, metadata and embeddings
+	SizeBytes int64 `json:"sizeBytes"`
+	// Quantization is the quantization of the stored embeddings, if any
+	Quantization *QuantizationConfig `json:"quantization,omitempty"`
+}
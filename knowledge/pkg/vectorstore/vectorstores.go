@@ -8,7 +8,9 @@ import (
 
 	etypes "github.com/gptscript-ai/knowledge/pkg/datastore/embeddings/types"
 	dbtypes "github.com/gptscript-ai/knowledge/pkg/index/types"
+	"github.com/gptscript-ai/knowledge/pkg/migrate"
 	"github.com/gptscript-ai/knowledge/pkg/vectorstore/chromem"
+	"github.com/gptscript-ai/knowledge/pkg/vectorstore/hnsw"
 	"github.com/gptscript-ai/knowledge/pkg/vectorstore/pgvector"
 	sqlite_vec "github.com/gptscript-ai/knowledge/pkg/vectorstore/sqlite-vec"
 	"github.com/gptscript-ai/knowledge/pkg/vectorstore/types"
@@ -22,6 +24,11 @@ type VectorStore interface {
 	RemoveCollection(ctx context.Context, collection string) error
 	RemoveDocument(ctx context.Context, documentID string, collection string, where map[string]string, whereDocument []cg.WhereDocument) error
 	GetDocuments(ctx context.Context, collection string, where map[string]string, whereDocument []cg.WhereDocument) ([]types.Document, error)
+	CollectionStats(ctx context.Context, collection string) (*types.CollectionStats, error)
+	// CopyDocuments copies the given (or all, if empty) documents with their embeddings into an existing collection,
+	// without re-computing the embeddings. The copies keep their IDs, unless IDs are unique across collections in
+	// the store - the returned map holds the ID of each copy by the ID of its original.
+	CopyDocuments(ctx context.Context, source, target string, ids []string) (map[string]string, error)
 
 	ImportCollectionsFromFile(ctx context.Context, path string, collections ...string) error
 	ExportCollectionsToFile(ctx context.Context, path string, collections ...string) error
@@ -29,6 +36,36 @@ type VectorStore interface {
 	Close() error
 }
 
+// IndexBuilder is implemented by vector stores that support configurable approximate nearest neighbor (ANN) indexes.
+type IndexBuilder interface {
+	// BuildIndex (re-)builds the ANN index of a collection - the config is merged into the collection's current one
+	BuildIndex(ctx context.Context, collection string, config *types.IndexConfig, rebuild bool) error
+}
+
+// CollectionRenamer is implemented by vector stores that can rename a collection in place, keeping its document IDs.
+type CollectionRenamer interface {
+	// RenameCollection renames the collection - it fails if the new name is taken
+	RenameCollection(ctx context.Context, oldName, newName string) error
+}
+
+// EmbeddingsGetter is implemented by vector stores that can return the stored embeddings of documents.
+type EmbeddingsGetter interface {
+	// GetEmbeddings returns the embeddings of the given documents by their ID - documents whose embeddings
+	// are not stored in full precision (i.e. quantized without rescoring) are missing from the result
+	GetEmbeddings(ctx context.Context, collection string, ids []string) (map[string][]float32, error)
+}
+
+// NewMigrator returns the schema migrator of the vector store at dsn without migrating it.
+// Vector stores without versioned schema migrations return nil.
+func NewMigrator(ctx context.Context, dsn string) (migrate.Migrator, error) {
+	switch strings.Split(dsn, "://")[0] {
+	case "pgvector":
+		return pgvector.NewMigrator(ctx, dsn)
+	default:
+		return nil, nil
+	}
+}
+
 func New(ctx context.Context, dsn string, embeddingProvider etypes.EmbeddingModelProvider) (VectorStore, error) {
 	embeddingFunc, err := embeddingProvider.EmbeddingFunc()
 	if err != nil {
@@ -47,6 +84,8 @@ func New(ctx context.Context, dsn string, embeddingProvider etypes.EmbeddingMode
 		return pgvector.New(ctx, dsn, embeddingFunc)
 	case "sqlite-vec":
 		return sqlite_vec.New(ctx, dsn, embeddingFunc)
+	case "hnsw":
+		return hnsw.New(ctx, dsn, embeddingFunc)
 	default:
 		return nil, fmt.Errorf("unsupported dialect: %q", dialect)
 	}